@@ -80,7 +80,7 @@ func (d *DevClient) DeleteAdaptor(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _ADAPTORS_DEV_PREAMBLE+systemKey+"/adaptors/"+name, nil, creds, nil)
+	resp, err := del(d, _ADAPTORS_DEV_PREAMBLE+systemKey+"/adaptors/"+name, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
@@ -213,7 +213,7 @@ func (d *DevClient) DeleteAdaptorFile(systemKey, adaptorName, fileName string) e
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _ADAPTORS_DEV_PREAMBLE+systemKey+"/adaptors/"+adaptorName+"/files/"+fileName, nil, creds, nil)
+	resp, err := del(d, _ADAPTORS_DEV_PREAMBLE+systemKey+"/adaptors/"+adaptorName+"/files/"+fileName, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
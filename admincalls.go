@@ -116,7 +116,7 @@ func (d *DevClient) DisableSystem(systemKey string) (map[string]interface{}, err
 	}
 
 	disableSystemEndpoint := d.preamble() + "/platform/" + systemKey
-	resp, err := delete(d, disableSystemEndpoint, nil, creds, nil)
+	resp, err := del(d, disableSystemEndpoint, nil, creds, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -237,7 +237,7 @@ func (d *DevClient) DeleteDeveloper(email string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, "/admin/platform/developer", map[string]string{"email": email}, creds, nil)
+	resp, err := del(d, "/admin/platform/developer", map[string]string{"email": email}, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -275,7 +275,7 @@ func (d *DevClient) DeleteSelf() error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, "/admin/userinfo", nil, creds, nil)
+	resp, err := del(d, "/admin/userinfo", nil, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -357,7 +357,7 @@ func (d *DevClient) DeleteSystemAlias(systemKey, alias string) error {
 		return err
 	}
 	uri := fmt.Sprintf("/admin/aliases/%s/%s", systemKey, alias)
-	resp, err := delete(d, uri, nil, creds, nil)
+	resp, err := del(d, uri, nil, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -237,7 +237,7 @@ func (d *DevClient) DeleteDeploymentByName(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	_, err = mapResponse(delete(d, "/admin/"+systemKey+"/deployments/"+name, nil, creds, nil))
+	_, err = mapResponse(del(d, "/admin/"+systemKey+"/deployments/"+name, nil, creds, nil))
 	return err
 }
 
@@ -246,6 +246,6 @@ func (u *UserClient) DeleteDeploymentByName(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	_, err = mapResponse(delete(u, "/api/v/3/"+systemKey+"/deployments/"+name, nil, creds, nil))
+	_, err = mapResponse(del(u, "/api/v/3/"+systemKey+"/deployments/"+name, nil, creds, nil))
 	return err
 }
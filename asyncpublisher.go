@@ -0,0 +1,391 @@
+package GoSDK
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+const (
+	_ASYNC_PUBLISH_DEFAULT_WINDOW  = 1000
+	_ASYNC_PUBLISH_DEFAULT_TIMEOUT = 30 * time.Second
+	_ASYNC_PUBLISH_MAX_ERRORS      = 100
+
+	_PUBLISH_BATCH_DEFAULT_MESSAGES  = 100
+	_PUBLISH_BATCH_DEFAULT_BYTES     = 64 * 1024
+	_PUBLISH_BATCH_DEFAULT_DELAY     = 10 * time.Millisecond
+	_PUBLISH_BATCH_DEFAULT_THRESHOLD = 1024
+)
+
+var ErrPublisherClosed = errors.New("publisher is closed")
+
+// PublishResult reports how one message passed to AsyncPublisher.Publish went
+type PublishResult struct {
+	Topic   string
+	Payload []byte
+	// Batched is the number of messages in the envelope the message was sent in, 0 if sent alone
+	Batched int
+	Err     error
+}
+
+// PublishBatchOptions combines small payloads for the same topic and qos into one PublishEnvelope.
+// Zero values pick the defaults.
+type PublishBatchOptions struct {
+	// MaxMessages and MaxBytes send an envelope once it holds this many messages or payload bytes
+	MaxMessages int
+	MaxBytes    int
+	// MaxDelay sends an envelope this long after its first message at the latest
+	MaxDelay time.Duration
+	// Threshold is the largest payload that is batched. Larger ones are sent alone.
+	Threshold int
+}
+
+// AsyncPublisherOptions configures an AsyncPublisher. Zero values pick the defaults.
+type AsyncPublisherOptions struct {
+	// MaxInFlight is the number of publishes waiting for the broker before Publish blocks
+	MaxInFlight int
+	// PublishTimeout fails a publish the broker has not confirmed after this long
+	PublishTimeout time.Duration
+	// OnComplete is called for every message, from a single goroutine, so it should be quick
+	OnComplete func(res PublishResult)
+	// Batch turns on batching of small payloads
+	Batch *PublishBatchOptions
+	// Context bounds how long a batch waits for room in the window. A batch holds the messages of
+	// several Publish calls, so it is not sent with the context of any one of them. Cancelling it
+	// fails the batches still waiting. Background by default.
+	Context context.Context
+}
+
+// PublishStats are the counters of an AsyncPublisher
+type PublishStats struct {
+	Published int64
+	Failed    int64
+	// InFlight counts the messages waiting for the broker or in a batch
+	InFlight int64
+}
+
+// PublishEnvelope is the payload of a batch of messages. The JSON encodes each payload as base64.
+type PublishEnvelope struct {
+	Messages [][]byte `json:"messages"`
+}
+
+// DecodePublishEnvelope returns the payloads of a batch sent by an AsyncPublisher
+func DecodePublishEnvelope(data []byte) ([][]byte, error) {
+	var env PublishEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("could not decode publish envelope: %w", err)
+	}
+	return env.Messages, nil
+}
+
+// AsyncPublisher publishes without waiting for each confirmation. Up to MaxInFlight publishes are
+// outstanding at once, and every message's result arrives on the channel Publish returns and at
+// OnComplete. Failures are also collected for Errors.
+type AsyncPublisher struct {
+	client func() MqttClient
+	opts   AsyncPublisherOptions
+
+	slots   chan struct{}
+	pending chan *asyncPublish
+	done    chan struct{}
+
+	mu          sync.Mutex
+	batches     map[publishBatchKey]*publishBatch
+	stats       PublishStats
+	errs        []error
+	dropped     int
+	outstanding int64
+	drained     chan struct{}
+	closed      bool
+}
+
+type asyncPublish struct {
+	tok     mqtt.Token
+	topic   string
+	msgs    [][]byte
+	results []chan error
+	batched bool
+}
+
+type publishBatchKey struct {
+	topic string
+	qos   int
+}
+
+type publishBatch struct {
+	msgs    [][]byte
+	results []chan error
+	bytes   int
+	timer   *time.Timer
+}
+
+// NewAsyncPublisher returns a publisher on the client's MQTT connection
+func (u *UserClient) NewAsyncPublisher(opts AsyncPublisherOptions) *AsyncPublisher {
+	return newAsyncPublisher(func() MqttClient { return u.MQTTClient }, opts)
+}
+
+// NewAsyncPublisher returns a publisher on the client's MQTT connection
+func (d *DeviceClient) NewAsyncPublisher(opts AsyncPublisherOptions) *AsyncPublisher {
+	return newAsyncPublisher(func() MqttClient { return d.MQTTClient }, opts)
+}
+
+// NewAsyncPublisher returns a publisher on the client's MQTT connection
+func (d *DevClient) NewAsyncPublisher(opts AsyncPublisherOptions) *AsyncPublisher {
+	return newAsyncPublisher(func() MqttClient { return d.MQTTClient }, opts)
+}
+
+func newAsyncPublisher(client func() MqttClient, opts AsyncPublisherOptions) *AsyncPublisher {
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = _ASYNC_PUBLISH_DEFAULT_WINDOW
+	}
+	if opts.PublishTimeout <= 0 {
+		opts.PublishTimeout = _ASYNC_PUBLISH_DEFAULT_TIMEOUT
+	}
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if b := opts.Batch; b != nil {
+		batch := *b
+		if batch.MaxMessages <= 0 {
+			batch.MaxMessages = _PUBLISH_BATCH_DEFAULT_MESSAGES
+		}
+		if batch.MaxBytes <= 0 {
+			batch.MaxBytes = _PUBLISH_BATCH_DEFAULT_BYTES
+		}
+		if batch.MaxDelay <= 0 {
+			batch.MaxDelay = _PUBLISH_BATCH_DEFAULT_DELAY
+		}
+		if batch.Threshold <= 0 {
+			batch.Threshold = _PUBLISH_BATCH_DEFAULT_THRESHOLD
+		}
+		opts.Batch = &batch
+	}
+	p := &AsyncPublisher{
+		client:  client,
+		opts:    opts,
+		slots:   make(chan struct{}, opts.MaxInFlight),
+		pending: make(chan *asyncPublish, opts.MaxInFlight),
+		done:    make(chan struct{}),
+		batches: map[publishBatchKey]*publishBatch{},
+	}
+	go p.complete()
+	return p
+}
+
+// Publish sends payload to topic and returns a channel that receives the result once the broker
+// confirmed it. It blocks while MaxInFlight publishes are outstanding, until ctx is done. A
+// payload that fills its batch waits for the batch to be sent, bounded by the publisher's Context.
+func (p *AsyncPublisher) Publish(ctx context.Context, topic string, payload []byte, qos int) (<-chan error, error) {
+	result := make(chan error, 1)
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPublisherClosed
+	}
+	p.trackLocked(1)
+	if p.opts.Batch != nil && len(payload) <= p.opts.Batch.Threshold {
+		full := p.addLocked(publishBatchKey{topic: topic, qos: qos}, payload, result)
+		p.mu.Unlock()
+		if full != nil {
+			p.sendBatch(publishBatchKey{topic: topic, qos: qos}, full)
+		}
+		return result, nil
+	}
+	p.mu.Unlock()
+	if err := p.send(ctx, &asyncPublish{topic: topic, msgs: [][]byte{payload}, results: []chan error{result}}, payload, qos); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// addLocked adds payload to its batch and returns the batch if it is now full
+func (p *AsyncPublisher) addLocked(key publishBatchKey, payload []byte, result chan error) *publishBatch {
+	b := p.batches[key]
+	if b == nil {
+		b = &publishBatch{}
+		b.timer = time.AfterFunc(p.opts.Batch.MaxDelay, func() { p.flushBatch(key, b) })
+		p.batches[key] = b
+	}
+	b.msgs = append(b.msgs, payload)
+	b.results = append(b.results, result)
+	b.bytes += len(payload)
+	if len(b.msgs) < p.opts.Batch.MaxMessages && b.bytes < p.opts.Batch.MaxBytes {
+		return nil
+	}
+	b.timer.Stop()
+	delete(p.batches, key)
+	return b
+}
+
+// flushBatch sends b unless it was already sent for being full
+func (p *AsyncPublisher) flushBatch(key publishBatchKey, b *publishBatch) {
+	p.mu.Lock()
+	if p.batches[key] != b {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.batches, key)
+	p.mu.Unlock()
+	p.sendBatch(key, b)
+}
+
+func (p *AsyncPublisher) sendBatch(key publishBatchKey, b *publishBatch) {
+	pub := &asyncPublish{topic: key.topic, msgs: b.msgs, results: b.results, batched: true}
+	envelope, err := json.Marshal(&PublishEnvelope{Messages: b.msgs})
+	if err != nil {
+		p.finish(pub, err)
+		return
+	}
+	// the error was handed to every message of the batch already
+	p.send(p.opts.Context, pub, envelope, key.qos)
+}
+
+// send waits for a slot in the window and publishes. Messages that never reach the broker are
+// finished with the error, which is also returned.
+func (p *AsyncPublisher) send(ctx context.Context, pub *asyncPublish, payload []byte, qos int) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		err := fmt.Errorf("could not publish to %s: %w", pub.topic, ctx.Err())
+		p.finish(pub, err)
+		return err
+	}
+	c := p.client()
+	if c == nil {
+		<-p.slots
+		err := errors.New("MQTTClient is uninitialized")
+		p.finish(pub, err)
+		return err
+	}
+	pub.tok = c.Publish(pub.topic, uint8(qos), false, payload)
+	p.pending <- pub
+	return nil
+}
+
+// complete waits for the confirmations in the order the messages were published
+func (p *AsyncPublisher) complete() {
+	defer close(p.done)
+	for pub := range p.pending {
+		var err error
+		if !pub.tok.WaitTimeout(p.opts.PublishTimeout) {
+			err = fmt.Errorf("publish to %s was not confirmed within %v", pub.topic, p.opts.PublishTimeout)
+		} else if pub.tok.Error() != nil {
+			err = fmt.Errorf("could not publish to %s: %w", pub.topic, pub.tok.Error())
+		}
+		<-p.slots
+		p.finish(pub, err)
+	}
+}
+
+func (p *AsyncPublisher) finish(pub *asyncPublish, err error) {
+	batched := 0
+	if pub.batched {
+		batched = len(pub.msgs)
+	}
+	p.mu.Lock()
+	if err != nil {
+		p.stats.Failed += int64(len(pub.msgs))
+		if len(p.errs) < _ASYNC_PUBLISH_MAX_ERRORS {
+			p.errs = append(p.errs, err)
+		} else {
+			p.dropped++
+		}
+	} else {
+		p.stats.Published += int64(len(pub.msgs))
+	}
+	p.mu.Unlock()
+	for i, result := range pub.results {
+		if p.opts.OnComplete != nil {
+			p.opts.OnComplete(PublishResult{Topic: pub.topic, Payload: pub.msgs[i], Batched: batched, Err: err})
+		}
+		result <- err
+	}
+	p.mu.Lock()
+	p.trackLocked(-int64(len(pub.msgs)))
+	p.mu.Unlock()
+}
+
+// trackLocked counts messages in and out of flight, opening drained when the count reaches zero
+func (p *AsyncPublisher) trackLocked(n int64) {
+	if p.outstanding == 0 && n > 0 {
+		p.drained = make(chan struct{})
+	}
+	p.outstanding += n
+	if p.outstanding == 0 && p.drained != nil {
+		close(p.drained)
+		p.drained = nil
+	}
+}
+
+// Flush sends every pending batch and waits until all messages published so far have a result
+func (p *AsyncPublisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	batches := p.batches
+	p.batches = map[publishBatchKey]*publishBatch{}
+	p.mu.Unlock()
+	for key, b := range batches {
+		b.timer.Stop()
+		// the batches may wait for room in the window, which ctx bounds below
+		go p.sendBatch(key, b)
+	}
+	p.mu.Lock()
+	drained := p.drained
+	p.mu.Unlock()
+	if drained == nil {
+		return nil
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Errors returns the failures since the last call joined into one error, or nil
+func (p *AsyncPublisher) Errors() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := p.errs
+	if p.dropped > 0 {
+		errs = append(errs, fmt.Errorf("and %d more publish failures", p.dropped))
+	}
+	p.errs, p.dropped = nil, 0
+	return errors.Join(errs...)
+}
+
+// Stats returns the publisher's counters
+func (p *AsyncPublisher) Stats() PublishStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.InFlight = p.outstanding
+	return s
+}
+
+// Close flushes, stops the publisher and returns the failures Errors has not returned yet. When
+// ctx ends first, the messages still in flight go on to receive their results in the background.
+func (p *AsyncPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPublisherClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+	if err := p.Flush(ctx); err != nil {
+		go func() {
+			p.Flush(context.Background())
+			close(p.pending)
+		}()
+		return err
+	}
+	close(p.pending)
+	<-p.done
+	return p.Errors()
+}
@@ -0,0 +1,228 @@
+package GoSDK
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+)
+
+func waitResult(t *testing.T, result <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a publish result")
+		return nil
+	}
+}
+
+func expectEnvelope(t *testing.T, msgs <-chan *mqttTypes.Publish, want ...string) {
+	t.Helper()
+	select {
+	case msg := <-msgs:
+		payloads, err := DecodePublishEnvelope(msg.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payloads) != len(want) {
+			t.Fatalf("envelope holds %d messages, want %d", len(payloads), len(want))
+		}
+		for i, p := range payloads {
+			if string(p) != want[i] {
+				t.Fatalf("envelope message %d is %q, want %q", i, p, want[i])
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an envelope")
+	}
+}
+
+func TestAsyncPublisherPublishesAndReports(t *testing.T) {
+	b := NewMemoryBroker()
+	msgs, err := subscribe(newMemoryClient(t, b, "sub"), "data/#", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newMemoryClient(t, b, "pub")
+	var mu sync.Mutex
+	var completed []PublishResult
+	p := newAsyncPublisher(func() MqttClient { return c }, AsyncPublisherOptions{
+		MaxInFlight: 2,
+		OnComplete: func(res PublishResult) {
+			mu.Lock()
+			completed = append(completed, res)
+			mu.Unlock()
+		},
+	})
+	var results []<-chan error
+	for i := 0; i < 5; i++ {
+		result, err := p.Publish(context.Background(), "data/x", []byte(fmt.Sprint(i)), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	for i, result := range results {
+		if err := waitResult(t, result); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		expectPublish(t, msgs, fmt.Sprint(i))
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Stats(); s.Published != 5 || s.Failed != 0 || s.InFlight != 0 {
+		t.Fatalf("stats %+v", s)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(completed) != 5 || string(completed[4].Payload) != "4" || completed[4].Batched != 0 {
+		t.Fatalf("completed %+v", completed)
+	}
+	if _, err := p.Publish(context.Background(), "data/x", nil, 1); !errors.Is(err, ErrPublisherClosed) {
+		t.Fatalf("publish after close: %v", err)
+	}
+}
+
+func TestAsyncPublisherBatchesSmallPayloads(t *testing.T) {
+	b := NewMemoryBroker()
+	msgs, err := subscribe(newMemoryClient(t, b, "sub"), "data/#", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newMemoryClient(t, b, "pub")
+	p := newAsyncPublisher(func() MqttClient { return c }, AsyncPublisherOptions{
+		Batch: &PublishBatchOptions{MaxMessages: 3, MaxDelay: 20 * time.Millisecond, Threshold: 4},
+	})
+	defer p.Close(context.Background())
+
+	var results []<-chan error
+	for _, payload := range []string{"a", "b", "c", "d", "large"} {
+		result, err := p.Publish(context.Background(), "data/x", []byte(payload), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	// the first three fill a batch, the large payload goes alone and the last batch waits for the delay
+	expectEnvelope(t, msgs, "a", "b", "c")
+	expectPublish(t, msgs, "large")
+	expectEnvelope(t, msgs, "d")
+	for _, result := range results {
+		if err := waitResult(t, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAsyncPublisherSendsAFullBatchWithItsOwnContext(t *testing.T) {
+	b := NewMemoryBroker()
+	msgs, err := subscribe(newMemoryClient(t, b, "sub"), "data/#", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &slowAckClient{MqttClient: newMemoryClient(t, b, "pub"), release: make(chan struct{})}
+	p := newAsyncPublisher(func() MqttClient { return c }, AsyncPublisherOptions{
+		MaxInFlight: 1,
+		Batch:       &PublishBatchOptions{MaxMessages: 2, MaxDelay: time.Hour, Threshold: 4},
+	})
+	defer p.Close(context.Background())
+
+	// the unconfirmed publish fills the window
+	held, err := p.Publish(context.Background(), "data/held", []byte("held back"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := p.Publish(context.Background(), "data/x", []byte("a"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second caller gives up on its context, which must not fail the first caller's message
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	filled := make(chan (<-chan error), 1)
+	go func() {
+		result, err := p.Publish(ctx, "data/x", []byte("b"), 1)
+		if err != nil {
+			t.Error(err)
+		}
+		filled <- result
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(c.release)
+	expectPublish(t, msgs, "held back")
+	expectEnvelope(t, msgs, "a", "b")
+	for _, result := range []<-chan error{held, first, <-filled} {
+		if err := waitResult(t, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAsyncPublisherContextFailsWaitingBatches(t *testing.T) {
+	b := NewMemoryBroker()
+	c := &slowAckClient{MqttClient: newMemoryClient(t, b, "pub"), release: make(chan struct{})}
+	defer close(c.release)
+	ctx, cancel := context.WithCancel(context.Background())
+	p := newAsyncPublisher(func() MqttClient { return c }, AsyncPublisherOptions{
+		MaxInFlight: 1,
+		Batch:       &PublishBatchOptions{MaxMessages: 2, MaxDelay: time.Hour, Threshold: 4},
+		Context:     ctx,
+	})
+	if _, err := p.Publish(context.Background(), "data/held", []byte("held back"), 1); err != nil {
+		t.Fatal(err)
+	}
+	first, err := p.Publish(context.Background(), "data/x", []byte("a"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Publish(context.Background(), "data/x", []byte("b"), 1)
+	}()
+	cancel()
+	<-done
+	if err := waitResult(t, first); !errors.Is(err, context.Canceled) {
+		t.Fatalf("batch waiting for the window gave %v", err)
+	}
+	if s := p.Stats(); s.Failed != 2 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func BenchmarkAsyncPublisher(b *testing.B) {
+	for _, batch := range []*PublishBatchOptions{nil, {}} {
+		name := "unbatched"
+		if batch != nil {
+			name = "batched"
+		}
+		b.Run(name, func(b *testing.B) {
+			broker := NewMemoryBroker()
+			c, err := broker.NewClient("pub", MemoryClientOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer disconnect(c)
+			p := newAsyncPublisher(func() MqttClient { return c }, AsyncPublisherOptions{Batch: batch})
+			payload := []byte(`{"temp":21.5}`)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Publish(ctx, "bench/x", payload, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := p.Close(ctx); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
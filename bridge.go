@@ -0,0 +1,447 @@
+package GoSDK
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	_BRIDGE_DEFAULT_BUFFER      = 1000
+	_BRIDGE_DEFAULT_LOOP_WINDOW = 30 * time.Second
+	_BRIDGE_RETRY_INTERVAL      = time.Second
+)
+
+var ErrBridgeClosed = errors.New("bridge is closed")
+
+// BridgeMessage is a message crossing a bridge. Qos is the qos of the rule's subscription,
+// since subscriptions do not report the qos a message arrived with.
+type BridgeMessage struct {
+	Topic   string
+	Payload []byte
+	Qos     int
+	Retain  bool
+}
+
+// BridgeRule forwards the messages matching Filter from one side of a bridge to the other
+type BridgeRule struct {
+	// Filter is subscribed to on the source side and may contain + and # wildcards
+	Filter string
+	Qos    int
+	// SourcePrefix is replaced by TargetPrefix at the start of forwarded topics, e.g. "site1/" by
+	// "edge/site1/". Topics that do not start with it are forwarded unchanged.
+	SourcePrefix string
+	TargetPrefix string
+	// PublishQos overrides the qos messages are published with on the target side
+	PublishQos *int
+	Retain     bool
+	// Accept drops the messages it returns false for
+	Accept func(msg *BridgeMessage) bool
+	// Transform rewrites a message after its topic was mapped. Returning nil drops it.
+	Transform func(msg *BridgeMessage) (*BridgeMessage, error)
+}
+
+// BridgeOptions configures a bridge. Zero values pick the defaults.
+type BridgeOptions struct {
+	// Outbound rules forward from the local client to the remote one
+	Outbound []BridgeRule
+	// Inbound rules forward from the remote client to the local one
+	Inbound []BridgeRule
+	// BufferSize is the number of messages per direction held while the target is disconnected.
+	// The oldest message is dropped to make room.
+	BufferSize int
+	// LoopWindow is how long a forwarded message is remembered, so the copy the other side's rules
+	// pick up is not forwarded back
+	LoopWindow time.Duration
+	// RetryInterval is the wait before retrying a failed publish
+	RetryInterval time.Duration
+	// OnError receives transform and publish failures
+	OnError func(err error)
+}
+
+// BridgeDirectionMetrics counts the messages of one direction of a bridge
+type BridgeDirectionMetrics struct {
+	Received  int64
+	Forwarded int64
+	// Filtered counts messages dropped by Accept or Transform
+	Filtered int64
+	// Looped counts messages recognized as coming back from the other direction
+	Looped int64
+	// Dropped counts messages evicted from a full buffer or left over at Close
+	Dropped int64
+	Errors  int64
+	// Buffered is the number of messages waiting for the target
+	Buffered int
+}
+
+// BridgeMetrics are the counters of both directions of a bridge
+type BridgeMetrics struct {
+	Outbound BridgeDirectionMetrics
+	Inbound  BridgeDirectionMetrics
+}
+
+// Bridge forwards messages between two MQTT clients, e.g. a local broker at an edge site and
+// the platform. Subscriptions go through the clients, so they are restored after a reconnect,
+// and messages for a disconnected side wait in a bounded buffer.
+type Bridge struct {
+	opts     BridgeOptions
+	outbound *bridgeDirection
+	inbound  *bridgeDirection
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// bridgeDirection forwards from source to target. recent holds the messages it published, keyed
+// by bridgeFingerprint, which the opposite direction drops when they come back. expiry holds the
+// same records in the order they were published, so expired ones are found from its front.
+type bridgeDirection struct {
+	name   string
+	source MqttClient
+	target MqttClient
+	rules  []BridgeRule
+	opts   *BridgeOptions
+
+	mu         sync.Mutex
+	subscribed []string
+	buffer     []*BridgeMessage
+	metrics    BridgeDirectionMetrics
+	recent     map[string][]*bridgeSent
+	expiry     []*bridgeSent
+	opposite   *bridgeDirection
+	closed     bool
+	unlisten   func()
+
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	readers sync.WaitGroup
+}
+
+// NewBridge subscribes to the rules' filters on both clients and starts forwarding
+func NewBridge(local, remote MqttClient, opts BridgeOptions) (*Bridge, error) {
+	if local == nil || remote == nil {
+		return nil, errors.New("a bridge needs two initialized MQTT clients")
+	}
+	if len(opts.Outbound) == 0 && len(opts.Inbound) == 0 {
+		return nil, errors.New("a bridge needs at least one rule")
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = _BRIDGE_DEFAULT_BUFFER
+	}
+	if opts.LoopWindow <= 0 {
+		opts.LoopWindow = _BRIDGE_DEFAULT_LOOP_WINDOW
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = _BRIDGE_RETRY_INTERVAL
+	}
+	b := &Bridge{opts: opts}
+	b.outbound = newBridgeDirection("outbound", local, remote, opts.Outbound, &b.opts)
+	b.inbound = newBridgeDirection("inbound", remote, local, opts.Inbound, &b.opts)
+	b.outbound.opposite, b.inbound.opposite = b.inbound, b.outbound
+	for _, dir := range []*bridgeDirection{b.outbound, b.inbound} {
+		if err := dir.start(); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func newBridgeDirection(name string, source, target MqttClient, rules []BridgeRule, opts *BridgeOptions) *bridgeDirection {
+	d := &bridgeDirection{
+		name:   name,
+		source: source,
+		target: target,
+		rules:  rules,
+		opts:   opts,
+		recent: map[string][]*bridgeSent{},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go d.forward()
+	return d
+}
+
+// Metrics returns a snapshot of the bridge's counters
+func (b *Bridge) Metrics() BridgeMetrics {
+	return BridgeMetrics{Outbound: b.outbound.snapshot(), Inbound: b.inbound.snapshot()}
+}
+
+// Close unsubscribes from every rule's filter and stops forwarding. Buffered messages are dropped.
+func (b *Bridge) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBridgeClosed
+	}
+	b.closed = true
+	b.mu.Unlock()
+	return errors.Join(b.outbound.close(), b.inbound.close())
+}
+
+func (d *bridgeDirection) start() error {
+	for i := range d.rules {
+		rule := &d.rules[i]
+		if rule.Filter == "" {
+			return fmt.Errorf("%s bridge rule %d has no filter", d.name, i)
+		}
+		msgs, err := subscribe(d.source, rule.Filter, rule.Qos)
+		if err != nil {
+			return fmt.Errorf("%s bridge rule %s: %w", d.name, rule.Filter, err)
+		}
+		d.mu.Lock()
+		d.subscribed = append(d.subscribed, rule.Filter)
+		d.mu.Unlock()
+		d.readers.Add(1)
+		go func() {
+			defer d.readers.Done()
+			for pub := range msgs {
+				d.receive(rule, pub.Topic.Whole, pub.Payload)
+			}
+		}()
+	}
+	if subs := subscriptionsOf(d.target); subs != nil {
+		unlisten := subs.listen(func(ev MQTTEvent) {
+			if ev.Kind == MQTTConnected || ev.Kind == MQTTReconnected {
+				d.signal()
+			}
+		})
+		d.mu.Lock()
+		d.unlisten = unlisten
+		d.mu.Unlock()
+	}
+	return nil
+}
+
+func (d *bridgeDirection) receive(rule *BridgeRule, topic string, payload []byte) {
+	d.count(func(m *BridgeDirectionMetrics) { m.Received++ })
+	if d.opposite.echo(topic, payload) {
+		d.count(func(m *BridgeDirectionMetrics) { m.Looped++ })
+		return
+	}
+	msg := &BridgeMessage{Topic: topic, Payload: payload, Qos: rule.Qos, Retain: rule.Retain}
+	if rule.Accept != nil && !rule.Accept(msg) {
+		d.count(func(m *BridgeDirectionMetrics) { m.Filtered++ })
+		return
+	}
+	if strings.HasPrefix(msg.Topic, rule.SourcePrefix) {
+		msg.Topic = rule.TargetPrefix + strings.TrimPrefix(msg.Topic, rule.SourcePrefix)
+	}
+	if rule.PublishQos != nil {
+		msg.Qos = *rule.PublishQos
+	}
+	if rule.Transform != nil {
+		out, err := rule.Transform(msg)
+		if err != nil {
+			d.count(func(m *BridgeDirectionMetrics) { m.Errors++ })
+			d.fail(fmt.Errorf("%s bridge could not transform message on %s: %w", d.name, topic, err))
+			return
+		}
+		if out == nil {
+			d.count(func(m *BridgeDirectionMetrics) { m.Filtered++ })
+			return
+		}
+		msg = out
+	}
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	if len(d.buffer) >= d.opts.BufferSize {
+		d.buffer = d.buffer[1:]
+		d.metrics.Dropped++
+	}
+	d.buffer = append(d.buffer, msg)
+	d.mu.Unlock()
+	d.signal()
+}
+
+// forward publishes buffered messages in order while the target is connected
+func (d *bridgeDirection) forward() {
+	defer close(d.done)
+	retry := time.NewTimer(0)
+	<-retry.C
+	defer retry.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-d.wake:
+		case <-retry.C:
+		}
+		for {
+			d.mu.Lock()
+			if d.closed || len(d.buffer) == 0 {
+				d.mu.Unlock()
+				break
+			}
+			msg := d.buffer[0]
+			d.mu.Unlock()
+			if !d.target.IsConnected() {
+				// the connect event wakes the loop, the timer covers clients that send none
+				retry.Reset(d.opts.RetryInterval)
+				break
+			}
+			sent := d.remember(msg)
+			if err := publish(d.target, msg.Topic, msg.Payload, msg.Qos, 0, msg.Retain); err != nil {
+				d.forget(sent)
+				d.count(func(m *BridgeDirectionMetrics) { m.Errors++ })
+				d.fail(fmt.Errorf("%s bridge could not publish to %s: %w", d.name, msg.Topic, err))
+				retry.Reset(d.opts.RetryInterval)
+				break
+			}
+			d.mu.Lock()
+			if len(d.buffer) > 0 && d.buffer[0] == msg {
+				d.buffer = d.buffer[1:]
+			}
+			d.metrics.Forwarded++
+			d.mu.Unlock()
+		}
+	}
+}
+
+func bridgeFingerprint(topic string, payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return topic + "\x00" + string(sum[:])
+}
+
+// bridgeSent records a message published to a direction's target. done is set once the record
+// is consumed, forgotten or expired, so it is only removed from recent once.
+type bridgeSent struct {
+	key  string
+	at   time.Time
+	done bool
+}
+
+// remember records that msg is about to be published to the target
+func (d *bridgeDirection) remember(msg *BridgeMessage) *bridgeSent {
+	now := time.Now()
+	sent := &bridgeSent{key: bridgeFingerprint(msg.Topic, msg.Payload), at: now}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expireLocked(now)
+	d.recent[sent.key] = append(d.recent[sent.key], sent)
+	d.expiry = append(d.expiry, sent)
+	return sent
+}
+
+// forget drops the record of a message whose publish failed
+func (d *bridgeDirection) forget(sent *bridgeSent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if sent.done {
+		return
+	}
+	sent.done = true
+	records := d.recent[sent.key]
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i] == sent {
+			records = append(records[:i], records[i+1:]...)
+			break
+		}
+	}
+	d.setRecentLocked(sent.key, records)
+}
+
+// echo reports whether a message received from this direction's target is one it published
+// itself, consuming the oldest record if so
+func (d *bridgeDirection) echo(topic string, payload []byte) bool {
+	key := bridgeFingerprint(topic, payload)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expireLocked(time.Now())
+	records := d.recent[key]
+	if len(records) == 0 {
+		return false
+	}
+	records[0].done = true
+	d.setRecentLocked(key, records[1:])
+	return true
+}
+
+// expireLocked drops the records older than the loop window. Records already consumed stay in
+// expiry until they reach its front.
+func (d *bridgeDirection) expireLocked(now time.Time) {
+	for len(d.expiry) > 0 && now.Sub(d.expiry[0].at) > d.opts.LoopWindow {
+		sent := d.expiry[0]
+		d.expiry[0] = nil
+		d.expiry = d.expiry[1:]
+		if sent.done {
+			continue
+		}
+		sent.done = true
+		// records of a key are published in order, so the expired one is the oldest
+		d.setRecentLocked(sent.key, d.recent[sent.key][1:])
+	}
+	if len(d.expiry) == 0 {
+		d.expiry = nil
+	}
+}
+
+func (d *bridgeDirection) setRecentLocked(key string, records []*bridgeSent) {
+	if len(records) == 0 {
+		delete(d.recent, key)
+	} else {
+		d.recent[key] = records
+	}
+}
+
+func (d *bridgeDirection) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *bridgeDirection) count(fn func(m *BridgeDirectionMetrics)) {
+	d.mu.Lock()
+	fn(&d.metrics)
+	d.mu.Unlock()
+}
+
+func (d *bridgeDirection) snapshot() BridgeDirectionMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m := d.metrics
+	m.Buffered = len(d.buffer)
+	return m
+}
+
+func (d *bridgeDirection) fail(err error) {
+	if d.opts.OnError != nil {
+		d.opts.OnError(err)
+	}
+}
+
+func (d *bridgeDirection) close() error {
+	d.mu.Lock()
+	subscribed := d.subscribed
+	d.subscribed = nil
+	unlisten := d.unlisten
+	d.unlisten = nil
+	d.mu.Unlock()
+	if unlisten != nil {
+		unlisten()
+	}
+	var errs []error
+	for _, filter := range subscribed {
+		if err := unsubscribe(d.source, filter); err != nil {
+			errs = append(errs, fmt.Errorf("%s bridge rule %s: %w", d.name, filter, err))
+		}
+	}
+	d.readers.Wait()
+	d.mu.Lock()
+	d.closed = true
+	d.metrics.Dropped += int64(len(d.buffer))
+	d.buffer = nil
+	d.mu.Unlock()
+	close(d.stop)
+	<-d.done
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package GoSDK
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBridgeForwardsBothWaysWithoutLooping(t *testing.T) {
+	local, remote := NewMemoryBroker(), NewMemoryBroker()
+	localClient := newMemoryClient(t, local, "bridge")
+	remoteClient := newMemoryClient(t, remote, "bridge")
+	b, err := NewBridge(localClient, remoteClient, BridgeOptions{
+		Outbound: []BridgeRule{{Filter: "site1/#", Qos: 1, SourcePrefix: "site1/", TargetPrefix: "edge/site1/"}},
+		Inbound:  []BridgeRule{{Filter: "edge/site1/#", Qos: 1, SourcePrefix: "edge/site1/", TargetPrefix: "site1/"}},
+	})
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer b.Close()
+
+	localSub, err := subscribe(newMemoryClient(t, local, "local-app"), "site1/#", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteSub, err := subscribe(newMemoryClient(t, remote, "remote-app"), "edge/site1/#", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publish(newMemoryClient(t, local, "sensor"), "site1/temp", []byte("21"), 1, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if msg := expectPublish(t, remoteSub, "21"); msg.Topic.Whole != "edge/site1/temp" {
+		t.Fatalf("forwarded to %s", msg.Topic.Whole)
+	}
+	expectPublish(t, localSub, "21")
+	if err := publish(newMemoryClient(t, remote, "cloud"), "edge/site1/setpoint", []byte("19"), 1, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if msg := expectPublish(t, localSub, "19"); msg.Topic.Whole != "site1/setpoint" {
+		t.Fatalf("forwarded to %s", msg.Topic.Whole)
+	}
+	expectPublish(t, remoteSub, "19")
+
+	// each side's copy of a forwarded message comes back to the bridge and is not sent back
+	waitFor(t, "the copies to come back", func() bool {
+		m := b.Metrics()
+		return m.Outbound.Looped == 1 && m.Inbound.Looped == 1
+	})
+	select {
+	case msg := <-localSub:
+		t.Fatalf("looped back %s %q", msg.Topic.Whole, msg.Payload)
+	case msg := <-remoteSub:
+		t.Fatalf("looped back %s %q", msg.Topic.Whole, msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+	m := b.Metrics()
+	if m.Outbound.Forwarded != 1 || m.Inbound.Forwarded != 1 || m.Outbound.Received != 2 || m.Inbound.Received != 2 {
+		t.Fatalf("metrics %+v", m)
+	}
+}
+
+func TestBridgeBuffersWhileTheTargetIsDisconnected(t *testing.T) {
+	local, remote := NewMemoryBroker(), NewMemoryBroker()
+	target, err := remote.NewClient("bridge", MemoryClientOptions{NoAutoReconnect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disconnect(target)
+	b, err := NewBridge(newMemoryClient(t, local, "bridge"), target, BridgeOptions{
+		Outbound:   []BridgeRule{{Filter: "data/#", Qos: 1}},
+		BufferSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("bridge: %v", err)
+	}
+	defer b.Close()
+	remoteSub, err := subscribe(newMemoryClient(t, remote, "remote-app"), "data/#", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.DropConnection("bridge"); err != nil {
+		t.Fatal(err)
+	}
+	sensor := newMemoryClient(t, local, "sensor")
+	for i := 0; i < 3; i++ {
+		if err := publish(sensor, "data/x", []byte(fmt.Sprint(i)), 1, 0, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the buffer to fill", func() bool { return b.Metrics().Outbound.Received == 3 })
+	if m := b.Metrics().Outbound; m.Buffered != 2 || m.Dropped != 1 {
+		t.Fatalf("metrics %+v", m)
+	}
+
+	// the oldest message made room, the others follow in order once the target is back
+	target.Connect().Wait()
+	expectPublish(t, remoteSub, "1")
+	expectPublish(t, remoteSub, "2")
+	waitFor(t, "the buffer to drain", func() bool { return b.Metrics().Outbound.Buffered == 0 })
+}
+
+func TestBridgeLoopRecordsExpireInOrder(t *testing.T) {
+	d := &bridgeDirection{opts: &BridgeOptions{LoopWindow: time.Minute}, recent: map[string][]*bridgeSent{}}
+	a := &BridgeMessage{Topic: "a", Payload: []byte("1")}
+	first := d.remember(a)
+	first.at = time.Now().Add(-time.Hour)
+	second := d.remember(a)
+	d.remember(&BridgeMessage{Topic: "b", Payload: []byte("1")})
+
+	// remembering expired the first record, the echo consumes the second
+	if !first.done || len(d.recent[bridgeFingerprint("a", []byte("1"))]) != 1 || len(d.expiry) != 2 {
+		t.Fatalf("first record was not expired: %d left", len(d.expiry))
+	}
+	if !d.echo("a", []byte("1")) || !second.done || d.echo("a", []byte("1")) {
+		t.Fatal("echo did not consume exactly one record")
+	}
+
+	// a forgotten record is not echoed and is skipped when it expires
+	third := d.remember(a)
+	d.forget(third)
+	if d.echo("a", []byte("1")) {
+		t.Fatal("echoed a forgotten record")
+	}
+	fourth := d.remember(a)
+	d.mu.Lock()
+	for _, sent := range d.expiry {
+		if sent != fourth {
+			sent.at = time.Now().Add(-time.Hour)
+		}
+	}
+	d.expireLocked(time.Now())
+	d.mu.Unlock()
+	if len(d.expiry) != 1 || len(d.recent) != 1 || !d.echo("a", []byte("1")) {
+		t.Fatalf("expiring older records removed the newest: %d left", len(d.expiry))
+	}
+	d.mu.Lock()
+	d.expireLocked(time.Now().Add(2 * time.Minute))
+	d.mu.Unlock()
+	if len(d.expiry) != 0 || len(d.recent) != 0 {
+		t.Fatalf("%d records and %d keys left after the window", len(d.expiry), len(d.recent))
+	}
+}
@@ -55,7 +55,7 @@ func deleteBucketSet(c cbClient, endpoint string) error {
 	if err != nil {
 		return err
 	}
-	_, err = delete(c, endpoint, nil, creds, nil)
+	_, err = del(c, endpoint, nil, creds, nil)
 	if err != nil {
 		return err
 	}
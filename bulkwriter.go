@@ -0,0 +1,381 @@
+package GoSDK
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	_BULK_DEFAULT_BATCH_ROWS    = 500
+	_BULK_DEFAULT_BATCH_BYTES   = 1 << 20
+	_BULK_DEFAULT_FLUSH         = time.Second
+	_BULK_DEFAULT_WORKERS       = 4
+	_BULK_DEFAULT_RETRY_BACKOFF = 500 * time.Millisecond
+)
+
+var ErrBulkWriterClosed = errors.New("bulk writer is closed")
+
+// BulkWriterOptions controls how a BulkWriter batches and sends rows. Zero values pick sane defaults.
+type BulkWriterOptions struct {
+	// MaxBatchRows is the number of rows after which a batch is sent
+	MaxBatchRows int
+	// MaxBatchBytes is the approximate JSON size after which a batch is sent
+	MaxBatchBytes int
+	// FlushInterval is the longest a partial batch waits before it is sent
+	FlushInterval time.Duration
+	// Workers is the number of requests that may be in flight at once
+	Workers int
+	// MaxBufferedRows caps the rows that are queued or in flight. Write blocks once it is reached.
+	// Defaults to 4 batches per worker.
+	MaxBufferedRows int
+	// ConflictColumn switches the writer from CreateData to UpsertData semantics
+	ConflictColumn string
+	// MaxRetries is the number of times a failed batch is resent before it is reported as failed.
+	// Upserts are retried on any failure the platform did not reject outright. Inserts are only
+	// retried when the rows cannot have been written, e.g. the connection was refused or the
+	// platform answered 429 or 503, so a retry never duplicates them.
+	MaxRetries int
+	// RetryBackoff is the initial delay between retries, doubled on every attempt
+	RetryBackoff time.Duration
+	// OnBatch, if set, is called from a worker goroutine after every batch completes
+	OnBatch func(BulkBatchResult)
+}
+
+// BulkBatchResult describes the outcome of a single batch sent by a BulkWriter
+type BulkBatchResult struct {
+	Rows     []map[string]interface{}
+	Bytes    int
+	Attempts int
+	Duration time.Duration
+	// Response is the platform response: the created item ids for inserts, or the upsert body
+	Response interface{}
+	Err      error
+}
+
+// BulkWriterStats is a point in time snapshot of a BulkWriter's counters
+type BulkWriterStats struct {
+	RowsWritten   int64
+	RowsFailed    int64
+	BatchesSent   int64
+	BatchesFailed int64
+	Retries       int64
+	BufferedRows  int64
+}
+
+type bulkBatch struct {
+	seq   uint64
+	rows  []map[string]interface{}
+	bytes int
+	// done is closed once the batch was written or gave up, with err set on failure
+	done chan struct{}
+	err  error
+}
+
+// BulkWriter accepts rows from many goroutines and writes them to a collection in batches
+// using a bounded number of parallel requests. Always Close a BulkWriter to flush the remaining rows.
+type BulkWriter struct {
+	c            cbClient
+	collectionID string
+	opts         BulkWriterOptions
+
+	mu      sync.Mutex
+	rows    []map[string]interface{}
+	bytes   int
+	closed  bool
+	seq     uint64
+	pending map[uint64]*bulkBatch
+	// unreported holds the failed batches no Flush has returned yet
+	unreported []*bulkBatch
+	batches    chan *bulkBatch
+	slots      chan struct{}
+	workers    sync.WaitGroup
+	stop       chan struct{}
+
+	errMu sync.Mutex
+	errs  []error
+
+	rowsWritten   int64
+	rowsFailed    int64
+	batchesSent   int64
+	batchesFailed int64
+	retries       int64
+}
+
+// NewBulkWriter returns a BulkWriter that inserts rows into the given collection
+func (d *DevClient) NewBulkWriter(collectionID string, opts BulkWriterOptions) *BulkWriter {
+	return newBulkWriter(d, collectionID, opts)
+}
+
+// NewBulkWriter returns a BulkWriter that inserts rows into the given collection
+func (u *UserClient) NewBulkWriter(collectionID string, opts BulkWriterOptions) *BulkWriter {
+	return newBulkWriter(u, collectionID, opts)
+}
+
+// NewBulkWriter returns a BulkWriter that inserts rows into the given collection
+func (d *DeviceClient) NewBulkWriter(collectionID string, opts BulkWriterOptions) *BulkWriter {
+	return newBulkWriter(d, collectionID, opts)
+}
+
+func newBulkWriter(c cbClient, collectionID string, opts BulkWriterOptions) *BulkWriter {
+	if opts.MaxBatchRows <= 0 {
+		opts.MaxBatchRows = _BULK_DEFAULT_BATCH_ROWS
+	}
+	if opts.MaxBatchBytes <= 0 {
+		opts.MaxBatchBytes = _BULK_DEFAULT_BATCH_BYTES
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = _BULK_DEFAULT_FLUSH
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = _BULK_DEFAULT_WORKERS
+	}
+	if opts.MaxBufferedRows <= 0 {
+		opts.MaxBufferedRows = opts.MaxBatchRows * opts.Workers * 4
+	}
+	if opts.MaxBufferedRows < opts.MaxBatchRows {
+		opts.MaxBufferedRows = opts.MaxBatchRows
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = _BULK_DEFAULT_RETRY_BACKOFF
+	}
+	w := &BulkWriter{
+		c:            c,
+		collectionID: collectionID,
+		opts:         opts,
+		// every queued batch holds at least one slot, so this can never fill up
+		batches: make(chan *bulkBatch, opts.MaxBufferedRows),
+		slots:   make(chan struct{}, opts.MaxBufferedRows),
+		stop:    make(chan struct{}),
+		pending: map[uint64]*bulkBatch{},
+	}
+	for i := 0; i < opts.Workers; i++ {
+		w.workers.Add(1)
+		go w.work()
+	}
+	go w.flushLoop()
+	return w
+}
+
+// Write queues a single row. It blocks while the writer is at MaxBufferedRows.
+func (w *BulkWriter) Write(row map[string]interface{}) error {
+	return w.WriteContext(context.Background(), row)
+}
+
+// WriteContext queues a single row, giving up if ctx is done before there is room for it
+func (w *BulkWriter) WriteContext(ctx context.Context, row map[string]interface{}) error {
+	b, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("could not encode row: %w", err)
+	}
+	select {
+	case w.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		<-w.slots
+		return ErrBulkWriterClosed
+	}
+	w.rows = append(w.rows, row)
+	w.bytes += len(b)
+	if len(w.rows) >= w.opts.MaxBatchRows || w.bytes >= w.opts.MaxBatchBytes {
+		w.cutLocked()
+	}
+	return nil
+}
+
+// WriteMany queues every row in rows, see WriteContext
+func (w *BulkWriter) WriteMany(ctx context.Context, rows []map[string]interface{}) error {
+	for _, row := range rows {
+		if err := w.WriteContext(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush sends any partial batch and waits until every row queued before the call has been written.
+// Rows written concurrently are not waited for. The returned error joins the failures of the
+// batches queued before the call that no earlier Flush returned.
+func (w *BulkWriter) Flush() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrBulkWriterClosed
+	}
+	w.cutLocked()
+	upTo := w.seq
+	waitFor := make([]*bulkBatch, 0, len(w.pending))
+	for _, b := range w.pending {
+		waitFor = append(waitFor, b)
+	}
+	w.mu.Unlock()
+	for _, b := range waitFor {
+		<-b.done
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	kept := w.unreported[:0]
+	for _, b := range w.unreported {
+		if b.seq <= upTo {
+			errs = append(errs, b.err)
+		} else {
+			kept = append(kept, b)
+		}
+	}
+	w.unreported = kept
+	return errors.Join(errs...)
+}
+
+// Close flushes the remaining rows, waits for all requests to complete and stops the writer.
+// The returned error joins every batch failure seen over the life of the writer.
+func (w *BulkWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrBulkWriterClosed
+	}
+	w.closed = true
+	w.cutLocked()
+	close(w.stop)
+	close(w.batches)
+	w.mu.Unlock()
+
+	w.workers.Wait()
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return errors.Join(w.errs...)
+}
+
+// Stats returns the current counters of the writer
+func (w *BulkWriter) Stats() BulkWriterStats {
+	return BulkWriterStats{
+		RowsWritten:   atomic.LoadInt64(&w.rowsWritten),
+		RowsFailed:    atomic.LoadInt64(&w.rowsFailed),
+		BatchesSent:   atomic.LoadInt64(&w.batchesSent),
+		BatchesFailed: atomic.LoadInt64(&w.batchesFailed),
+		Retries:       atomic.LoadInt64(&w.retries),
+		BufferedRows:  int64(len(w.slots)),
+	}
+}
+
+func (w *BulkWriter) cutLocked() {
+	if len(w.rows) == 0 {
+		return
+	}
+	w.seq++
+	b := &bulkBatch{seq: w.seq, rows: w.rows, bytes: w.bytes, done: make(chan struct{})}
+	w.pending[b.seq] = b
+	w.batches <- b
+	w.rows = nil
+	w.bytes = 0
+}
+
+func (w *BulkWriter) flushLoop() {
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			if !w.closed {
+				w.cutLocked()
+			}
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *BulkWriter) work() {
+	defer w.workers.Done()
+	for b := range w.batches {
+		res := w.send(b)
+		for range b.rows {
+			<-w.slots
+		}
+		if res.Err != nil {
+			atomic.AddInt64(&w.batchesFailed, 1)
+			atomic.AddInt64(&w.rowsFailed, int64(len(b.rows)))
+			w.errMu.Lock()
+			w.errs = append(w.errs, res.Err)
+			w.errMu.Unlock()
+		} else {
+			atomic.AddInt64(&w.batchesSent, 1)
+			atomic.AddInt64(&w.rowsWritten, int64(len(b.rows)))
+		}
+		if w.opts.OnBatch != nil {
+			w.opts.OnBatch(res)
+		}
+		w.mu.Lock()
+		delete(w.pending, b.seq)
+		if res.Err != nil {
+			b.err = res.Err
+			w.unreported = append(w.unreported, b)
+		}
+		w.mu.Unlock()
+		close(b.done)
+	}
+}
+
+func (w *BulkWriter) send(b *bulkBatch) BulkBatchResult {
+	res := BulkBatchResult{Rows: b.rows, Bytes: b.bytes}
+	start := time.Now()
+	backoff := w.opts.RetryBackoff
+	for {
+		res.Attempts++
+		var retry bool
+		res.Response, retry, res.Err = w.attempt(b)
+		if res.Err == nil || !retry || res.Attempts > w.opts.MaxRetries {
+			break
+		}
+		atomic.AddInt64(&w.retries, 1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	res.Duration = time.Since(start)
+	if res.Err != nil {
+		res.Err = fmt.Errorf("bulk write of %d rows to %s failed after %d attempts: %w", len(b.rows), w.collectionID, res.Attempts, res.Err)
+	}
+	return res
+}
+
+// attempt sends b once and reports whether a failure may be retried without writing rows twice
+func (w *BulkWriter) attempt(b *bulkBatch) (interface{}, bool, error) {
+	creds, err := w.c.credentials()
+	if err != nil {
+		return nil, false, err
+	}
+	upsert := w.opts.ConflictColumn != ""
+	var resp *CbResp
+	if upsert {
+		url := fmt.Sprintf("%sdata/%s/upsert?conflictColumn=%s", _DATA_V4_PREAMBLE, w.collectionID, w.opts.ConflictColumn)
+		resp, err = put(w.c, url, b.rows, creds, nil)
+	} else {
+		resp, err = post(w.c, _DATA_PREAMBLE+w.collectionID, b.rows, creds, nil)
+	}
+	if err != nil {
+		// a timeout or reset may come after the platform inserted the rows, a failed dial cannot
+		var opErr *net.OpError
+		notSent := errors.As(err, &opErr) && opErr.Op == "dial"
+		return nil, upsert || notSent, fmt.Errorf("could not reach platform: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		rejected := resp.StatusCode == 429 || resp.StatusCode == 503
+		retry := rejected || upsert && resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("status %d: %v", resp.StatusCode, resp.Body)
+	}
+	return resp.Body, false, nil
+}
@@ -0,0 +1,200 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bulkPlatform answers inserts and upserts with the status returned by status for each request
+type bulkPlatform struct {
+	mu       sync.Mutex
+	requests int
+	rows     int
+	status   func(n int, rows []map[string]interface{}) int
+}
+
+func (p *bulkPlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rows []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&rows); err != nil {
+		writeJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p.mu.Lock()
+	p.requests++
+	status := http.StatusOK
+	if p.status != nil {
+		status = p.status(p.requests, rows)
+	}
+	if status == http.StatusOK {
+		p.rows += len(rows)
+	}
+	p.mu.Unlock()
+	if status != http.StatusOK {
+		writeJSON(w, status, "failed")
+		return
+	}
+	if strings.Contains(r.URL.Path, "/upsert") {
+		writeJSON(w, status, map[string]interface{}{"count": len(rows)})
+		return
+	}
+	ids := make([]interface{}, len(rows))
+	for i := range ids {
+		ids[i] = map[string]interface{}{"item_id": "id"}
+	}
+	writeJSON(w, status, ids)
+}
+
+func (p *bulkPlatform) counts() (requests, rows int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests, p.rows
+}
+
+func TestBulkWriterWritesEveryRow(t *testing.T) {
+	platform := &bulkPlatform{}
+	d := newTestDevClient(t, platform)
+	w := d.NewBulkWriter("collection", BulkWriterOptions{MaxBatchRows: 10, Workers: 3, FlushInterval: time.Hour})
+	var wg sync.WaitGroup
+	for g := 0; g < 5; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 41; i++ {
+				if err := w.Write(map[string]interface{}{"n": i}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, rows := platform.counts(); rows != 205 {
+		t.Fatalf("platform got %d rows, want 205", rows)
+	}
+	if s := w.Stats(); s.RowsWritten != 205 || s.BufferedRows != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestBulkWriterFlushReturnsFailures(t *testing.T) {
+	platform := &bulkPlatform{status: func(n int, rows []map[string]interface{}) int {
+		if rows[0]["fail"] == true {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	}}
+	d := newTestDevClient(t, platform)
+	w := d.NewBulkWriter("collection", BulkWriterOptions{MaxBatchRows: 100, FlushInterval: time.Hour})
+	defer w.Close()
+
+	w.Write(map[string]interface{}{"fail": true})
+	if err := w.Flush(); err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Fatalf("Flush returned %v, want the batch failure", err)
+	}
+	w.Write(map[string]interface{}{"fail": false})
+	if err := w.Flush(); err != nil {
+		t.Fatalf("second Flush returned %v, the failure was already reported", err)
+	}
+}
+
+func TestBulkWriterFlushUnderConcurrentWrites(t *testing.T) {
+	platform := &bulkPlatform{}
+	d := newTestDevClient(t, platform)
+	w := d.NewBulkWriter("collection", BulkWriterOptions{MaxBatchRows: 5, Workers: 2, FlushInterval: time.Millisecond})
+	stop := make(chan struct{})
+	var written int64
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := w.Write(map[string]interface{}{"n": 1}); err != nil {
+					return
+				}
+				atomic.AddInt64(&written, 1)
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		done := make(chan error, 1)
+		go func() { done <- w.Flush() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Flush did not return while other goroutines kept writing")
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, rows := platform.counts(); int64(rows) != atomic.LoadInt64(&written) {
+		t.Fatalf("platform got %d rows, %d were written", rows, written)
+	}
+}
+
+func TestBulkWriterRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		upsert   bool
+		status   int
+		requests int
+	}{
+		{"insert rejected with 503 is retried", false, http.StatusServiceUnavailable, 3},
+		{"insert rate limited is retried", false, http.StatusTooManyRequests, 3},
+		{"insert failing with 500 may have been applied", false, http.StatusInternalServerError, 1},
+		{"insert behind a gateway timeout may have been applied", false, http.StatusGatewayTimeout, 1},
+		{"upsert failing with 500 is retried", true, http.StatusInternalServerError, 3},
+		{"bad request is never retried", true, http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			platform := &bulkPlatform{status: func(int, []map[string]interface{}) int { return tt.status }}
+			d := newTestDevClient(t, platform)
+			opts := BulkWriterOptions{MaxRetries: 2, RetryBackoff: time.Millisecond}
+			if tt.upsert {
+				opts.ConflictColumn = "id"
+			}
+			w := d.NewBulkWriter("collection", opts)
+			w.Write(map[string]interface{}{"id": 1})
+			if err := w.Close(); err == nil {
+				t.Fatal("Close did not report the failed batch")
+			}
+			if requests, _ := platform.counts(); requests != tt.requests {
+				t.Fatalf("platform got %d requests, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestBulkWriterRetriesRefusedConnections(t *testing.T) {
+	d := NewDevClientWithTokenAndAddrs("http://127.0.0.1:1", "", "test-dev-token", "dev@example.com")
+	var attempts int
+	w := d.NewBulkWriter("collection", BulkWriterOptions{MaxRetries: 2, RetryBackoff: time.Millisecond, OnBatch: func(res BulkBatchResult) {
+		attempts = res.Attempts
+	}})
+	w.Write(map[string]interface{}{"n": 1})
+	if err := w.Close(); err == nil {
+		t.Fatal("Close did not report the failed batch")
+	}
+	if attempts != 3 {
+		t.Fatalf("batch was attempted %d times, want 3", attempts)
+	}
+}
@@ -336,7 +336,7 @@ func (d *DevClient) DeleteService(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _CODE_ADMIN_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _CODE_ADMIN_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting service: %v", err)
 	}
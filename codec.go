@@ -0,0 +1,285 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec turns values into message payloads and back
+type Codec interface {
+	// ContentType is sent as the MQTT 5 content type of encoded messages
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec     Codec = jsonCodec{}
+	CBORCodec     Codec = cborCodec{}
+	MsgpackCodec  Codec = msgpackCodec{}
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string                        { return "application/cbor" }
+func (cborCodec) Marshal(v interface{}) ([]byte, error)      { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string                        { return "application/msgpack" }
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// protobufCodec only handles values implementing proto.Message
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec cannot encode %T, it is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec cannot decode into %T, it is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+type codecRoute struct {
+	filter string
+	codec  Codec
+}
+
+// CodecRegistry picks the codec of a message. A known content type wins, then the first topic
+// pattern matching the topic, then the default codec.
+type CodecRegistry struct {
+	mu          sync.RWMutex
+	routes      []codecRoute
+	contentType map[string]Codec
+	fallback    Codec
+}
+
+// DefaultCodecs is used by PublishValue and by typed subscriptions that do not name a registry
+var DefaultCodecs = NewCodecRegistry()
+
+// NewCodecRegistry returns a registry that knows the built in codecs' content types and
+// falls back to JSON
+func NewCodecRegistry() *CodecRegistry {
+	r := &CodecRegistry{contentType: map[string]Codec{}, fallback: JSONCodec}
+	for _, c := range []Codec{JSONCodec, CBORCodec, MsgpackCodec, ProtobufCodec} {
+		r.RegisterContentType(c.ContentType(), c)
+	}
+	r.RegisterContentType("application/x-msgpack", MsgpackCodec)
+	r.RegisterContentType("application/protobuf", ProtobufCodec)
+	return r
+}
+
+// RegisterContentType makes messages carrying contentType decode with c
+func (r *CodecRegistry) RegisterContentType(contentType string, c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.contentType[normalizeContentType(contentType)] = c
+}
+
+// ForTopic uses c for topics matching filter, which may contain + and # wildcards
+func (r *CodecRegistry) ForTopic(filter string, c Codec) error {
+	if filter == "" || c == nil {
+		return errors.New("ForTopic needs a topic filter and a codec")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.routes {
+		if r.routes[i].filter == filter {
+			r.routes[i].codec = c
+			return nil
+		}
+	}
+	r.routes = append(r.routes, codecRoute{filter: filter, codec: c})
+	return nil
+}
+
+// SetDefault sets the codec used when neither a content type nor a topic pattern applies
+func (r *CodecRegistry) SetDefault(c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = c
+}
+
+// Lookup returns the codec for a message on topic. contentType may be empty.
+func (r *CodecRegistry) Lookup(topic, contentType string) Codec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if contentType != "" {
+		if c, ok := r.contentType[normalizeContentType(contentType)]; ok {
+			return c
+		}
+	}
+	for _, route := range r.routes {
+		if topicMatches(route.filter, topic) {
+			return route.codec
+		}
+	}
+	return r.fallback
+}
+
+// normalizeContentType drops parameters such as charset and lower cases the media type
+func normalizeContentType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// DecodeError is sent on a typed subscription's Errors channel when a payload does not decode
+type DecodeError struct {
+	Topic   string
+	Payload []byte
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode message on %s: %v", e.Topic, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// TypedMessage is a decoded message of a typed subscription
+type TypedMessage[T any] struct {
+	Topic       string
+	ContentType string
+	Value       T
+}
+
+// TypedSubscription delivers decoded messages on Messages and the ones that failed to decode on
+// Errors. Both channels are closed when the subscription ends; Errors must be drained as well.
+type TypedSubscription[T any] struct {
+	Topic    string
+	Messages <-chan TypedMessage[T]
+	Errors   <-chan *DecodeError
+}
+
+// TypedSubscribeOptions controls a typed subscription. The zero value uses DefaultCodecs.
+type TypedSubscribeOptions struct {
+	Codecs    *CodecRegistry
+	Subscribe SubscribeOptions
+}
+
+// PublishValue encodes v with the codec DefaultCodecs picks for topic and publishes it
+func (u *UserClient) PublishValue(topic string, v interface{}, qos int) error {
+	return publishValue(u.MQTTClient, DefaultCodecs, topic, v, qos)
+}
+
+// PublishValue encodes v with the codec DefaultCodecs picks for topic and publishes it
+func (d *DeviceClient) PublishValue(topic string, v interface{}, qos int) error {
+	return publishValue(d.MQTTClient, DefaultCodecs, topic, v, qos)
+}
+
+// PublishValue encodes v with the codec DefaultCodecs picks for topic and publishes it
+func (d *DevClient) PublishValue(topic string, v interface{}, qos int) error {
+	return publishValue(d.MQTTClient, DefaultCodecs, topic, v, qos)
+}
+
+func publishValue(c MqttClient, codecs *CodecRegistry, topic string, v interface{}, qos int) error {
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	codec := codecs.Lookup(topic, "")
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode message for %s: %w", topic, err)
+	}
+	if _, err := asMqttV5(c); err == nil {
+		return publishWithProperties(c, topic, data, qos, false, &PublishProperties{ContentType: codec.ContentType()})
+	}
+	return publish(c, topic, data, qos, 0, false)
+}
+
+// newTypedValue returns a value to decode a message into and the pointer to hand to the codec.
+// A pointer T gets a new value to point at, so codecs see *Msg rather than **Msg.
+func newTypedValue[T any]() (*T, interface{}) {
+	v := new(T)
+	if t := reflect.TypeOf(v).Elem(); t.Kind() == reflect.Ptr {
+		p := reflect.New(t.Elem())
+		reflect.ValueOf(v).Elem().Set(p)
+		return v, p.Interface()
+	}
+	return v, v
+}
+
+// SubscribeTyped subscribes to topic and decodes every message into a T, e.g.
+// SubscribeTyped[Reading](client.MQTTClient, "devices/+/readings", 1, TypedSubscribeOptions{}).
+// T may be a pointer, which protobuf messages must be: SubscribeTyped[*pb.Reading](...).
+func SubscribeTyped[T any](c MqttClient, topic string, qos int, opts TypedSubscribeOptions) (*TypedSubscription[T], error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	if _, ok := interface{}(new(T)).(proto.Message); ok {
+		return nil, fmt.Errorf("SubscribeTyped needs a pointer type for the protobuf message %T", *new(T))
+	}
+	codecs := opts.Codecs
+	if codecs == nil {
+		codecs = DefaultCodecs
+	}
+	size := opts.Subscribe.BufferSize
+	if size <= 0 {
+		size = _SUBSCRIBE_DEFAULT_BUFFER
+	}
+	msgs := make(chan TypedMessage[T], size)
+	errs := make(chan *DecodeError, size)
+	decode := func(topic, contentType string, payload []byte) {
+		v, into := newTypedValue[T]()
+		if err := codecs.Lookup(topic, contentType).Unmarshal(payload, into); err != nil {
+			errs <- &DecodeError{Topic: topic, Payload: payload, Err: err}
+			return
+		}
+		msgs <- TypedMessage[T]{Topic: topic, ContentType: contentType, Value: *v}
+	}
+	if _, err := asMqttV5(c); err == nil {
+		raw, err := subscribeWithPropertiesOptions(c, topic, qos, opts.Subscribe)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			defer close(msgs)
+			defer close(errs)
+			for m := range raw {
+				decode(m.Topic, m.Properties.ContentType, m.Payload)
+			}
+		}()
+	} else {
+		raw, err := subscribeWithOptions(c, topic, qos, opts.Subscribe)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			defer close(msgs)
+			defer close(errs)
+			for m := range raw {
+				decode(m.Topic.Whole, "", m.Payload)
+			}
+		}()
+	}
+	return &TypedSubscription[T]{Topic: topic, Messages: msgs, Errors: errs}, nil
+}
@@ -0,0 +1,137 @@
+package GoSDK
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecReading struct {
+	Device string  `json:"device" cbor:"device" msgpack:"device"`
+	Value  float64 `json:"value" cbor:"value" msgpack:"value"`
+}
+
+func nextTyped[T any](t *testing.T, sub *TypedSubscription[T]) TypedMessage[T] {
+	t.Helper()
+	select {
+	case m, ok := <-sub.Messages:
+		if !ok {
+			t.Fatal("typed subscription closed")
+		}
+		return m
+	case err := <-sub.Errors:
+		t.Fatalf("decode error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a typed message")
+	}
+	return TypedMessage[T]{}
+}
+
+func TestSubscribeTypedRoundTripsEachCodec(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, CBORCodec, MsgpackCodec} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			b := NewMemoryBroker()
+			c := newMemoryClient(t, b, "typed")
+			codecs := NewCodecRegistry()
+			codecs.ForTopic("readings/#", codec)
+
+			values, err := SubscribeTyped[codecReading](c, "readings/+", 1, TypedSubscribeOptions{Codecs: codecs})
+			if err != nil {
+				t.Fatalf("subscribe: %v", err)
+			}
+			pointers, err := SubscribeTyped[*codecReading](c, "readings/#", 1, TypedSubscribeOptions{Codecs: codecs})
+			if err != nil {
+				t.Fatalf("subscribe: %v", err)
+			}
+			want := codecReading{Device: "d1", Value: 21.5}
+			if err := publishValue(c, codecs, "readings/d1", want, 1); err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+			if got := nextTyped(t, values); got.Value != want || got.Topic != "readings/d1" {
+				t.Fatalf("got %+v", got)
+			}
+			if got := nextTyped(t, pointers); got.Value == nil || *got.Value != want {
+				t.Fatalf("got %+v", got)
+			}
+		})
+	}
+}
+
+func TestSubscribeTypedDecodesProtobufIntoNewMessages(t *testing.T) {
+	b := NewMemoryBroker()
+	c := newMemoryClient(t, b, "proto")
+	codecs := NewCodecRegistry()
+	codecs.ForTopic("proto/#", ProtobufCodec)
+
+	sub, err := SubscribeTyped[*structpb.Struct](c, "proto/+", 1, TypedSubscribeOptions{Codecs: codecs})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	for _, v := range []float64{1, 2} {
+		msg, err := structpb.NewStruct(map[string]interface{}{"value": v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := publishValue(c, codecs, "proto/a", msg, 1); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	first, second := nextTyped(t, sub), nextTyped(t, sub)
+	if first.Value == second.Value {
+		t.Fatal("both messages were decoded into the same value")
+	}
+	if first.Value.Fields["value"].GetNumberValue() != 1 || second.Value.Fields["value"].GetNumberValue() != 2 {
+		t.Fatalf("decoded %v and %v", first.Value, second.Value)
+	}
+}
+
+func TestSubscribeTypedRejectsProtobufValueType(t *testing.T) {
+	c := newMemoryClient(t, NewMemoryBroker(), "proto")
+	if _, err := SubscribeTyped[wrapperspb.StringValue](c, "proto/+", 1, TypedSubscribeOptions{}); err == nil {
+		t.Fatal("subscribed with a protobuf value type")
+	}
+}
+
+func TestSubscribeTypedSendsDecodeErrors(t *testing.T) {
+	b := NewMemoryBroker()
+	c := newMemoryClient(t, b, "typed")
+	sub, err := SubscribeTyped[codecReading](c, "readings/+", 1, TypedSubscribeOptions{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := publish(c, "readings/d1", []byte("{not json"), 1, 0, false); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	select {
+	case derr := <-sub.Errors:
+		if derr.Topic != "readings/d1" || string(derr.Payload) != "{not json" {
+			t.Fatalf("decode error %+v", derr)
+		}
+	case m := <-sub.Messages:
+		t.Fatalf("undecodable payload delivered as %+v", m)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no decode error")
+	}
+}
+
+func TestCodecRegistryPrefersContentType(t *testing.T) {
+	r := NewCodecRegistry()
+	r.ForTopic("a/#", CBORCodec)
+	if r.Lookup("a/b", "application/x-msgpack; charset=binary") != MsgpackCodec {
+		t.Fatal("content type did not win over the topic pattern")
+	}
+	if r.Lookup("a/b", "") != CBORCodec || r.Lookup("b", "") != JSONCodec {
+		t.Fatal("topic pattern or default not applied")
+	}
+	if _, err := ProtobufCodec.Marshal(struct{}{}); err == nil {
+		t.Fatal("protobuf codec encoded a non-proto value")
+	}
+	data, _ := ProtobufCodec.Marshal(wrapperspb.String("x"))
+	var got wrapperspb.StringValue
+	if err := ProtobufCodec.Unmarshal(data, &got); err != nil || !proto.Equal(&got, wrapperspb.String("x")) {
+		t.Fatalf("protobuf round trip: %v", err)
+	}
+}
@@ -150,7 +150,7 @@ func deleteService(c cbClient, systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(c, _CODE_USER_PREAMBLE+"/"+systemKey+"/service/"+name, nil, creds, nil)
+	resp, err := del(c, _CODE_USER_PREAMBLE+"/"+systemKey+"/service/"+name, nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting service: %v", err)
 	}
@@ -276,7 +276,7 @@ func (d *DevClient) DeleteServiceCacheMeta(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _CODE_CACHE_META_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _CODE_CACHE_META_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting code cache meta: %v", err)
 	}
@@ -360,14 +360,14 @@ func (d *DevClient) InvokeWebhook(systemKey, name string, body map[string]interf
 		resp, err = post(d, "/api/v/4/webhook/execute/"+systemKey+"/"+name, body, creds, nil)
 	case HTTP_BASIC_AUTH:
 		headers := map[string][]string{
-			"Authorization": {fmt.Sprintf("Basic %s", d.DevToken)},
+			"Authorization": {fmt.Sprintf("Basic %s", d.getToken())},
 		}
 		resp, err = post(d, "/api/v/4/webhook/execute/"+systemKey+"/"+name, body, nil, headers)
 	case PAYLOAD_AUTH:
 		if body == nil {
 			body = map[string]interface{}{}
 		}
-		body["token"] = d.DevToken
+		body["token"] = d.getToken()
 	default:
 		return nil, fmt.Errorf("Invalid auth method for executing webhook: %s", authMethod)
 	}
@@ -397,14 +397,14 @@ func (u *UserClient) InvokeWebhook(systemKey, name string, body map[string]inter
 		resp, err = post(u, "/api/v/4/webhook/execute/"+systemKey+"/"+name, body, creds, nil)
 	case HTTP_BASIC_AUTH:
 		headers := map[string][]string{
-			"Authorization": {fmt.Sprintf("Basic %s", u.UserToken)},
+			"Authorization": {fmt.Sprintf("Basic %s", u.getToken())},
 		}
 		resp, err = post(u, "/api/v/4/webhook/execute/"+systemKey+"/"+name, body, nil, headers)
 	case PAYLOAD_AUTH:
 		if body == nil {
 			body = map[string]interface{}{}
 		}
-		body["token"] = u.UserToken
+		body["token"] = u.getToken()
 		resp, err = post(u, "/api/v/4/webhook/execute/"+systemKey+"/"+name, body, nil, nil)
 	default:
 		return nil, fmt.Errorf("Invalid auth method for executing webhook: %s", authMethod)
@@ -442,7 +442,7 @@ func (d *DevClient) DeleteWebhook(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _WEBHOOK_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _WEBHOOK_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting webhook: %v", err)
 	}
@@ -0,0 +1,205 @@
+package GoSDK
+
+import (
+	"fmt"
+)
+
+const _COPY_DEFAULT_PAGE_SIZE = 1000
+
+// CopyCollectionOptions controls CopyCollection. The zero value copies the schema and every row into
+// a collection of the same name.
+type CopyCollectionOptions struct {
+	// DestinationCollection defaults to the source collection name
+	DestinationCollection string
+	// SkipSchema copies rows only, the destination collection must already exist
+	SkipSchema bool
+	// AllowDestructive lets the schema copy drop or retype columns, indexes and aggregates in the destination
+	AllowDestructive bool
+	// Query restricts which source rows are copied. Paging is managed by CopyCollection, which also
+	// orders by the watermark column, or appends item_id to the query's ordering when there is none.
+	Query *Query
+	// PageSize is the number of rows read and written per request
+	PageSize int
+	// Transform is applied to every row before it is written. Returning a nil row skips it.
+	Transform func(row map[string]interface{}) (map[string]interface{}, error)
+	// PreserveItemIDs keeps the source item_id values instead of letting the destination assign new ones
+	PreserveItemIDs bool
+	// WatermarkColumn enables incremental copies: rows are read in ascending order of this column and
+	// only rows greater than Since are copied
+	WatermarkColumn string
+	Since           interface{}
+	// ResumeFromDestination looks up the highest watermark already in the destination and uses it as Since
+	ResumeFromDestination bool
+}
+
+// CopyCollectionResult reports what CopyCollection did. Watermark holds the highest watermark copied,
+// to be passed as Since on the next run.
+type CopyCollectionResult struct {
+	Schema      *SchemaPlan
+	Pages       int
+	RowsRead    int
+	RowsWritten int
+	RowsSkipped int
+	Watermark   interface{}
+}
+
+// CopyCollection recreates a collection from one system in another, possibly on a different platform, and
+// streams its rows across. Schema recreation needs developer clients on both sides; other clients can
+// still copy rows with SkipSchema.
+func CopyCollection(src Client, srcSystem, srcCollection string, dst Client, dstSystem string, opts CopyCollectionOptions) (*CopyCollectionResult, error) {
+	if opts.DestinationCollection == "" {
+		opts.DestinationCollection = srcCollection
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = _COPY_DEFAULT_PAGE_SIZE
+	}
+	result := &CopyCollectionResult{Watermark: opts.Since}
+
+	if !opts.SkipSchema {
+		plan, err := copyCollectionSchema(src, srcSystem, srcCollection, dst, dstSystem, opts)
+		result.Schema = plan
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if opts.WatermarkColumn != "" && opts.Since == nil && opts.ResumeFromDestination {
+		since, err := highestWatermark(dst, dstSystem, opts.DestinationCollection, opts.WatermarkColumn)
+		if err != nil {
+			return result, err
+		}
+		opts.Since = since
+		result.Watermark = since
+	}
+
+	for page := 1; ; page++ {
+		qry := copyPageQuery(opts, page)
+		resp, err := src.GetDataByNameWithSystemKey(srcSystem, srcCollection, qry)
+		if err != nil {
+			return result, fmt.Errorf("could not read page %d of %s: %w", page, srcCollection, err)
+		}
+		rows, err := dataRows(resp)
+		if err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		result.Pages++
+		result.RowsRead += len(rows)
+
+		// the watermark only moves once the page is in the destination, so a failed run resumes from
+		// the last page that was actually written
+		watermark := result.Watermark
+		out := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if opts.WatermarkColumn != "" {
+				if wm, ok := row[opts.WatermarkColumn]; ok && wm != nil {
+					watermark = wm
+				}
+			}
+			if !opts.PreserveItemIDs {
+				delete(row, _SCHEMA_DEFAULT_ID_COLUMN)
+			}
+			if opts.Transform != nil {
+				if row, err = opts.Transform(row); err != nil {
+					return result, fmt.Errorf("could not transform row: %w", err)
+				}
+				if row == nil {
+					result.RowsSkipped++
+					continue
+				}
+			}
+			out = append(out, row)
+		}
+		if len(out) > 0 {
+			if _, err := dst.CreateDataByName(dstSystem, opts.DestinationCollection, out); err != nil {
+				return result, fmt.Errorf("could not write page %d to %s: %w", page, opts.DestinationCollection, err)
+			}
+			result.RowsWritten += len(out)
+		}
+		result.Watermark = watermark
+		if len(rows) < opts.PageSize {
+			break
+		}
+	}
+	return result, nil
+}
+
+func copyCollectionSchema(src Client, srcSystem, srcCollection string, dst Client, dstSystem string, opts CopyCollectionOptions) (*SchemaPlan, error) {
+	srcDev, srcOK := src.(*DevClient)
+	dstDev, dstOK := dst.(*DevClient)
+	if !srcOK || !dstOK {
+		return nil, fmt.Errorf("copying a collection schema requires developer clients, use SkipSchema to copy rows only")
+	}
+	schema, err := srcDev.DescribeCollection(srcSystem, srcCollection)
+	if err != nil {
+		return nil, fmt.Errorf("could not describe %s: %w", srcCollection, err)
+	}
+	schema.Name = opts.DestinationCollection
+	plan, err := dstDev.ApplySchema(dstSystem, *schema, ApplySchemaOptions{AllowDestructive: opts.AllowDestructive})
+	if err != nil {
+		return plan, fmt.Errorf("could not recreate schema of %s: %w", srcCollection, err)
+	}
+	return plan, nil
+}
+
+// copyPageQuery builds the query for one page, ANDing the watermark constraint into every OR group
+// of the caller's query
+func copyPageQuery(opts CopyCollectionOptions, page int) *Query {
+	qry := NewQuery()
+	if opts.Query != nil {
+		qry.Filters = make([][]Filter, len(opts.Query.Filters))
+		for i, group := range opts.Query.Filters {
+			qry.Filters[i] = append([]Filter{}, group...)
+		}
+		if len(qry.Filters) == 0 {
+			qry.Filters = [][]Filter{{}}
+		}
+		qry.Columns = opts.Query.Columns
+		qry.Order = opts.Query.Order
+	}
+	if opts.WatermarkColumn != "" {
+		if opts.Since != nil {
+			for i := range qry.Filters {
+				qry.Filters[i] = append(qry.Filters[i], Filter{Field: opts.WatermarkColumn, Value: opts.Since, Operator: ">"})
+			}
+		}
+		qry.Order = []Ordering{{SortOrder: true, OrderKey: opts.WatermarkColumn}}
+		if opts.WatermarkColumn != _SCHEMA_DEFAULT_ID_COLUMN {
+			// watermarks can repeat, and offset paging needs a total order
+			qry.Order = append(qry.Order, Ordering{SortOrder: true, OrderKey: _SCHEMA_DEFAULT_ID_COLUMN})
+		}
+	} else {
+		// offset paging needs a total order, otherwise rows can move between pages
+		qry.Order = append(append([]Ordering{}, qry.Order...), Ordering{SortOrder: true, OrderKey: _SCHEMA_DEFAULT_ID_COLUMN})
+	}
+	qry.PageSize = opts.PageSize
+	qry.PageNumber = page
+	return qry
+}
+
+func highestWatermark(c Client, systemKey, collection, column string) (interface{}, error) {
+	qry := NewQuery()
+	qry.PageSize = 1
+	qry.PageNumber = 1
+	qry.Order = []Ordering{{SortOrder: false, OrderKey: column}}
+	resp, err := c.GetDataByNameWithSystemKey(systemKey, collection, qry)
+	if err != nil {
+		return nil, fmt.Errorf("could not read watermark from %s: %w", collection, err)
+	}
+	rows, err := dataRows(resp)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0][column], nil
+}
+
+// dataRows pulls the rows out of a GetData style response
+func dataRows(resp map[string]interface{}) ([]map[string]interface{}, error) {
+	data, ok := resp["DATA"]
+	if !ok || data == nil {
+		return nil, nil
+	}
+	return makeSliceOfMaps(data)
+}
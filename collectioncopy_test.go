@@ -0,0 +1,131 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// copyPlatform serves a source collection in item_id order and records what is written to the
+// destination. Writes after failWriteAfter pages fail.
+type copyPlatform struct {
+	rows           []map[string]interface{}
+	queries        []map[string]interface{}
+	written        []interface{}
+	writes         int
+	failWriteAfter int
+}
+
+func (p *copyPlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		var qry map[string]interface{}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("query")), &qry); err != nil {
+			writeJSON(w, 400, err.Error())
+			return
+		}
+		p.queries = append(p.queries, qry)
+		size, page := int(qry["PAGESIZE"].(float64)), int(qry["PAGENUM"].(float64))
+		start, end := (page-1)*size, page*size
+		if start > len(p.rows) {
+			start = len(p.rows)
+		}
+		if end > len(p.rows) {
+			end = len(p.rows)
+		}
+		writeJSON(w, 200, map[string]interface{}{"DATA": p.rows[start:end]})
+	case "POST":
+		p.writes++
+		if p.failWriteAfter > 0 && p.writes > p.failWriteAfter {
+			writeJSON(w, 500, "write failed")
+			return
+		}
+		var rows []interface{}
+		json.NewDecoder(r.Body).Decode(&rows)
+		p.written = append(p.written, rows...)
+		writeJSON(w, 200, rows)
+	}
+}
+
+func copyRows(n int) []map[string]interface{} {
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"item_id": float64(i), "ts": float64(100 + i)}
+	}
+	return rows
+}
+
+func TestCopyCollectionKeepsWatermarkOfLastWrittenPage(t *testing.T) {
+	src := &copyPlatform{rows: copyRows(5)}
+	dst := &copyPlatform{failWriteAfter: 1}
+	srcClient := newTestDevClient(t, src)
+	dstClient := newTestDevClient(t, dst)
+
+	result, err := CopyCollection(srcClient, "sys", "readings", dstClient, "sys", CopyCollectionOptions{
+		SkipSchema:      true,
+		PageSize:        2,
+		WatermarkColumn: "ts",
+	})
+	if err == nil {
+		t.Fatal("expected the failed write to be reported")
+	}
+	if result.Watermark != float64(101) {
+		t.Fatalf("watermark is %v, want 101 from the only page written", result.Watermark)
+	}
+	if result.RowsWritten != 2 || len(dst.written) != 2 {
+		t.Fatalf("wrote %d rows (%d received), want 2", result.RowsWritten, len(dst.written))
+	}
+}
+
+func TestCopyCollectionOrdersByItemIDWithoutWatermark(t *testing.T) {
+	src := &copyPlatform{rows: copyRows(5)}
+	dst := &copyPlatform{}
+	srcClient := newTestDevClient(t, src)
+	dstClient := newTestDevClient(t, dst)
+
+	qry := NewQuery()
+	qry.Order = []Ordering{{SortOrder: false, OrderKey: "ts"}}
+	result, err := CopyCollection(srcClient, "sys", "readings", dstClient, "sys", CopyCollectionOptions{
+		SkipSchema: true,
+		PageSize:   2,
+		Query:      qry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pages != 3 || result.RowsWritten != 5 {
+		t.Fatalf("copied %d rows in %d pages, want 5 in 3", result.RowsWritten, result.Pages)
+	}
+	want := []interface{}{map[string]interface{}{"DESC": "ts"}, map[string]interface{}{"ASC": "item_id"}}
+	for _, q := range src.queries {
+		if !reflect.DeepEqual(q["SORT"], want) {
+			t.Fatalf("page query sorted by %v, want %v", q["SORT"], want)
+		}
+	}
+	if len(qry.Order) != 1 {
+		t.Fatalf("caller's query was modified: %v", qry.Order)
+	}
+}
+
+func TestCopyCollectionBreaksWatermarkTiesByItemID(t *testing.T) {
+	for column, want := range map[string][]interface{}{
+		"ts":      {map[string]interface{}{"ASC": "ts"}, map[string]interface{}{"ASC": "item_id"}},
+		"item_id": {map[string]interface{}{"ASC": "item_id"}},
+	} {
+		src := &copyPlatform{rows: copyRows(3)}
+		_, err := CopyCollection(newTestDevClient(t, src), "sys", "readings", newTestDevClient(t, &copyPlatform{}), "sys", CopyCollectionOptions{
+			SkipSchema:      true,
+			PageSize:        2,
+			WatermarkColumn: column,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range src.queries {
+			if !reflect.DeepEqual(q["SORT"], want) {
+				t.Fatalf("watermark %s: page query sorted by %v, want %v", column, q["SORT"], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,659 @@
+package GoSDK
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// This file lets collections be described declaratively, either as Go structs or as a YAML
+// document, and reconciled against what the platform currently has. PlanSchema works out the
+// difference and ApplySchema carries it out using the regular collection management calls.
+// Anything that can lose data (dropping columns, indexes or aggregates, retyping a column) is
+// flagged as destructive and only applied when explicitly allowed.
+
+// CollectionSchema is the desired state of a single collection
+type CollectionSchema struct {
+	Name                 string                      `json:"name" yaml:"name"`
+	Columns              []SchemaColumn              `json:"columns" yaml:"columns"`
+	Indexes              []string                    `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	UniqueIndexes        []string                    `json:"unique_indexes,omitempty" yaml:"unique_indexes,omitempty"`
+	Hypertable           *HypertableOptions          `json:"hypertable,omitempty" yaml:"hypertable,omitempty"`
+	Compression          *CompressionOptions         `json:"compression,omitempty" yaml:"compression,omitempty"`
+	ContinuousAggregates []ContinuousAggregateSchema `json:"continuous_aggregates,omitempty" yaml:"continuous_aggregates,omitempty"`
+}
+
+// SchemaColumn describes a single column. RenamedFrom lets an existing column be renamed instead
+// of being dropped and re-added.
+type SchemaColumn struct {
+	Name        string `json:"name" yaml:"name"`
+	Type        string `json:"type" yaml:"type"`
+	RenamedFrom string `json:"renamed_from,omitempty" yaml:"renamed_from,omitempty"`
+}
+
+type ContinuousAggregateSchema struct {
+	Name                       string `json:"name" yaml:"name"`
+	ContinuousAggregateOptions `yaml:",inline"`
+}
+
+type SchemaChangeKind string
+
+const (
+	SchemaCreateCollection  SchemaChangeKind = "create_collection"
+	SchemaAddColumn         SchemaChangeKind = "add_column"
+	SchemaRenameColumn      SchemaChangeKind = "rename_column"
+	SchemaRetypeColumn      SchemaChangeKind = "retype_column"
+	SchemaDropColumn        SchemaChangeKind = "drop_column"
+	SchemaCreateIndex       SchemaChangeKind = "create_index"
+	SchemaDropIndex         SchemaChangeKind = "drop_index"
+	SchemaCreateUniqueIndex SchemaChangeKind = "create_unique_index"
+	SchemaDropUniqueIndex   SchemaChangeKind = "drop_unique_index"
+	SchemaConvertHypertable SchemaChangeKind = "convert_hypertable"
+	SchemaUpdateHypertable  SchemaChangeKind = "update_hypertable"
+	SchemaSetCompression    SchemaChangeKind = "set_compression"
+	SchemaCreateAggregate   SchemaChangeKind = "create_continuous_aggregate"
+	SchemaUpdateAggregate   SchemaChangeKind = "update_continuous_aggregate"
+	SchemaDropAggregate     SchemaChangeKind = "drop_continuous_aggregate"
+)
+
+const _SCHEMA_DEFAULT_ID_COLUMN = "item_id"
+
+// SchemaChange is a single step of a SchemaPlan
+type SchemaChange struct {
+	Kind        SchemaChangeKind
+	Name        string // column, index column or aggregate name
+	From        string // previous name or type, where it applies
+	Type        string
+	Hypertable  *HypertableOptions
+	Update      *HypertableUpdate
+	Aggregate   *ContinuousAggregateOptions
+	Compression *CompressionOptions
+	Destructive bool
+}
+
+func (c SchemaChange) String() string {
+	s := string(c.Kind)
+	if c.Name != "" {
+		s += " " + c.Name
+	}
+	if c.From != "" {
+		s += " (from " + c.From + ")"
+	}
+	if c.Type != "" {
+		s += " " + c.Type
+	}
+	if c.Destructive {
+		s += " [destructive]"
+	}
+	return s
+}
+
+// SchemaPlan is the ordered list of changes needed to bring a collection in line with its schema
+type SchemaPlan struct {
+	SystemKey    string
+	Collection   string
+	CollectionID string
+	Changes      []SchemaChange
+}
+
+// HasDestructive reports whether applying the plan could lose data
+func (p *SchemaPlan) HasDestructive() bool {
+	for _, c := range p.Changes {
+		if c.Destructive {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether the collection already matches its schema
+func (p *SchemaPlan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+func (p *SchemaPlan) String() string {
+	lines := []string{fmt.Sprintf("collection %s (%d changes)", p.Collection, len(p.Changes))}
+	for _, c := range p.Changes {
+		lines = append(lines, "  "+c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type ApplySchemaOptions struct {
+	// AllowDestructive must be set for plans that drop or retype anything
+	AllowDestructive bool
+}
+
+// ParseCollectionSchemas reads a YAML document holding either a single collection or a
+// list of them under a top level "collections" key
+func ParseCollectionSchemas(data []byte) ([]CollectionSchema, error) {
+	var doc struct {
+		Collections []CollectionSchema `yaml:"collections"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("could not parse collection schema: %w", err)
+	}
+	schemas := doc.Collections
+	if len(schemas) == 0 {
+		var single CollectionSchema
+		if err := yaml.Unmarshal(data, &single); err != nil {
+			return nil, fmt.Errorf("could not parse collection schema: %w", err)
+		}
+		schemas = []CollectionSchema{single}
+	}
+	for i := range schemas {
+		if err := schemas[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return schemas, nil
+}
+
+// Validate checks the schema for mistakes that can be caught without talking to the platform
+func (s *CollectionSchema) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("collection schema is missing a name")
+	}
+	seen := map[string]bool{}
+	for _, col := range s.Columns {
+		if col.Name == "" || col.Type == "" {
+			return fmt.Errorf("collection %s: every column needs a name and a type", s.Name)
+		}
+		if seen[col.Name] {
+			return fmt.Errorf("collection %s: column %s declared twice", s.Name, col.Name)
+		}
+		seen[col.Name] = true
+	}
+	for _, idx := range append(append([]string{}, s.Indexes...), s.UniqueIndexes...) {
+		if !seen[idx] && idx != _SCHEMA_DEFAULT_ID_COLUMN {
+			return fmt.Errorf("collection %s: index on unknown column %s", s.Name, idx)
+		}
+	}
+	if s.Hypertable != nil {
+		if err := s.Hypertable.Validate(); err != nil {
+			return fmt.Errorf("collection %s: %w", s.Name, err)
+		}
+	}
+	if s.Compression != nil && s.Hypertable == nil {
+		return fmt.Errorf("collection %s: compression requires a hypertable", s.Name)
+	}
+	if len(s.ContinuousAggregates) > 0 && s.Hypertable == nil {
+		return fmt.Errorf("collection %s: continuous aggregates require a hypertable", s.Name)
+	}
+	for _, agg := range s.ContinuousAggregates {
+		if !identifierPattern.MatchString(agg.Name) {
+			return fmt.Errorf("collection %s: continuous aggregate name %q is not a valid name", s.Name, agg.Name)
+		}
+		if err := agg.Validate(); err != nil {
+			return fmt.Errorf("collection %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// PlanSchema compares the schema against the collection in the given system and returns the changes
+// that ApplySchema would make. Nothing is modified.
+func (d *DevClient) PlanSchema(systemKey string, schema CollectionSchema) (*SchemaPlan, error) {
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	plan := &SchemaPlan{SystemKey: systemKey, Collection: schema.Name}
+
+	collectionID, err := d.findCollectionID(systemKey, schema.Name)
+	if err != nil {
+		return nil, err
+	}
+	if collectionID == "" {
+		planNewCollection(plan, schema)
+		return plan, nil
+	}
+	plan.CollectionID = collectionID
+
+	info, err := d.GetCollectionInfo(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := getColumns(d, collectionID, "", "")
+	if err != nil {
+		return nil, err
+	}
+	planColumns(plan, schema, columnTypes(columns))
+
+	indexResp, err := d.ListIndexes(systemKey, schema.Name)
+	if err != nil {
+		return nil, err
+	}
+	indexes, unique, err := parseIndexList(indexResp)
+	if err != nil {
+		return nil, err
+	}
+	planIndexes(plan, SchemaCreateIndex, SchemaDropIndex, schema.Indexes, indexes)
+	planIndexes(plan, SchemaCreateUniqueIndex, SchemaDropUniqueIndex, schema.UniqueIndexes, unique)
+
+	if schema.Hypertable == nil {
+		return plan, nil
+	}
+	current, isHypertable, err := hypertableState(info)
+	if err != nil {
+		return nil, err
+	}
+	if !isHypertable {
+		plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaConvertHypertable, Hypertable: schema.Hypertable})
+	} else {
+		if current.TimeColumn != "" && current.TimeColumn != schema.Hypertable.TimeColumn {
+			return nil, fmt.Errorf("collection %s: hypertable time column cannot be changed from %s to %s", schema.Name, current.TimeColumn, schema.Hypertable.TimeColumn)
+		}
+		want := schema.Hypertable.ChunkInterval
+		if !want.isZero() && !strings.EqualFold(want.IntervalStr, current.ChunkInterval.IntervalStr) {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaUpdateHypertable, From: current.ChunkInterval.IntervalStr, Update: &HypertableUpdate{ChunkInterval: want}})
+		}
+	}
+
+	if schema.Compression != nil {
+		var policy *CompressionPolicy
+		if isHypertable {
+			stats, err := d.GetCompressionStats(systemKey, schema.Name)
+			if err != nil {
+				return nil, err
+			}
+			policy = stats.Policy
+		}
+		if policy == nil || policy.SegmentBy != schema.Compression.SegmentBy || policy.Interval != schema.Compression.Interval {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaSetCompression, Compression: schema.Compression})
+		}
+	}
+
+	existing := map[string]bool{}
+	if isHypertable {
+		aggs, err := d.GetAllContinuousAggregatesForCollection(systemKey, schema.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range aggregateNames(aggs) {
+			existing[name] = true
+		}
+	}
+	declared := map[string]bool{}
+	for i := range schema.ContinuousAggregates {
+		agg := &schema.ContinuousAggregates[i]
+		declared[agg.Name] = true
+		if !existing[agg.Name] {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaCreateAggregate, Name: agg.Name, Aggregate: &agg.ContinuousAggregateOptions})
+			continue
+		}
+		current, err := d.GetContinuousAggregateInfo(systemKey, schema.Name, agg.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !sameAggregate(agg.ContinuousAggregateOptions, current.ContinuousAggregateOptions) {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaUpdateAggregate, Name: agg.Name, Aggregate: &agg.ContinuousAggregateOptions})
+		}
+	}
+	for _, name := range sortedKeys(existing) {
+		if !declared[name] {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaDropAggregate, Name: name, Destructive: true})
+		}
+	}
+	return plan, nil
+}
+
+// ApplySchema plans the schema and then executes the plan. A destructive plan is refused, and
+// nothing is changed, unless opts.AllowDestructive is set. The executed plan is returned.
+func (d *DevClient) ApplySchema(systemKey string, schema CollectionSchema, opts ApplySchemaOptions) (*SchemaPlan, error) {
+	plan, err := d.PlanSchema(systemKey, schema)
+	if err != nil {
+		return nil, err
+	}
+	return plan, d.ApplySchemaPlan(plan, opts)
+}
+
+// ApplySchemaPlan executes a plan previously returned by PlanSchema. It stops at the first failing step.
+func (d *DevClient) ApplySchemaPlan(plan *SchemaPlan, opts ApplySchemaOptions) error {
+	if plan.HasDestructive() && !opts.AllowDestructive {
+		return fmt.Errorf("plan for collection %s contains destructive changes, refusing to apply:\n%s", plan.Collection, plan)
+	}
+	for _, c := range plan.Changes {
+		if err := d.applySchemaChange(plan, c); err != nil {
+			return fmt.Errorf("could not %s on collection %s: %w", c, plan.Collection, err)
+		}
+	}
+	return nil
+}
+
+func (d *DevClient) applySchemaChange(plan *SchemaPlan, c SchemaChange) error {
+	sk, name := plan.SystemKey, plan.Collection
+	switch c.Kind {
+	case SchemaCreateCollection:
+		id, err := d.NewCollection(sk, name)
+		if err != nil {
+			return err
+		}
+		plan.CollectionID = id
+		return nil
+	case SchemaAddColumn:
+		return d.AddColumn(plan.CollectionID, c.Name, c.Type)
+	case SchemaRenameColumn:
+		return d.RenameColumn(plan.CollectionID, c.From, c.Name)
+	case SchemaRetypeColumn:
+		if err := d.DeleteColumn(plan.CollectionID, c.Name); err != nil {
+			return err
+		}
+		return d.AddColumn(plan.CollectionID, c.Name, c.Type)
+	case SchemaDropColumn:
+		return d.DeleteColumn(plan.CollectionID, c.Name)
+	case SchemaCreateIndex:
+		return d.CreateIndex(sk, name, c.Name)
+	case SchemaDropIndex:
+		return d.DropIndex(sk, name, c.Name)
+	case SchemaCreateUniqueIndex:
+		return d.CreateUniqueIndex(sk, name, c.Name)
+	case SchemaDropUniqueIndex:
+		return d.DropUniqueIndex(sk, name, c.Name)
+	case SchemaConvertHypertable:
+		return d.ConvertCollectionToHypertableWithOptions(sk, name, c.Hypertable)
+	case SchemaUpdateHypertable:
+		return d.UpdateHypertablePropertiesWithOptions(sk, name, c.Update)
+	case SchemaSetCompression:
+		return d.CompressHypertable(sk, name, *c.Compression)
+	case SchemaCreateAggregate:
+		return d.CreateContinuousAggregateWithOptions(sk, name, c.Name, c.Aggregate)
+	case SchemaUpdateAggregate:
+		return d.UpdateContinuousAggregateWithOptions(sk, name, c.Name, c.Aggregate)
+	case SchemaDropAggregate:
+		return d.DeleteContinuousAggregate(sk, name, c.Name)
+	default:
+		return fmt.Errorf("unknown schema change %q", c.Kind)
+	}
+}
+
+func (d *DevClient) findCollectionID(systemKey, name string) (string, error) {
+	cols, err := d.GetAllCollections(systemKey)
+	if err != nil {
+		return "", err
+	}
+	for _, colIF := range cols {
+		col, ok := colIF.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if n, _ := col["name"].(string); n == name {
+			id, _ := col["collectionID"].(string)
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+func planNewCollection(plan *SchemaPlan, schema CollectionSchema) {
+	plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaCreateCollection, Name: schema.Name})
+	for _, col := range schema.Columns {
+		if col.Name == _SCHEMA_DEFAULT_ID_COLUMN {
+			continue
+		}
+		plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaAddColumn, Name: col.Name, Type: col.Type})
+	}
+	for _, idx := range schema.Indexes {
+		plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaCreateIndex, Name: idx})
+	}
+	for _, idx := range schema.UniqueIndexes {
+		plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaCreateUniqueIndex, Name: idx})
+	}
+	if schema.Hypertable != nil {
+		plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaConvertHypertable, Hypertable: schema.Hypertable})
+	}
+	if schema.Compression != nil {
+		plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaSetCompression, Compression: schema.Compression})
+	}
+	for i := range schema.ContinuousAggregates {
+		agg := &schema.ContinuousAggregates[i]
+		plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaCreateAggregate, Name: agg.Name, Aggregate: &agg.ContinuousAggregateOptions})
+	}
+}
+
+func planColumns(plan *SchemaPlan, schema CollectionSchema, current map[string]string) {
+	declared := map[string]bool{_SCHEMA_DEFAULT_ID_COLUMN: true}
+	for _, col := range schema.Columns {
+		declared[col.Name] = true
+		curType, exists := current[col.Name]
+		if !exists && col.RenamedFrom != "" {
+			if oldType, ok := current[col.RenamedFrom]; ok {
+				plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaRenameColumn, Name: col.Name, From: col.RenamedFrom})
+				declared[col.RenamedFrom] = true
+				curType, exists = oldType, true
+			}
+		}
+		switch {
+		case !exists:
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaAddColumn, Name: col.Name, Type: col.Type})
+		case !strings.EqualFold(curType, col.Type):
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaRetypeColumn, Name: col.Name, From: curType, Type: col.Type, Destructive: true})
+		}
+	}
+	for _, name := range sortedKeys(current) {
+		if !declared[name] {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: SchemaDropColumn, Name: name, Destructive: true})
+		}
+	}
+}
+
+func planIndexes(plan *SchemaPlan, create, drop SchemaChangeKind, want []string, have map[string]bool) {
+	wanted := map[string]bool{}
+	for _, idx := range want {
+		wanted[idx] = true
+		if !have[idx] {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: create, Name: idx})
+		}
+	}
+	for _, idx := range sortedKeys(have) {
+		if !wanted[idx] && idx != _SCHEMA_DEFAULT_ID_COLUMN {
+			plan.Changes = append(plan.Changes, SchemaChange{Kind: drop, Name: idx, Destructive: true})
+		}
+	}
+}
+
+// columnTypes turns the GetColumns response into a name -> type map, leaving out primary keys
+func columnTypes(columns []interface{}) map[string]string {
+	rval := map[string]string{}
+	for _, colIF := range columns {
+		col, ok := colIF.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if pk, _ := col["PK"].(bool); pk {
+			continue
+		}
+		name, _ := col["ColumnName"].(string)
+		typ, _ := col["ColumnType"].(string)
+		if name != "" {
+			rval[name] = typ
+		}
+	}
+	return rval
+}
+
+// collectionIndexList is the ListIndexes response:
+// {"indexes": [{"name": "...", "column_name": "...", "unique": false}, ...]}
+type collectionIndexList struct {
+	Indexes *[]struct {
+		Name       string `json:"name"`
+		ColumnName string `json:"column_name"`
+		Unique     bool   `json:"unique"`
+	} `json:"indexes"`
+}
+
+// parseIndexList pulls the indexed column names out of a ListIndexes response, split into
+// plain and unique indexes
+func parseIndexList(resp map[string]interface{}) (map[string]bool, map[string]bool, error) {
+	var list collectionIndexList
+	if err := decodeMapToStruct(resp, &list); err != nil {
+		return nil, nil, fmt.Errorf("could not decode index list: %w", err)
+	}
+	if list.Indexes == nil {
+		return nil, nil, fmt.Errorf("index list has no indexes field: %v", resp)
+	}
+	plain, unique := map[string]bool{}, map[string]bool{}
+	for _, idx := range *list.Indexes {
+		if idx.ColumnName == "" {
+			return nil, nil, fmt.Errorf("index %q has no column_name", idx.Name)
+		}
+		if idx.Unique {
+			unique[idx.ColumnName] = true
+		} else {
+			plain[idx.ColumnName] = true
+		}
+	}
+	return plain, unique, nil
+}
+
+// collectionHypertableInfo is the part of the GetCollectionInfo response that describes hypertables.
+// hypertable_properties accompanies is_hypertable when it is true.
+type collectionHypertableInfo struct {
+	IsHypertable         *bool                  `json:"is_hypertable"`
+	HypertableProperties map[string]interface{} `json:"hypertable_properties"`
+}
+
+// hypertableState reports whether the collection info describes a hypertable and its current
+// properties. An info without is_hypertable is an error rather than a plain table, so a plan
+// never converts a collection that already is a hypertable.
+func hypertableState(info map[string]interface{}) (*HypertableOptions, bool, error) {
+	var state collectionHypertableInfo
+	if err := decodeMapToStruct(info, &state); err != nil {
+		return nil, false, fmt.Errorf("could not decode collection info: %w", err)
+	}
+	if state.IsHypertable == nil {
+		return nil, false, errors.New("collection info does not say whether the collection is a hypertable")
+	}
+	if !*state.IsHypertable {
+		return nil, false, nil
+	}
+	opts := &HypertableOptions{}
+	if state.HypertableProperties != nil {
+		if err := decodeTimescaleMap(state.HypertableProperties, opts); err != nil {
+			return nil, false, fmt.Errorf("could not decode hypertable properties: %w", err)
+		}
+	}
+	return opts, true, nil
+}
+
+func aggregateNames(aggs []interface{}) []string {
+	names := []string{}
+	for _, aggIF := range aggs {
+		switch agg := aggIF.(type) {
+		case string:
+			names = append(names, agg)
+		case map[string]interface{}:
+			if name := firstString(agg, "name", "view_name", "aggregate_name"); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// sameAggregate compares two aggregate definitions, ignoring differences the platform does not preserve
+func sameAggregate(a, b ContinuousAggregateOptions) bool {
+	norm := func(o ContinuousAggregateOptions) string {
+		for i := range o.Aggregations {
+			o.Aggregations[i].Function = strings.ToLower(o.Aggregations[i].Function)
+		}
+		return strings.ToLower(fmt.Sprintf("%v", o.toMap()))
+	}
+	a.Aggregations = append([]Aggregation{}, a.Aggregations...)
+	b.Aggregations = append([]Aggregation{}, b.Aggregations...)
+	return norm(a) == norm(b)
+}
+
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DescribeCollection reads the current state of a collection back as a CollectionSchema, suitable
+// for applying to another system
+func (d *DevClient) DescribeCollection(systemKey, collectionName string) (*CollectionSchema, error) {
+	collectionID, err := d.findCollectionID(systemKey, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if collectionID == "" {
+		return nil, fmt.Errorf("collection %s not found in system %s", collectionName, systemKey)
+	}
+	info, err := d.GetCollectionInfo(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := getColumns(d, collectionID, "", "")
+	if err != nil {
+		return nil, err
+	}
+	schema := &CollectionSchema{Name: collectionName}
+	types := columnTypes(columns)
+	for _, name := range sortedKeys(types) {
+		schema.Columns = append(schema.Columns, SchemaColumn{Name: name, Type: types[name]})
+	}
+
+	indexResp, err := d.ListIndexes(systemKey, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	indexes, unique, err := parseIndexList(indexResp)
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range sortedKeys(indexes) {
+		if idx != _SCHEMA_DEFAULT_ID_COLUMN {
+			schema.Indexes = append(schema.Indexes, idx)
+		}
+	}
+	for _, idx := range sortedKeys(unique) {
+		if idx != _SCHEMA_DEFAULT_ID_COLUMN {
+			schema.UniqueIndexes = append(schema.UniqueIndexes, idx)
+		}
+	}
+
+	hypertable, isHypertable, err := hypertableState(info)
+	if err != nil {
+		return nil, err
+	}
+	if !isHypertable {
+		return schema, nil
+	}
+	schema.Hypertable = hypertable
+
+	stats, err := d.GetCompressionStats(systemKey, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Policy != nil {
+		schema.Compression = &CompressionOptions{SegmentBy: stats.Policy.SegmentBy, Interval: stats.Policy.Interval}
+	}
+
+	aggs, err := d.GetAllContinuousAggregatesForCollection(systemKey, collectionName)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range aggregateNames(aggs) {
+		agg, err := d.GetContinuousAggregateInfo(systemKey, collectionName, name)
+		if err != nil {
+			return nil, err
+		}
+		schema.ContinuousAggregates = append(schema.ContinuousAggregates, ContinuousAggregateSchema{Name: name, ContinuousAggregateOptions: agg.ContinuousAggregateOptions})
+	}
+	return schema, nil
+}
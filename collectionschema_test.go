@@ -0,0 +1,108 @@
+package GoSDK
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// schemaPlatform serves the calls PlanSchema makes for one existing collection
+func schemaPlatform(info map[string]interface{}, indexes interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case strings.HasSuffix(path, "/allcollections"):
+			writeJSON(w, http.StatusOK, []interface{}{map[string]interface{}{"name": "readings", "collectionID": "cid"}})
+		case strings.HasSuffix(path, "/collectionmanagement"):
+			writeJSON(w, http.StatusOK, info)
+		case strings.HasSuffix(path, "/cid/columns"):
+			writeJSON(w, http.StatusOK, []interface{}{
+				map[string]interface{}{"ColumnName": "item_id", "ColumnType": "string", "PK": true},
+				map[string]interface{}{"ColumnName": "ts", "ColumnType": "timestamp"},
+				map[string]interface{}{"ColumnName": "value", "ColumnType": "float"},
+			})
+		case strings.HasSuffix(path, "/listindexes"):
+			writeJSON(w, http.StatusOK, indexes)
+		case strings.HasSuffix(path, "/listcontinuousaggregates"):
+			writeJSON(w, http.StatusOK, []interface{}{})
+		default:
+			writeJSON(w, http.StatusNotFound, "unexpected call to "+path)
+		}
+	}
+}
+
+var readingsSchema = CollectionSchema{
+	Name:       "readings",
+	Columns:    []SchemaColumn{{Name: "ts", Type: "timestamp"}, {Name: "value", Type: "float"}},
+	Indexes:    []string{"value"},
+	Hypertable: &HypertableOptions{TimeColumn: "ts"},
+}
+
+func TestPlanSchemaOfExistingHypertableIsEmpty(t *testing.T) {
+	info := map[string]interface{}{
+		"name":                  "readings",
+		"is_hypertable":         true,
+		"hypertable_properties": map[string]interface{}{"time_column": "ts"},
+	}
+	indexes := map[string]interface{}{"indexes": []interface{}{
+		map[string]interface{}{"name": "readings_value_idx", "column_name": "value", "unique": false},
+	}}
+	d := newTestDevClient(t, schemaPlatform(info, indexes))
+	plan, err := d.PlanSchema("system", readingsSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Fatalf("applying the schema again would change %+v", plan.Changes)
+	}
+}
+
+func TestPlanSchemaConvertsPlainTable(t *testing.T) {
+	info := map[string]interface{}{"name": "readings", "is_hypertable": false}
+	indexes := map[string]interface{}{"indexes": []interface{}{
+		map[string]interface{}{"name": "readings_value_idx", "column_name": "value"},
+	}}
+	d := newTestDevClient(t, schemaPlatform(info, indexes))
+	plan, err := d.PlanSchema("system", readingsSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Kind != SchemaConvertHypertable {
+		t.Fatalf("unexpected plan %+v", plan.Changes)
+	}
+}
+
+func TestPlanSchemaRejectsUnknownResponses(t *testing.T) {
+	goodIndexes := map[string]interface{}{"indexes": []interface{}{}}
+	tests := []struct {
+		name    string
+		info    map[string]interface{}
+		indexes interface{}
+	}{
+		{"info without is_hypertable", map[string]interface{}{"name": "readings", "isHypertable": true}, goodIndexes},
+		{"index list without indexes", map[string]interface{}{"is_hypertable": true}, map[string]interface{}{"unique_indexes": []interface{}{"value"}}},
+		{"index without column_name", map[string]interface{}{"is_hypertable": true}, map[string]interface{}{"indexes": []interface{}{
+			map[string]interface{}{"name": "readings_value_idx", "columnName": "value"},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDevClient(t, schemaPlatform(tt.info, tt.indexes))
+			if plan, err := d.PlanSchema("system", readingsSchema); err == nil {
+				t.Fatalf("planned %+v from an unknown response", plan.Changes)
+			}
+		})
+	}
+}
+
+func TestParseIndexList(t *testing.T) {
+	plain, unique, err := parseIndexList(map[string]interface{}{"indexes": []interface{}{
+		map[string]interface{}{"name": "a_idx", "column_name": "a"},
+		map[string]interface{}{"name": "b_key", "column_name": "b", "unique": true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plain["a"] || plain["b"] || !unique["b"] || unique["a"] {
+		t.Fatalf("got plain %v unique %v", plain, unique)
+	}
+}
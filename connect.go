@@ -2,6 +2,11 @@ package GoSDK
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 //This file provides the interface for establishing connect collections
@@ -16,136 +21,635 @@ type ConnectCollection interface {
 	Name() string
 }
 
+// ConnectCollectionValidator is implemented by configs that can check themselves before they are
+// sent to the platform. Every config in this package implements it.
+type ConnectCollectionValidator interface {
+	Validate() error
+}
+
+// ConnectCollectionParser builds a config from the map form produced by ToMap
+type ConnectCollectionParser func(m map[string]interface{}) (ConnectCollection, error)
+
+var (
+	connectTypesMu sync.RWMutex
+	connectTypes   = map[string]ConnectCollectionParser{}
+)
+
+func init() {
+	RegisterConnectCollectionType("mysql", parseMySqlConfig)
+	RegisterConnectCollectionType("mssql", parseMSSqlConfig)
+	RegisterConnectCollectionType("postgres", parsePostgresqlConfig)
+	// older platforms and callers use the long name
+	RegisterConnectCollectionType("postgresql", parsePostgresqlConfig)
+	RegisterConnectCollectionType("MongoDB", parseMongoDBConfig)
+	RegisterConnectCollectionType("sqlite", parseSQLiteConfig)
+	RegisterConnectCollectionType("snowflake", parseSnowflakeConfig)
+	RegisterConnectCollectionType("influxdb", parseInfluxDBConfig)
+	RegisterConnectCollectionType("redshift", parseRedshiftConfig)
+}
+
+// RegisterConnectCollectionType makes GenerateConnectCollection understand a new dbtype. Registering
+// an existing dbtype replaces its parser.
+func RegisterConnectCollectionType(dbtype string, parse ConnectCollectionParser) {
+	connectTypesMu.Lock()
+	defer connectTypesMu.Unlock()
+	connectTypes[dbtype] = parse
+}
+
+// ConnectCollectionTypes lists the registered dbtypes
+func ConnectCollectionTypes() []string {
+	connectTypesMu.RLock()
+	defer connectTypesMu.RUnlock()
+	return sortedKeys(connectTypes)
+}
+
+// GenerateConnectCollection turns the map form of a connect collection back into its config.
+// Mistyped fields are reported as errors, and the config must pass Validate, so maps missing
+// required fields are rejected rather than producing a half filled config.
+func GenerateConnectCollection(co map[string]interface{}) (ConnectCollection, error) {
+	dbtype, ok := co["dbtype"].(string)
+	if !ok {
+		return nil, fmt.Errorf("generateConnectCollection: dbtype field missing or is not a string")
+	}
+	connectTypesMu.RLock()
+	parse, ok := connectTypes[dbtype]
+	connectTypesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("generateConnectCollection: Unknown connect database type: '%s'", dbtype)
+	}
+	cc, err := parse(co)
+	if err != nil {
+		return nil, fmt.Errorf("generateConnectCollection: %s: %w", dbtype, err)
+	}
+	if err := validateConnectCollection(cc); err != nil {
+		return nil, fmt.Errorf("generateConnectCollection: %w", err)
+	}
+	return cc, nil
+}
+
+func validateConnectCollection(cc ConnectCollection) error {
+	if v, ok := cc.(ConnectCollectionValidator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// ConnectTLS configures an encrypted connection to the backing database. Certificates are PEM encoded.
+type ConnectTLS struct {
+	Enabled            bool
+	CACert             string
+	ClientCert         string
+	ClientKey          string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+func (t ConnectTLS) validate() error {
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("tls client cert and key must be set together")
+	}
+	if !t.Enabled && (t.CACert != "" || t.ClientCert != "" || t.ServerName != "" || t.InsecureSkipVerify) {
+		return fmt.Errorf("tls options are set but tls is not enabled")
+	}
+	return nil
+}
+
+func (t ConnectTLS) addTo(m map[string]interface{}) {
+	if !t.Enabled {
+		return
+	}
+	m["tls_enabled"] = true
+	setIfNotEmpty(m, "tls_ca_cert", t.CACert)
+	setIfNotEmpty(m, "tls_client_cert", t.ClientCert)
+	setIfNotEmpty(m, "tls_client_key", t.ClientKey)
+	setIfNotEmpty(m, "tls_server_name", t.ServerName)
+	if t.InsecureSkipVerify {
+		m["tls_skip_verify"] = true
+	}
+}
+
+func (f *connectFields) tls() ConnectTLS {
+	return ConnectTLS{
+		Enabled:            f.boolean("tls_enabled"),
+		CACert:             f.str("tls_ca_cert"),
+		ClientCert:         f.str("tls_client_cert"),
+		ClientKey:          f.str("tls_client_key"),
+		ServerName:         f.str("tls_server_name"),
+		InsecureSkipVerify: f.boolean("tls_skip_verify"),
+	}
+}
+
+// ConnectPool sizes the platform's connection pool to the backing database. Zero values leave the
+// platform defaults in place.
+type ConnectPool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+func (p ConnectPool) validate() error {
+	if p.MaxOpenConns < 0 || p.MaxIdleConns < 0 || p.ConnMaxLifetime < 0 {
+		return fmt.Errorf("connection pool options cannot be negative")
+	}
+	if p.MaxOpenConns > 0 && p.MaxIdleConns > p.MaxOpenConns {
+		return fmt.Errorf("max idle connections (%d) exceeds max open connections (%d)", p.MaxIdleConns, p.MaxOpenConns)
+	}
+	return nil
+}
+
+func (p ConnectPool) addTo(m map[string]interface{}) {
+	if p.MaxOpenConns != 0 {
+		m["max_open_conns"] = p.MaxOpenConns
+	}
+	if p.MaxIdleConns != 0 {
+		m["max_idle_conns"] = p.MaxIdleConns
+	}
+	if p.ConnMaxLifetime != 0 {
+		m["conn_max_lifetime"] = p.ConnMaxLifetime.String()
+	}
+}
+
+func (f *connectFields) pool() ConnectPool {
+	return ConnectPool{
+		MaxOpenConns:    f.integer("max_open_conns"),
+		MaxIdleConns:    f.integer("max_idle_conns"),
+		ConnMaxLifetime: f.duration("conn_max_lifetime"),
+	}
+}
+
 // MySqlConfig houses configuration information for an MySql-backed collection
 type MySqlConfig struct {
 	ColName, User, Password, Host, Port, DBName, Tablename string
+	TLS                                                    ConnectTLS
+	Pool                                                   ConnectPool
 }
 
 func (my MySqlConfig) TableName() string { return my.Tablename }
 func (my MySqlConfig) Name() string      { return my.ColName }
 
 func (my MySqlConfig) ToMap() map[string]interface{} {
-	m := make(map[string]interface{})
-	m["name"] = my.ColName
-	m["user"] = my.User
-	m["password"] = my.Password
-	m["address"] = my.Host
-	m["port"] = my.Port
-	m["dbname"] = my.DBName
-	m["tablename"] = my.Tablename
-	m["dbtype"] = "mysql"
+	m := serverConnectMap("mysql", my.ColName, my.User, my.Password, my.Host, my.Port, my.DBName, my.Tablename)
+	my.TLS.addTo(m)
+	my.Pool.addTo(m)
 	return m
 }
 
+func (my MySqlConfig) Validate() error {
+	return validateServerConfig("mysql", my.ColName, my.Host, my.Port, my.DBName, my.Tablename, my.TLS, my.Pool)
+}
+
+func parseMySqlConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &MySqlConfig{
+		User:      f.str("user"),
+		Password:  f.str("password"),
+		Host:      f.str("address"),
+		Port:      f.str("port"),
+		DBName:    f.str("dbname"),
+		Tablename: f.str("tablename"),
+		ColName:   f.str("name"),
+		TLS:       f.tls(),
+		Pool:      f.pool(),
+	}
+	return cfg, f.err()
+}
+
 // MSSqlConfig houses configuration information for an MSSql-backed collection
 type MSSqlConfig struct {
 	ColName, User, Password, Host, Port, DBName, Tablename string
+	TLS                                                    ConnectTLS
+	Pool                                                   ConnectPool
 }
 
 func (ms MSSqlConfig) TableName() string { return ms.Tablename }
-func (ms MSSqlConfig) Name() string      { return ms.Tablename }
+func (ms MSSqlConfig) Name() string      { return ms.ColName }
 
 func (ms MSSqlConfig) ToMap() map[string]interface{} {
-	m := make(map[string]interface{})
-	m["user"] = ms.User
-	m["password"] = ms.Password
-	m["address"] = ms.Host
-	m["port"] = ms.Port
-	m["dbname"] = ms.DBName
-	m["tablename"] = ms.Tablename
-	m["dbtype"] = "mssql"
-	m["name"] = ms.ColName
+	m := serverConnectMap("mssql", ms.ColName, ms.User, ms.Password, ms.Host, ms.Port, ms.DBName, ms.Tablename)
+	ms.TLS.addTo(m)
+	ms.Pool.addTo(m)
 	return m
 }
 
+func (ms MSSqlConfig) Validate() error {
+	return validateServerConfig("mssql", ms.ColName, ms.Host, ms.Port, ms.DBName, ms.Tablename, ms.TLS, ms.Pool)
+}
+
+func parseMSSqlConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &MSSqlConfig{
+		User:      f.str("user"),
+		Password:  f.str("password"),
+		Host:      f.str("address"),
+		Port:      f.str("port"),
+		DBName:    f.str("dbname"),
+		Tablename: f.str("tablename"),
+		ColName:   f.str("name"),
+		TLS:       f.tls(),
+		Pool:      f.pool(),
+	}
+	return cfg, f.err()
+}
+
 // PostgresqlConfig houses configuration information for an Postgresql-backed collection
 type PostgresqlConfig struct {
 	ColName, User, Password, Host, Port, DBName, Tablename string
+	TLS                                                    ConnectTLS
+	Pool                                                   ConnectPool
 }
 
 func (pg PostgresqlConfig) ToMap() map[string]interface{} {
-	m := make(map[string]interface{})
-	m["user"] = pg.User
-	m["password"] = pg.Password
-	m["address"] = pg.Host
-	m["port"] = pg.Port
-	m["dbname"] = pg.DBName
-	m["tablename"] = pg.Tablename
-	m["dbtype"] = "postgres"
-	m["name"] = pg.ColName
+	m := serverConnectMap("postgres", pg.ColName, pg.User, pg.Password, pg.Host, pg.Port, pg.DBName, pg.Tablename)
+	pg.TLS.addTo(m)
+	pg.Pool.addTo(m)
 	return m
 }
 
 func (pg PostgresqlConfig) TableName() string { return pg.Tablename }
-func (pg PostgresqlConfig) Name() string      { return pg.Tablename }
+func (pg PostgresqlConfig) Name() string      { return pg.ColName }
+
+func (pg PostgresqlConfig) Validate() error {
+	return validateServerConfig("postgres", pg.ColName, pg.Host, pg.Port, pg.DBName, pg.Tablename, pg.TLS, pg.Pool)
+}
+
+func parsePostgresqlConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &PostgresqlConfig{
+		User:      f.str("user"),
+		Password:  f.str("password"),
+		Host:      f.str("address"),
+		Port:      f.str("port"),
+		DBName:    f.str("dbname"),
+		Tablename: f.str("tablename"),
+		ColName:   f.str("name"),
+		TLS:       f.tls(),
+		Pool:      f.pool(),
+	}
+	return cfg, f.err()
+}
 
 type MongoDBConfig struct {
 	ColName, User, Password, Host, Port, DBName, Tablename string
+	TLS                                                    ConnectTLS
+	Pool                                                   ConnectPool
 }
 
 func (mg MongoDBConfig) ToMap() map[string]interface{} {
-	m := make(map[string]interface{})
-	m["user"] = mg.User
-	m["password"] = mg.Password
-	m["address"] = mg.Host
-	m["port"] = mg.Port
-	m["dbname"] = mg.DBName
-	m["tablename"] = mg.Tablename
-	m["dbtype"] = "MongoDB"
-	m["name"] = mg.ColName
+	m := serverConnectMap("MongoDB", mg.ColName, mg.User, mg.Password, mg.Host, mg.Port, mg.DBName, mg.Tablename)
+	mg.TLS.addTo(m)
+	mg.Pool.addTo(m)
 	return m
 }
 
 func (mg MongoDBConfig) TableName() string { return mg.Tablename }
-func (mg MongoDBConfig) Name() string      { return mg.Tablename }
+func (mg MongoDBConfig) Name() string      { return mg.ColName }
 
-func GenerateConnectCollection(co map[string]interface{}) (ConnectCollection, error) {
-	dbtype, ok := co["dbtype"].(string)
-	if !ok {
-		return nil, fmt.Errorf("generateConnectCollection: dbtype field missing or is not a string")
+func (mg MongoDBConfig) Validate() error {
+	return validateServerConfig("MongoDB", mg.ColName, mg.Host, mg.Port, mg.DBName, mg.Tablename, mg.TLS, mg.Pool)
+}
+
+func parseMongoDBConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &MongoDBConfig{
+		User:      f.str("user"),
+		Password:  f.str("password"),
+		Host:      f.str("address"),
+		Port:      f.str("port"),
+		DBName:    f.str("dbname"),
+		Tablename: f.str("tablename"),
+		ColName:   f.str("name"),
+		TLS:       f.tls(),
+		Pool:      f.pool(),
 	}
-	switch dbtype {
-	case "mysql":
-		return &MySqlConfig{
-			User:      co["user"].(string),
-			Password:  co["password"].(string),
-			Host:      co["address"].(string),
-			Port:      co["port"].(string),
-			DBName:    co["dbname"].(string),
-			Tablename: co["tablename"].(string),
-			ColName:   co["name"].(string),
-		}, nil
-	case "mssql":
-		return &MSSqlConfig{
-			User:      co["user"].(string),
-			Password:  co["password"].(string),
-			Host:      co["address"].(string),
-			Port:      co["port"].(string),
-			DBName:    co["dbname"].(string),
-			Tablename: co["tablename"].(string),
-			ColName:   co["name"].(string),
-		}, nil
-	case "postgresql":
-		return &PostgresqlConfig{
-			User:      co["user"].(string),
-			Password:  co["password"].(string),
-			Host:      co["address"].(string),
-			Port:      co["port"].(string),
-			DBName:    co["dbname"].(string),
-			Tablename: co["tablename"].(string),
-			ColName:   co["name"].(string),
-		}, nil
-	case "MongoDB":
-		return &MongoDBConfig{
-			User:      co["user"].(string),
-			Password:  co["password"].(string),
-			Host:      co["address"].(string),
-			Port:      co["port"].(string),
-			DBName:    co["dbname"].(string),
-			Tablename: co["tablename"].(string),
-			ColName:   co["name"].(string),
-		}, nil
+	return cfg, f.err()
+}
+
+// RedshiftConfig houses configuration information for an Amazon Redshift-backed collection
+type RedshiftConfig struct {
+	ColName, User, Password, Host, Port, DBName, Schema, Tablename string
+	TLS                                                            ConnectTLS
+	Pool                                                           ConnectPool
+}
+
+func (rs RedshiftConfig) ToMap() map[string]interface{} {
+	m := serverConnectMap("redshift", rs.ColName, rs.User, rs.Password, rs.Host, rs.Port, rs.DBName, rs.Tablename)
+	setIfNotEmpty(m, "schema", rs.Schema)
+	rs.TLS.addTo(m)
+	rs.Pool.addTo(m)
+	return m
+}
+
+func (rs RedshiftConfig) TableName() string { return rs.Tablename }
+func (rs RedshiftConfig) Name() string      { return rs.ColName }
+
+func (rs RedshiftConfig) Validate() error {
+	return validateServerConfig("redshift", rs.ColName, rs.Host, rs.Port, rs.DBName, rs.Tablename, rs.TLS, rs.Pool)
+}
+
+func parseRedshiftConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &RedshiftConfig{
+		User:      f.str("user"),
+		Password:  f.str("password"),
+		Host:      f.str("address"),
+		Port:      f.str("port"),
+		DBName:    f.str("dbname"),
+		Schema:    f.str("schema"),
+		Tablename: f.str("tablename"),
+		ColName:   f.str("name"),
+		TLS:       f.tls(),
+		Pool:      f.pool(),
+	}
+	return cfg, f.err()
+}
+
+// SQLiteConfig houses configuration information for a collection backed by a SQLite file on the
+// platform or edge host
+type SQLiteConfig struct {
+	ColName, Path, Tablename string
+	Pool                     ConnectPool
+}
+
+func (sl SQLiteConfig) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"name":      sl.ColName,
+		"path":      sl.Path,
+		"tablename": sl.Tablename,
+		"dbtype":    "sqlite",
+	}
+	sl.Pool.addTo(m)
+	return m
+}
+
+func (sl SQLiteConfig) TableName() string { return sl.Tablename }
+func (sl SQLiteConfig) Name() string      { return sl.ColName }
+
+func (sl SQLiteConfig) Validate() error {
+	if err := requireConnectFields("sqlite", map[string]string{"name": sl.ColName, "path": sl.Path, "tablename": sl.Tablename}); err != nil {
+		return err
+	}
+	if err := sl.Pool.validate(); err != nil {
+		return fmt.Errorf("sqlite connect collection %s: %w", sl.ColName, err)
+	}
+	return nil
+}
+
+func parseSQLiteConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &SQLiteConfig{
+		ColName:   f.str("name"),
+		Path:      f.str("path"),
+		Tablename: f.str("tablename"),
+		Pool:      f.pool(),
+	}
+	return cfg, f.err()
+}
+
+// SnowflakeConfig houses configuration information for a Snowflake-backed collection. Snowflake
+// connections are always encrypted so there are no TLS options.
+type SnowflakeConfig struct {
+	ColName, User, Password, Account, Warehouse, Role, DBName, Schema, Tablename string
+	Pool                                                                         ConnectPool
+}
+
+func (sf SnowflakeConfig) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"name":      sf.ColName,
+		"user":      sf.User,
+		"password":  sf.Password,
+		"account":   sf.Account,
+		"dbname":    sf.DBName,
+		"tablename": sf.Tablename,
+		"dbtype":    "snowflake",
+	}
+	setIfNotEmpty(m, "warehouse", sf.Warehouse)
+	setIfNotEmpty(m, "role", sf.Role)
+	setIfNotEmpty(m, "schema", sf.Schema)
+	sf.Pool.addTo(m)
+	return m
+}
+
+func (sf SnowflakeConfig) TableName() string { return sf.Tablename }
+func (sf SnowflakeConfig) Name() string      { return sf.ColName }
+
+func (sf SnowflakeConfig) Validate() error {
+	if err := requireConnectFields("snowflake", map[string]string{"name": sf.ColName, "user": sf.User, "account": sf.Account, "dbname": sf.DBName, "tablename": sf.Tablename}); err != nil {
+		return err
+	}
+	if err := sf.Pool.validate(); err != nil {
+		return fmt.Errorf("snowflake connect collection %s: %w", sf.ColName, err)
+	}
+	return nil
+}
+
+func parseSnowflakeConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &SnowflakeConfig{
+		ColName:   f.str("name"),
+		User:      f.str("user"),
+		Password:  f.str("password"),
+		Account:   f.str("account"),
+		Warehouse: f.str("warehouse"),
+		Role:      f.str("role"),
+		DBName:    f.str("dbname"),
+		Schema:    f.str("schema"),
+		Tablename: f.str("tablename"),
+		Pool:      f.pool(),
+	}
+	return cfg, f.err()
+}
+
+// InfluxDBConfig houses configuration information for an InfluxDB 2.x-backed collection. The
+// measurement plays the role of the table.
+type InfluxDBConfig struct {
+	ColName, Host, Port, Org, Bucket, Token, Measurement string
+	TLS                                                  ConnectTLS
+}
+
+func (in InfluxDBConfig) ToMap() map[string]interface{} {
+	m := map[string]interface{}{
+		"name":      in.ColName,
+		"address":   in.Host,
+		"port":      in.Port,
+		"org":       in.Org,
+		"bucket":    in.Bucket,
+		"token":     in.Token,
+		"tablename": in.Measurement,
+		"dbtype":    "influxdb",
+	}
+	in.TLS.addTo(m)
+	return m
+}
+
+func (in InfluxDBConfig) TableName() string { return in.Measurement }
+func (in InfluxDBConfig) Name() string      { return in.ColName }
+
+func (in InfluxDBConfig) Validate() error {
+	if err := requireConnectFields("influxdb", map[string]string{"name": in.ColName, "address": in.Host, "org": in.Org, "bucket": in.Bucket, "tablename": in.Measurement}); err != nil {
+		return err
+	}
+	if err := validatePort(in.Port); err != nil {
+		return fmt.Errorf("influxdb connect collection %s: %w", in.ColName, err)
+	}
+	if err := in.TLS.validate(); err != nil {
+		return fmt.Errorf("influxdb connect collection %s: %w", in.ColName, err)
+	}
+	return nil
+}
+
+func parseInfluxDBConfig(co map[string]interface{}) (ConnectCollection, error) {
+	f := &connectFields{m: co}
+	cfg := &InfluxDBConfig{
+		ColName:     f.str("name"),
+		Host:        f.str("address"),
+		Port:        f.str("port"),
+		Org:         f.str("org"),
+		Bucket:      f.str("bucket"),
+		Token:       f.str("token"),
+		Measurement: f.str("tablename"),
+		TLS:         f.tls(),
+	}
+	return cfg, f.err()
+}
+
+func serverConnectMap(dbtype, name, user, password, host, port, dbname, table string) map[string]interface{} {
+	m := make(map[string]interface{})
+	m["user"] = user
+	m["password"] = password
+	m["address"] = host
+	m["port"] = port
+	m["dbname"] = dbname
+	m["tablename"] = table
+	m["dbtype"] = dbtype
+	m["name"] = name
+	return m
+}
+
+func validateServerConfig(dbtype, name, host, port, dbname, table string, tls ConnectTLS, pool ConnectPool) error {
+	if err := requireConnectFields(dbtype, map[string]string{"name": name, "address": host, "dbname": dbname, "tablename": table}); err != nil {
+		return err
+	}
+	if err := validatePort(port); err != nil {
+		return fmt.Errorf("%s connect collection %s: %w", dbtype, name, err)
+	}
+	if err := tls.validate(); err != nil {
+		return fmt.Errorf("%s connect collection %s: %w", dbtype, name, err)
+	}
+	if err := pool.validate(); err != nil {
+		return fmt.Errorf("%s connect collection %s: %w", dbtype, name, err)
+	}
+	return nil
+}
+
+func requireConnectFields(dbtype string, fields map[string]string) error {
+	missing := []string{}
+	for key, val := range fields {
+		if strings.TrimSpace(val) == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%s connect collection is missing %s", dbtype, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// validatePort allows an empty port so the driver default is used
+func validatePort(port string) error {
+	if port == "" {
+		return nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+func setIfNotEmpty(m map[string]interface{}, key, val string) {
+	if val != "" {
+		m[key] = val
+	}
+}
+
+// connectFields reads the map form of a config, collecting type errors instead of panicking.
+// Absent fields read as zero values and are left to Validate.
+type connectFields struct {
+	m    map[string]interface{}
+	errs []string
+}
+
+func (f *connectFields) str(key string) string {
+	switch v := f.m[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		// ports sometimes come back from the platform as numbers
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
 	default:
-		return nil, fmt.Errorf("generateConnectCollection: Unknown connect database type: '%s'\n", dbtype)
+		f.errs = append(f.errs, fmt.Sprintf("%s should be a string, got %T", key, v))
+		return ""
+	}
+}
+
+func (f *connectFields) integer(key string) int {
+	v, ok := f.m[key]
+	if !ok || v == nil {
+		return 0
+	}
+	i, err := iWantAnInt(v)
+	if err != nil {
+		f.errs = append(f.errs, fmt.Sprintf("%s should be an integer: %v", key, err))
+		return 0
+	}
+	return i
+}
+
+func (f *connectFields) boolean(key string) bool {
+	switch v := f.m[key].(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			f.errs = append(f.errs, fmt.Sprintf("%s should be a boolean, got %q", key, v))
+		}
+		return b
+	default:
+		f.errs = append(f.errs, fmt.Sprintf("%s should be a boolean, got %T", key, v))
+		return false
+	}
+}
+
+func (f *connectFields) duration(key string) time.Duration {
+	switch v := f.m[key].(type) {
+	case nil:
+		return 0
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			f.errs = append(f.errs, fmt.Sprintf("%s should be a duration, got %q", key, v))
+		}
+		return d
+	case float64:
+		// bare numbers are seconds
+		return time.Duration(v * float64(time.Second))
+	default:
+		f.errs = append(f.errs, fmt.Sprintf("%s should be a duration, got %T", key, v))
+		return 0
+	}
+}
+
+func (f *connectFields) err() error {
+	if len(f.errs) == 0 {
+		return nil
 	}
+	return fmt.Errorf("%s", strings.Join(f.errs, "; "))
 }
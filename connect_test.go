@@ -0,0 +1,202 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func TestConnectCollectionRoundTrip(t *testing.T) {
+	tls := ConnectTLS{Enabled: true, CACert: "ca", ClientCert: "cert", ClientKey: "key", ServerName: "db.internal"}
+	pool := ConnectPool{MaxOpenConns: 10, MaxIdleConns: 2, ConnMaxLifetime: 5 * time.Minute}
+	configs := []ConnectCollection{
+		&MySqlConfig{ColName: "c", User: "u", Password: "p", Host: "h", Port: "3306", DBName: "d", Tablename: "t", TLS: tls, Pool: pool},
+		&MSSqlConfig{ColName: "c", User: "u", Password: "p", Host: "h", Port: "1433", DBName: "d", Tablename: "t"},
+		&PostgresqlConfig{ColName: "c", User: "u", Password: "p", Host: "h", Port: "5432", DBName: "d", Tablename: "t", Pool: pool},
+		&MongoDBConfig{ColName: "c", User: "u", Password: "p", Host: "h", DBName: "d", Tablename: "t", TLS: ConnectTLS{Enabled: true, InsecureSkipVerify: true}},
+		&RedshiftConfig{ColName: "c", User: "u", Password: "p", Host: "h", Port: "5439", DBName: "d", Schema: "s", Tablename: "t", TLS: tls},
+		&SQLiteConfig{ColName: "c", Path: "/data/app.db", Tablename: "t", Pool: ConnectPool{MaxOpenConns: 1}},
+		&SnowflakeConfig{ColName: "c", User: "u", Password: "p", Account: "acct", Warehouse: "w", Role: "r", DBName: "d", Schema: "s", Tablename: "t"},
+		&InfluxDBConfig{ColName: "c", Host: "h", Port: "8086", Org: "o", Bucket: "b", Token: "tok", Measurement: "m", TLS: tls},
+	}
+	for _, cfg := range configs {
+		t.Run(reflect.TypeOf(cfg).Elem().Name(), func(t *testing.T) {
+			// go through JSON so numbers come back as float64, the way the platform returns them
+			raw, err := json.Marshal(cfg.ToMap())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m map[string]interface{}
+			if err := json.Unmarshal(raw, &m); err != nil {
+				t.Fatal(err)
+			}
+			got, err := GenerateConnectCollection(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, cfg) {
+				t.Fatalf("round trip gave %+v, want %+v", got, cfg)
+			}
+		})
+	}
+}
+
+// connectGenerators builds a random valid config for every registered dbtype
+var connectGenerators = map[string]func(r *rand.Rand) ConnectCollection{
+	"mysql": func(r *rand.Rand) ConnectCollection {
+		return &MySqlConfig{ColName: genName(r), User: genText(r), Password: genText(r), Host: genName(r), Port: genPort(r),
+			DBName: genName(r), Tablename: genName(r), TLS: genTLS(r), Pool: genPool(r)}
+	},
+	"mssql": func(r *rand.Rand) ConnectCollection {
+		return &MSSqlConfig{ColName: genName(r), User: genText(r), Password: genText(r), Host: genName(r), Port: genPort(r),
+			DBName: genName(r), Tablename: genName(r), TLS: genTLS(r), Pool: genPool(r)}
+	},
+	"postgres": func(r *rand.Rand) ConnectCollection {
+		return &PostgresqlConfig{ColName: genName(r), User: genText(r), Password: genText(r), Host: genName(r), Port: genPort(r),
+			DBName: genName(r), Tablename: genName(r), TLS: genTLS(r), Pool: genPool(r)}
+	},
+	"MongoDB": func(r *rand.Rand) ConnectCollection {
+		return &MongoDBConfig{ColName: genName(r), User: genText(r), Password: genText(r), Host: genName(r), Port: genPort(r),
+			DBName: genName(r), Tablename: genName(r), TLS: genTLS(r), Pool: genPool(r)}
+	},
+	"redshift": func(r *rand.Rand) ConnectCollection {
+		return &RedshiftConfig{ColName: genName(r), User: genText(r), Password: genText(r), Host: genName(r), Port: genPort(r),
+			DBName: genName(r), Schema: genText(r), Tablename: genName(r), TLS: genTLS(r), Pool: genPool(r)}
+	},
+	"sqlite": func(r *rand.Rand) ConnectCollection {
+		return &SQLiteConfig{ColName: genName(r), Path: genName(r), Tablename: genName(r), Pool: genPool(r)}
+	},
+	"snowflake": func(r *rand.Rand) ConnectCollection {
+		return &SnowflakeConfig{ColName: genName(r), User: genName(r), Password: genText(r), Account: genName(r), Warehouse: genText(r),
+			Role: genText(r), DBName: genName(r), Schema: genText(r), Tablename: genName(r), Pool: genPool(r)}
+	},
+	"influxdb": func(r *rand.Rand) ConnectCollection {
+		return &InfluxDBConfig{ColName: genName(r), Host: genName(r), Port: genPort(r), Org: genName(r), Bucket: genName(r),
+			Token: genText(r), Measurement: genName(r), TLS: genTLS(r)}
+	},
+}
+
+// connectAliases are dbtypes that parse into the config of another dbtype
+var connectAliases = map[string]string{"postgresql": "postgres"}
+
+var genRunes = []rune("abcXYZ019 _-./:@'\"\\%;\tçé日本🙂")
+
+// genText may be empty
+func genText(r *rand.Rand) string {
+	s := make([]rune, r.Intn(12))
+	for i := range s {
+		s[i] = genRunes[r.Intn(len(genRunes))]
+	}
+	return string(s)
+}
+
+// genName is never blank, so it can fill required fields
+func genName(r *rand.Rand) string {
+	return string(genRunes[r.Intn(3)]) + genText(r)
+}
+
+func genPort(r *rand.Rand) string {
+	if r.Intn(4) == 0 {
+		return ""
+	}
+	return strconv.Itoa(1 + r.Intn(65535))
+}
+
+func genTLS(r *rand.Rand) ConnectTLS {
+	if r.Intn(2) == 0 {
+		return ConnectTLS{}
+	}
+	t := ConnectTLS{Enabled: true, CACert: genText(r), ServerName: genText(r), InsecureSkipVerify: r.Intn(2) == 0}
+	if r.Intn(2) == 0 {
+		t.ClientCert, t.ClientKey = genName(r), genName(r)
+	}
+	return t
+}
+
+func genPool(r *rand.Rand) ConnectPool {
+	p := ConnectPool{MaxOpenConns: r.Intn(3) * r.Intn(200)}
+	if p.MaxOpenConns > 0 {
+		p.MaxIdleConns = r.Intn(p.MaxOpenConns + 1)
+	} else {
+		p.MaxIdleConns = r.Intn(3) * r.Intn(50)
+	}
+	if r.Intn(2) == 0 {
+		p.ConnMaxLifetime = time.Duration(r.Int63())
+	}
+	return p
+}
+
+func TestConnectCollectionRoundTripProperty(t *testing.T) {
+	for _, dbtype := range ConnectCollectionTypes() {
+		genType := dbtype
+		if alias, ok := connectAliases[dbtype]; ok {
+			genType = alias
+		}
+		gen, ok := connectGenerators[genType]
+		if !ok {
+			t.Errorf("no config generator for registered dbtype %q", dbtype)
+			continue
+		}
+		t.Run(dbtype, func(t *testing.T) {
+			roundTrips := func(seed int64) bool {
+				cfg := gen(rand.New(rand.NewSource(seed)))
+				if err := validateConnectCollection(cfg); err != nil {
+					t.Errorf("generated an invalid config %+v: %v", cfg, err)
+					return false
+				}
+				raw, err := json.Marshal(cfg.ToMap())
+				if err != nil {
+					t.Error(err)
+					return false
+				}
+				var m map[string]interface{}
+				if err := json.Unmarshal(raw, &m); err != nil {
+					t.Error(err)
+					return false
+				}
+				m["dbtype"] = dbtype
+				got, err := GenerateConnectCollection(m)
+				if err != nil {
+					t.Errorf("%s: %v", raw, err)
+					return false
+				}
+				if !reflect.DeepEqual(got, cfg) {
+					t.Errorf("round trip gave %+v, want %+v", got, cfg)
+					return false
+				}
+				return true
+			}
+			if err := quick.Check(roundTrips, &quick.Config{MaxCount: 300}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGenerateConnectCollectionRejectsInvalidConfigs(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[string]interface{}
+		want string
+	}{
+		{"unknown type", map[string]interface{}{"dbtype": "oracle"}, "Unknown connect database type"},
+		{"missing fields", map[string]interface{}{"dbtype": "mysql", "name": "c", "address": "h"}, "missing dbname, tablename"},
+		{"bad port", map[string]interface{}{"dbtype": "postgres", "name": "c", "address": "h", "dbname": "d", "tablename": "t", "port": "99999"}, "invalid port"},
+		{"mistyped field", map[string]interface{}{"dbtype": "sqlite", "name": "c", "path": true, "tablename": "t"}, "path should be a string"},
+		{"tls key without cert", map[string]interface{}{"dbtype": "mssql", "name": "c", "address": "h", "dbname": "d", "tablename": "t", "tls_enabled": true, "tls_client_key": "k"}, "cert and key"},
+		{"idle above open", map[string]interface{}{"dbtype": "sqlite", "name": "c", "path": "p", "tablename": "t", "max_open_conns": 1, "max_idle_conns": 2}, "exceeds max open"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateConnectCollection(tt.m)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package GoSDK
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -480,7 +481,7 @@ func deletedata(c cbClient, collection_id string, query *Query) error {
 	} else {
 		qry = nil
 	}
-	resp, err := delete(c, _DATA_PREAMBLE+collection_id, qry, creds, nil)
+	resp, err := del(c, _DATA_PREAMBLE+collection_id, qry, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting data: %v", err)
 	}
@@ -666,12 +667,12 @@ func addColumn(c cbClient, preamble, collection_id, column_name, column_type str
 }
 
 type CompressionOptions struct {
-	SegmentBy string    `json:"segment_by"`
-	Interval  TimeValue `json:"interval"`
+	SegmentBy string    `json:"segment_by" yaml:"segment_by"`
+	Interval  TimeValue `json:"interval" yaml:"interval"`
 }
 
 type TimeValue struct {
-	IntervalStr string `json:"interval_string"`
+	IntervalStr string `json:"interval_string" yaml:"interval_string"`
 }
 
 func (d *DevClient) CompressHypertable(systemKey, collectionName string, options CompressionOptions) error {
@@ -734,7 +735,7 @@ func (d *DevClient) DeleteCompressionPolicy(systemKey, collectionName string) er
 		return err
 	}
 
-	resp, err := delete(d, _DATA_NAME_PREAMBLE+systemKey+"/"+collectionName+"/compression", nil, creds, nil)
+	resp, err := del(d, _DATA_NAME_PREAMBLE+systemKey+"/"+collectionName+"/compression", nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("could not delete compression policy for hypertable %s in %s: %w", collectionName, systemKey, err)
 	}
@@ -856,7 +857,7 @@ func (d *DevClient) DeleteContinuousAggregate(systemKey, collectionName, aggrega
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _DATA_V4_PREAMBLE+"/collection/"+systemKey+"/"+collectionName+"/"+aggregateName+"/continuousaggregate", nil, creds, nil)
+	resp, err := del(d, _DATA_V4_PREAMBLE+"/collection/"+systemKey+"/"+collectionName+"/"+aggregateName+"/continuousaggregate", nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting continuous aggregate: %v", err)
 	}
@@ -990,7 +991,7 @@ func deleteCollection(c cbClient, preamble, colID string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(c, preamble+"/collectionmanagement", map[string]string{
+	resp, err := del(c, preamble+"/collectionmanagement", map[string]string{
 		"id": colID,
 	}, creds, nil)
 	if err != nil {
@@ -1088,7 +1089,7 @@ func dropUniqueIndex(c cbClient, systemKey, collectionName, columnToIndex string
 		return err
 	}
 	url := fmt.Sprintf("%scollection/%s/%s/uniqueindex?columnName=%s", _DATA_V4_PREAMBLE, systemKey, collectionName, columnToIndex)
-	resp, err := delete(c, url, nil, creds, nil)
+	resp, err := del(c, url, nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error sending request for dropping unique index: %v", err)
 	}
@@ -1116,7 +1117,7 @@ func dropIndex(c cbClient, systemKey, collectionName, columnToIndex string) erro
 		return err
 	}
 	url := fmt.Sprintf("%scollection/%s/%s/index?columnName=%s", _DATA_V4_PREAMBLE, systemKey, collectionName, columnToIndex)
-	resp, err := delete(c, url, nil, creds, nil)
+	resp, err := del(c, url, nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error sending request for dropping index: %v", err)
 	}
@@ -1183,15 +1184,22 @@ func listIndexeswithid(c cbClient, collectionID string) (map[string]interface{},
 }
 
 func (d *DevClient) RawExec(systemKey, query string, params []interface{}) error {
+	return d.rawExec(context.Background(), systemKey, query, params)
+}
+
+func (d *DevClient) rawExec(ctx context.Context, systemKey, query string, params []interface{}) error {
 	creds, err := d.credentials()
 	if err != nil {
 		return err
 	}
 	url := _DATA_V4_PREAMBLE + "database/" + systemKey + "/exec"
 	data := map[string]interface{}{"query": query, "params": params}
-	_, err = post(d, url, data, creds, nil)
+	resp, err := do(d, &CbReq{Body: data, Method: "POST", Endpoint: url, Context: ctx}, creds)
 	if err != nil {
-		return fmt.Errorf("Error executing %v with args %v: %v", query, params, err)
+		return fmt.Errorf("Error executing %v with args %v: %w", query, params, err)
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Error executing %v with args %v: %v", query, params, resp.Body)
 	}
 	return nil
 }
@@ -1207,19 +1215,26 @@ func (d *DevClient) RawQuery(systemKey, query string, params []interface{}) (map
 	if err != nil {
 		return nil, fmt.Errorf("Error executing %v with args %v: %v", query, params, err)
 	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Error executing %v with args %v: %v", query, params, resp.Body)
+	}
 	return resp.Body.(map[string]interface{}), nil
 }
 
 func (d *DevClient) RemoteEdgeDBRawExec(systemKey, edgeName, query string, params []interface{}) (int, error) {
+	return d.remoteEdgeDBRawExec(context.Background(), systemKey, edgeName, query, params)
+}
+
+func (d *DevClient) remoteEdgeDBRawExec(ctx context.Context, systemKey, edgeName, query string, params []interface{}) (int, error) {
 	creds, err := d.credentials()
 	if err != nil {
 		return -1, err
 	}
 	url := _DATA_V4_PREAMBLE + "database/" + systemKey + "/" + edgeName + "/exec"
 	data := map[string]interface{}{"query": query, "parameters": params}
-	resp, err := post(d, url, data, creds, nil)
+	resp, err := do(d, &CbReq{Body: data, Method: "POST", Endpoint: url, Context: ctx}, creds)
 	if err != nil {
-		return -1, fmt.Errorf("Error executing %v with args %v: %v", query, params, err)
+		return -1, fmt.Errorf("Error executing %v with args %v: %w", query, params, err)
 	}
 	if resp.StatusCode != 200 {
 		return -1, fmt.Errorf("Error executing remote edge db query: %v with args %v: %v", query, params, resp.Body)
@@ -1233,15 +1248,19 @@ func (d *DevClient) RemoteEdgeDBRawExec(systemKey, edgeName, query string, param
 }
 
 func (d *DevClient) RemoteEdgeDBRawQuery(systemKey, edgeName, query string, params []interface{}) ([]interface{}, error) {
+	return d.remoteEdgeDBRawQuery(context.Background(), systemKey, edgeName, query, params)
+}
+
+func (d *DevClient) remoteEdgeDBRawQuery(ctx context.Context, systemKey, edgeName, query string, params []interface{}) ([]interface{}, error) {
 	creds, err := d.credentials()
 	if err != nil {
 		return nil, err
 	}
 	url := _DATA_V4_PREAMBLE + "database/" + systemKey + "/" + edgeName + "/query"
 	data := map[string]interface{}{"query": query, "parameters": params}
-	resp, err := post(d, url, data, creds, nil)
+	resp, err := do(d, &CbReq{Body: data, Method: "POST", Endpoint: url, Context: ctx}, creds)
 	if err != nil {
-		return nil, fmt.Errorf("Error executing %v with args %v: %v", query, params, err)
+		return nil, fmt.Errorf("Error executing %v with args %v: %w", query, params, err)
 	}
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("Error executing remote edge db query: %v with args %v: %v", query, params, resp.Body)
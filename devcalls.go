@@ -104,7 +104,7 @@ func (d *DevClient) DeleteSystem(s string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, d.preamble()+"/systemmanagement", map[string]string{"id": s}, creds, nil)
+	resp, err := del(d, d.preamble()+"/systemmanagement", map[string]string{"id": s}, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting system: %v", err)
 	}
@@ -252,7 +252,7 @@ func (d *DevClient) DeleteRootCACertificate(systemKey string, query *Query) erro
 		"system_key": systemKey,
 		"query":      string(query_bytes),
 	}
-	_, err = delete(d, d.preamble()+"/systemmanagement/certificates", qry, creds, nil)
+	_, err = del(d, d.preamble()+"/systemmanagement/certificates", qry, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -320,7 +320,7 @@ func (d *DevClient) DeleteRegistryMapping(systemKey string) error {
 	if err != nil {
 		return err
 	}
-	_, err = delete(d, d.preamble()+"/systemmanagement/registrymapping", map[string]string{
+	_, err = del(d, d.preamble()+"/systemmanagement/registrymapping", map[string]string{
 		"system_key": systemKey,
 	}, creds, nil)
 	if err != nil {
@@ -354,13 +354,16 @@ func (d *DevClient) DevUserInfo() (map[string]interface{}, error) {
 
 // NewConnectCollection creates a new collection that is backed by a datastore of your own choosing.
 func (d *DevClient) NewConnectCollection(systemkey string, connectConfig ConnectCollection) (string, error) {
+	if err := validateConnectCollection(connectConfig); err != nil {
+		return "", err
+	}
 	creds, err := d.credentials()
-	m := connectConfig.ToMap()
-	m["appID"] = systemkey
-	m["name"] = connectConfig.Name()
 	if err != nil {
 		return "", err
 	}
+	m := connectConfig.ToMap()
+	m["appID"] = systemkey
+	m["name"] = connectConfig.Name()
 	resp, err := post(d, d.preamble()+"/collectionmanagement", m, creds, nil)
 	if err != nil {
 		return "", fmt.Errorf("Error creating collection: %s", err.Error())
@@ -368,12 +371,22 @@ func (d *DevClient) NewConnectCollection(systemkey string, connectConfig Connect
 	if resp.StatusCode != 200 {
 		return "", fmt.Errorf("Error creating collection %v\n", resp.Body)
 	}
-	return resp.Body.(map[string]interface{})["collectionID"].(string), nil
+	id, ok := resp.Body.(map[string]interface{})["collectionID"].(string)
+	if !ok {
+		return "", fmt.Errorf("Error creating collection: no collection id in %v", resp.Body)
+	}
+	return id, nil
 }
 
 // AlterConnectionDetails allows the developer to change or add connection information, such as updating a username
 func (d *DevClient) AlterConnectionDetails(systemkey string, connectConfig ConnectCollection) error {
+	if err := validateConnectCollection(connectConfig); err != nil {
+		return err
+	}
 	creds, err := d.credentials()
+	if err != nil {
+		return err
+	}
 	out := make(map[string]interface{})
 	m := connectConfig.ToMap()
 	out["appID"] = systemkey
@@ -701,7 +714,7 @@ func (d *DevClient) DeleteRole(systemKey, roleId string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, d.preamble()+"/user/"+systemKey+"/roles", map[string]string{"role": roleId}, creds, nil)
+	resp, err := del(d, d.preamble()+"/user/"+systemKey+"/roles", map[string]string{"role": roleId}, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -745,7 +758,7 @@ func (d *DevClient) DeleteUser(systemKey, userId string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, d.preamble()+"/user/"+systemKey, map[string]string{"user": userId}, creds, nil)
+	resp, err := del(d, d.preamble()+"/user/"+systemKey, map[string]string{"user": userId}, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -1232,11 +1245,11 @@ func (d *DevClient) GetEdgeSyncStatus(systemKey, edge string) ([]map[string]inte
 }
 
 func (d *DevClient) credentials() ([][]string, error) {
-	if d.DevToken != "" {
+	if tok := d.getToken(); tok != "" {
 		return [][]string{
 			[]string{
 				_DEV_HEADER_KEY,
-				d.DevToken,
+				tok,
 			},
 		}, nil
 	} else {
@@ -1253,21 +1266,33 @@ func (d *DevClient) getSystemInfo() (string, string) {
 }
 
 func (d *DevClient) setToken(t string) {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
 	d.DevToken = t
 }
 func (d *DevClient) getToken() string {
+	d.tokenMu.RLock()
+	defer d.tokenMu.RUnlock()
 	return d.DevToken
 }
 func (d *DevClient) getRefreshToken() string {
+	d.tokenMu.RLock()
+	defer d.tokenMu.RUnlock()
 	return d.RefreshToken
 }
 func (d *DevClient) setRefreshToken(body map[string]interface{}) {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
 	d.RefreshToken = nicelySetRefreshToken(body)
 }
 func (d *DevClient) setExpiresAt(t float64) {
+	d.tokenMu.Lock()
+	defer d.tokenMu.Unlock()
 	d.ExpiresAt = t
 }
 func (d *DevClient) getExpiresAt() float64 {
+	d.tokenMu.RLock()
+	defer d.tokenMu.RUnlock()
 	return d.ExpiresAt
 }
 
@@ -1322,7 +1347,7 @@ func (d *DevClient) DeleteMessageTypeTriggers(systemKey string) error {
 	} else if len(creds) != 1 {
 		return fmt.Errorf("Error deleting mesage type triggers: No DevToken Supplied")
 	}
-	resp, err := delete(d, d.preamble()+"/"+systemKey+"/msgtypetriggers", nil, creds, nil)
+	resp, err := del(d, d.preamble()+"/"+systemKey+"/msgtypetriggers", nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting mesage type triggers: %v", err)
 	}
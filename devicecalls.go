@@ -120,7 +120,7 @@ func (d *DevClient) DeleteDevicePublicKey(systemKey, deviceName string, query *Q
 	qry := map[string]string{
 		"query": string(query_bytes),
 	}
-	_, err = delete(d, _DEVICE_PUBKEY_PREAMBLE+systemKey+"/"+deviceName, qry, creds, nil)
+	_, err = del(d, _DEVICE_PUBKEY_PREAMBLE+systemKey+"/"+deviceName, qry, creds, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +252,7 @@ func deleteDevices(client cbClient, systemKey string, preamble string, query *Qu
 		return err
 	}
 
-	resp, err := delete(client, preamble+systemKey, qry, creds, nil)
+	resp, err := del(client, preamble+systemKey, qry, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
@@ -360,7 +360,7 @@ func (d *DeviceClient) AuthenticateDeviceWithKey(systemKey, name, activeKey stri
 	if !ok {
 		return nil, fmt.Errorf("Got unexpected return value from AuthenticateDeviceWithKey: %+v", theJewels)
 	}
-	d.DeviceToken = theJewels["deviceToken"].(string)
+	d.setToken(theJewels["deviceToken"].(string))
 	return theJewels, nil
 }
 
@@ -393,7 +393,7 @@ func (d *DeviceClient) AuthenticateDeviceWithMTLS(systemKey, name, certFile, pri
 	if !ok {
 		return nil, fmt.Errorf("Got unexpected return value from AuthenticateDeviceWithMTLS: %+v", theJewels)
 	}
-	d.DeviceToken = theJewels["deviceToken"].(string)
+	d.setToken(theJewels["deviceToken"].(string))
 	return theJewels, nil
 }
 
@@ -402,7 +402,7 @@ func (d *DevClient) DeleteDevice(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _DEVICES_DEV_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _DEVICES_DEV_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
@@ -412,7 +412,7 @@ func (d *DeviceClient) DeleteDevice(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _DEVICES_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _DEVICES_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
@@ -422,7 +422,7 @@ func (u *UserClient) DeleteDevice(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(u, _DEVICES_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(u, _DEVICES_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
@@ -514,7 +514,7 @@ func (d *DevClient) DeleteKeyset(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _DEVICES_DEV_PREAMBLE+"keys/"+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _DEVICES_DEV_PREAMBLE+"keys/"+systemKey+"/"+name, nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
@@ -566,7 +566,7 @@ func (d *DevClient) DeleteDeviceColumn(systemKey, columnName string) error {
 	}
 	data := map[string]string{"column_name": columnName}
 
-	resp, err := delete(d, _DEVICES_DEV_PREAMBLE+systemKey+"/columns", data, creds, nil)
+	resp, err := del(d, _DEVICES_DEV_PREAMBLE+systemKey+"/columns", data, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting device column: %v", err)
 	}
@@ -623,7 +623,7 @@ func (d *DevClient) DeleteDeviceSession(systemKey string, query *Query) error {
 	} else {
 		qry = nil
 	}
-	resp, err := delete(d, _DEVICE_SESSION+"/"+systemKey+"/device", qry, creds, nil)
+	resp, err := del(d, _DEVICE_SESSION+"/"+systemKey+"/device", qry, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting device session data: %v", err)
 	}
@@ -650,10 +650,10 @@ func (dvc *DeviceClient) credentials() ([][]string, error) {
 		}
 		return ret, nil
 	}
-	if dvc.DeviceToken != "" {
+	if tok := dvc.getToken(); tok != "" {
 		ret = append(ret, []string{
 			_DEVICE_HEADER_KEY,
-			dvc.DeviceToken,
+			tok,
 		})
 	}
 	if dvc.SystemKey != "" && dvc.SystemSecret != "" {
@@ -700,23 +700,35 @@ func (dvc *DeviceClient) preamble() string {
 }
 
 func (dvc *DeviceClient) setToken(tok string) {
+	dvc.tokenMu.Lock()
+	defer dvc.tokenMu.Unlock()
 	dvc.DeviceToken = tok
 }
 
 func (dvc *DeviceClient) getToken() string {
+	dvc.tokenMu.RLock()
+	defer dvc.tokenMu.RUnlock()
 	return dvc.DeviceToken
 }
 
 func (dvc *DeviceClient) getRefreshToken() string {
+	dvc.tokenMu.RLock()
+	defer dvc.tokenMu.RUnlock()
 	return dvc.RefreshToken
 }
 func (dvc *DeviceClient) setRefreshToken(body map[string]interface{}) {
+	dvc.tokenMu.Lock()
+	defer dvc.tokenMu.Unlock()
 	dvc.RefreshToken = nicelySetRefreshToken(body)
 }
 func (dvc *DeviceClient) setExpiresAt(t float64) {
+	dvc.tokenMu.Lock()
+	defer dvc.tokenMu.Unlock()
 	dvc.ExpiresAt = t
 }
 func (dvc *DeviceClient) getExpiresAt() float64 {
+	dvc.tokenMu.RLock()
+	defer dvc.tokenMu.RUnlock()
 	return dvc.ExpiresAt
 }
 
@@ -166,7 +166,7 @@ func deleteEdge(client cbClient, systemKey, preamble string, name string) error
 	if err != nil {
 		return err
 	}
-	resp, err := delete(client, preamble+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(client, preamble+systemKey+"/"+name, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
@@ -338,7 +338,7 @@ func (d *DevClient) DeleteEdgeColumn(systemKey, colName string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _EDGES_PREAMBLE+systemKey+"/columns", map[string]string{"column": colName}, creds, nil)
+	resp, err := del(d, _EDGES_PREAMBLE+systemKey+"/columns", map[string]string{"column": colName}, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
@@ -469,7 +469,7 @@ func (d *DevClient) DeleteEdgePublicKey(systemKey, edgeName string, query *Query
 	qry := map[string]string{
 		"query": string(query_bytes),
 	}
-	_, err = delete(d, _EDGES_PREAMBLE+"public_key/"+systemKey+"/"+edgeName, qry, creds, nil)
+	_, err = del(d, _EDGES_PREAMBLE+"public_key/"+systemKey+"/"+edgeName, qry, creds, nil)
 	if err != nil {
 		return nil, err
 	}
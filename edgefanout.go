@@ -0,0 +1,125 @@
+package GoSDK
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	_EDGE_FANOUT_DEFAULT_CONCURRENCY = 8
+	_EDGE_FANOUT_DEFAULT_TIMEOUT     = 30 * time.Second
+	_EDGE_FANOUT_DEFAULT_COLUMN      = "edge_name"
+)
+
+// EdgeQueryOptions controls QueryAllEdges. Zero values pick sane defaults.
+type EdgeQueryOptions struct {
+	// Concurrency is the number of edges queried at once
+	Concurrency int
+	// Timeout bounds the query against a single edge
+	Timeout time.Duration
+	// EdgeColumn is the column added to every row holding the edge name, "edge_name" by default
+	EdgeColumn string
+}
+
+// EdgeQueryResult holds the merged rows of a fan-out query. Rows are grouped by edge in name order.
+// Edges that failed are listed in Errors and contribute no rows.
+type EdgeQueryResult struct {
+	Rows      []map[string]interface{}
+	RowCounts map[string]int
+	Errors    map[string]error
+}
+
+// Err joins the per edge errors, or returns nil if every edge answered
+func (r *EdgeQueryResult) Err() error {
+	names := sortedKeys(r.Errors)
+	errs := make([]error, len(names))
+	for i, name := range names {
+		errs[i] = fmt.Errorf("edge %s: %w", name, r.Errors[name])
+	}
+	return errors.Join(errs...)
+}
+
+// QueryAllEdges runs sql against the database of every edge matching edgeQuery (all edges when nil)
+// and merges the rows. An error is only returned when the edges could not be listed or ctx ended
+// before any edge answered; per edge failures are reported in the result.
+func (d *DevClient) QueryAllEdges(ctx context.Context, systemKey string, edgeQuery *Query, sql string, params []interface{}, opts EdgeQueryOptions) (*EdgeQueryResult, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = _EDGE_FANOUT_DEFAULT_CONCURRENCY
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = _EDGE_FANOUT_DEFAULT_TIMEOUT
+	}
+	if opts.EdgeColumn == "" {
+		opts.EdgeColumn = _EDGE_FANOUT_DEFAULT_COLUMN
+	}
+	edges, err := d.GetEdgesWithQuery(systemKey, edgeQuery)
+	if err != nil {
+		return nil, fmt.Errorf("could not list edges: %w", err)
+	}
+	names := make([]string, 0, len(edges))
+	for _, e := range edges {
+		if m, ok := e.(map[string]interface{}); ok {
+			if name, ok := m["name"].(string); ok && name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	perEdge := make([][]map[string]interface{}, len(names))
+	result := &EdgeQueryResult{RowCounts: map[string]int{}, Errors: map[string]error{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, opts.Concurrency)
+	for i, name := range names {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			result.Errors[name] = ctx.Err()
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			rows, err := d.queryEdge(ctx, systemKey, name, sql, params, opts.Timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Errors[name] = err
+				return
+			}
+			for _, row := range rows {
+				row[opts.EdgeColumn] = name
+			}
+			perEdge[i] = rows
+			result.RowCounts[name] = len(rows)
+		}(i, name)
+	}
+	wg.Wait()
+
+	for _, rows := range perEdge {
+		result.Rows = append(result.Rows, rows...)
+	}
+	if len(names) > 0 && len(result.Errors) == len(names) && ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+func (d *DevClient) queryEdge(ctx context.Context, systemKey, edgeName, sql string, params []interface{}, timeout time.Duration) ([]map[string]interface{}, error) {
+	// the request itself is cancelled, so the slot is not freed while it is still running
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, err := d.remoteEdgeDBRawQuery(ctx, systemKey, edgeName, sql, params)
+	if err != nil {
+		return nil, err
+	}
+	return makeSliceOfMaps(resp)
+}
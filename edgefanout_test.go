@@ -0,0 +1,96 @@
+package GoSDK
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fanoutPlatform lists edges and answers their queries. Edges named in hang block until their
+// request is cancelled.
+type fanoutPlatform struct {
+	edges []string
+	hang  map[string]bool
+
+	mu        sync.Mutex
+	cancelled []string
+}
+
+func (p *fanoutPlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, _EDGES_PREAMBLE) {
+		edges := make([]map[string]interface{}, len(p.edges))
+		for i, name := range p.edges {
+			edges[i] = map[string]interface{}{"name": name}
+		}
+		writeJSON(w, 200, edges)
+		return
+	}
+	parts := strings.Split(r.URL.Path, "/")
+	edge := parts[len(parts)-2]
+	// the server only notices a dropped connection once the body has been read
+	io.Copy(io.Discard, r.Body)
+	if p.hang[edge] {
+		<-r.Context().Done()
+		p.mu.Lock()
+		p.cancelled = append(p.cancelled, edge)
+		p.mu.Unlock()
+		return
+	}
+	writeJSON(w, 200, []map[string]interface{}{{"value": 1}})
+}
+
+func TestQueryAllEdgesMergesRows(t *testing.T) {
+	p := &fanoutPlatform{edges: []string{"b", "a", "c"}}
+	d := newTestDevClient(t, p)
+	result, err := d.QueryAllEdges(context.Background(), "sys", nil, "SELECT 1 AS value", nil, EdgeQueryOptions{})
+	if err != nil || result.Err() != nil {
+		t.Fatal(err, result.Err())
+	}
+	if len(result.Rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(result.Rows))
+	}
+	for i, want := range []string{"a", "b", "c"} {
+		if result.Rows[i]["edge_name"] != want || result.RowCounts[want] != 1 {
+			t.Fatalf("row %d is %v, want edge %s", i, result.Rows[i], want)
+		}
+	}
+}
+
+func TestQueryAllEdgesTimeoutCancelsTheRequest(t *testing.T) {
+	p := &fanoutPlatform{edges: []string{"a", "b", "c"}, hang: map[string]bool{"a": true, "b": true}}
+	d := newTestDevClient(t, p)
+	result, err := d.QueryAllEdges(context.Background(), "sys", nil, "SELECT 1", nil, EdgeQueryOptions{
+		Concurrency: 1,
+		Timeout:     50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, edge := range []string{"a", "b"} {
+		if !errors.Is(result.Errors[edge], context.DeadlineExceeded) {
+			t.Fatalf("edge %s failed with %v, want a deadline error", edge, result.Errors[edge])
+		}
+	}
+	if result.RowCounts["c"] != 1 {
+		t.Fatalf("edge c was not queried: %v", result.Errors["c"])
+	}
+	// the abandoned requests must actually end rather than run on behind the freed slots
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.Lock()
+		n := len(p.cancelled)
+		p.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of 2 timed out requests were cancelled", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -56,7 +56,7 @@ func (d *DevClient) DeleteEdgeGroup(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, "/admin/"+systemKey+"/edge_groups/"+name, nil, creds, nil)
+	resp, err := del(d, "/admin/"+systemKey+"/edge_groups/"+name, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
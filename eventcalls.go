@@ -126,7 +126,7 @@ func deleteEventHandler(c cbClient, endpoint string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(c, endpoint, nil, creds, nil)
+	resp, err := del(c, endpoint, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
@@ -274,7 +274,7 @@ func deleteTimer(c cbClient, endpoint string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(c, endpoint, nil, creds, nil)
+	resp, err := del(c, endpoint, nil, creds, nil)
 	_, err = mapResponse(resp, err)
 	return err
 }
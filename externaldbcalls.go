@@ -117,7 +117,7 @@ func deleteExternalDBConnection(c cbClient, systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(c, _EXTERNAL_DB_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(c, _EXTERNAL_DB_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting external db connection: %v", err)
 	}
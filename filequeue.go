@@ -0,0 +1,219 @@
+package GoSDK
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+const _FILE_QUEUE_COMPACT_AFTER = 1000
+
+// fileQueueEntry is an entry of a fileQueue, ordered by its sequence number
+type fileQueueEntry interface {
+	sequence() uint64
+}
+
+// fileQueue is an ordered queue kept in an append-only file of JSON lines. Acknowledgements are
+// appended as well and the file is rewritten once they outnumber the pending entries. A rewritten
+// file starts with the next sequence number, so numbers are not reused after every entry is acked.
+type fileQueue[T fileQueueEntry] struct {
+	name    string
+	path    string
+	f       *os.File
+	pending []T
+	acks    int
+	nextSeq uint64
+	corrupt int
+}
+
+type fileQueueRecord[T any] struct {
+	Entry *T     `json:"m,omitempty"`
+	Ack   uint64 `json:"ack,omitempty"`
+	// Next is the high-water mark written at the top of a compacted file
+	Next uint64 `json:"next,omitempty"`
+}
+
+// openFileQueue reads the queue file at path, creating it if needed. name is used in errors.
+// A final line without a newline is the torn tail of a write interrupted by a crash and is dropped.
+// Any other line that cannot be read is skipped and copied to path+".corrupt" before the file is
+// rewritten, so no data is lost; Corrupt reports how many there were.
+func openFileQueue[T fileQueueEntry](path, name string) (*fileQueue[T], error) {
+	q := &fileQueue[T]{name: name, path: path, nextSeq: 1}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", name, err)
+	}
+	var corrupt [][]byte
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// a torn tail, or nothing at all
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not read %s: %w", name, err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var rec fileQueueRecord[T]
+		if err := json.Unmarshal(line, &rec); err != nil || (rec.Entry == nil && rec.Ack == 0 && rec.Next == 0) {
+			corrupt = append(corrupt, line)
+			continue
+		}
+		switch {
+		case rec.Entry != nil:
+			q.pending = append(q.pending, *rec.Entry)
+			if seq := (*rec.Entry).sequence(); seq >= q.nextSeq {
+				q.nextSeq = seq + 1
+			}
+		case rec.Ack != 0:
+			if len(q.pending) > 0 && q.pending[0].sequence() == rec.Ack {
+				q.pending = q.pending[1:]
+			}
+			q.acks++
+		case rec.Next > q.nextSeq:
+			q.nextSeq = rec.Next
+		}
+	}
+	f.Close()
+	if len(corrupt) > 0 {
+		if err := saveCorruptLines(path+".corrupt", corrupt); err != nil {
+			return nil, fmt.Errorf("could not set aside unreadable lines of %s: %w", name, err)
+		}
+		q.corrupt = len(corrupt)
+	}
+	// always rewrite on open, which also drops a torn tail
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// saveCorruptLines appends lines to the file at path and syncs it
+func saveCorruptLines(path string, lines [][]byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := f.Write(line); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (q *fileQueue[T]) Append(entry T) error {
+	if err := q.write(fileQueueRecord[T]{Entry: &entry}); err != nil {
+		return err
+	}
+	q.pending = append(q.pending, entry)
+	if seq := entry.sequence(); seq >= q.nextSeq {
+		q.nextSeq = seq + 1
+	}
+	return nil
+}
+
+func (q *fileQueue[T]) Front() (T, bool) {
+	if len(q.pending) == 0 {
+		var zero T
+		return zero, false
+	}
+	return q.pending[0], true
+}
+
+func (q *fileQueue[T]) Ack(seq uint64) error {
+	if len(q.pending) == 0 || q.pending[0].sequence() != seq {
+		return fmt.Errorf("%s: %d is not the oldest entry", q.name, seq)
+	}
+	if err := q.write(fileQueueRecord[T]{Ack: seq}); err != nil {
+		return err
+	}
+	q.pending = q.pending[1:]
+	q.acks++
+	if q.acks >= _FILE_QUEUE_COMPACT_AFTER && q.acks > len(q.pending) {
+		return q.compact()
+	}
+	return nil
+}
+
+func (q *fileQueue[T]) Len() int        { return len(q.pending) }
+func (q *fileQueue[T]) NextSeq() uint64 { return q.nextSeq }
+
+// Corrupt returns the number of unreadable lines skipped when the file was opened. They are kept
+// in a file next to the queue named after it with a ".corrupt" suffix.
+func (q *fileQueue[T]) Corrupt() int { return q.corrupt }
+
+func (q *fileQueue[T]) Close() error {
+	if q.f == nil {
+		return nil
+	}
+	err := q.f.Close()
+	q.f = nil
+	return err
+}
+
+func (q *fileQueue[T]) write(rec fileQueueRecord[T]) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("could not encode %s entry: %w", q.name, err)
+	}
+	if _, err := q.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("could not write %s: %w", q.name, err)
+	}
+	return q.f.Sync()
+}
+
+// compact rewrites the file with the high-water mark and the pending entries and swaps it in
+// atomically
+func (q *fileQueue[T]) compact() error {
+	tmp := q.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("could not compact %s: %w", q.name, err)
+	}
+	w := bufio.NewWriter(f)
+	next, _ := json.Marshal(fileQueueRecord[T]{Next: q.nextSeq})
+	w.Write(append(next, '\n'))
+	for i := range q.pending {
+		b, err := json.Marshal(fileQueueRecord[T]{Entry: &q.pending[i]})
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("could not compact %s: %w", q.name, err)
+		}
+		w.Write(append(b, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not compact %s: %w", q.name, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not compact %s: %w", q.name, err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		f.Close()
+		return fmt.Errorf("could not compact %s: %w", q.name, err)
+	}
+	if q.f != nil {
+		q.f.Close()
+	}
+	if _, err := f.Seek(0, 2); err != nil {
+		f.Close()
+		return fmt.Errorf("could not compact %s: %w", q.name, err)
+	}
+	q.f = f
+	q.acks = 0
+	return nil
+}
@@ -0,0 +1,109 @@
+package GoSDK
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileQueueRecovery(t *testing.T) {
+	good := func(seq, topic string) string {
+		return `{"m":{"seq":` + seq + `,"id":"id` + seq + `","topic":"` + topic + `","payload":null,"qos":1,"queued_at":"2024-01-01T00:00:00Z"}}` + "\n"
+	}
+	tests := []struct {
+		name        string
+		contents    string
+		wantTopics  []string
+		wantCorrupt int
+	}{
+		{"torn final line", good("1", "a") + good("2", "b") + `{"m":{"seq":3,"to`, []string{"a", "b"}, 0},
+		{"bad line in the middle", good("1", "a") + "not json\n" + good("2", "b"), []string{"a", "b"}, 1},
+		{"unknown record", good("1", "a") + `{"other":1}` + "\n" + good("2", "b"), []string{"a", "b"}, 1},
+		{"acks are applied", good("1", "a") + good("2", "b") + `{"ack":1}` + "\n", []string{"b"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "queue")
+			if err := os.WriteFile(path, []byte(tt.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+			s, err := OpenFileOutboundStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			var topics []string
+			for _, m := range s.pending {
+				topics = append(topics, m.Topic)
+			}
+			if strings.Join(topics, ",") != strings.Join(tt.wantTopics, ",") {
+				t.Fatalf("recovered %v, want %v", topics, tt.wantTopics)
+			}
+			if s.Corrupt() != tt.wantCorrupt {
+				t.Fatalf("Corrupt() = %d, want %d", s.Corrupt(), tt.wantCorrupt)
+			}
+			if s.NextSeq() != 3 {
+				t.Fatalf("NextSeq() = %d, want 3", s.NextSeq())
+			}
+		})
+	}
+}
+
+func TestFileQueueKeepsUnreadableLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	if err := os.WriteFile(path, []byte("garbage one\n{\"ack\":0}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenFileOfflineStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	// opening again must not lose what was set aside the first time
+	s, err = OpenFileOfflineStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	saved, err := os.ReadFile(path + ".corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "garbage one\n{\"ack\":0}\n" {
+		t.Fatalf("set aside %q", saved)
+	}
+}
+
+func TestFileQueueKeepsSequenceAfterCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	s, err := OpenFileOfflineStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// enough acks to compact the file down to nothing pending
+	for i := 0; i < _FILE_QUEUE_COMPACT_AFTER; i++ {
+		seq := s.NextSeq()
+		if err := s.Append(OfflineMutation{Seq: seq}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Ack(seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := s.NextSeq()
+	if contents, _ := os.ReadFile(path); strings.Contains(string(contents), `"m"`) {
+		t.Fatalf("the queue was not compacted: %s", contents)
+	}
+	s.Close()
+	for reopen := 0; reopen < 2; reopen++ {
+		s, err = OpenFileOfflineStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Len() != 0 || s.NextSeq() != want {
+			t.Fatalf("reopened with %d pending and NextSeq %d, want NextSeq %d", s.Len(), s.NextSeq(), want)
+		}
+		s.Close()
+	}
+}
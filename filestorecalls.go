@@ -175,7 +175,7 @@ func deleteFilestore(c cbClient, systemKey, filestoreName string) error {
 		return err
 	}
 	endpoint := _FILESTORES_PREAMBLE + systemKey
-	_, err = delete(c, endpoint, map[string]string{"name": filestoreName}, creds, nil)
+	_, err = del(c, endpoint, map[string]string{"name": filestoreName}, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -259,7 +259,7 @@ func deleteFilestoreFile(c cbClient, systemKey, filestore, path string) error {
 		return err
 	}
 	endpoint := fmt.Sprintf("%s%s/%s/file/%s", _FILESTORES_PREAMBLE, systemKey, filestore, path)
-	resp, err := delete(c, endpoint, nil, creds, nil)
+	resp, err := del(c, endpoint, nil, creds, nil)
 	if err != nil {
 		return err
 	}
@@ -6,15 +6,24 @@ require (
 	github.com/clearblade/go-utils v1.1.5-0.20240513160427-a20563b372a5
 	github.com/clearblade/mqtt_parsing v0.0.0-20160301165118-6ae49eac0961
 	github.com/clearblade/paho.mqtt.golang v1.1.1-0.20250218131504-def575eed97a
+	github.com/eclipse/paho.golang v0.22.0
 	github.com/eclipse/paho.mqtt.golang v1.5.0 // indirect
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/pkg/errors v0.8.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.36.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/net v0.38.0
+require (
+	github.com/fatih/structs v1.1.0
+	golang.org/x/net v0.38.0
+)
 
 require (
-	github.com/fatih/structs v1.1.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 )
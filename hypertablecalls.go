@@ -0,0 +1,341 @@
+package GoSDK
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+// Typed counterparts of the map based hypertable and continuous aggregate calls in datacalls.go.
+// Options are validated before anything is sent to the platform.
+
+var (
+	intervalPattern   = regexp.MustCompile(`^(?i)\s*(\d+(\.\d+)?\s*(microseconds?|us|milliseconds?|ms|seconds?|secs?|s|minutes?|mins?|m|hours?|hrs?|h|days?|d|weeks?|w|months?|mons?|years?|y)\s*)+$`)
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	aggregateFunctions = map[string]bool{
+		"avg": true, "sum": true, "min": true, "max": true, "count": true,
+		"first": true, "last": true, "stddev": true, "variance": true,
+	}
+)
+
+// Interval returns a TimeValue holding d as a postgres interval string, e.g. "300 seconds"
+func Interval(d time.Duration) TimeValue {
+	if d%time.Second != 0 {
+		return TimeValue{IntervalStr: fmt.Sprintf("%d milliseconds", d.Milliseconds())}
+	}
+	return TimeValue{IntervalStr: fmt.Sprintf("%d seconds", int64(d/time.Second))}
+}
+
+// Validate checks that the value looks like a postgres interval, e.g. "5 minutes" or "1 day 12 hours"
+func (t TimeValue) Validate() error {
+	if !intervalPattern.MatchString(t.IntervalStr) {
+		return fmt.Errorf("invalid interval %q", t.IntervalStr)
+	}
+	return nil
+}
+
+// UnmarshalYAML lets intervals be written as plain strings in schema documents
+func (t *TimeValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		t.IntervalStr = node.Value
+		return nil
+	}
+	var raw struct {
+		IntervalStr string `yaml:"interval_string"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	t.IntervalStr = raw.IntervalStr
+	return nil
+}
+
+func (t TimeValue) isZero() bool {
+	return t.IntervalStr == ""
+}
+
+// HypertableOptions describes how a collection is turned into a hypertable
+type HypertableOptions struct {
+	TimeColumn    string    `json:"time_column" yaml:"time_column"`
+	ChunkInterval TimeValue `json:"chunk_time_interval,omitempty" yaml:"chunk_time_interval,omitempty"`
+	// PartitioningColumn and NumberPartitions add space partitioning on top of the time dimension
+	PartitioningColumn string `json:"partitioning_column,omitempty" yaml:"partitioning_column,omitempty"`
+	NumberPartitions   int    `json:"number_partitions,omitempty" yaml:"number_partitions,omitempty"`
+	// MigrateData must be set when converting a collection that already holds rows
+	MigrateData bool `json:"migrate_data,omitempty" yaml:"migrate_data,omitempty"`
+}
+
+func (o *HypertableOptions) Validate() error {
+	if !identifierPattern.MatchString(o.TimeColumn) {
+		return fmt.Errorf("hypertable time column %q is not a valid column name", o.TimeColumn)
+	}
+	if !o.ChunkInterval.isZero() {
+		if err := o.ChunkInterval.Validate(); err != nil {
+			return fmt.Errorf("hypertable chunk interval: %w", err)
+		}
+	}
+	if o.PartitioningColumn != "" {
+		if !identifierPattern.MatchString(o.PartitioningColumn) {
+			return fmt.Errorf("hypertable partitioning column %q is not a valid column name", o.PartitioningColumn)
+		}
+		if o.NumberPartitions <= 0 {
+			return fmt.Errorf("hypertable partitioning column requires a positive number of partitions")
+		}
+	} else if o.NumberPartitions != 0 {
+		return fmt.Errorf("hypertable number of partitions requires a partitioning column")
+	}
+	return nil
+}
+
+func (o *HypertableOptions) toMap() map[string]interface{} {
+	m := map[string]interface{}{"time_column": o.TimeColumn}
+	if !o.ChunkInterval.isZero() {
+		m["chunk_time_interval"] = o.ChunkInterval
+	}
+	if o.PartitioningColumn != "" {
+		m["partitioning_column"] = o.PartitioningColumn
+		m["number_partitions"] = o.NumberPartitions
+	}
+	if o.MigrateData {
+		m["migrate_data"] = true
+	}
+	return m
+}
+
+// HypertableUpdate holds the hypertable properties that can be changed after creation
+type HypertableUpdate struct {
+	ChunkInterval TimeValue `json:"chunk_time_interval"`
+}
+
+func (u *HypertableUpdate) Validate() error {
+	if err := u.ChunkInterval.Validate(); err != nil {
+		return fmt.Errorf("hypertable chunk interval: %w", err)
+	}
+	return nil
+}
+
+// DropChunksOptions selects the chunks removed by DropHypertableChunksWithOptions. At least one bound is required.
+type DropChunksOptions struct {
+	OlderThan TimeValue `json:"older_than"`
+	NewerThan TimeValue `json:"newer_than"`
+}
+
+func (o *DropChunksOptions) Validate() error {
+	if o.OlderThan.isZero() && o.NewerThan.isZero() {
+		return fmt.Errorf("dropping hypertable chunks requires older_than and/or newer_than")
+	}
+	for _, tv := range []TimeValue{o.OlderThan, o.NewerThan} {
+		if !tv.isZero() {
+			if err := tv.Validate(); err != nil {
+				return fmt.Errorf("drop chunks: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *DropChunksOptions) toMap() map[string]interface{} {
+	m := map[string]interface{}{}
+	if !o.OlderThan.isZero() {
+		m["older_than"] = o.OlderThan
+	}
+	if !o.NewerThan.isZero() {
+		m["newer_than"] = o.NewerThan
+	}
+	return m
+}
+
+type DropChunksResult struct {
+	DroppedChunks []string               `json:"dropped_chunks"`
+	Raw           map[string]interface{} `json:"-"`
+}
+
+// Aggregation is one aggregated output column of a continuous aggregate, e.g. avg(temperature) AS avg_temp
+type Aggregation struct {
+	Function string `json:"function" yaml:"function"`
+	Column   string `json:"column" yaml:"column"`
+	Alias    string `json:"alias" yaml:"alias"`
+}
+
+// RefreshPolicy controls how the platform keeps a continuous aggregate up to date
+type RefreshPolicy struct {
+	StartOffset      TimeValue `json:"start_offset" yaml:"start_offset"`
+	EndOffset        TimeValue `json:"end_offset" yaml:"end_offset"`
+	ScheduleInterval TimeValue `json:"schedule_interval" yaml:"schedule_interval"`
+}
+
+// ContinuousAggregateOptions describes a continuous aggregate over a hypertable
+type ContinuousAggregateOptions struct {
+	TimeColumn       string         `json:"time_column" yaml:"time_column"`
+	BucketWidth      TimeValue      `json:"bucket_width" yaml:"bucket_width"`
+	GroupBy          []string       `json:"group_by,omitempty" yaml:"group_by,omitempty"`
+	Aggregations     []Aggregation  `json:"aggregations" yaml:"aggregations"`
+	RefreshPolicy    *RefreshPolicy `json:"refresh_policy,omitempty" yaml:"refresh_policy,omitempty"`
+	MaterializedOnly bool           `json:"materialized_only,omitempty" yaml:"materialized_only,omitempty"`
+}
+
+func (o *ContinuousAggregateOptions) Validate() error {
+	if !identifierPattern.MatchString(o.TimeColumn) {
+		return fmt.Errorf("continuous aggregate time column %q is not a valid column name", o.TimeColumn)
+	}
+	if err := o.BucketWidth.Validate(); err != nil {
+		return fmt.Errorf("continuous aggregate bucket width: %w", err)
+	}
+	for _, col := range o.GroupBy {
+		if !identifierPattern.MatchString(col) {
+			return fmt.Errorf("continuous aggregate group by column %q is not a valid column name", col)
+		}
+	}
+	if len(o.Aggregations) == 0 {
+		return fmt.Errorf("continuous aggregate needs at least one aggregation")
+	}
+	aliases := map[string]bool{}
+	for _, agg := range o.Aggregations {
+		if !aggregateFunctions[strings.ToLower(agg.Function)] {
+			return fmt.Errorf("continuous aggregate function %q is not supported", agg.Function)
+		}
+		if agg.Column != "*" && !identifierPattern.MatchString(agg.Column) {
+			return fmt.Errorf("continuous aggregate column %q is not a valid column name", agg.Column)
+		}
+		if !identifierPattern.MatchString(agg.Alias) {
+			return fmt.Errorf("continuous aggregate alias %q is not a valid column name", agg.Alias)
+		}
+		if aliases[agg.Alias] {
+			return fmt.Errorf("continuous aggregate alias %q used twice", agg.Alias)
+		}
+		aliases[agg.Alias] = true
+	}
+	if p := o.RefreshPolicy; p != nil {
+		for name, tv := range map[string]TimeValue{"start offset": p.StartOffset, "end offset": p.EndOffset, "schedule interval": p.ScheduleInterval} {
+			if err := tv.Validate(); err != nil {
+				return fmt.Errorf("continuous aggregate refresh policy %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *ContinuousAggregateOptions) toMap() map[string]interface{} {
+	aggs := make([]map[string]interface{}, len(o.Aggregations))
+	for i, agg := range o.Aggregations {
+		aggs[i] = map[string]interface{}{"function": strings.ToLower(agg.Function), "column": agg.Column, "alias": agg.Alias}
+	}
+	m := map[string]interface{}{
+		"time_column":  o.TimeColumn,
+		"bucket_width": o.BucketWidth,
+		"aggregations": aggs,
+	}
+	if len(o.GroupBy) > 0 {
+		m["group_by"] = o.GroupBy
+	}
+	if p := o.RefreshPolicy; p != nil {
+		m["refresh_policy"] = p
+	}
+	if o.MaterializedOnly {
+		m["materialized_only"] = true
+	}
+	return m
+}
+
+// ContinuousAggregateInfo is the typed form of GetContinuousAggregate
+type ContinuousAggregateInfo struct {
+	Name string `json:"name"`
+	ContinuousAggregateOptions
+	Raw map[string]interface{} `json:"-"`
+}
+
+func (d *DevClient) ConvertCollectionToHypertableWithOptions(systemKey, collectionName string, options *HypertableOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	return d.ConvertCollectionToHypertable(systemKey, collectionName, options.toMap())
+}
+
+func (d *DevClient) UpdateHypertablePropertiesWithOptions(systemKey, collectionName string, update *HypertableUpdate) error {
+	if err := update.Validate(); err != nil {
+		return err
+	}
+	return d.UpdateHypertableProperties(systemKey, collectionName, map[string]interface{}{
+		"chunk_time_interval": update.ChunkInterval,
+	})
+}
+
+func (d *DevClient) DropHypertableChunksWithOptions(systemKey, collectionName string, options *DropChunksOptions) (*DropChunksResult, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	body, err := d.DropHypertableChunks(systemKey, collectionName, options.toMap())
+	if err != nil {
+		return nil, err
+	}
+	result := &DropChunksResult{}
+	if err := decodeTimescaleMap(body, result); err != nil {
+		return nil, fmt.Errorf("could not decode dropped chunks: %w", err)
+	}
+	result.Raw = body
+	return result, nil
+}
+
+func (d *DevClient) CreateContinuousAggregateWithOptions(systemKey, collectionName, aggregateName string, options *ContinuousAggregateOptions) error {
+	if !identifierPattern.MatchString(aggregateName) {
+		return fmt.Errorf("continuous aggregate name %q is not a valid name", aggregateName)
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	return d.CreateContinuousAggregate(systemKey, collectionName, aggregateName, options.toMap())
+}
+
+func (d *DevClient) UpdateContinuousAggregateWithOptions(systemKey, collectionName, aggregateName string, options *ContinuousAggregateOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	return d.UpdateContinuousAggregate(systemKey, collectionName, aggregateName, options.toMap())
+}
+
+func (d *DevClient) GetContinuousAggregateInfo(systemKey, collectionName, aggregateName string) (*ContinuousAggregateInfo, error) {
+	body, err := d.GetContinuousAggregate(systemKey, collectionName, aggregateName)
+	if err != nil {
+		return nil, err
+	}
+	return parseContinuousAggregateInfo(aggregateName, body)
+}
+
+func parseContinuousAggregateInfo(name string, body map[string]interface{}) (*ContinuousAggregateInfo, error) {
+	info := &ContinuousAggregateInfo{}
+	if err := decodeTimescaleMap(body, info); err != nil {
+		return nil, fmt.Errorf("could not decode continuous aggregate %s: %w", name, err)
+	}
+	if info.Name == "" {
+		info.Name = name
+	}
+	info.Raw = body
+	return info, nil
+}
+
+// decodeTimescaleMap decodes platform responses, accepting intervals either as plain strings
+// or in the {"interval_string": ...} form used in requests
+func decodeTimescaleMap(in interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           out,
+		TagName:          "json",
+		Squash:           true,
+		WeaklyTypedInput: true,
+		DecodeHook: func(from, to reflect.Type, data interface{}) (interface{}, error) {
+			if to == reflect.TypeOf(TimeValue{}) && from.Kind() == reflect.String {
+				return TimeValue{IntervalStr: data.(string)}, nil
+			}
+			return data, nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(in)
+}
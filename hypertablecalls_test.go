@@ -0,0 +1,218 @@
+package GoSDK
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInterval(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                       "0 seconds",
+		5 * time.Minute:         "300 seconds",
+		36 * time.Hour:          "129600 seconds",
+		1500 * time.Millisecond: "1500 milliseconds",
+		time.Millisecond / 2:    "0 milliseconds",
+	} {
+		tv := Interval(d)
+		if tv.IntervalStr != want {
+			t.Errorf("Interval(%v) = %q, want %q", d, tv.IntervalStr, want)
+		}
+		if err := tv.Validate(); err != nil {
+			t.Errorf("Interval(%v): %v", d, err)
+		}
+	}
+}
+
+func TestTimeValueValidate(t *testing.T) {
+	for interval, valid := range map[string]bool{
+		"5 minutes":      true,
+		"1 day 12 hours": true,
+		"1.5 h":          true,
+		"30s":            true,
+		"2 WEEKS":        true,
+		"":               false,
+		"5":              false,
+		"minutes":        false,
+		"5 fortnights":   false,
+		"1 day; drop":    false,
+		"-5 minutes":     false,
+	} {
+		if err := (TimeValue{IntervalStr: interval}).Validate(); (err == nil) != valid {
+			t.Errorf("%q: valid %v, got %v", interval, valid, err)
+		}
+	}
+}
+
+func TestHypertableOptionsValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts  HypertableOptions
+		valid bool
+	}{
+		"time column only":          {HypertableOptions{TimeColumn: "ts"}, true},
+		"every option":              {HypertableOptions{TimeColumn: "ts", ChunkInterval: TimeValue{"1 day"}, PartitioningColumn: "device", NumberPartitions: 4, MigrateData: true}, true},
+		"missing time column":       {HypertableOptions{}, false},
+		"bad time column":           {HypertableOptions{TimeColumn: "ts; drop"}, false},
+		"bad chunk interval":        {HypertableOptions{TimeColumn: "ts", ChunkInterval: TimeValue{"soon"}}, false},
+		"bad partitioning column":   {HypertableOptions{TimeColumn: "ts", PartitioningColumn: "1device", NumberPartitions: 2}, false},
+		"partitions without column": {HypertableOptions{TimeColumn: "ts", NumberPartitions: 2}, false},
+		"column without partitions": {HypertableOptions{TimeColumn: "ts", PartitioningColumn: "device"}, false},
+	} {
+		if err := tc.opts.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: valid %v, got %v", name, tc.valid, err)
+		}
+	}
+}
+
+func TestHypertableOptionsToMap(t *testing.T) {
+	minimal := HypertableOptions{TimeColumn: "ts"}
+	if got := minimal.toMap(); !reflect.DeepEqual(got, map[string]interface{}{"time_column": "ts"}) {
+		t.Fatalf("minimal options gave %v", got)
+	}
+	full := HypertableOptions{TimeColumn: "ts", ChunkInterval: TimeValue{"1 day"}, PartitioningColumn: "device", NumberPartitions: 4, MigrateData: true}
+	want := map[string]interface{}{
+		"time_column":         "ts",
+		"chunk_time_interval": TimeValue{"1 day"},
+		"partitioning_column": "device",
+		"number_partitions":   4,
+		"migrate_data":        true,
+	}
+	if got := full.toMap(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestHypertableUpdateValidate(t *testing.T) {
+	if err := (&HypertableUpdate{ChunkInterval: TimeValue{"12 hours"}}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&HypertableUpdate{}).Validate(); err == nil {
+		t.Fatal("an update without an interval was accepted")
+	}
+}
+
+func TestDropChunksOptions(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts DropChunksOptions
+		want map[string]interface{}
+	}{
+		"older":      {DropChunksOptions{OlderThan: TimeValue{"30 days"}}, map[string]interface{}{"older_than": TimeValue{"30 days"}}},
+		"newer":      {DropChunksOptions{NewerThan: TimeValue{"1 day"}}, map[string]interface{}{"newer_than": TimeValue{"1 day"}}},
+		"both":       {DropChunksOptions{OlderThan: TimeValue{"30 days"}, NewerThan: TimeValue{"60 days"}}, map[string]interface{}{"older_than": TimeValue{"30 days"}, "newer_than": TimeValue{"60 days"}}},
+		"no bound":   {DropChunksOptions{}, nil},
+		"bad bound":  {DropChunksOptions{OlderThan: TimeValue{"a while"}}, nil},
+		"bad second": {DropChunksOptions{OlderThan: TimeValue{"1 day"}, NewerThan: TimeValue{"x"}}, nil},
+	} {
+		err := tc.opts.Validate()
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%s: accepted", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if got := tc.opts.toMap(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func validAggregate() ContinuousAggregateOptions {
+	return ContinuousAggregateOptions{
+		TimeColumn:   "ts",
+		BucketWidth:  TimeValue{"1 hour"},
+		GroupBy:      []string{"device"},
+		Aggregations: []Aggregation{{Function: "AVG", Column: "temp", Alias: "avg_temp"}, {Function: "count", Column: "*", Alias: "n"}},
+	}
+}
+
+func TestContinuousAggregateOptionsValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		change func(*ContinuousAggregateOptions)
+		valid  bool
+	}{
+		"valid": {func(*ContinuousAggregateOptions) {}, true},
+		"refresh policy": {func(o *ContinuousAggregateOptions) {
+			o.RefreshPolicy = &RefreshPolicy{TimeValue{"3 days"}, TimeValue{"1 hour"}, TimeValue{"1 hour"}}
+		}, true},
+		"bad time column":  {func(o *ContinuousAggregateOptions) { o.TimeColumn = "" }, false},
+		"bad bucket width": {func(o *ContinuousAggregateOptions) { o.BucketWidth = TimeValue{} }, false},
+		"bad group by":     {func(o *ContinuousAggregateOptions) { o.GroupBy = []string{"a b"} }, false},
+		"no aggregations":  {func(o *ContinuousAggregateOptions) { o.Aggregations = nil }, false},
+		"unknown function": {func(o *ContinuousAggregateOptions) { o.Aggregations[0].Function = "median" }, false},
+		"bad column":       {func(o *ContinuousAggregateOptions) { o.Aggregations[0].Column = "temp)" }, false},
+		"bad alias":        {func(o *ContinuousAggregateOptions) { o.Aggregations[0].Alias = "" }, false},
+		"duplicate alias":  {func(o *ContinuousAggregateOptions) { o.Aggregations[1].Alias = "avg_temp" }, false},
+		"incomplete refresh": {func(o *ContinuousAggregateOptions) {
+			o.RefreshPolicy = &RefreshPolicy{StartOffset: TimeValue{"3 days"}}
+		}, false},
+		"bad refresh interval": {func(o *ContinuousAggregateOptions) {
+			o.RefreshPolicy = &RefreshPolicy{TimeValue{"3 days"}, TimeValue{"1 hour"}, TimeValue{"hourly"}}
+		}, false},
+	} {
+		opts := validAggregate()
+		tc.change(&opts)
+		if err := opts.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: valid %v, got %v", name, tc.valid, err)
+		}
+	}
+}
+
+func TestContinuousAggregateOptionsToMap(t *testing.T) {
+	opts := validAggregate()
+	opts.MaterializedOnly = true
+	opts.RefreshPolicy = &RefreshPolicy{TimeValue{"3 days"}, TimeValue{"1 hour"}, TimeValue{"1 hour"}}
+	want := map[string]interface{}{
+		"time_column":  "ts",
+		"bucket_width": TimeValue{"1 hour"},
+		"aggregations": []map[string]interface{}{
+			{"function": "avg", "column": "temp", "alias": "avg_temp"},
+			{"function": "count", "column": "*", "alias": "n"},
+		},
+		"group_by":          []string{"device"},
+		"refresh_policy":    opts.RefreshPolicy,
+		"materialized_only": true,
+	}
+	if got := opts.toMap(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestDecodeTimescaleMap(t *testing.T) {
+	body := map[string]interface{}{
+		"name":         "hourly",
+		"time_column":  "ts",
+		"bucket_width": "1 hour",
+		"aggregations": []interface{}{map[string]interface{}{"function": "avg", "column": "temp", "alias": "avg_temp"}},
+		"refresh_policy": map[string]interface{}{
+			"start_offset":      map[string]interface{}{"interval_string": "3 days"},
+			"end_offset":        "1 hour",
+			"schedule_interval": "1 hour",
+		},
+		"materialized_only": "true",
+	}
+	info, err := parseContinuousAggregateInfo("ignored", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "hourly" || info.TimeColumn != "ts" || info.BucketWidth.IntervalStr != "1 hour" || !info.MaterializedOnly ||
+		len(info.Aggregations) != 1 || info.Aggregations[0].Alias != "avg_temp" {
+		t.Fatalf("decoded %+v", info)
+	}
+	if p := info.RefreshPolicy; p == nil || p.StartOffset.IntervalStr != "3 days" || p.EndOffset.IntervalStr != "1 hour" {
+		t.Fatalf("refresh policy %+v", p)
+	}
+	if info, err := parseContinuousAggregateInfo("hourly", map[string]interface{}{}); err != nil || info.Name != "hourly" {
+		t.Fatalf("empty body gave %+v, %v", info, err)
+	}
+
+	var dropped DropChunksResult
+	if err := decodeTimescaleMap(map[string]interface{}{"dropped_chunks": []interface{}{"_hyper_1_1_chunk"}}, &dropped); err != nil ||
+		len(dropped.DroppedChunks) != 1 {
+		t.Fatalf("dropped chunks %+v, %v", dropped, err)
+	}
+	if err := decodeTimescaleMap(map[string]interface{}{"dropped_chunks": map[string]interface{}{"a": 1}}, &dropped); err == nil {
+		t.Fatal("decoded a map as a list of chunks")
+	}
+}
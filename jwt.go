@@ -0,0 +1,146 @@
+package GoSDK
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for the ES384 and ES512 hashes
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JWTSigner signs the JWTs a device connects with when its MQTT client uses JWT auth. Key is an
+// *rsa.PrivateKey (RS256), an *ecdsa.PrivateKey (ES256, ES384 or ES512 by curve), an
+// ed25519.PrivateKey (EdDSA) or a []byte secret (HS256). Every token carries Claims plus iat set
+// to the signing time and, when TTL is positive, exp set TTL later.
+type JWTSigner struct {
+	Key    interface{}
+	Claims map[string]interface{}
+	TTL    time.Duration
+}
+
+// Sign returns a newly signed token
+func (s *JWTSigner) Sign() (string, error) {
+	return s.signAt(time.Now())
+}
+
+func (s *JWTSigner) signAt(now time.Time) (string, error) {
+	alg, sign, err := jwtAlgorithm(s.Key)
+	if err != nil {
+		return "", err
+	}
+	claims := make(map[string]interface{}, len(s.Claims)+2)
+	for k, v := range s.Claims {
+		claims[k] = v
+	}
+	claims["iat"] = now.Unix()
+	if s.TTL > 0 {
+		claims["exp"] = now.Add(s.TTL).Unix()
+	}
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not encode JWT claims: %w", err)
+	}
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(body)
+	sig, err := sign([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("could not sign JWT: %w", err)
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
+
+// credentials is the MQTT credentials provider for a JWT client: no username and a fresh token
+// as the password
+func (s *JWTSigner) credentials() (string, string, error) {
+	tok, err := s.Sign()
+	return "", tok, err
+}
+
+// jwtAlgorithm returns the JWS alg name for key and a function signing with it
+func jwtAlgorithm(key interface{}) (string, func([]byte) ([]byte, error), error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256", func(in []byte) ([]byte, error) {
+			sum := sha256.Sum256(in)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		}, nil
+	case *ecdsa.PrivateKey:
+		var alg string
+		var hash crypto.Hash
+		switch k.Curve {
+		case elliptic.P256():
+			alg, hash = "ES256", crypto.SHA256
+		case elliptic.P384():
+			alg, hash = "ES384", crypto.SHA384
+		case elliptic.P521():
+			alg, hash = "ES512", crypto.SHA512
+		default:
+			return "", nil, fmt.Errorf("unsupported JWT signing curve %s", k.Curve.Params().Name)
+		}
+		return alg, func(in []byte) ([]byte, error) {
+			h := hash.New()
+			h.Write(in)
+			r, s, err := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+			if err != nil {
+				return nil, err
+			}
+			// JWS wants r and s as fixed size big endian integers, not ASN.1
+			size := (k.Curve.Params().BitSize + 7) / 8
+			sig := make([]byte, 2*size)
+			r.FillBytes(sig[:size])
+			s.FillBytes(sig[size:])
+			return sig, nil
+		}, nil
+	case ed25519.PrivateKey:
+		return "EdDSA", func(in []byte) ([]byte, error) {
+			return ed25519.Sign(k, in), nil
+		}, nil
+	case []byte:
+		if len(k) == 0 {
+			return "", nil, errors.New("the JWT HMAC secret is empty")
+		}
+		return "HS256", func(in []byte) ([]byte, error) {
+			mac := hmac.New(sha256.New, k)
+			mac.Write(in)
+			return mac.Sum(nil), nil
+		}, nil
+	case nil:
+		return "", nil, errors.New("no JWT signing key is set")
+	}
+	return "", nil, fmt.Errorf("unsupported JWT signing key %T", key)
+}
+
+// InitializeJWTMQTTWithSigner connects like InitializeJWTMQTT, but with a token from signer that
+// is signed again for every reconnect instead of the fixed DeviceToken
+func (d *DeviceClient) InitializeJWTMQTTWithSigner(clientid string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, signer *JWTSigner) error {
+	if signer == nil {
+		return errors.New("a JWT signer is required")
+	}
+	tok, err := signer.Sign()
+	if err != nil {
+		return err
+	}
+	mqc, err := newJwtMqttClient(tok, d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, true)
+	if err != nil {
+		return err
+	}
+	if err := setMQTTCredentialsProvider(mqc, signer.credentials); err != nil {
+		return err
+	}
+	d.MQTTClient = mqc
+	return nil
+}
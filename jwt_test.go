@@ -0,0 +1,109 @@
+package GoSDK
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeJWT splits tok and returns its header, claims, signing input and signature
+func decodeJWT(t *testing.T, tok string) (map[string]interface{}, map[string]interface{}, []byte, []byte) {
+	t.Helper()
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q does not have three parts", tok)
+	}
+	var header, claims map[string]interface{}
+	for i, into := range []*map[string]interface{}{&header, &claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if err := json.Unmarshal(raw, into); err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("signature: %v", err)
+	}
+	return header, claims, []byte(parts[0] + "." + parts[1]), sig
+}
+
+func TestJWTSignerSignsWithEachKeyType(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("shared-secret")
+	for _, tc := range []struct {
+		alg    string
+		key    interface{}
+		verify func(in, sig []byte) bool
+	}{
+		{"RS256", rsaKey, func(in, sig []byte) bool {
+			sum := sha256.Sum256(in)
+			return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, sum[:], sig) == nil
+		}},
+		{"ES384", ecKey, func(in, sig []byte) bool {
+			h := crypto.SHA384.New()
+			h.Write(in)
+			r, s := new(big.Int).SetBytes(sig[:48]), new(big.Int).SetBytes(sig[48:])
+			return len(sig) == 96 && ecdsa.Verify(&ecKey.PublicKey, h.Sum(nil), r, s)
+		}},
+		{"EdDSA", edKey, func(in, sig []byte) bool {
+			return ed25519.Verify(edKey.Public().(ed25519.PublicKey), in, sig)
+		}},
+		{"HS256", secret, func(in, sig []byte) bool {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(in)
+			return hmac.Equal(mac.Sum(nil), sig)
+		}},
+	} {
+		t.Run(tc.alg, func(t *testing.T) {
+			now := time.Unix(1700000000, 0)
+			signer := &JWTSigner{Key: tc.key, Claims: map[string]interface{}{"sub": "device-1"}, TTL: time.Hour}
+			tok, err := signer.signAt(now)
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			header, claims, in, sig := decodeJWT(t, tok)
+			if header["alg"] != tc.alg || header["typ"] != "JWT" {
+				t.Fatalf("header %v", header)
+			}
+			if claims["sub"] != "device-1" || claims["iat"] != float64(now.Unix()) || claims["exp"] != float64(now.Add(time.Hour).Unix()) {
+				t.Fatalf("claims %v", claims)
+			}
+			if !tc.verify(in, sig) {
+				t.Fatal("signature does not verify")
+			}
+		})
+	}
+}
+
+func TestJWTSignerRejectsUnusableKeys(t *testing.T) {
+	for _, key := range []interface{}{nil, []byte{}, "not a key"} {
+		if _, err := (&JWTSigner{Key: key}).Sign(); err == nil {
+			t.Fatalf("signed with key %#v", key)
+		}
+	}
+}
@@ -76,7 +76,7 @@ func (d *DevClient) DeleteLibrary(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _LIB_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _LIB_PREAMBLE+"/"+systemKey+"/"+name, nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
@@ -0,0 +1,452 @@
+package GoSDK
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+var errMemoryClientDisconnected = errors.New("memory broker client is not connected")
+
+// MemoryBroker is an MQTT broker held in memory, for testing code built on the SDK's MQTT clients
+// without a platform. It routes messages by topic filter, including wildcards and $share groups,
+// keeps retained messages and publishes last wills. Every message is delivered exactly once
+// whatever its QoS. Sessions are clean: a client that loses its connection also loses its
+// subscriptions until it makes them again.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	clients   map[string]*memoryClient
+	retained  map[string]*memoryMessage
+	shareNext map[string]int
+}
+
+// MemoryClientOptions controls a client made by MemoryBroker.NewClient
+type MemoryClientOptions struct {
+	LastWill  *LastWillPacket
+	Callbacks *Callbacks
+	// NoAutoReconnect leaves the client disconnected after DropConnection until Connect is called
+	NoAutoReconnect bool
+}
+
+// NewMemoryBroker returns an empty broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		clients:   map[string]*memoryClient{},
+		retained:  map[string]*memoryMessage{},
+		shareNext: map[string]int{},
+	}
+}
+
+// NewClient returns a connected client of the broker. It tracks and restores its subscriptions
+// like a client made by InitializeMQTT, so it can be assigned to MQTTClient. A client connecting
+// with the id of a connected one takes over its session and the old one is dropped.
+func (b *MemoryBroker) NewClient(clientID string, opts MemoryClientOptions) (MqttClient, error) {
+	subs := newSubscriptionManager()
+	cb := subs.wrap(opts.Callbacks)
+	mc := &memoryClient{
+		broker:        b,
+		clientID:      clientID,
+		will:          opts.LastWill,
+		autoReconnect: !opts.NoAutoReconnect,
+		onConnect:     cb.OnConnectCallback,
+		onLost:        cb.OnConnectionLostCallback,
+		subscriptions: map[string]byte{},
+	}
+	mqc := &mqttBaseClient{Client: mc, clientID: clientID, subs: subs}
+	mc.outer = mqc
+	if ret := mc.Connect(); ret.Error() != nil {
+		return nil, ret.Error()
+	}
+	return mqc, nil
+}
+
+// DropConnection disconnects a client as a network failure would. Its last will is published and,
+// unless it was made with NoAutoReconnect, it connects again straight away.
+func (b *MemoryBroker) DropConnection(clientID string) error {
+	b.mu.Lock()
+	mc, ok := b.clients[clientID]
+	b.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("client %s is not connected", clientID)
+	}
+	mc.drop(errors.New("connection dropped by memory broker"))
+	return nil
+}
+
+// DropConnections drops every connected client, see DropConnection
+func (b *MemoryBroker) DropConnections() {
+	b.mu.Lock()
+	clients := make([]*memoryClient, 0, len(b.clients))
+	for _, id := range sortedKeys(b.clients) {
+		clients = append(clients, b.clients[id])
+	}
+	b.mu.Unlock()
+	for _, mc := range clients {
+		mc.drop(errors.New("connection dropped by memory broker"))
+	}
+}
+
+// Connected lists the ids of the connected clients
+func (b *MemoryBroker) Connected() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedKeys(b.clients)
+}
+
+// Subscriptions lists the topic filters the broker holds for a client
+func (b *MemoryBroker) Subscriptions(clientID string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	mc, ok := b.clients[clientID]
+	if !ok {
+		return nil
+	}
+	return sortedKeys(mc.subscriptions)
+}
+
+func (b *MemoryBroker) connect(mc *memoryClient) {
+	b.mu.Lock()
+	old := b.clients[mc.clientID]
+	b.clients[mc.clientID] = mc
+	b.mu.Unlock()
+	if old != nil && old != mc {
+		old.drop(errors.New("session taken over by a new connection"))
+	}
+}
+
+// disconnect removes mc from the broker, publishing its will when it went away uncleanly
+func (b *MemoryBroker) disconnect(mc *memoryClient, publishWill bool) {
+	b.mu.Lock()
+	if b.clients[mc.clientID] == mc {
+		delete(b.clients, mc.clientID)
+	}
+	mc.subscriptions = map[string]byte{}
+	b.mu.Unlock()
+	if publishWill && mc.will != nil {
+		b.route(&memoryMessage{topic: mc.will.Topic, payload: []byte(mc.will.Body), qos: byte(mc.will.Qos), retained: mc.will.Retain})
+	}
+}
+
+func (b *MemoryBroker) subscribe(mc *memoryClient, filter string, qos byte) error {
+	b.mu.Lock()
+	if b.clients[mc.clientID] != mc {
+		b.mu.Unlock()
+		return errMemoryClientDisconnected
+	}
+	mc.subscriptions[filter] = qos
+	var retained []*memoryMessage
+	if !strings.HasPrefix(filter, "$share/") {
+		for _, topic := range sortedKeys(b.retained) {
+			if topicMatches(filter, topic) {
+				retained = append(retained, b.retained[topic])
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, m := range retained {
+		mc.deliver(m)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) unsubscribe(mc *memoryClient, filters []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, filter := range filters {
+		delete(mc.subscriptions, filter)
+	}
+}
+
+func (b *MemoryBroker) publish(mc *memoryClient, m *memoryMessage) error {
+	b.mu.Lock()
+	connected := b.clients[mc.clientID] == mc
+	b.mu.Unlock()
+	if !connected {
+		return errMemoryClientDisconnected
+	}
+	b.route(m)
+	return nil
+}
+
+// route stores m if it is retained and hands it to every matching subscriber, one member of each
+// shared group
+func (b *MemoryBroker) route(m *memoryMessage) {
+	b.mu.Lock()
+	if m.retained {
+		if len(m.payload) == 0 {
+			delete(b.retained, m.topic)
+		} else {
+			b.retained[m.topic] = m
+		}
+	}
+	var targets []*memoryClient
+	groups := map[string][]*memoryClient{}
+	for _, id := range sortedKeys(b.clients) {
+		mc := b.clients[id]
+		direct := false
+		for filter := range mc.subscriptions {
+			if !topicMatches(filter, m.topic) {
+				continue
+			}
+			if strings.HasPrefix(filter, "$share/") {
+				key := strings.SplitN(filter, "/", 3)[1] + "\x00" + strings.SplitN(filter, "/", 3)[2]
+				groups[key] = append(groups[key], mc)
+			} else {
+				direct = true
+			}
+		}
+		if direct {
+			targets = append(targets, mc)
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		members := groups[key]
+		next := b.shareNext[key] % len(members)
+		b.shareNext[key] = next + 1
+		targets = append(targets, members[next])
+	}
+	b.mu.Unlock()
+	for _, mc := range targets {
+		// a delivered copy is never retained, except the ones sent on subscribe
+		mc.deliver(&memoryMessage{topic: m.topic, payload: m.payload, qos: m.qos})
+	}
+}
+
+// memoryClient implements mqtt.Client against a MemoryBroker. Incoming messages are handed to
+// the handlers from a single goroutine per connection, in order, as paho does.
+type memoryClient struct {
+	broker        *MemoryBroker
+	outer         *mqttBaseClient
+	clientID      string
+	will          *LastWillPacket
+	autoReconnect bool
+	onConnect     mqtt.OnConnectHandler
+	onLost        mqtt.ConnectionLostHandler
+
+	// subscriptions is the broker side session, guarded by broker.mu
+	subscriptions map[string]byte
+
+	mu        sync.Mutex
+	connected bool
+	routes    []memoryRoute
+	nextID    uint16
+	inbox     []*memoryMessage
+	wake      chan struct{}
+	stop      chan struct{}
+}
+
+type memoryRoute struct {
+	filter  string
+	handler mqtt.MessageHandler
+}
+
+type memoryMessage struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retained bool
+	id       uint16
+}
+
+func (m *memoryMessage) Duplicate() bool   { return false }
+func (m *memoryMessage) Qos() byte         { return m.qos }
+func (m *memoryMessage) Retained() bool    { return m.retained }
+func (m *memoryMessage) Topic() string     { return m.topic }
+func (m *memoryMessage) MessageID() uint16 { return m.id }
+func (m *memoryMessage) Payload() []byte   { return m.payload }
+func (m *memoryMessage) Ack()              {}
+
+func (c *memoryClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *memoryClient) IsConnectionOpen() bool { return c.IsConnected() }
+
+func (c *memoryClient) Connect() mqtt.Token {
+	c.mu.Lock()
+	if c.connected {
+		c.mu.Unlock()
+		return completedToken(nil)
+	}
+	c.connected = true
+	c.inbox = nil
+	c.wake = make(chan struct{}, 1)
+	c.stop = make(chan struct{})
+	go c.dispatch(c.wake, c.stop)
+	c.mu.Unlock()
+	c.broker.connect(c)
+	if c.onConnect != nil {
+		go c.onConnect(c.outer)
+	}
+	return completedToken(nil)
+}
+
+func (c *memoryClient) Disconnect(quiesce uint) {
+	if c.close() {
+		c.broker.disconnect(c, false)
+	}
+}
+
+// drop ends the connection uncleanly and reconnects when the client does so automatically
+func (c *memoryClient) drop(err error) {
+	if !c.close() {
+		return
+	}
+	c.broker.disconnect(c, true)
+	go func() {
+		if c.onLost != nil {
+			c.onLost(c.outer, err)
+		}
+		if c.autoReconnect {
+			c.Connect()
+		}
+	}()
+}
+
+// close marks the client disconnected and stops its dispatcher, reporting whether it was connected
+func (c *memoryClient) close() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return false
+	}
+	c.connected = false
+	close(c.stop)
+	c.inbox = nil
+	return true
+}
+
+func (c *memoryClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	var body []byte
+	switch p := payload.(type) {
+	case []byte:
+		body = append([]byte{}, p...)
+	case string:
+		body = []byte(p)
+	default:
+		return completedToken(fmt.Errorf("unknown payload type %T", payload))
+	}
+	if qos > 2 {
+		return completedToken(fmt.Errorf("invalid qos %d", qos))
+	}
+	return completedToken(c.broker.publish(c, &memoryMessage{topic: topic, payload: body, qos: qos, retained: retained}))
+}
+
+func (c *memoryClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+func (c *memoryClient) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	for _, filter := range sortedKeys(filters) {
+		if callback != nil {
+			c.AddRoute(filter, callback)
+		}
+		if err := c.broker.subscribe(c, filter, filters[filter]); err != nil {
+			return completedToken(err)
+		}
+	}
+	return completedToken(nil)
+}
+
+func (c *memoryClient) Unsubscribe(topics ...string) mqtt.Token {
+	c.mu.Lock()
+	routes := c.routes[:0]
+	for _, route := range c.routes {
+		removed := false
+		for _, topic := range topics {
+			removed = removed || route.filter == topic
+		}
+		if !removed {
+			routes = append(routes, route)
+		}
+	}
+	c.routes = routes
+	connected := c.connected
+	c.mu.Unlock()
+	if !connected {
+		return completedToken(errMemoryClientDisconnected)
+	}
+	c.broker.unsubscribe(c, topics)
+	return completedToken(nil)
+}
+
+func (c *memoryClient) AddRoute(topic string, callback mqtt.MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, route := range c.routes {
+		if route.filter == topic {
+			c.routes[i].handler = callback
+			return
+		}
+	}
+	c.routes = append(c.routes, memoryRoute{filter: topic, handler: callback})
+}
+
+func (c *memoryClient) OptionsReader() mqtt.ClientOptionsReader {
+	o := mqtt.NewClientOptions()
+	o.SetClientID(c.clientID)
+	o.SetAutoReconnect(c.autoReconnect)
+	return mqtt.NewClient(o).OptionsReader()
+}
+
+func (c *memoryClient) deliver(m *memoryMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return
+	}
+	c.nextID++
+	m.id = c.nextID
+	c.inbox = append(c.inbox, m)
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch hands queued messages to every matching route until the connection ends
+func (c *memoryClient) dispatch(wake, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-wake:
+		}
+		for {
+			c.mu.Lock()
+			select {
+			case <-stop:
+				c.mu.Unlock()
+				return
+			default:
+			}
+			if len(c.inbox) == 0 {
+				c.mu.Unlock()
+				break
+			}
+			m := c.inbox[0]
+			c.inbox = c.inbox[1:]
+			var handlers []mqtt.MessageHandler
+			for _, route := range c.routes {
+				if topicMatches(route.filter, m.topic) {
+					handlers = append(handlers, route.handler)
+				}
+			}
+			c.mu.Unlock()
+			for _, h := range handlers {
+				h(c.outer, m)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package GoSDK
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerRetainedMessages(t *testing.T) {
+	b := NewMemoryBroker()
+	pub := newMemoryClient(t, b, "pub")
+	if err := publish(pub, "config/a", []byte("v1"), QOS_AtLeastOnce, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	sub := newMemoryClient(t, b, "sub")
+	msgs, err := subscribe(sub, "config/#", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPublish(t, msgs, "v1")
+
+	// an empty retained payload clears the topic
+	if err := publish(pub, "config/a", nil, QOS_AtLeastOnce, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	expectPublish(t, msgs, "")
+	late := newMemoryClient(t, b, "late")
+	lateMsgs, err := subscribe(late, "config/#", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-lateMsgs:
+		t.Fatalf("cleared retained message delivered: %q", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryBrokerLastWill(t *testing.T) {
+	b := NewMemoryBroker()
+	watcher := newMemoryClient(t, b, "watcher")
+	wills, err := subscribe(watcher, "status/+", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := b.NewClient("dev", MemoryClientOptions{
+		LastWill:        &LastWillPacket{Topic: "status/dev", Body: "offline"},
+		NoAutoReconnect: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DropConnection("dev"); err != nil {
+		t.Fatal(err)
+	}
+	expectPublish(t, wills, "offline")
+	if dev.IsConnected() {
+		t.Fatal("client without auto reconnect came back")
+	}
+	if err := publish(dev, "status/dev", []byte("online"), QOS_AtMostOnce, 0, false); err == nil {
+		t.Fatal("publish on a dropped client succeeded")
+	}
+
+	// a clean disconnect does not publish the will
+	dev.Connect().Wait()
+	disconnect(dev)
+	select {
+	case msg := <-wills:
+		t.Fatalf("will published on a clean disconnect: %q", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryBrokerSharedSubscriptions(t *testing.T) {
+	b := NewMemoryBroker()
+	pub := newMemoryClient(t, b, "pub")
+	w1, err := subscribe(newMemoryClient(t, b, "w1"), "$share/workers/jobs", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := subscribe(newMemoryClient(t, b, "w2"), "$share/workers/jobs", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []string{"1", "2"} {
+		if err := publish(pub, "jobs", []byte(job), QOS_AtLeastOnce, 0, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectPublish(t, w1, "1")
+	expectPublish(t, w2, "2")
+}
@@ -0,0 +1,289 @@
+package GoSDK
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+)
+
+const (
+	_HISTORY_DEFAULT_PAGE_SIZE = 100
+	// _REPLAY_DEFAULT_MAX_MESSAGES bounds the messages Replay holds in memory
+	_REPLAY_DEFAULT_MAX_MESSAGES = 100000
+)
+
+// ErrReplayTooLarge is returned by Replay when the history range holds more messages than
+// ReplayOptions.MaxMessages
+var ErrReplayTooLarge = errors.New("message history range is too large to replay")
+
+// HistoryMessage is a message kept in a system's message history
+type HistoryMessage struct {
+	Topic       string
+	Payload     []byte
+	Qos         int
+	Time        time.Time
+	UserID      string
+	IP          string
+	PayloadSize int
+}
+
+// HistoryQuery selects messages from the message history. Zero values do not filter.
+type HistoryQuery struct {
+	// Topic is a topic or a filter with + and # wildcards. Wildcard filters are applied on the client.
+	Topic string
+	Start time.Time
+	End   time.Time
+	// ClientID only keeps messages published by this user, device or client id
+	ClientID string
+	// PageSize is the number of messages fetched per request, 100 by default. Pages are requested
+	// by whole seconds, so it should exceed the messages published in any one second; the rest of
+	// a busier second is skipped.
+	PageSize int
+	// Limit stops the iterator after this many messages
+	Limit int
+}
+
+// MessageHistoryIterator walks the message history from the newest message to the oldest,
+// fetching a page at a time
+type MessageHistoryIterator struct {
+	d         *DevClient
+	systemKey string
+	q         HistoryQuery
+
+	page    []HistoryMessage
+	current HistoryMessage
+	before  time.Time
+	// seen holds the messages returned from the second before falls in, which the next page
+	// returns again
+	seen     map[string]bool
+	returned int
+	done     bool
+	err      error
+}
+
+// QueryMessageHistory returns an iterator over the messages matching q
+func (d *DevClient) QueryMessageHistory(systemKey string, q HistoryQuery) *MessageHistoryIterator {
+	if q.PageSize <= 0 {
+		q.PageSize = _HISTORY_DEFAULT_PAGE_SIZE
+	}
+	return &MessageHistoryIterator{d: d, systemKey: systemKey, q: q, before: q.End, seen: map[string]bool{}}
+}
+
+// Next advances to the next message, returning false when there are no more or a request failed
+func (it *MessageHistoryIterator) Next() bool {
+	return it.NextContext(context.Background())
+}
+
+// NextContext is Next with ctx passed to the page requests
+func (it *MessageHistoryIterator) NextContext(ctx context.Context) bool {
+	for {
+		if it.err != nil || (it.q.Limit > 0 && it.returned >= it.q.Limit) {
+			return false
+		}
+		if len(it.page) == 0 {
+			if it.done {
+				return false
+			}
+			if it.err = it.fetch(ctx); it.err != nil {
+				return false
+			}
+			continue
+		}
+		it.current = it.page[0]
+		it.page = it.page[1:]
+		if !it.matches(it.current) {
+			continue
+		}
+		it.returned++
+		return true
+	}
+}
+
+// Message returns the message Next moved to
+func (it *MessageHistoryIterator) Message() HistoryMessage {
+	return it.current
+}
+
+// Err returns the error that stopped the iterator, if any
+func (it *MessageHistoryIterator) Err() error {
+	return it.err
+}
+
+func (it *MessageHistoryIterator) matches(m HistoryMessage) bool {
+	if it.q.Topic != "" && !topicMatches(it.q.Topic, m.Topic) {
+		return false
+	}
+	if it.q.ClientID != "" && m.UserID != it.q.ClientID {
+		return false
+	}
+	return it.q.Start.IsZero() || !m.Time.Before(it.q.Start)
+}
+
+func (it *MessageHistoryIterator) fetch(ctx context.Context) error {
+	creds, err := it.d.credentials()
+	if err != nil {
+		return err
+	}
+	qry := map[string]string{"count": strconv.Itoa(it.q.PageSize)}
+	if it.q.Topic != "" && !strings.ContainsAny(it.q.Topic, "+#") {
+		qry["topic"] = it.q.Topic
+	}
+	if !it.before.IsZero() {
+		qry["last"] = strconv.FormatInt(it.before.Unix(), 10)
+	}
+	if !it.q.Start.IsZero() {
+		qry["start"] = strconv.FormatInt(it.q.Start.Unix(), 10)
+	}
+	if !it.q.End.IsZero() {
+		qry["stop"] = strconv.FormatInt(it.q.End.Unix(), 10)
+	}
+	resp, err := do(it.d, &CbReq{Method: "GET", Endpoint: _MH_PREAMBLE + it.systemKey, QueryString: query_to_string(qry), Context: ctx}, creds)
+	resp, err = mapResponse(resp, err)
+	if err != nil {
+		return err
+	}
+	rows, ok := resp.Body.([]interface{})
+	if !ok {
+		return fmt.Errorf("message history returned %T, expecting a list", resp.Body)
+	}
+	if len(rows) < it.q.PageSize {
+		it.done = true
+	}
+	oldest := it.before
+	var page []HistoryMessage
+	for _, row := range rows {
+		fields, ok := row.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("message history returned a %T entry, expecting a map", row)
+		}
+		m, err := parseHistoryMessage(fields)
+		if err != nil {
+			return err
+		}
+		if it.seen[historyKey(m)] {
+			continue
+		}
+		if oldest.IsZero() || m.Time.Before(oldest) {
+			oldest = m.Time
+		}
+		page = append(page, m)
+	}
+	if len(page) == 0 && !it.done {
+		// a full page of repeats: the rest of this second is out of reach, so move past it
+		oldest = time.Unix(it.before.Unix()-1, 0)
+		it.seen = map[string]bool{}
+	} else {
+		seen := map[string]bool{}
+		if oldest.Unix() == it.before.Unix() {
+			seen = it.seen
+		}
+		for _, m := range page {
+			if m.Time.Unix() == oldest.Unix() {
+				seen[historyKey(m)] = true
+			}
+		}
+		it.seen = seen
+	}
+	if !it.q.Start.IsZero() && !oldest.IsZero() && oldest.Before(it.q.Start) {
+		it.done = true
+	}
+	it.before = oldest
+	it.page = page
+	return nil
+}
+
+func historyKey(m HistoryMessage) string {
+	return fmt.Sprintf("%d|%s|%s|%s", m.Time.UnixNano(), m.Topic, m.UserID, m.Payload)
+}
+
+func parseHistoryMessage(fields map[string]interface{}) (HistoryMessage, error) {
+	m := HistoryMessage{}
+	m.Topic, _ = fields["topicid"].(string)
+	m.UserID, _ = fields["userid"].(string)
+	m.IP, _ = fields["ip"].(string)
+	switch p := fields["payload"].(type) {
+	case string:
+		m.Payload = []byte(p)
+	case nil:
+	default:
+		m.Payload = []byte(fmt.Sprint(p))
+	}
+	if t, ok := fields["time"]; ok && t != nil {
+		ts, err := parseRawTime(t)
+		if err != nil {
+			return m, fmt.Errorf("message history entry on %s: %w", m.Topic, err)
+		}
+		m.Time = ts
+	}
+	if qos, err := iWantAnInt(fields["qos"]); err == nil {
+		m.Qos = qos
+	}
+	if size, err := iWantAnInt(fields["payloadsize"]); err == nil {
+		m.PayloadSize = size
+	}
+	return m, nil
+}
+
+// ReplayOptions controls Replay
+type ReplayOptions struct {
+	// Speed scales the gaps between messages: 1 replays in real time, 2 twice as fast.
+	// Zero delivers every message as fast as possible.
+	Speed float64
+	// MaxMessages is the most messages Replay will hold in memory, 100000 by default
+	MaxMessages int
+}
+
+// Replay delivers the messages of it to deliver oldest first, spaced out as they were published
+// when opts.Speed is set. The history is served newest first, so the whole range is read into
+// memory before the first delivery; a range holding more than opts.MaxMessages fails with
+// ErrReplayTooLarge, and long ranges are best replayed in Start/End windows. deliver receives
+// messages in the form subscriptions do, so a live handler, Router.Dispatch or a function sending
+// on a subscription channel can be reused for backfilling.
+func Replay(ctx context.Context, it *MessageHistoryIterator, opts ReplayOptions, deliver func(*mqttTypes.Publish) error) error {
+	max := opts.MaxMessages
+	if max <= 0 {
+		max = _REPLAY_DEFAULT_MAX_MESSAGES
+	}
+	var msgs []HistoryMessage
+	for it.NextContext(ctx) {
+		if len(msgs) == max {
+			return fmt.Errorf("%w: more than %d messages", ErrReplayTooLarge, max)
+		}
+		msgs = append(msgs, it.Message())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].Time.Before(msgs[j].Time) })
+	for i, m := range msgs {
+		if opts.Speed > 0 && i > 0 {
+			gap := time.Duration(float64(m.Time.Sub(msgs[i-1].Time)) / opts.Speed)
+			if gap > 0 {
+				timer := time.NewTimer(gap)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path, ok := mqttTypes.NewTopicPath(m.Topic)
+		if !ok {
+			return fmt.Errorf("message history entry has invalid topic %q", m.Topic)
+		}
+		if err := deliver(&mqttTypes.Publish{Topic: path, Payload: m.Payload}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
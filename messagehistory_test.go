@@ -0,0 +1,258 @@
+package GoSDK
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+)
+
+type storedHistoryMessage struct {
+	topic, user, payload string
+	// at is in seconds, as the platform sends it
+	at float64
+}
+
+// historyServer serves /api/v/1/message/ newest first, asking for "last" by whole seconds
+// inclusively the way the platform does
+type historyServer struct {
+	msgs []storedHistoryMessage
+
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func (s *historyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	s.mu.Lock()
+	s.queries = append(s.queries, q)
+	s.mu.Unlock()
+	msgs := append([]storedHistoryMessage(nil), s.msgs...)
+	sort.SliceStable(msgs, func(i, j int) bool { return msgs[i].at > msgs[j].at })
+	count, _ := strconv.Atoi(q.Get("count"))
+	rows := []interface{}{}
+	for _, m := range msgs {
+		if len(rows) == count {
+			break
+		}
+		if t := q.Get("topic"); t != "" && t != m.topic {
+			continue
+		}
+		if last, err := strconv.ParseInt(q.Get("last"), 10, 64); err == nil && int64(m.at) > last {
+			continue
+		}
+		if start, err := strconv.ParseInt(q.Get("start"), 10, 64); err == nil && int64(m.at) < start {
+			continue
+		}
+		rows = append(rows, map[string]interface{}{
+			"topicid": m.topic, "userid": m.user, "payload": m.payload, "time": m.at, "qos": 0,
+		})
+	}
+	writeJSON(w, http.StatusOK, rows)
+}
+
+func (s *historyServer) requests() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.queries...)
+}
+
+func readHistory(t *testing.T, it *MessageHistoryIterator) []string {
+	t.Helper()
+	var got []string
+	for it.Next() {
+		got = append(got, string(it.Message().Payload))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	return got
+}
+
+func TestMessageHistoryPagesAcrossASecond(t *testing.T) {
+	srv := &historyServer{msgs: []storedHistoryMessage{
+		{"t", "u", "a", 102.5}, {"t", "u", "b", 101.9}, {"t", "u", "c", 101.5},
+		{"t", "u", "d", 101.2}, {"t", "u", "e", 100},
+	}}
+	d := newTestDevClient(t, srv)
+	got := readHistory(t, d.QueryMessageHistory("sys", HistoryQuery{PageSize: 3}))
+	if strings.Join(got, "") != "abcde" {
+		t.Fatalf("got %v, want every message once, newest first", got)
+	}
+	// the second page asks for second 101 again and the third finds only repeats of it
+	var lasts []string
+	for _, q := range srv.requests() {
+		lasts = append(lasts, q.Get("last"))
+	}
+	if strings.Join(lasts, ",") != ",101,101,100" {
+		t.Fatalf("requested pages before %v", lasts)
+	}
+
+	// a second with more messages than a page holds is skipped past rather than repeated
+	srv.queries = nil
+	got = readHistory(t, d.QueryMessageHistory("sys", HistoryQuery{PageSize: 2}))
+	if strings.Join(got, "") != "abce" {
+		t.Fatalf("got %v with a page smaller than a second", got)
+	}
+}
+
+func TestMessageHistoryFilters(t *testing.T) {
+	srv := &historyServer{msgs: []storedHistoryMessage{
+		{"sensors/1/temp", "dev1", "a", 105}, {"sensors/2/temp", "dev2", "b", 104},
+		{"sensors/1/humidity", "dev1", "c", 103}, {"other", "dev1", "d", 102},
+		{"sensors/3/temp", "dev1", "e", 101},
+	}}
+	d := newTestDevClient(t, srv)
+	for _, tc := range []struct {
+		name  string
+		q     HistoryQuery
+		want  string
+		topic string
+	}{
+		{name: "wildcard", q: HistoryQuery{Topic: "sensors/+/temp"}, want: "abe"},
+		{name: "multi-level wildcard", q: HistoryQuery{Topic: "sensors/#"}, want: "abce"},
+		{name: "exact topic", q: HistoryQuery{Topic: "other"}, want: "d", topic: "other"},
+		{name: "client id", q: HistoryQuery{ClientID: "dev1"}, want: "acde"},
+		{name: "wildcard and client id", q: HistoryQuery{Topic: "sensors/+/temp", ClientID: "dev1"}, want: "ae"},
+		{name: "limit", q: HistoryQuery{Limit: 2}, want: "ab"},
+		{name: "limit after filtering", q: HistoryQuery{ClientID: "dev1", Limit: 3, PageSize: 2}, want: "acd"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv.queries = nil
+			got := readHistory(t, d.QueryMessageHistory("sys", tc.q))
+			if strings.Join(got, "") != tc.want {
+				t.Fatalf("got %v, want %s", got, tc.want)
+			}
+			for _, q := range srv.requests() {
+				if q.Get("topic") != tc.topic {
+					t.Fatalf("requested topic %q, want %q", q.Get("topic"), tc.topic)
+				}
+			}
+		})
+	}
+
+	// the limit stops the paging as well as the iterator
+	srv.queries = nil
+	it := d.QueryMessageHistory("sys", HistoryQuery{Limit: 1, PageSize: 1})
+	readHistory(t, it)
+	if n := len(srv.requests()); n != 1 {
+		t.Fatalf("%d pages fetched for a limit of 1", n)
+	}
+}
+
+func TestReplayDeliversOldestFirstAtSpeed(t *testing.T) {
+	srv := &historyServer{msgs: []storedHistoryMessage{
+		{"a/b", "u", "3", 102}, {"a/b", "u", "2", 101}, {"a/c", "u", "1", 100},
+	}}
+	d := newTestDevClient(t, srv)
+	var got []string
+	deliver := func(p *mqttTypes.Publish) error {
+		got = append(got, p.Topic.Whole+"="+string(p.Payload))
+		return nil
+	}
+	start := time.Now()
+	// one second gaps at ten times speed
+	if err := Replay(context.Background(), d.QueryMessageHistory("sys", HistoryQuery{}), ReplayOptions{Speed: 10}, deliver); err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	if strings.Join(got, " ") != "a/c=1 a/b=2 a/b=3" {
+		t.Fatalf("delivered %v", got)
+	}
+	if elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("replay at speed 10 took %v, want about 200ms", elapsed)
+	}
+
+	got = nil
+	start = time.Now()
+	if err := Replay(context.Background(), d.QueryMessageHistory("sys", HistoryQuery{}), ReplayOptions{}, deliver); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || time.Since(start) > time.Second {
+		t.Fatalf("unpaced replay delivered %v in %v", got, time.Since(start))
+	}
+
+	stop := errors.New("stop")
+	if err := Replay(context.Background(), d.QueryMessageHistory("sys", HistoryQuery{}), ReplayOptions{}, func(*mqttTypes.Publish) error { return stop }); err != stop {
+		t.Fatalf("deliver error came back as %v", err)
+	}
+}
+
+func TestReplayStopsWhenCancelled(t *testing.T) {
+	srv := &historyServer{msgs: []storedHistoryMessage{
+		{"a", "u", "2", 160}, {"a", "u", "1", 100},
+	}}
+	d := newTestDevClient(t, srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	delivered := make(chan struct{}, 2)
+	done := make(chan error, 1)
+	go func() {
+		done <- Replay(ctx, d.QueryMessageHistory("sys", HistoryQuery{}), ReplayOptions{Speed: 1}, func(*mqttTypes.Publish) error {
+			delivered <- struct{}{}
+			return nil
+		})
+	}()
+	// the second message is a minute after the first
+	<-delivered
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) || len(delivered) != 0 {
+			t.Fatalf("cancelled replay gave %v after %d more deliveries", err, len(delivered))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay kept waiting for the next message")
+	}
+}
+
+func TestReplayCancelsThePageRequest(t *testing.T) {
+	arrived := make(chan struct{})
+	d := newTestDevClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Replay(ctx, d.QueryMessageHistory("sys", HistoryQuery{}), ReplayOptions{}, func(*mqttTypes.Publish) error { return nil })
+	}()
+	<-arrived
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("cancelled fetch gave %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the page request ignored the context")
+	}
+}
+
+func TestReplayRefusesRangesOverTheLimit(t *testing.T) {
+	srv := &historyServer{msgs: []storedHistoryMessage{
+		{"a", "u", "3", 102}, {"a", "u", "2", 101}, {"a", "u", "1", 100},
+	}}
+	d := newTestDevClient(t, srv)
+	var delivered int
+	err := Replay(context.Background(), d.QueryMessageHistory("sys", HistoryQuery{}), ReplayOptions{MaxMessages: 2}, func(*mqttTypes.Publish) error {
+		delivered++
+		return nil
+	})
+	if !errors.Is(err, ErrReplayTooLarge) || delivered != 0 {
+		t.Fatalf("got %v after %d deliveries, want ErrReplayTooLarge before any", err, delivered)
+	}
+	if err := Replay(context.Background(), d.QueryMessageHistory("sys", HistoryQuery{}), ReplayOptions{MaxMessages: 3}, func(*mqttTypes.Publish) error { return nil }); err != nil {
+		t.Fatalf("range at the limit: %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package GoSDK
 
 import (
 	"crypto/tls"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -48,42 +47,28 @@ func (b *client) NewClientID() string {
 
 // InitializeMQTT allocates the mqtt client for the user. an empty string can be passed as the second argument for the user client
 func (u *UserClient) InitializeMQTT(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket) error {
-	mqc, err := newMqttClient(u.UserToken, u.SystemKey, u.SystemSecret, clientid, timeout, u.MqttAddr, ssl, lastWill, true)
+	mqc, err := newMqttClient(u.getToken(), u.SystemKey, u.SystemSecret, clientid, timeout, u.MqttAddr, ssl, lastWill, true)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, u.mqttToken)
 	u.MQTTClient = mqc
 	return nil
 }
 
 func (u *UserClient) InitializeMQTTWithCallback(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, callbacks *Callbacks) error {
-	mqc, err := newMqttClientWithCallbacks(u.UserToken, u.SystemKey, u.SystemSecret, clientid, timeout, u.MqttAddr, ssl, lastWill, callbacks)
+	mqc, err := newMqttClientWithCallbacks(u.getToken(), u.SystemKey, u.SystemSecret, clientid, timeout, u.MqttAddr, ssl, lastWill, callbacks)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, u.mqttToken)
 	u.MQTTClient = mqc
 	return nil
 }
 
+// AuthenticateMQTT logs the user in through the MQTT auth broker and waits up to 10 seconds for the token
 func (u *UserClient) AuthenticateMQTT(username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) error {
-	mqc, err := newMqttAuthClient(username, password, systemKey, systemSecret, timeout, u.MqttAuthAddr, ssl)
-	if err != nil {
-		return err
-	}
-	subChan, err := subscribe(mqc, subTopic, 2)
-	if err != nil {
-		return err
-	}
-	select {
-	case data := <-subChan:
-		authData := data.Payload
-		tokLen := binary.BigEndian.Uint16(authData[:2])
-		tok := string(authData[2 : tokLen+2])
-		u.UserToken = tok
-	case <-time.After(10 * time.Second):
-		return fmt.Errorf("Timed out waiting for MQTT auth response")
-	}
-	return nil
+	return authenticateMQTTWithDefaultWait(u, _MQTT_AUTH_USER_WAIT, u.MqttAuthAddr, username, password, systemKey, systemSecret, subTopic, timeout, ssl)
 }
 
 // InitializeMQTT allocates the mqtt client for the developer. the second argument is a
@@ -91,50 +76,37 @@ func (u *UserClient) AuthenticateMQTT(username, password, systemKey, systemSecre
 // topics are isolated across systems, so in order to communicate with a specific
 // system, you must supply the system key
 func (d *DevClient) InitializeMQTT(clientid, systemkey string, timeout int, ssl *tls.Config, lastWill *LastWillPacket) error {
-	mqc, err := newMqttClient(d.DevToken, systemkey, "", clientid, timeout, d.MqttAddr, ssl, lastWill, true)
+	mqc, err := newMqttClient(d.getToken(), systemkey, "", clientid, timeout, d.MqttAddr, ssl, lastWill, true)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, d.mqttToken)
 	d.MQTTClient = mqc
 	return nil
 }
 
 func (d *DevClient) InitializeMQTTWithCallback(clientid, systemkey string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, callbacks *Callbacks) error {
-	mqc, err := newMqttClientWithCallbacks(d.DevToken, systemkey, "", clientid, timeout, d.MqttAddr, ssl, lastWill, callbacks)
+	mqc, err := newMqttClientWithCallbacks(d.getToken(), systemkey, "", clientid, timeout, d.MqttAddr, ssl, lastWill, callbacks)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, d.mqttToken)
 	d.MQTTClient = mqc
 	return nil
 }
 
+// AuthenticateMQTT gets a developer token from the MQTT auth broker, allowing it a minute to answer
 func (d *DevClient) AuthenticateMQTT(username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) error {
-	mqc, err := newMqttAuthClient(username, password, systemKey, systemSecret, timeout, d.MqttAuthAddr, ssl)
-	if err != nil {
-		return err
-	}
-	subChan, err := subscribe(mqc, subTopic, 2)
-	if err != nil {
-		return err
-	}
-	select {
-	case data := <-subChan:
-		authData := data.Payload
-		tokLen := binary.BigEndian.Uint16(authData[:2])
-		tok := string(authData[2 : tokLen+2])
-		d.DevToken = tok
-	case <-time.After(60 * time.Second):
-		return fmt.Errorf("Timed out waiting for MQTT auth response")
-	}
-	return nil
+	return authenticateMQTTWithDefaultWait(d, _MQTT_AUTH_DEVICE_WAIT, d.MqttAuthAddr, username, password, systemKey, systemSecret, subTopic, timeout, ssl)
 }
 
 // InitializeMQTT allocates the mqtt client for the user. an empty string can be passed as the second argument for the user client
 func (d *DeviceClient) InitializeMQTT(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket) error {
-	mqc, err := newMqttClient(d.DeviceToken, d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, true)
+	mqc, err := newMqttClient(d.getToken(), d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, true)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, d.mqttToken)
 	d.MQTTClient = mqc
 	return nil
 }
@@ -149,10 +121,11 @@ func (d *DeviceClient) InitializeMQTTWithUsernamePassword(clientid, username, pa
 }
 
 func (d *DeviceClient) InitializeMQTTWithoutAutoReconnect(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket) error {
-	mqc, err := newMqttClient(d.DeviceToken, d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, false)
+	mqc, err := newMqttClient(d.getToken(), d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, false)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, d.mqttToken)
 	d.MQTTClient = mqc
 	return nil
 }
@@ -172,51 +145,38 @@ func (d *DeviceClient) InitializeMQTTWithMTLS(username, clientid string, ignore
 }
 
 func (d *DeviceClient) InitializeJWTMQTT(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket) error {
-	mqc, err := newJwtMqttClient(d.DeviceToken, d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, true)
+	mqc, err := newJwtMqttClient(d.getToken(), d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, true)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, d.mqttToken)
 	d.MQTTClient = mqc
 	return nil
 }
 
 func (d *DeviceClient) InitializeJWTMQTTWithoutAutoReconnect(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket) error {
-	mqc, err := newJwtMqttClient(d.DeviceToken, d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, false)
+	mqc, err := newJwtMqttClient(d.getToken(), d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, false)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, d.mqttToken)
 	d.MQTTClient = mqc
 	return nil
 }
 
 func (d *DeviceClient) InitializeMQTTWithCallback(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, callbacks *Callbacks) error {
-	mqc, err := newMqttClientWithCallbacks(d.DeviceToken, d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, callbacks)
+	mqc, err := newMqttClientWithCallbacks(d.getToken(), d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, callbacks)
 	if err != nil {
 		return err
 	}
+	useMQTTTokenSource(mqc, d.mqttToken)
 	d.MQTTClient = mqc
 	return nil
 }
 
+// AuthenticateMQTT is the device login over MQTT; like the developer form it waits up to a minute
 func (d *DeviceClient) AuthenticateMQTT(username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) error {
-	mqc, err := newMqttAuthClient(username, password, systemKey, systemSecret, timeout, d.MqttAuthAddr, ssl)
-	if err != nil {
-		return err
-	}
-	subChan, err := subscribe(mqc, subTopic, 2)
-	if err != nil {
-		return err
-	}
-	select {
-	case data := <-subChan:
-		authData := data.Payload
-		tokLen := binary.BigEndian.Uint16(authData[:2])
-		tok := string(authData[2 : tokLen+2])
-		d.DeviceToken = tok
-	case <-time.After(60 * time.Second):
-		return fmt.Errorf("Timed out waiting for MQTT auth response")
-	}
-	return nil
+	return authenticateMQTTWithDefaultWait(d, _MQTT_AUTH_DEVICE_WAIT, d.MqttAuthAddr, username, password, systemKey, systemSecret, subTopic, timeout, ssl)
 }
 
 // Publish publishes a message to the specified mqtt topic
@@ -366,6 +326,8 @@ type mqttBaseClient struct {
 	address                                  string
 	token, systemKey, systemSecret, clientID string
 	timeout                                  int
+	subs                                     *subscriptionManager
+	creds                                    *mqttCredentials
 }
 
 func newJwtMqttClient(token, systemkey, systemsecret, clientid string, timeout int, address string, ssl *tls.Config, lastWill *LastWillPacket, autoReconnect bool) (MqttClient, error) {
@@ -384,8 +346,15 @@ func newJwtMqttClient(token, systemkey, systemsecret, clientid string, timeout i
 	if lastWill != nil {
 		o.SetWill(lastWill.Topic, lastWill.Body, uint8(lastWill.Qos), lastWill.Retain)
 	}
+	subs := newSubscriptionManager()
+	creds := newMqttCredentials("", token, true)
+	creds.listen(subs)
+	o.SetCredentialsProvider(creds.get)
+	cb := subs.wrap(nil)
+	o.SetOnConnectHandler(cb.OnConnectCallback)
+	o.SetConnectionLostHandler(cb.OnConnectionLostCallback)
 	cli := mqtt.NewClient(o)
-	mqc := &mqttBaseClient{cli, address, token, systemkey, systemsecret, clientid, timeout}
+	mqc := &mqttBaseClient{cli, address, token, systemkey, systemsecret, clientid, timeout, subs, creds}
 	ret := mqc.Connect()
 	ret.Wait()
 	return mqc, ret.Error()
@@ -411,8 +380,15 @@ func newMqttClient(token, systemkey, systemsecret, clientid string, timeout int,
 	if lastWill != nil {
 		o.SetWill(lastWill.Topic, lastWill.Body, uint8(lastWill.Qos), lastWill.Retain)
 	}
+	subs := newSubscriptionManager()
+	creds := newMqttCredentials(token, systemkey, false)
+	creds.listen(subs)
+	o.SetCredentialsProvider(creds.get)
+	cb := subs.wrap(nil)
+	o.SetOnConnectHandler(cb.OnConnectCallback)
+	o.SetConnectionLostHandler(cb.OnConnectionLostCallback)
 	cli := mqtt.NewClient(o)
-	mqc := &mqttBaseClient{cli, address, token, systemkey, systemsecret, clientid, timeout}
+	mqc := &mqttBaseClient{cli, address, token, systemkey, systemsecret, clientid, timeout, subs, creds}
 	ret := mqc.Connect()
 	ret.Wait()
 	return mqc, ret.Error()
@@ -434,36 +410,15 @@ func newMqttClientWithCallbacks(token, systemkey, systemsecret, clientid string,
 	if lastWill != nil {
 		o.SetWill(lastWill.Topic, lastWill.Body, uint8(lastWill.Qos), lastWill.Retain)
 	}
-	if callbacks.OnConnectionLostCallback != nil {
-		o.SetConnectionLostHandler(callbacks.OnConnectionLostCallback)
-	}
-	if callbacks.OnConnectCallback != nil {
-		o.SetOnConnectHandler(callbacks.OnConnectCallback)
-	}
-	cli := mqtt.NewClient(o)
-	mqc := &mqttBaseClient{cli, address, token, systemkey, systemsecret, clientid, timeout}
-	ret := mqc.Connect()
-	ret.Wait()
-	return mqc, ret.Error()
-}
-
-func newMqttAuthClient(username, password, systemkey, systemsecret string, timeout int, address string, ssl *tls.Config) (MqttClient, error) {
-	o := mqtt.NewClientOptions()
-	o.SetAutoReconnect(false)
-	o.SetConnectionLostHandler(nil)
-	if ssl != nil {
-		o.AddBroker("tls://" + address)
-		o.SetTLSConfig(ssl)
-	} else {
-		o.AddBroker("tcp://" + address)
-	}
-	clientid := username + ":" + password
-	o.SetClientID(clientid)
-	o.SetUsername(systemkey)
-	o.SetPassword(systemsecret)
-	o.SetConnectTimeout(time.Duration(timeout) * time.Second)
+	subs := newSubscriptionManager()
+	creds := newMqttCredentials(token, systemkey, false)
+	creds.listen(subs)
+	o.SetCredentialsProvider(creds.get)
+	cb := subs.wrap(callbacks)
+	o.SetOnConnectHandler(cb.OnConnectCallback)
+	o.SetConnectionLostHandler(cb.OnConnectionLostCallback)
 	cli := mqtt.NewClient(o)
-	mqc := &mqttBaseClient{cli, address, "", systemkey, systemsecret, clientid, timeout}
+	mqc := &mqttBaseClient{cli, address, token, systemkey, systemsecret, clientid, timeout, subs, creds}
 	ret := mqc.Connect()
 	ret.Wait()
 	return mqc, ret.Error()
@@ -486,16 +441,31 @@ func publishGetToken(c MqttClient, topic string, data []byte, qos int, mid uint1
 }
 
 func subscribe(c MqttClient, topic string, qos int) (<-chan *mqttTypes.Publish, error) {
+	return subscribeWithOptions(c, topic, qos, SubscribeOptions{})
+}
+
+func subscribeWithOptions(c MqttClient, topic string, qos int, opts SubscribeOptions) (<-chan *mqttTypes.Publish, error) {
 	if c == nil {
 		return nil, errors.New("MQTTClient is uninitialized")
 	}
-	pubs := make(chan *mqttTypes.Publish, 50)
-	ret := c.Subscribe(topic, uint8(qos), func(client mqtt.Client, msg mqtt.Message) {
+	var onOverflow func(*mqttTypes.Publish)
+	if opts.OnOverflow != nil {
+		onOverflow = func(msg *mqttTypes.Publish) { opts.OnOverflow(topic, msg) }
+	}
+	pubs := newDeliveryQueue(topic, opts.BufferSize, opts.Overflow, onOverflow)
+	handler := func(client mqtt.Client, msg mqtt.Message) {
 		path, _ := mqttTypes.NewTopicPath(msg.Topic())
-		pubs <- &mqttTypes.Publish{Topic: path, Payload: msg.Payload()}
-	})
+		pubs.send(&mqttTypes.Publish{Topic: path, Payload: msg.Payload()})
+	}
+	ret := c.Subscribe(topic, uint8(qos), handler)
 	ret.WaitTimeout(1 * time.Second)
-	return pubs, ret.Error()
+	if err := ret.Error(); err != nil {
+		return pubs.ch, err
+	}
+	if subs := subscriptionsOf(c); subs != nil {
+		subs.add(topic, uint8(qos), handler, pubs)
+	}
+	return pubs.ch, nil
 }
 
 func unsubscribe(c MqttClient, topic string) error {
@@ -504,17 +474,82 @@ func unsubscribe(c MqttClient, topic string) error {
 	}
 	ret := c.Unsubscribe(topic)
 	ret.WaitTimeout(1 * time.Second)
+	if subs := subscriptionsOf(c); subs != nil {
+		subs.remove(topic)
+	}
 	return ret.Error()
 }
 
+// PublishMQTT publishes on c. It and the functions below are for packages that build on an
+// MqttClient rather than on one of the client types.
+func PublishMQTT(c MqttClient, topic string, data []byte, qos int, retain bool) error {
+	return publish(c, topic, data, qos, 0, retain)
+}
+
+// SubscribeMQTT subscribes c to topic. The subscription is restored after reconnects and its
+// channel is closed by UnsubscribeMQTT.
+func SubscribeMQTT(c MqttClient, topic string, qos int) (<-chan *mqttTypes.Publish, error) {
+	return subscribe(c, topic, qos)
+}
+
+// UnsubscribeMQTT ends a subscription made with SubscribeMQTT
+func UnsubscribeMQTT(c MqttClient, topic string) error {
+	return unsubscribe(c, topic)
+}
+
+// ListenMQTTEvents calls fn on the connection events of c until the returned function is called.
+// fn is called synchronously from the MQTT client and must not block.
+func ListenMQTTEvents(c MqttClient, fn func(MQTTEvent)) (func(), error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	subs := subscriptionsOf(c)
+	if subs == nil {
+		return nil, errors.New("MQTTClient does not track its connection")
+	}
+	return subs.listen(fn), nil
+}
+
 func disconnect(c MqttClient) error {
 	if c == nil {
 		return errors.New("MQTTClient is uninitialized")
 	}
 	c.Disconnect(250)
+	if subs := subscriptionsOf(c); subs != nil {
+		subs.closeAll()
+	}
 	return nil
 }
 
+// topicMatches reports whether topic matches filter, treating a shared subscription filter as
+// the filter it wraps. Wildcards at the start of a filter do not match $ topics.
+func topicMatches(filter, topic string) bool {
+	if strings.HasPrefix(filter, "$share/") {
+		parts := strings.SplitN(filter, "/", 3)
+		if len(parts) != 3 {
+			return false
+		}
+		filter = parts[2]
+	}
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	if strings.HasPrefix(topic, "$") && (f[0] == "+" || f[0] == "#") {
+		return false
+	}
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
 func getMqttTopicsWithQuery(c cbClient, systemKey string, columns []string, pageSize, pageNum int, descending bool) ([]map[string]interface{}, error) {
 	creds, err := c.credentials()
 	if err != nil {
@@ -0,0 +1,172 @@
+package GoSDK
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+// Default waits for the auth response when no context is given. They are the waits the per-client
+// implementations used before the flow was shared.
+const (
+	_MQTT_AUTH_USER_WAIT   = 10 * time.Second
+	_MQTT_AUTH_DEVICE_WAIT = 60 * time.Second
+)
+
+var ErrMalformedMQTTAuthResponse = errors.New("malformed MQTT auth response")
+
+// MQTTAuthResult is what the MQTT auth broker returned. RefreshToken and ExpiresAt are only set
+// when the response carries them.
+type MQTTAuthResult struct {
+	Token        string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// AuthenticateMQTTContext authenticates the user through the MQTT auth broker and stores the token,
+// and the refresh token and expiry when present, on the client. ctx bounds the connect and the
+// wait for the response.
+func (u *UserClient) AuthenticateMQTTContext(ctx context.Context, username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) (*MQTTAuthResult, error) {
+	return authenticateMQTT(ctx, u, u.MqttAuthAddr, username, password, systemKey, systemSecret, subTopic, timeout, ssl)
+}
+
+// AuthenticateMQTTContext is the device form of UserClient.AuthenticateMQTTContext
+func (d *DeviceClient) AuthenticateMQTTContext(ctx context.Context, username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) (*MQTTAuthResult, error) {
+	return authenticateMQTT(ctx, d, d.MqttAuthAddr, username, password, systemKey, systemSecret, subTopic, timeout, ssl)
+}
+
+// AuthenticateMQTTContext is the developer form of UserClient.AuthenticateMQTTContext
+func (d *DevClient) AuthenticateMQTTContext(ctx context.Context, username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) (*MQTTAuthResult, error) {
+	return authenticateMQTT(ctx, d, d.MqttAuthAddr, username, password, systemKey, systemSecret, subTopic, timeout, ssl)
+}
+
+func authenticateMQTTWithDefaultWait(client cbClient, wait time.Duration, address, username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	_, err := authenticateMQTT(ctx, client, address, username, password, systemKey, systemSecret, subTopic, timeout, ssl)
+	return err
+}
+
+// authenticateMQTT connects a temporary client to the auth broker, waits for the response on
+// subTopic and always unsubscribes and disconnects before returning
+func authenticateMQTT(ctx context.Context, client cbClient, address, username, password, systemKey, systemSecret, subTopic string, timeout int, ssl *tls.Config) (*MQTTAuthResult, error) {
+	if address == "" {
+		return nil, errors.New("no MQTT auth address is configured")
+	}
+	if subTopic == "" {
+		return nil, errors.New("a topic for the MQTT auth response is required")
+	}
+	mqc, err := newMqttAuthClient(ctx, username, password, systemKey, systemSecret, timeout, address, ssl)
+	if err != nil {
+		return nil, err
+	}
+	defer mqc.Disconnect(250)
+	subChan, err := subscribe(mqc, subTopic, 2)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to the MQTT auth response: %w", err)
+	}
+	defer unsubscribe(mqc, subTopic)
+	var res *MQTTAuthResult
+	select {
+	case data, ok := <-subChan:
+		if !ok {
+			return nil, errors.New("MQTT auth subscription ended without a response")
+		}
+		if res, err = parseMQTTAuthResponse(data.Payload); err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	client.setToken(res.Token)
+	if res.RefreshToken != "" {
+		client.setRefreshToken(map[string]interface{}{"refresh_token": res.RefreshToken})
+	}
+	if !res.ExpiresAt.IsZero() {
+		client.setExpiresAt(float64(res.ExpiresAt.Unix()))
+	}
+	return res, nil
+}
+
+// parseMQTTAuthResponse reads the auth response frame: the token as a 2 byte big endian length
+// followed by its bytes, optionally followed by the refresh token in the same form and then the
+// expiry as 8 byte big endian unix seconds
+func parseMQTTAuthResponse(frame []byte) (*MQTTAuthResult, error) {
+	readString := func(what string) (string, error) {
+		if len(frame) < 2 {
+			return "", fmt.Errorf("%w: %d bytes are too short for the %s length", ErrMalformedMQTTAuthResponse, len(frame), what)
+		}
+		n := int(binary.BigEndian.Uint16(frame))
+		if len(frame)-2 < n {
+			return "", fmt.Errorf("%w: %s is %d bytes but only %d follow", ErrMalformedMQTTAuthResponse, what, n, len(frame)-2)
+		}
+		s := string(frame[2 : 2+n])
+		frame = frame[2+n:]
+		return s, nil
+	}
+	res := &MQTTAuthResult{}
+	var err error
+	if res.Token, err = readString("token"); err != nil {
+		return nil, err
+	}
+	if res.Token == "" {
+		return nil, fmt.Errorf("%w: empty token", ErrMalformedMQTTAuthResponse)
+	}
+	if len(frame) == 0 {
+		return res, nil
+	}
+	if res.RefreshToken, err = readString("refresh token"); err != nil {
+		return nil, err
+	}
+	switch len(frame) {
+	case 0:
+	case 8:
+		if secs := binary.BigEndian.Uint64(frame); secs != 0 {
+			res.ExpiresAt = time.Unix(int64(secs), 0)
+		}
+	default:
+		return nil, fmt.Errorf("%w: expiry is %d bytes, expecting 8", ErrMalformedMQTTAuthResponse, len(frame))
+	}
+	return res, nil
+}
+
+// newMqttAuthClient connects to the auth broker, giving up when ctx is done
+func newMqttAuthClient(ctx context.Context, username, password, systemkey, systemsecret string, timeout int, address string, ssl *tls.Config) (MqttClient, error) {
+	o := mqtt.NewClientOptions()
+	o.SetAutoReconnect(false)
+	o.SetConnectionLostHandler(nil)
+	if ssl != nil {
+		o.AddBroker("tls://" + address)
+		o.SetTLSConfig(ssl)
+	} else {
+		o.AddBroker("tcp://" + address)
+	}
+	clientid := username + ":" + password
+	o.SetClientID(clientid)
+	o.SetUsername(systemkey)
+	o.SetPassword(systemsecret)
+	o.SetConnectTimeout(time.Duration(timeout) * time.Second)
+	cli := mqtt.NewClient(o)
+	mqc := &mqttBaseClient{cli, address, "", systemkey, systemsecret, clientid, timeout, nil, nil}
+	ret := mqc.Connect()
+	connected := make(chan struct{})
+	go func() {
+		ret.Wait()
+		close(connected)
+	}()
+	select {
+	case <-connected:
+	case <-ctx.Done():
+		mqc.Disconnect(0)
+		return nil, ctx.Err()
+	}
+	if err := ret.Error(); err != nil {
+		return nil, err
+	}
+	return mqc, nil
+}
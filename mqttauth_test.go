@@ -0,0 +1,127 @@
+package GoSDK
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/clearblade/paho.mqtt.golang/packets"
+)
+
+func authFrame(token string, extra ...byte) []byte {
+	frame := []byte{byte(len(token) >> 8), byte(len(token))}
+	frame = append(frame, token...)
+	return append(frame, extra...)
+}
+
+// authFrameWithRefresh is a frame carrying the token, the refresh token and the expiry
+func authFrameWithRefresh(token, refresh string, expires int64) []byte {
+	frame := authFrame(token, byte(len(refresh)>>8), byte(len(refresh)))
+	frame = append(frame, refresh...)
+	return binary.BigEndian.AppendUint64(frame, uint64(expires))
+}
+
+func TestParseMQTTAuthResponse(t *testing.T) {
+	full := authFrameWithRefresh("tok", "ref", 1700000000)
+	for _, tc := range []struct {
+		name    string
+		frame   []byte
+		token   string
+		refresh string
+		expires int64
+		bad     bool
+	}{
+		{name: "empty frame", frame: nil, bad: true},
+		{name: "short frame", frame: []byte{0x00}, bad: true},
+		{name: "oversized length", frame: []byte{0xff, 0xff, 'a', 'b'}, bad: true},
+		{name: "length one past the end", frame: []byte{0x00, 0x03, 'a', 'b'}, bad: true},
+		{name: "empty token", frame: []byte{0x00, 0x00}, bad: true},
+		{name: "token only", frame: authFrame("tok"), token: "tok"},
+		{name: "refresh token without expiry", frame: authFrame("tok", 0x00, 0x03, 'r', 'e', 'f'), token: "tok", refresh: "ref"},
+		{name: "refresh token and expiry", frame: full, token: "tok", refresh: "ref", expires: 1700000000},
+		{name: "expiry without a refresh token", frame: authFrameWithRefresh("tok", "", 1700000000), token: "tok", expires: 1700000000},
+		{name: "zero expiry", frame: authFrameWithRefresh("tok", "ref", 0), token: "tok", refresh: "ref"},
+		{name: "cut off refresh length", frame: authFrame("tok", 0x00), bad: true},
+		{name: "truncated refresh token", frame: authFrame("tok", 0x00, 0x09, 'r', 'e'), bad: true},
+		{name: "truncated expiry", frame: full[:len(full)-3], bad: true},
+		{name: "bytes after the expiry", frame: append(append([]byte(nil), full...), 0x01), bad: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parseMQTTAuthResponse(tc.frame)
+			if tc.bad {
+				if !errors.Is(err, ErrMalformedMQTTAuthResponse) {
+					t.Fatalf("got %+v, %v; want ErrMalformedMQTTAuthResponse", res, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			var expires time.Time
+			if tc.expires != 0 {
+				expires = time.Unix(tc.expires, 0)
+			}
+			if res.Token != tc.token || res.RefreshToken != tc.refresh || !res.ExpiresAt.Equal(expires) {
+				t.Fatalf("got %+v, want token %q refresh %q expiring %v", res, tc.token, tc.refresh, expires)
+			}
+		})
+	}
+}
+
+func TestAuthenticateMQTTStoresToken(t *testing.T) {
+	b := newTCPBroker(t)
+	b.onSubscribe = func(c *tcpBrokerConn, topic string) {
+		c.publish(topic, authFrameWithRefresh("mqtt-token", "mqtt-refresh", 1700000000))
+	}
+	u := NewUserClient("key", "secret", "user@example.com", "pw")
+	u.MqttAuthAddr = b.addr()
+	res, err := u.AuthenticateMQTTContext(context.Background(), "user@example.com", "pw", "key", "secret", "auth/resp", 5, nil)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if res.Token != "mqtt-token" || u.UserToken != "mqtt-token" {
+		t.Fatalf("got result %q and client token %q", res.Token, u.UserToken)
+	}
+	if u.getRefreshToken() != "mqtt-refresh" || u.getExpiresAt() != 1700000000 {
+		t.Fatalf("client refresh token %q expiring %v", u.getRefreshToken(), u.getExpiresAt())
+	}
+	connects := b.connectPackets()
+	if len(connects) != 1 || connects[0].ClientIdentifier != "user@example.com:pw" || connects[0].Username != "key" {
+		t.Fatalf("unexpected CONNECTs: %s", b.clientIDs())
+	}
+	waitFor(t, "the auth client to unsubscribe", func() bool {
+		unsubs := b.unsubscribed()
+		return len(unsubs) == 1 && unsubs[0] == "auth/resp"
+	})
+}
+
+func TestAuthenticateMQTTReportsContextError(t *testing.T) {
+	b := newTCPBroker(t)
+	b.onConnect = func(*packets.ConnectPacket) byte { return packets.Accepted }
+	d := NewDeviceClient("key", "secret", "dev", "active")
+	d.MqttAuthAddr = b.addr()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := d.AuthenticateMQTTContext(ctx, "dev", "active", "key", "secret", "auth/resp", 5, nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded as-is", err)
+	}
+	if d.DeviceToken != "" {
+		t.Fatalf("token set without a response: %q", d.DeviceToken)
+	}
+}
+
+func TestAuthenticateMQTTRejectsMalformedResponse(t *testing.T) {
+	b := newTCPBroker(t)
+	b.onSubscribe = func(c *tcpBrokerConn, topic string) {
+		c.publish(topic, []byte{0x00, 0x20, 'x'})
+	}
+	d := NewDevClient("dev@example.com", "pw")
+	d.MqttAuthAddr = b.addr()
+	_, err := d.AuthenticateMQTTContext(context.Background(), "dev@example.com", "pw", "key", "secret", "auth/resp", 5, nil)
+	if !errors.Is(err, ErrMalformedMQTTAuthResponse) {
+		t.Fatalf("got %v, want ErrMalformedMQTTAuthResponse", err)
+	}
+}
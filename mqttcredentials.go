@@ -0,0 +1,181 @@
+package GoSDK
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// _MQTT_TOKEN_REFRESH_MARGIN is how long before it expires a token is renewed for a reconnect
+const _MQTT_TOKEN_REFRESH_MARGIN = time.Minute
+
+// MQTTCredentialsProvider returns the username and password for the next MQTT connect. JWT
+// devices should sign a new token here, returning it as the password.
+type MQTTCredentialsProvider func() (username, password string, err error)
+
+// mqttTokenSource returns the platform token to connect with. force is set when a connect with
+// the previous token did not succeed, so a cached token is likely no longer accepted.
+type mqttTokenSource func(force bool) (string, error)
+
+// mqttCredentials hands the credentials to every connect of an MQTT client, so reconnects
+// do not replay a token that has since expired. Failures keep the last known credentials.
+type mqttCredentials struct {
+	mu              sync.Mutex
+	username        string
+	password        string
+	tokenIsPassword bool
+	source          mqttTokenSource
+	provider        MQTTCredentialsProvider
+	// attempted is set while a connect with the current credentials has not succeeded
+	attempted bool
+	lastError error
+}
+
+func newMqttCredentials(username, password string, tokenIsPassword bool) *mqttCredentials {
+	return &mqttCredentials{username: username, password: password, tokenIsPassword: tokenIsPassword}
+}
+
+// get is installed as the client's credentials provider. paho calls it from the connect
+// goroutine; the refresh runs without m.mu held since it may log in over HTTP.
+func (m *mqttCredentials) get() (string, string) {
+	m.mu.Lock()
+	force := m.attempted
+	m.attempted = true
+	provider, source := m.provider, m.source
+	m.mu.Unlock()
+
+	var username, password, token string
+	var err error
+	switch {
+	case provider != nil:
+		username, password, err = provider()
+	case source != nil:
+		token, err = source(force)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case err != nil:
+		m.lastError = err
+	case provider != nil:
+		m.username, m.password, m.lastError = username, password, nil
+	case source != nil:
+		if m.tokenIsPassword {
+			m.password = token
+		} else {
+			m.username = token
+		}
+		m.lastError = nil
+	}
+	return m.username, m.password
+}
+
+func (m *mqttCredentials) connected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempted = false
+}
+
+// listen clears the failed attempt marker whenever the client connects
+func (m *mqttCredentials) listen(subs *subscriptionManager) {
+	if subs == nil {
+		return
+	}
+	subs.listen(func(ev MQTTEvent) {
+		if ev.Kind == MQTTConnected || ev.Kind == MQTTReconnected {
+			m.connected()
+		}
+	})
+}
+
+func (m *mqttCredentials) setSource(source mqttTokenSource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.source = source
+}
+
+func (m *mqttCredentials) setProvider(provider MQTTCredentialsProvider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.provider = provider
+}
+
+func credentialsOf(c MqttClient) *mqttCredentials {
+	if base, ok := c.(*mqttBaseClient); ok {
+		return base.creds
+	}
+	return nil
+}
+
+// tokenExpiring reports whether a token expiring at expiresAt, a unix time in seconds, needs renewing
+func tokenExpiring(expiresAt float64) bool {
+	return expiresAt > 0 && time.Now().Add(_MQTT_TOKEN_REFRESH_MARGIN).Unix() >= int64(expiresAt)
+}
+
+// SetMQTTCredentialsProvider replaces the credentials used when the MQTT client reconnects
+func (u *UserClient) SetMQTTCredentialsProvider(provider MQTTCredentialsProvider) error {
+	return setMQTTCredentialsProvider(u.MQTTClient, provider)
+}
+
+// SetMQTTCredentialsProvider replaces the credentials used when the MQTT client reconnects
+func (d *DeviceClient) SetMQTTCredentialsProvider(provider MQTTCredentialsProvider) error {
+	return setMQTTCredentialsProvider(d.MQTTClient, provider)
+}
+
+// SetMQTTCredentialsProvider replaces the credentials used when the MQTT client reconnects
+func (d *DevClient) SetMQTTCredentialsProvider(provider MQTTCredentialsProvider) error {
+	return setMQTTCredentialsProvider(d.MQTTClient, provider)
+}
+
+func setMQTTCredentialsProvider(c MqttClient, provider MQTTCredentialsProvider) error {
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	creds := credentialsOf(c)
+	if creds == nil {
+		return errors.New("MQTTClient does not support changing its credentials")
+	}
+	creds.setProvider(provider)
+	return nil
+}
+
+// useMQTTTokenSource makes reconnects of c take their token from source
+func useMQTTTokenSource(c MqttClient, source mqttTokenSource) {
+	if creds := credentialsOf(c); creds != nil {
+		creds.setSource(source)
+	}
+}
+
+// mqttToken returns the user token, refreshing it first when it is about to expire or was rejected
+func (u *UserClient) mqttToken(force bool) (string, error) {
+	if !force && !tokenExpiring(u.getExpiresAt()) {
+		return u.getToken(), nil
+	}
+	var err error
+	switch {
+	case u.getRefreshToken() != "":
+		err = refreshAuthentication(u)
+	case u.Email != "" && u.Password != "":
+		_, err = u.Authenticate()
+	}
+	return u.getToken(), err
+}
+
+// mqttToken returns the developer token, logging in again when it is about to expire or was rejected
+func (d *DevClient) mqttToken(force bool) (string, error) {
+	if (force || tokenExpiring(d.getExpiresAt())) && d.Email != "" && d.Password != "" {
+		_, err := d.Authenticate()
+		return d.getToken(), err
+	}
+	return d.getToken(), nil
+}
+
+// mqttToken returns the device token, authenticating again when it is about to expire or was rejected
+func (d *DeviceClient) mqttToken(force bool) (string, error) {
+	if (force || tokenExpiring(d.getExpiresAt())) && d.ActiveKey != "" {
+		_, err := d.Authenticate()
+		return d.getToken(), err
+	}
+	return d.getToken(), nil
+}
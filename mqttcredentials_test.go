@@ -0,0 +1,129 @@
+package GoSDK
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/clearblade/paho.mqtt.golang/packets"
+)
+
+// staleTokenBroker accepts a credential until revoke is called, then rejects it until another
+// is presented. cred picks the username or password out of the CONNECT.
+type staleTokenBroker struct {
+	*tcpBroker
+	mu      sync.Mutex
+	revoked map[string]bool
+	results []string
+}
+
+func newStaleTokenBroker(t *testing.T, cred func(*packets.ConnectPacket) string) *staleTokenBroker {
+	b := &staleTokenBroker{tcpBroker: newTCPBroker(t), revoked: map[string]bool{}}
+	b.onConnect = func(p *packets.ConnectPacket) byte {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		c := cred(p)
+		if b.revoked[c] {
+			b.results = append(b.results, "rejected "+c)
+			return packets.ErrRefusedBadUsernameOrPassword
+		}
+		b.results = append(b.results, "accepted "+c)
+		return packets.Accepted
+	}
+	return b
+}
+
+// revoke marks every credential accepted so far as stale and drops the connections
+func (b *staleTokenBroker) revoke() {
+	b.mu.Lock()
+	for _, p := range b.connectPackets() {
+		b.revoked[string(p.Password)] = true
+		b.revoked[p.Username] = true
+	}
+	b.mu.Unlock()
+	b.dropConnections()
+}
+
+func (b *staleTokenBroker) log() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.results...)
+}
+
+func TestDeviceReconnectLogsInAgainAfterRejectedToken(t *testing.T) {
+	b := newStaleTokenBroker(t, func(p *packets.ConnectPacket) string { return p.Username })
+	var mu sync.Mutex
+	logins := 0
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != _DEVICES_USER_PREAMBLE+"key/auth" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		logins++
+		mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deviceToken": "fresh-token"})
+	}))
+	defer platform.Close()
+
+	d := NewDeviceClientWithAddrs(platform.URL, b.addr(), "key", "secret", "dev", "active")
+	d.setToken("first-token")
+	if err := d.InitializeMQTT("dev-client", "", 5, nil, nil); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	defer d.MQTTClient.Disconnect(0)
+
+	b.revoke()
+	waitForWithin(t, 15*time.Second, "a reconnect with the fresh token", func() bool {
+		log := b.log()
+		return len(log) > 0 && log[len(log)-1] == "accepted fresh-token"
+	})
+	log := b.log()
+	if log[0] != "accepted first-token" || log[1] != "rejected first-token" {
+		t.Fatalf("connect log %v", log)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if logins != 1 {
+		t.Fatalf("logged in %d times, want once after the rejected CONNECT", logins)
+	}
+	if d.getToken() != "fresh-token" {
+		t.Fatalf("device token is %q", d.getToken())
+	}
+}
+
+func TestJWTDeviceReconnectSignsANewToken(t *testing.T) {
+	b := newTCPBroker(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDeviceClientWithAddrs("http://127.0.0.1:0", b.addr(), "key", "secret", "dev", "")
+	signer := &JWTSigner{Key: key, Claims: map[string]interface{}{"aud": "key"}, TTL: time.Hour}
+	if err := d.InitializeJWTMQTTWithSigner("jwt-client", 5, nil, nil, signer); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	defer d.MQTTClient.Disconnect(0)
+
+	// whether a password without a username reaches the wire depends on the paho build, so the
+	// tokens are read from the credentials the client hands to each CONNECT
+	creds := credentialsOf(d.MQTTClient)
+	b.dropConnections()
+	waitForWithin(t, 15*time.Second, "a reconnect", func() bool {
+		return len(b.connectPackets()) > 1
+	})
+	user, first := creds.get()
+	_, second := creds.get()
+	if user != "" || first == "" || first == second {
+		t.Fatalf("reconnect credentials %q / %q then %q", user, first, second)
+	}
+	_, claims, _, _ := decodeJWT(t, second)
+	if claims["aud"] != "key" || claims["exp"] == nil {
+		t.Fatalf("re-signed claims %v", claims)
+	}
+}
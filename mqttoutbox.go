@@ -0,0 +1,455 @@
+package GoSDK
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+const (
+	_OUTBOX_DEFAULT_RETRY     = time.Second
+	_OUTBOX_DEFAULT_MAX_RETRY = 30 * time.Second
+	_OUTBOX_DEFAULT_TIMEOUT   = 30 * time.Second
+)
+
+var (
+	ErrOutboundQueueClosed = errors.New("outbound queue is closed")
+	// ErrOutboundQueueFull is returned by Publish when the queue is full and EvictRejectNew is set
+	ErrOutboundQueueFull = errors.New("outbound queue is full")
+	// ErrOutboundEvicted is passed to OnDelivery for messages evicted to make room for newer ones
+	ErrOutboundEvicted = errors.New("message evicted from outbound queue")
+	// ErrOutboundExpired is passed to OnDelivery for messages older than MaxAge
+	ErrOutboundExpired = errors.New("message expired in outbound queue")
+)
+
+// OutboundEviction decides what Publish does when the outbound queue is full
+type OutboundEviction int
+
+const (
+	// EvictOldest discards the oldest queued messages to make room
+	EvictOldest OutboundEviction = iota
+	// EvictRejectNew keeps the queue as it is and fails Publish with ErrOutboundQueueFull
+	EvictRejectNew
+)
+
+// OutboundMessage is a single queued publish
+type OutboundMessage struct {
+	Seq      uint64    `json:"seq"`
+	ID       string    `json:"id"`
+	Topic    string    `json:"topic"`
+	Payload  []byte    `json:"payload"`
+	Qos      byte      `json:"qos"`
+	Retain   bool      `json:"retain,omitempty"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+func (m OutboundMessage) sequence() uint64 { return m.Seq }
+
+// OutboundStore persists queued publishes in order. Implementations must survive a crash between
+// Append and Ack without losing or reordering entries.
+type OutboundStore interface {
+	Append(m OutboundMessage) error
+	// Front returns the oldest unacknowledged message
+	Front() (OutboundMessage, bool)
+	// Ack removes the message with the given sequence number, which is always the front
+	Ack(seq uint64) error
+	Len() int
+	// Bytes returns the total payload size of the queued messages
+	Bytes() int64
+	// NextSeq returns one more than the highest sequence number ever appended
+	NextSeq() uint64
+	Close() error
+}
+
+// OutboundQueueOptions controls an OutboundQueue. Path is required unless Store is set.
+// Zero limits are unlimited.
+type OutboundQueueOptions struct {
+	// Path of the append-only queue file
+	Path string
+	// Store replaces the file store
+	Store OutboundStore
+	// MaxMessages and MaxBytes cap the queue. Eviction decides what happens when they are reached.
+	MaxMessages int
+	MaxBytes    int64
+	Eviction    OutboundEviction
+	// MaxAge drops messages that could not be delivered in time
+	MaxAge time.Duration
+	// PublishTimeout is how long to wait for the broker to acknowledge a message, 30 seconds by default
+	PublishTimeout time.Duration
+	// RetryInterval is the initial delay between delivery attempts, doubled up to MaxRetryInterval
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// OnDelivery is called once for every message leaving the queue. err is nil when the broker
+	// acknowledged it, ErrOutboundEvicted or ErrOutboundExpired otherwise.
+	OnDelivery func(m OutboundMessage, err error)
+}
+
+// OutboundQueueStats is a point in time snapshot of an OutboundQueue
+type OutboundQueueStats struct {
+	Depth     int
+	Bytes     int64
+	OldestAge time.Duration
+	Delivered int64
+	Evicted   int64
+	Expired   int64
+	Retries   int64
+	LastError error
+}
+
+// OutboundQueue records publishes durably before sending them, so they are delivered in order once
+// the client is connected, including after the process restarts.
+type OutboundQueue struct {
+	client func() MqttClient
+	opts   OutboundQueueOptions
+
+	mu        sync.Mutex
+	store     OutboundStore
+	inflight  uint64
+	closed    bool
+	delivered int64
+	evicted   int64
+	expired   int64
+	retries   int64
+	lastError error
+
+	// listenTo is the connection tracker of the client last delivered on, unlisten detaches from it
+	listenTo *subscriptionManager
+	unlisten func()
+	// pending is the publish of the message last sent, kept while it is unconfirmed so a retry
+	// waits on it rather than publishing the message a second time
+	pending   mqtt.Token
+	pendingID string
+	pendingOn MqttClient
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewOutboundQueue opens, or creates, the durable publish queue described by opts and starts
+// delivering it over the client's MQTT connection
+func (u *UserClient) NewOutboundQueue(opts OutboundQueueOptions) (*OutboundQueue, error) {
+	return newOutboundQueue(func() MqttClient { return u.MQTTClient }, opts)
+}
+
+// NewOutboundQueue opens, or creates, the durable publish queue described by opts and starts
+// delivering it over the client's MQTT connection
+func (d *DeviceClient) NewOutboundQueue(opts OutboundQueueOptions) (*OutboundQueue, error) {
+	return newOutboundQueue(func() MqttClient { return d.MQTTClient }, opts)
+}
+
+// NewOutboundQueue opens, or creates, the durable publish queue described by opts and starts
+// delivering it over the client's MQTT connection
+func (d *DevClient) NewOutboundQueue(opts OutboundQueueOptions) (*OutboundQueue, error) {
+	return newOutboundQueue(func() MqttClient { return d.MQTTClient }, opts)
+}
+
+func newOutboundQueue(client func() MqttClient, opts OutboundQueueOptions) (*OutboundQueue, error) {
+	if opts.PublishTimeout <= 0 {
+		opts.PublishTimeout = _OUTBOX_DEFAULT_TIMEOUT
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = _OUTBOX_DEFAULT_RETRY
+	}
+	if opts.MaxRetryInterval < opts.RetryInterval {
+		opts.MaxRetryInterval = _OUTBOX_DEFAULT_MAX_RETRY
+	}
+	store := opts.Store
+	if store == nil {
+		if opts.Path == "" {
+			return nil, fmt.Errorf("outbound queue needs a Path or a Store")
+		}
+		var err error
+		if store, err = OpenFileOutboundStore(opts.Path); err != nil {
+			return nil, err
+		}
+	}
+	q := &OutboundQueue{
+		client: client,
+		opts:   opts,
+		store:  store,
+		kick:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go q.deliverLoop()
+	q.wake()
+	return q, nil
+}
+
+// Publish queues a message and returns its id once it is on disk. Delivery is reported to OnDelivery.
+func (q *OutboundQueue) Publish(topic string, payload []byte, qos int, retain bool) (string, error) {
+	if qos < 0 || qos > 2 {
+		return "", fmt.Errorf("invalid qos %d", qos)
+	}
+	m := OutboundMessage{
+		ID:       newClientID(),
+		Topic:    topic,
+		Payload:  append([]byte{}, payload...),
+		Qos:      byte(qos),
+		Retain:   retain,
+		QueuedAt: time.Now(),
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return "", ErrOutboundQueueClosed
+	}
+	evicted, err := q.makeRoom(int64(len(m.Payload)))
+	if err == nil {
+		m.Seq = q.store.NextSeq()
+		if err = q.store.Append(m); err != nil {
+			err = fmt.Errorf("could not queue publish: %w", err)
+		}
+	}
+	q.mu.Unlock()
+	q.report(evicted, ErrOutboundEvicted)
+	if err != nil {
+		return "", err
+	}
+	q.wake()
+	return m.ID, nil
+}
+
+// Stats returns the current depth, age and counters of the queue
+func (q *OutboundQueue) Stats() OutboundQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := OutboundQueueStats{
+		Depth:     q.store.Len(),
+		Bytes:     q.store.Bytes(),
+		Delivered: q.delivered,
+		Evicted:   q.evicted,
+		Expired:   q.expired,
+		Retries:   q.retries,
+		LastError: q.lastError,
+	}
+	if m, ok := q.store.Front(); ok {
+		s.OldestAge = time.Since(m.QueuedAt)
+	}
+	return s
+}
+
+// Close stops delivering and closes the store. Queued messages stay on disk for the next run.
+func (q *OutboundQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrOutboundQueueClosed
+	}
+	q.closed = true
+	q.mu.Unlock()
+	close(q.stop)
+	<-q.done
+	if q.unlisten != nil {
+		q.unlisten()
+	}
+	return q.store.Close()
+}
+
+// makeRoom evicts the oldest messages until one of size more fits. The message being delivered is
+// never evicted. Must be called with q.mu held.
+func (q *OutboundQueue) makeRoom(size int64) ([]OutboundMessage, error) {
+	full := func() bool {
+		return (q.opts.MaxMessages > 0 && q.store.Len()+1 > q.opts.MaxMessages) ||
+			(q.opts.MaxBytes > 0 && q.store.Bytes()+size > q.opts.MaxBytes)
+	}
+	if q.opts.MaxBytes > 0 && size > q.opts.MaxBytes {
+		return nil, fmt.Errorf("%w: message of %d bytes exceeds MaxBytes", ErrOutboundQueueFull, size)
+	}
+	var evicted []OutboundMessage
+	for full() {
+		front, ok := q.store.Front()
+		if q.opts.Eviction == EvictRejectNew || !ok || front.Seq == q.inflight {
+			return evicted, ErrOutboundQueueFull
+		}
+		if err := q.store.Ack(front.Seq); err != nil {
+			return evicted, err
+		}
+		q.evicted++
+		evicted = append(evicted, front)
+	}
+	return evicted, nil
+}
+
+func (q *OutboundQueue) report(msgs []OutboundMessage, err error) {
+	if q.opts.OnDelivery == nil {
+		return
+	}
+	for _, m := range msgs {
+		q.opts.OnDelivery(m, err)
+	}
+}
+
+func (q *OutboundQueue) wake() {
+	select {
+	case q.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (q *OutboundQueue) deliverLoop() {
+	defer close(q.done)
+	backoff := q.opts.RetryInterval
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-q.kick:
+		case <-timer.C:
+		}
+		ok := q.drain()
+		if ok {
+			backoff = q.opts.RetryInterval
+		} else if backoff *= 2; backoff > q.opts.MaxRetryInterval {
+			backoff = q.opts.MaxRetryInterval
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(backoff)
+	}
+}
+
+// drain delivers queued messages until the queue is empty or delivery fails
+func (q *OutboundQueue) drain() bool {
+	for {
+		c := q.client()
+		if c == nil {
+			return false
+		}
+		q.listen(c)
+
+		q.mu.Lock()
+		m, ok := q.store.Front()
+		if !ok || q.closed {
+			q.mu.Unlock()
+			return true
+		}
+		if q.opts.MaxAge > 0 && time.Since(m.QueuedAt) > q.opts.MaxAge {
+			err := q.store.Ack(m.Seq)
+			if err == nil {
+				q.expired++
+			} else {
+				q.lastError = err
+			}
+			q.mu.Unlock()
+			if err != nil {
+				return false
+			}
+			q.report([]OutboundMessage{m}, ErrOutboundExpired)
+			continue
+		}
+		if !c.IsConnected() {
+			q.mu.Unlock()
+			return false
+		}
+		q.inflight = m.Seq
+		q.mu.Unlock()
+
+		err := q.send(c, m)
+
+		q.mu.Lock()
+		q.inflight = 0
+		if err == nil {
+			err = q.store.Ack(m.Seq)
+		}
+		if err != nil {
+			q.retries++
+			q.lastError = err
+			q.mu.Unlock()
+			return false
+		}
+		q.delivered++
+		q.mu.Unlock()
+		q.report([]OutboundMessage{m}, nil)
+	}
+}
+
+// send publishes m and waits for the broker to confirm it. A publish that timed out is still owned
+// by the client, which resends it on reconnect, so retrying the same message on the same client
+// waits for that publish again instead of sending a duplicate.
+func (q *OutboundQueue) send(c MqttClient, m OutboundMessage) error {
+	ret := q.pending
+	if ret == nil || q.pendingID != m.ID || q.pendingOn != c {
+		ret = c.Publish(m.Topic, m.Qos, m.Retain, m.Payload)
+		q.pending, q.pendingID, q.pendingOn = ret, m.ID, c
+	}
+	if !ret.WaitTimeout(q.opts.PublishTimeout) {
+		return fmt.Errorf("timed out publishing to %s", m.Topic)
+	}
+	q.pending, q.pendingID, q.pendingOn = nil, "", nil
+	if err := ret.Error(); err != nil {
+		return fmt.Errorf("could not publish to %s: %w", m.Topic, err)
+	}
+	return nil
+}
+
+// listen wakes the queue whenever c connects, once c tracks its connection. The listener moves
+// to whichever client is current.
+func (q *OutboundQueue) listen(c MqttClient) {
+	subs := subscriptionsOf(c)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if subs == nil || subs == q.listenTo {
+		return
+	}
+	if q.unlisten != nil {
+		q.unlisten()
+	}
+	q.listenTo = subs
+	q.unlisten = subs.listen(func(ev MQTTEvent) {
+		if ev.Kind == MQTTConnected || ev.Kind == MQTTReconnected {
+			q.wake()
+		}
+	})
+}
+
+// FileOutboundStore keeps the outbound queue in an append-only file of JSON lines
+type FileOutboundStore struct {
+	*fileQueue[OutboundMessage]
+	bytes int64
+}
+
+// OpenFileOutboundStore opens the queue file at path, creating it if needed. A torn final line left
+// by a crash is ignored, other unreadable lines are moved aside and counted by Corrupt.
+func OpenFileOutboundStore(path string) (*FileOutboundStore, error) {
+	q, err := openFileQueue[OutboundMessage](path, "outbound queue")
+	if err != nil {
+		return nil, err
+	}
+	s := &FileOutboundStore{fileQueue: q}
+	for _, m := range q.pending {
+		s.bytes += int64(len(m.Payload))
+	}
+	return s, nil
+}
+
+func (s *FileOutboundStore) Append(m OutboundMessage) error {
+	if err := s.fileQueue.Append(m); err != nil {
+		return err
+	}
+	s.bytes += int64(len(m.Payload))
+	return nil
+}
+
+func (s *FileOutboundStore) Ack(seq uint64) error {
+	front, ok := s.Front()
+	if err := s.fileQueue.Ack(seq); err != nil {
+		return err
+	}
+	if ok {
+		s.bytes -= int64(len(front.Payload))
+	}
+	return nil
+}
+
+func (s *FileOutboundStore) Bytes() int64 { return s.bytes }
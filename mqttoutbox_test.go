@@ -0,0 +1,162 @@
+package GoSDK
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+// currentClient is a swappable client for an OutboundQueue
+type currentClient struct {
+	mu sync.Mutex
+	c  MqttClient
+}
+
+func (cc *currentClient) get() MqttClient {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.c
+}
+
+func (cc *currentClient) set(c MqttClient) {
+	cc.mu.Lock()
+	cc.c = c
+	cc.mu.Unlock()
+}
+
+func TestOutboundQueueDeliversInOrderAcrossRestarts(t *testing.T) {
+	b := NewMemoryBroker()
+	msgs, err := subscribe(newMemoryClient(t, b, "sub"), "out/#", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := b.NewClient("dev", MemoryClientOptions{NoAutoReconnect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.DropConnection("dev")
+	path := filepath.Join(t.TempDir(), "outbox")
+	opts := OutboundQueueOptions{Path: path, RetryInterval: 10 * time.Millisecond}
+	q, err := newOutboundQueue(func() MqttClient { return dev }, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{"1", "2"} {
+		if _, err := q.Publish("out/a", []byte(payload), 1, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dev.Connect().Wait()
+	q, err = newOutboundQueue(func() MqttClient { return dev }, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	expectPublish(t, msgs, "1")
+	expectPublish(t, msgs, "2")
+	waitFor(t, "the queue to empty", func() bool { return q.Stats().Depth == 0 })
+}
+
+func TestOutboundQueueFollowsReplacedClient(t *testing.T) {
+	b := NewMemoryBroker()
+	msgs, err := subscribe(newMemoryClient(t, b, "sub"), "out/#", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur := &currentClient{c: newMemoryClient(t, b, "first")}
+	// retries are slow, so only a connect event can get the message out in time
+	q, err := newOutboundQueue(cur.get, OutboundQueueOptions{Path: filepath.Join(t.TempDir(), "outbox"), RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if _, err := q.Publish("out/a", []byte("via first"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	expectPublish(t, msgs, "via first")
+
+	second, err := b.NewClient("second", MemoryClientOptions{NoAutoReconnect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disconnect(second)
+	b.DropConnection("second")
+	cur.set(second)
+	if _, err := q.Publish("out/a", []byte("via second"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the queue to look at the new client", func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.listenTo == subscriptionsOf(second)
+	})
+	second.Connect().Wait()
+	expectPublish(t, msgs, "via second")
+}
+
+// slowAckClient does not confirm its first publish until release is closed
+type slowAckClient struct {
+	MqttClient
+	publishes int32
+	first     *v5Token
+	release   chan struct{}
+}
+
+func (c *slowAckClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	if atomic.AddInt32(&c.publishes, 1) > 1 {
+		return c.MqttClient.Publish(topic, qos, retained, payload)
+	}
+	c.first = newV5Token()
+	go func() {
+		<-c.release
+		c.first.complete(c.MqttClient.Publish(topic, qos, retained, payload).Error())
+	}()
+	return c.first
+}
+
+func TestOutboundQueueRetryDoesNotRepublish(t *testing.T) {
+	b := NewMemoryBroker()
+	msgs, err := subscribe(newMemoryClient(t, b, "sub"), "out/#", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &slowAckClient{MqttClient: newMemoryClient(t, b, "dev"), release: make(chan struct{})}
+	var delivered int32
+	q, err := newOutboundQueue(func() MqttClient { return c }, OutboundQueueOptions{
+		Path:           filepath.Join(t.TempDir(), "outbox"),
+		PublishTimeout: 20 * time.Millisecond,
+		RetryInterval:  5 * time.Millisecond,
+		OnDelivery: func(m OutboundMessage, err error) {
+			if err == nil {
+				atomic.AddInt32(&delivered, 1)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if _, err := q.Publish("out/a", []byte("once"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a few timed out attempts", func() bool { return q.Stats().Retries >= 3 })
+	close(c.release)
+	expectPublish(t, msgs, "once")
+	waitFor(t, "delivery", func() bool { return atomic.LoadInt32(&delivered) == 1 })
+	if n := atomic.LoadInt32(&c.publishes); n != 1 {
+		t.Fatalf("message published %d times", n)
+	}
+	select {
+	case msg := <-msgs:
+		t.Fatalf("duplicate delivered: %q", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
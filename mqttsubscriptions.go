@@ -0,0 +1,318 @@
+package GoSDK
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+// MQTTEventKind identifies an MQTTEvent
+type MQTTEventKind int
+
+const (
+	// MQTTConnected is sent after the first successful connect
+	MQTTConnected MQTTEventKind = iota
+	// MQTTConnectionLost is sent when the broker connection drops
+	MQTTConnectionLost
+	// MQTTReconnected is sent after every later successful connect
+	MQTTReconnected
+	// MQTTResubscribed is sent for each topic restored after a reconnect
+	MQTTResubscribed
+	// MQTTResubscribeFailed is sent for each topic that could not be restored. It is retried on the next reconnect.
+	MQTTResubscribeFailed
+)
+
+func (k MQTTEventKind) String() string {
+	switch k {
+	case MQTTConnected:
+		return "connected"
+	case MQTTConnectionLost:
+		return "connection lost"
+	case MQTTReconnected:
+		return "reconnected"
+	case MQTTResubscribed:
+		return "resubscribed"
+	case MQTTResubscribeFailed:
+		return "resubscribe failed"
+	}
+	return "unknown"
+}
+
+// MQTTEvent describes a change in an MQTT client's connection or subscriptions
+type MQTTEvent struct {
+	Kind  MQTTEventKind
+	Topic string
+	Err   error
+	Time  time.Time
+}
+
+// MQTTSubscription is a subscription the client restores after every reconnect
+type MQTTSubscription struct {
+	Topic string
+	Qos   byte
+}
+
+type managedSubscription struct {
+	qos     byte
+	handler mqtt.MessageHandler
+	channel subscriptionChannel
+}
+
+// subscriptionManager remembers what a client is subscribed to so the subscriptions survive clean
+// session reconnects. It is driven from the client's OnConnect and ConnectionLost handlers.
+type subscriptionManager struct {
+	mu        sync.Mutex
+	subs      map[string]managedSubscription
+	listeners []*mqttListener
+	connected bool
+	// generation counts connects, so a resubscribe started for an earlier connection stops reporting
+	generation uint64
+}
+
+// _RESUBSCRIBE_TIMEOUT bounds the wait for all subacks after a reconnect
+const _RESUBSCRIBE_TIMEOUT = 10 * time.Second
+
+func newSubscriptionManager() *subscriptionManager {
+	return &subscriptionManager{subs: map[string]managedSubscription{}}
+}
+
+// wrap installs the manager's handlers in front of the caller's callbacks
+func (m *subscriptionManager) wrap(callbacks *Callbacks) *Callbacks {
+	var userConnect mqtt.OnConnectHandler
+	var userLost mqtt.ConnectionLostHandler
+	if callbacks != nil {
+		userConnect = callbacks.OnConnectCallback
+		userLost = callbacks.OnConnectionLostCallback
+	}
+	return &Callbacks{
+		OnConnectCallback: func(c mqtt.Client) {
+			m.onConnect(c)
+			if userConnect != nil {
+				userConnect(c)
+			}
+		},
+		OnConnectionLostCallback: func(c mqtt.Client, err error) {
+			m.emit(MQTTEvent{Kind: MQTTConnectionLost, Err: err})
+			if userLost != nil {
+				userLost(c, err)
+			}
+		},
+	}
+}
+
+func (m *subscriptionManager) onConnect(c mqtt.Client) {
+	m.mu.Lock()
+	reconnect := m.connected
+	m.connected = true
+	m.generation++
+	gen := m.generation
+	topics := sortedKeys(m.subs)
+	subs := make([]managedSubscription, len(topics))
+	for i, topic := range topics {
+		subs[i] = m.subs[topic]
+	}
+	m.mu.Unlock()
+
+	if !reconnect {
+		m.emit(MQTTEvent{Kind: MQTTConnected})
+		return
+	}
+	m.emit(MQTTEvent{Kind: MQTTReconnected})
+	// waiting for subacks must not hold up the client's callbacks
+	go m.resubscribe(c, gen, topics, subs)
+}
+
+// resubscribe sends every subscription at once and then waits for the acks under one deadline
+func (m *subscriptionManager) resubscribe(c mqtt.Client, gen uint64, topics []string, subs []managedSubscription) {
+	tokens := make([]mqtt.Token, len(topics))
+	for i, topic := range topics {
+		tokens[i] = c.Subscribe(topic, subs[i].qos, subs[i].handler)
+	}
+	deadline := time.Now().Add(_RESUBSCRIBE_TIMEOUT)
+	for i, topic := range topics {
+		var err error
+		if !tokens[i].WaitTimeout(time.Until(deadline)) {
+			err = errors.New("timed out waiting for suback")
+		} else {
+			err = tokens[i].Error()
+		}
+		m.mu.Lock()
+		current := m.generation == gen
+		m.mu.Unlock()
+		if !current {
+			return
+		}
+		if err != nil {
+			m.emit(MQTTEvent{Kind: MQTTResubscribeFailed, Topic: topic, Err: err})
+		} else {
+			m.emit(MQTTEvent{Kind: MQTTResubscribed, Topic: topic})
+		}
+	}
+}
+
+// add records a subscription. Subscribing to the same topic again replaces, and closes, the old channel.
+func (m *subscriptionManager) add(topic string, qos byte, handler mqtt.MessageHandler, channel subscriptionChannel) {
+	m.mu.Lock()
+	old, ok := m.subs[topic]
+	m.subs[topic] = managedSubscription{qos: qos, handler: handler, channel: channel}
+	m.mu.Unlock()
+	if ok && old.channel != nil && old.channel != channel {
+		old.channel.close()
+	}
+}
+
+// remove forgets a subscription and closes its channel
+func (m *subscriptionManager) remove(topic string) {
+	m.mu.Lock()
+	old, ok := m.subs[topic]
+	delete(m.subs, topic)
+	m.mu.Unlock()
+	if ok && old.channel != nil {
+		old.channel.close()
+	}
+}
+
+// closeAll forgets every subscription and closes their channels, used on Disconnect
+func (m *subscriptionManager) closeAll() {
+	m.mu.Lock()
+	subs := m.subs
+	m.subs = map[string]managedSubscription{}
+	m.mu.Unlock()
+	for _, sub := range subs {
+		if sub.channel != nil {
+			sub.channel.close()
+		}
+	}
+}
+
+func (m *subscriptionManager) stats() []SubscriptionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rval := make([]SubscriptionStats, 0, len(m.subs))
+	for _, topic := range sortedKeys(m.subs) {
+		if ch := m.subs[topic].channel; ch != nil {
+			rval = append(rval, ch.stats())
+		}
+	}
+	return rval
+}
+
+func (m *subscriptionManager) list() []MQTTSubscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rval := make([]MQTTSubscription, 0, len(m.subs))
+	for topic, sub := range m.subs {
+		rval = append(rval, MQTTSubscription{Topic: topic, Qos: sub.qos})
+	}
+	sort.Slice(rval, func(i, j int) bool { return rval[i].Topic < rval[j].Topic })
+	return rval
+}
+
+type mqttListener struct {
+	fn func(MQTTEvent)
+}
+
+// listen calls fn for every event until the returned function is called
+func (m *subscriptionManager) listen(fn func(MQTTEvent)) func() {
+	l := &mqttListener{fn: fn}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, l)
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, other := range m.listeners {
+			if other == l {
+				m.listeners = append(m.listeners[:i:i], m.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (m *subscriptionManager) emit(ev MQTTEvent) {
+	ev.Time = time.Now()
+	m.mu.Lock()
+	listeners := append([]*mqttListener{}, m.listeners...)
+	m.mu.Unlock()
+	for _, l := range listeners {
+		l.fn(ev)
+	}
+}
+
+func subscriptionsOf(c MqttClient) *subscriptionManager {
+	if base, ok := c.(*mqttBaseClient); ok {
+		return base.subs
+	}
+	return nil
+}
+
+// OnMQTTEvent registers fn to be called on connects, connection losses and resubscriptions.
+// fn is called synchronously from the MQTT client and must not block.
+func (u *UserClient) OnMQTTEvent(fn func(MQTTEvent)) error {
+	return onMQTTEvent(u.MQTTClient, fn)
+}
+
+// OnMQTTEvent registers fn to be called on connects, connection losses and resubscriptions.
+// fn is called synchronously from the MQTT client and must not block.
+func (d *DeviceClient) OnMQTTEvent(fn func(MQTTEvent)) error {
+	return onMQTTEvent(d.MQTTClient, fn)
+}
+
+// OnMQTTEvent registers fn to be called on connects, connection losses and resubscriptions.
+// fn is called synchronously from the MQTT client and must not block.
+func (d *DevClient) OnMQTTEvent(fn func(MQTTEvent)) error {
+	return onMQTTEvent(d.MQTTClient, fn)
+}
+
+// MQTTSubscriptions lists the subscriptions that will be restored after a reconnect
+func (u *UserClient) MQTTSubscriptions() ([]MQTTSubscription, error) {
+	return mqttSubscriptions(u.MQTTClient)
+}
+
+// MQTTSubscriptions lists the subscriptions that will be restored after a reconnect
+func (d *DeviceClient) MQTTSubscriptions() ([]MQTTSubscription, error) {
+	return mqttSubscriptions(d.MQTTClient)
+}
+
+// MQTTSubscriptions lists the subscriptions that will be restored after a reconnect
+func (d *DevClient) MQTTSubscriptions() ([]MQTTSubscription, error) {
+	return mqttSubscriptions(d.MQTTClient)
+}
+
+func onMQTTEvent(c MqttClient, fn func(MQTTEvent)) error {
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	subs := subscriptionsOf(c)
+	if subs == nil {
+		return errors.New("MQTTClient does not track its connection")
+	}
+	subs.listen(fn)
+	return nil
+}
+
+func mqttSubscriptions(c MqttClient) ([]MQTTSubscription, error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	subs := subscriptionsOf(c)
+	if subs == nil {
+		return nil, nil
+	}
+	return subs.list(), nil
+}
+
+func subscriptionStats(c MqttClient) ([]SubscriptionStats, error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	subs := subscriptionsOf(c)
+	if subs == nil {
+		return nil, nil
+	}
+	return subs.stats(), nil
+}
@@ -0,0 +1,147 @@
+package GoSDK
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+// recordEvents collects the events of c for later checks
+func recordEvents(t *testing.T, c MqttClient) *eventLog {
+	t.Helper()
+	log := &eventLog{}
+	if err := onMQTTEvent(c, log.add); err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+type eventLog struct {
+	mu     sync.Mutex
+	events []MQTTEvent
+}
+
+func (l *eventLog) add(ev MQTTEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, ev)
+}
+
+func (l *eventLog) has(kind MQTTEventKind, topic string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, ev := range l.events {
+		if ev.Kind == kind && ev.Topic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func newMemoryClient(t *testing.T, b *MemoryBroker, clientID string) MqttClient {
+	t.Helper()
+	c, err := b.NewClient(clientID, MemoryClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { disconnect(c) })
+	return c
+}
+
+func TestSubscriptionsAreRestoredAfterConnectionDrops(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := newMemoryClient(t, b, "sub")
+	pub := newMemoryClient(t, b, "pub")
+	events := recordEvents(t, sub)
+
+	msgs, err := subscribe(sub, "sensors/+/temp", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publish(pub, "sensors/1/temp", []byte("20"), QOS_AtMostOnce, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	expectPublish(t, msgs, "20")
+
+	if err := b.DropConnection("sub"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the resubscribe", func() bool { return events.has(MQTTResubscribed, "sensors/+/temp") })
+	if !events.has(MQTTConnectionLost, "") || !events.has(MQTTReconnected, "") {
+		t.Fatalf("missing connection events: %+v", events.events)
+	}
+	if got := b.Subscriptions("sub"); !reflect.DeepEqual(got, []string{"sensors/+/temp"}) {
+		t.Fatalf("broker holds %v for the client", got)
+	}
+	if err := publish(pub, "sensors/2/temp", []byte("21"), QOS_AtMostOnce, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	expectPublish(t, msgs, "21")
+}
+
+// stalledClient never acknowledges a subscribe
+type stalledClient struct {
+	mqtt.Client
+	mu      sync.Mutex
+	pending []*v5Token
+}
+
+func (c *stalledClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := newV5Token()
+	c.pending = append(c.pending, t)
+	return t
+}
+
+func TestResubscribeDoesNotBlockTheConnectCallback(t *testing.T) {
+	m := newSubscriptionManager()
+	m.add("a", 1, nil, nil)
+	m.add("b", 1, nil, nil)
+	log := &eventLog{}
+	m.listen(log.add)
+	c := &stalledClient{}
+
+	m.onConnect(c)
+	done := make(chan struct{})
+	go func() {
+		m.onConnect(c)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("onConnect waited for the subacks")
+	}
+	waitFor(t, "the resubscribes to be sent", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.pending) == 2
+	})
+
+	// a newer connection makes the acks of the first resubscribe irrelevant
+	m.onConnect(c)
+	c.mu.Lock()
+	for _, tok := range c.pending[:2] {
+		tok.complete(nil)
+	}
+	c.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if log.has(MQTTResubscribed, "a") {
+		t.Fatal("a stale resubscribe was reported")
+	}
+	waitFor(t, "the second resubscribe to be sent", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.pending) == 4
+	})
+	c.mu.Lock()
+	for _, tok := range c.pending[2:] {
+		tok.complete(nil)
+	}
+	c.mu.Unlock()
+	waitFor(t, "the resubscribe events", func() bool { return log.has(MQTTResubscribed, "a") && log.has(MQTTResubscribed, "b") })
+}
@@ -0,0 +1,1000 @@
+package GoSDK
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/extensions/topicaliases"
+	"github.com/eclipse/paho.golang/paho/session"
+	"github.com/eclipse/paho.golang/paho/session/state"
+)
+
+// The paho client only speaks MQTT 3.1/3.1.1, so MQTT 5 sessions use eclipse/paho.golang, wrapped
+// by mqttV5Client below. It implements mqtt.Client, which keeps Publish, Subscribe and everything
+// built on them working unchanged; the v5 only features are reached through the *WithProperties
+// calls. autopaho reconnects it, making a new paho.Client on the same session state each time.
+
+const (
+	_V5_DEFAULT_KEEPALIVE     = 60 * time.Second
+	_V5_DEFAULT_ALIAS_MAXIMUM = 16
+	_V5_MAX_RECONNECT_BACKOFF = 2 * time.Minute
+)
+
+var errMqttNotConnected = errors.New("mqtt client is not connected")
+
+// UserProperty is an MQTT 5 user property. Keys may repeat.
+type UserProperty struct {
+	Key   string
+	Value string
+}
+
+// PublishProperties are the MQTT 5 properties that travel with a message
+type PublishProperties struct {
+	ContentType     string
+	ResponseTopic   string
+	CorrelationData []byte
+	// MessageExpiry drops the message if it cannot be delivered in time. Zero never expires.
+	MessageExpiry time.Duration
+	// PayloadUTF8 tells receivers the payload is UTF-8 text
+	PayloadUTF8    bool
+	UserProperties []UserProperty
+}
+
+// MQTTv5Message is a message received over an MQTT 5 subscription
+type MQTTv5Message struct {
+	Topic      string
+	Payload    []byte
+	Qos        byte
+	Retained   bool
+	Properties PublishProperties
+}
+
+// MQTTv5Options configures an MQTT 5 session. The zero value gives a clean session with topic aliases.
+type MQTTv5Options struct {
+	// SessionExpiry keeps subscriptions and queued messages on the broker for this long after a
+	// disconnect. Reconnects resume the session when it is set.
+	SessionExpiry time.Duration
+	// ReceiveMaximum limits the unacknowledged QoS 1 and 2 messages the broker sends at once
+	ReceiveMaximum uint16
+	// TopicAliasMaximum is the number of topic aliases the broker may use towards us
+	TopicAliasMaximum uint16
+	// DisableTopicAliases stops the client aliasing the topics it publishes to
+	DisableTopicAliases bool
+	// UserProperties are sent with the CONNECT packet
+	UserProperties []UserProperty
+	KeepAlive      time.Duration
+	AutoReconnect  bool
+	Callbacks      *Callbacks
+}
+
+// ReasonCodeError is returned when the broker answers a packet with a failure reason code
+type ReasonCodeError struct {
+	Packet string
+	Code   byte
+	Reason string
+}
+
+func (e *ReasonCodeError) Error() string {
+	msg := fmt.Sprintf("mqtt %s failed: %s (0x%02X)", e.Packet, reasonCodeText(e.Code), e.Code)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+var reasonCodeTexts = map[byte]string{
+	0x80: "unspecified error",
+	0x81: "malformed packet",
+	0x82: "protocol error",
+	0x83: "implementation specific error",
+	0x84: "unsupported protocol version",
+	0x85: "client identifier not valid",
+	0x86: "bad user name or password",
+	0x87: "not authorized",
+	0x88: "server unavailable",
+	0x89: "server busy",
+	0x8A: "banned",
+	0x8B: "server shutting down",
+	0x8C: "bad authentication method",
+	0x8D: "keep alive timeout",
+	0x8E: "session taken over",
+	0x8F: "topic filter invalid",
+	0x90: "topic name invalid",
+	0x91: "packet identifier in use",
+	0x92: "packet identifier not found",
+	0x93: "receive maximum exceeded",
+	0x94: "topic alias invalid",
+	0x95: "packet too large",
+	0x96: "message rate too high",
+	0x97: "quota exceeded",
+	0x98: "administrative action",
+	0x99: "payload format invalid",
+	0x9A: "retain not supported",
+	0x9B: "qos not supported",
+	0x9C: "use another server",
+	0x9D: "server moved",
+	0x9E: "shared subscriptions not supported",
+	0x9F: "connection rate exceeded",
+	0xA0: "maximum connect time",
+	0xA1: "subscription identifiers not supported",
+	0xA2: "wildcard subscriptions not supported",
+}
+
+func reasonCodeText(code byte) string {
+	if text, ok := reasonCodeTexts[code]; ok {
+		return text
+	}
+	return "unknown reason"
+}
+
+// SharedTopic returns the shared subscription filter for topic, so that each message is delivered to
+// only one of the subscribers in group
+func SharedTopic(group, topic string) string {
+	return "$share/" + group + "/" + topic
+}
+
+// InitializeMQTTv5 allocates an MQTT 5 client for the user. opts may be nil.
+func (u *UserClient) InitializeMQTTv5(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, opts *MQTTv5Options) error {
+	mqc, err := newMqttV5Client(u.getToken(), u.SystemKey, u.SystemSecret, clientid, timeout, u.MqttAddr, ssl, lastWill, opts)
+	if err != nil {
+		return err
+	}
+	useMQTTTokenSource(mqc, u.mqttToken)
+	u.MQTTClient = mqc
+	return nil
+}
+
+// InitializeMQTTv5 allocates an MQTT 5 client for the developer. opts may be nil.
+func (d *DevClient) InitializeMQTTv5(clientid, systemkey string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, opts *MQTTv5Options) error {
+	mqc, err := newMqttV5Client(d.getToken(), systemkey, "", clientid, timeout, d.MqttAddr, ssl, lastWill, opts)
+	if err != nil {
+		return err
+	}
+	useMQTTTokenSource(mqc, d.mqttToken)
+	d.MQTTClient = mqc
+	return nil
+}
+
+// InitializeMQTTv5 allocates an MQTT 5 client for the device. opts may be nil.
+func (d *DeviceClient) InitializeMQTTv5(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, opts *MQTTv5Options) error {
+	mqc, err := newMqttV5Client(d.getToken(), d.SystemKey, d.SystemSecret, clientid, timeout, d.MqttAddr, ssl, lastWill, opts)
+	if err != nil {
+		return err
+	}
+	useMQTTTokenSource(mqc, d.mqttToken)
+	d.MQTTClient = mqc
+	return nil
+}
+
+// PublishWithProperties publishes a message with MQTT 5 properties. The client must have been
+// initialized with InitializeMQTTv5.
+func (u *UserClient) PublishWithProperties(topic string, message []byte, qos int, retain bool, props *PublishProperties) error {
+	return publishWithProperties(u.MQTTClient, topic, message, qos, retain, props)
+}
+
+// PublishWithProperties publishes a message with MQTT 5 properties. The client must have been
+// initialized with InitializeMQTTv5.
+func (d *DeviceClient) PublishWithProperties(topic string, message []byte, qos int, retain bool, props *PublishProperties) error {
+	return publishWithProperties(d.MQTTClient, topic, message, qos, retain, props)
+}
+
+// PublishWithProperties publishes a message with MQTT 5 properties. The client must have been
+// initialized with InitializeMQTTv5.
+func (d *DevClient) PublishWithProperties(topic string, message []byte, qos int, retain bool, props *PublishProperties) error {
+	return publishWithProperties(d.MQTTClient, topic, message, qos, retain, props)
+}
+
+// SubscribeWithProperties is Subscribe for MQTT 5 clients, delivering each message with its properties
+func (u *UserClient) SubscribeWithProperties(topic string, qos int) (<-chan *MQTTv5Message, error) {
+	return subscribeWithProperties(u.MQTTClient, topic, qos)
+}
+
+// SubscribeWithProperties is Subscribe for MQTT 5 clients, delivering each message with its properties
+func (d *DeviceClient) SubscribeWithProperties(topic string, qos int) (<-chan *MQTTv5Message, error) {
+	return subscribeWithProperties(d.MQTTClient, topic, qos)
+}
+
+// SubscribeWithProperties is Subscribe for MQTT 5 clients, delivering each message with its properties
+func (d *DevClient) SubscribeWithProperties(topic string, qos int) (<-chan *MQTTv5Message, error) {
+	return subscribeWithProperties(d.MQTTClient, topic, qos)
+}
+
+// SubscribeShared joins the shared subscription group for topic. The broker load balances messages
+// across the members of a group. Requires an MQTT 5 client.
+func (u *UserClient) SubscribeShared(group, topic string, qos int) (<-chan *mqttTypes.Publish, error) {
+	return subscribeShared(u.MQTTClient, group, topic, qos)
+}
+
+// SubscribeShared joins the shared subscription group for topic. The broker load balances messages
+// across the members of a group. Requires an MQTT 5 client.
+func (d *DeviceClient) SubscribeShared(group, topic string, qos int) (<-chan *mqttTypes.Publish, error) {
+	return subscribeShared(d.MQTTClient, group, topic, qos)
+}
+
+// SubscribeShared joins the shared subscription group for topic. The broker load balances messages
+// across the members of a group. Requires an MQTT 5 client.
+func (d *DevClient) SubscribeShared(group, topic string, qos int) (<-chan *mqttTypes.Publish, error) {
+	return subscribeShared(d.MQTTClient, group, topic, qos)
+}
+
+func newMqttV5Client(token, systemkey, systemsecret, clientid string, timeout int, address string, ssl *tls.Config, lastWill *LastWillPacket, opts *MQTTv5Options) (MqttClient, error) {
+	if opts == nil {
+		opts = &MQTTv5Options{}
+	}
+	subs := newSubscriptionManager()
+	creds := newMqttCredentials(token, systemkey, false)
+	creds.listen(subs)
+	o := *opts
+	o.Callbacks = subs.wrap(opts.Callbacks)
+	cli := newV5Client(address, ssl, clientid, token, systemkey, time.Duration(timeout)*time.Second, lastWill, o)
+	cli.credentials = creds.get
+	mqc := &mqttBaseClient{cli, address, token, systemkey, systemsecret, clientid, timeout, subs, creds}
+	ret := mqc.Connect()
+	ret.Wait()
+	return mqc, ret.Error()
+}
+
+func asMqttV5(c MqttClient) (*mqttV5Client, error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	var inner mqtt.Client = c
+	if base, ok := c.(*mqttBaseClient); ok {
+		inner = base.Client
+	}
+	v5, ok := inner.(*mqttV5Client)
+	if !ok {
+		return nil, errors.New("MQTTClient is not an MQTT 5 client, use InitializeMQTTv5")
+	}
+	return v5, nil
+}
+
+func publishWithProperties(c MqttClient, topic string, data []byte, qos int, retain bool, props *PublishProperties) error {
+	v5, err := asMqttV5(c)
+	if err != nil {
+		return err
+	}
+	ret := v5.publish(topic, byte(qos), retain, data, props)
+	ret.Wait()
+	return ret.Error()
+}
+
+func subscribeWithProperties(c MqttClient, topic string, qos int) (<-chan *MQTTv5Message, error) {
+	return subscribeWithPropertiesOptions(c, topic, qos, SubscribeOptions{})
+}
+
+// subscribeWithPropertiesOptions is subscribeWithProperties with the buffering and overflow
+// handling of opts. OnOverflow sees the dropped messages without their properties.
+func subscribeWithPropertiesOptions(c MqttClient, topic string, qos int, opts SubscribeOptions) (<-chan *MQTTv5Message, error) {
+	v5, err := asMqttV5(c)
+	if err != nil {
+		return nil, err
+	}
+	var onOverflow func(*MQTTv5Message)
+	if opts.OnOverflow != nil {
+		onOverflow = func(m *MQTTv5Message) {
+			path, _ := mqttTypes.NewTopicPath(m.Topic)
+			opts.OnOverflow(topic, &mqttTypes.Publish{Topic: path, Payload: m.Payload})
+		}
+	}
+	msgs := newDeliveryQueue(topic, opts.BufferSize, opts.Overflow, onOverflow)
+	handler := func(client mqtt.Client, msg mqtt.Message) {
+		if m, ok := msg.(*v5Message); ok {
+			msgs.send(m.toMQTTv5Message())
+		}
+	}
+	ret := v5.Subscribe(topic, byte(qos), handler)
+	ret.WaitTimeout(1 * time.Second)
+	if err := ret.Error(); err != nil {
+		return msgs.ch, err
+	}
+	if subs := subscriptionsOf(c); subs != nil {
+		subs.add(topic, byte(qos), handler, msgs)
+	}
+	return msgs.ch, nil
+}
+
+func subscribeShared(c MqttClient, group, topic string, qos int) (<-chan *mqttTypes.Publish, error) {
+	if _, err := asMqttV5(c); err != nil {
+		return nil, err
+	}
+	if group == "" || strings.ContainsAny(group, "/+#") {
+		return nil, fmt.Errorf("invalid shared subscription group %q", group)
+	}
+	return subscribe(c, SharedTopic(group, topic), qos)
+}
+
+// v5Token implements mqtt.Token
+type v5Token struct {
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+func newV5Token() *v5Token {
+	return &v5Token{done: make(chan struct{})}
+}
+
+func (t *v5Token) complete(err error) {
+	t.once.Do(func() {
+		t.err = err
+		close(t.done)
+	})
+}
+
+func (t *v5Token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *v5Token) WaitTimeout(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-t.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (t *v5Token) Done() <-chan struct{} { return t.done }
+
+func (t *v5Token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+func completedToken(err error) *v5Token {
+	t := newV5Token()
+	t.complete(err)
+	return t
+}
+
+// v5Message implements mqtt.Message and carries the v5 properties
+type v5Message struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retained bool
+	dup      bool
+	id       uint16
+	props    *paho.PublishProperties
+}
+
+func (m *v5Message) Duplicate() bool   { return m.dup }
+func (m *v5Message) Qos() byte         { return m.qos }
+func (m *v5Message) Retained() bool    { return m.retained }
+func (m *v5Message) Topic() string     { return m.topic }
+func (m *v5Message) MessageID() uint16 { return m.id }
+func (m *v5Message) Payload() []byte   { return m.payload }
+func (m *v5Message) Ack()              {}
+
+func (m *v5Message) toMQTTv5Message() *MQTTv5Message {
+	rval := &MQTTv5Message{Topic: m.topic, Payload: m.payload, Qos: m.qos, Retained: m.retained}
+	if m.props == nil {
+		return rval
+	}
+	p := &rval.Properties
+	p.ContentType = m.props.ContentType
+	p.ResponseTopic = m.props.ResponseTopic
+	p.CorrelationData = m.props.CorrelationData
+	if m.props.MessageExpiry != nil {
+		p.MessageExpiry = time.Duration(*m.props.MessageExpiry) * time.Second
+	}
+	p.PayloadUTF8 = m.props.PayloadFormat != nil && *m.props.PayloadFormat == 1
+	for _, up := range m.props.User {
+		p.UserProperties = append(p.UserProperties, UserProperty{Key: up.Key, Value: up.Value})
+	}
+	return rval
+}
+
+// pahoPublishProperties converts pp for paho.golang, which sends no properties for nil
+func pahoPublishProperties(pp *PublishProperties) *paho.PublishProperties {
+	props := &paho.PublishProperties{}
+	if pp == nil {
+		return props
+	}
+	if pp.PayloadUTF8 {
+		props.PayloadFormat = paho.Byte(1)
+	}
+	if pp.MessageExpiry > 0 {
+		props.MessageExpiry = paho.Uint32(uint32((pp.MessageExpiry + time.Second - 1) / time.Second))
+	}
+	props.ContentType = pp.ContentType
+	props.ResponseTopic = pp.ResponseTopic
+	props.CorrelationData = pp.CorrelationData
+	for _, up := range pp.UserProperties {
+		props.User.Add(up.Key, up.Value)
+	}
+	return props
+}
+
+// mqttV5Client adapts an autopaho connection manager to mqtt.Client. autopaho reconnects, topic
+// aliases are kept in topicaliases tables and a paho.StandardRouter hands messages to the
+// handlers of the matching topic filters.
+type mqttV5Client struct {
+	address        string
+	ssl            *tls.Config
+	clientID       string
+	username       string
+	password       string
+	credentials    func() (string, string)
+	will           *LastWillPacket
+	opts           MQTTv5Options
+	connectTimeout time.Duration
+	reader         mqtt.ClientOptionsReader
+	session        *v5Session
+	router         *paho.StandardRouter
+
+	// pubMu keeps publishes in call order. publish holds it until paho.golang has the PUBLISH in
+	// the session, which the session reports to pending.
+	pubMu   sync.Mutex
+	pending atomic.Pointer[v5Pending]
+
+	mu        sync.Mutex
+	cm        *autopaho.ConnectionManager
+	connected bool
+	closing   bool
+	inflight  int
+	// sessionCtx ends with the broker session, failing the publishes waiting for it
+	sessionCtx context.Context
+	endSession context.CancelCauseFunc
+	// outAliases are the aliases we assigned. Its PublishHook is not used, because it leaves the
+	// topic out of the PUBLISH that establishes an alias and overruns a full table.
+	outAliases *topicaliases.TAHandler
+	outMax     uint16
+	outCount   uint16
+	outWritten map[uint16]bool
+	// inAliases are the aliases of inClient, the connection they were set on
+	inAliases   *topicaliases.TAHandler
+	inClient    *paho.Client
+	protocolErr error
+}
+
+func newV5Client(address string, ssl *tls.Config, clientID, username, password string, connectTimeout time.Duration, will *LastWillPacket, opts MQTTv5Options) *mqttV5Client {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = _V5_DEFAULT_KEEPALIVE
+	}
+	if opts.TopicAliasMaximum == 0 {
+		opts.TopicAliasMaximum = _V5_DEFAULT_ALIAS_MAXIMUM
+	}
+	if connectTimeout <= 0 {
+		connectTimeout = 30 * time.Second
+	}
+	// OptionsReader has to hand back paho's own type, so describe the session with paho options
+	o := mqtt.NewClientOptions()
+	if ssl != nil {
+		o.AddBroker("tls://" + address)
+		o.SetTLSConfig(ssl)
+	} else {
+		o.AddBroker("tcp://" + address)
+	}
+	o.SetProtocolVersion(5)
+	o.SetClientID(clientID)
+	o.SetUsername(username)
+	o.SetPassword(password)
+	o.SetConnectTimeout(connectTimeout)
+	o.SetKeepAlive(opts.KeepAlive)
+	o.SetAutoReconnect(opts.AutoReconnect)
+	c := &mqttV5Client{
+		address:        address,
+		ssl:            ssl,
+		clientID:       clientID,
+		username:       username,
+		password:       password,
+		will:           will,
+		opts:           opts,
+		connectTimeout: connectTimeout,
+		reader:         mqtt.NewClient(o).OptionsReader(),
+		router:         paho.NewStandardRouter(),
+	}
+	c.session = &v5Session{State: state.NewInMemory(), c: c}
+	return c
+}
+
+func (c *mqttV5Client) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		return true
+	}
+	if c.closing || c.cm == nil || !c.opts.AutoReconnect {
+		return false
+	}
+	select {
+	case <-c.cm.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *mqttV5Client) IsConnectionOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *mqttV5Client) OptionsReader() mqtt.ClientOptionsReader { return c.reader }
+
+// connection returns the connection manager of the last Connect
+func (c *mqttV5Client) connection() *autopaho.ConnectionManager {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cm
+}
+
+// Connect starts the connection manager and waits for its first attempt. A failed first attempt
+// stops it again.
+func (c *mqttV5Client) Connect() mqtt.Token {
+	scheme := "mqtt://"
+	if c.ssl != nil {
+		scheme = "tls://"
+	}
+	u, err := url.Parse(scheme + c.address)
+	if err != nil {
+		return completedToken(fmt.Errorf("invalid mqtt address %s: %w", c.address, err))
+	}
+	first := make(chan error, 1)
+	report := func(err error) {
+		select {
+		case first <- err:
+		default:
+		}
+	}
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		TlsCfg:                        c.ssl,
+		KeepAlive:                     uint16(c.opts.KeepAlive / time.Second),
+		CleanStartOnInitialConnection: true,
+		ReconnectBackoff:              autopaho.NewExponentialBackoff(time.Second, _V5_MAX_RECONNECT_BACKOFF, 2*time.Second, 2),
+		ConnectTimeout:                c.connectTimeout,
+		ConnectPacketBuilder:          c.connectPacket,
+		OnConnectionUp: func(_ *autopaho.ConnectionManager, ca *paho.Connack) {
+			c.connectionUp(ca)
+			report(nil)
+		},
+		OnConnectError: report,
+		ClientConfig: paho.ClientConfig{
+			Session:           c.session,
+			PacketTimeout:     c.connectTimeout,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.received},
+			OnClientError:     c.connectionLost,
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				c.connectionLost(&ReasonCodeError{Packet: "disconnect", Code: d.ReasonCode, Reason: disconnectReason(d)})
+			},
+		},
+	}
+	c.mu.Lock()
+	c.closing = false
+	cm, err := autopaho.NewConnection(context.Background(), cfg)
+	if err != nil {
+		c.mu.Unlock()
+		return completedToken(fmt.Errorf("could not connect to %s: %w", c.address, err))
+	}
+	c.cm = cm
+	c.mu.Unlock()
+	if err := <-first; err != nil {
+		cm.Disconnect(context.Background())
+		var ce *autopaho.ConnackError
+		if errors.As(err, &ce) {
+			return completedToken(&ReasonCodeError{Packet: "connect", Code: ce.ReasonCode, Reason: ce.Reason})
+		}
+		return completedToken(fmt.Errorf("could not connect to %s: %w", c.address, err))
+	}
+	return completedToken(nil)
+}
+
+// connectPacket completes the CONNECT autopaho built for an attempt, which has CleanStart set on
+// the first one only. It fetches the credentials again for each attempt.
+func (c *mqttV5Client) connectPacket(cp *paho.Connect, _ *url.URL) (*paho.Connect, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing || (!cp.CleanStart && !c.opts.AutoReconnect) {
+		return nil, errMqttNotConnected
+	}
+	username, password := c.username, c.password
+	if c.credentials != nil {
+		username, password = c.credentials()
+	}
+	cp.ClientID = c.clientID
+	cp.CleanStart = cp.CleanStart || c.opts.SessionExpiry == 0
+	cp.Username = username
+	cp.UsernameFlag = username != ""
+	cp.Password = []byte(password)
+	cp.PasswordFlag = password != ""
+	cp.Properties = &paho.ConnectProperties{TopicAliasMaximum: paho.Uint16(c.opts.TopicAliasMaximum)}
+	if c.opts.SessionExpiry > 0 {
+		cp.Properties.SessionExpiryInterval = paho.Uint32(uint32(c.opts.SessionExpiry / time.Second))
+	}
+	if c.opts.ReceiveMaximum > 0 {
+		cp.Properties.ReceiveMaximum = paho.Uint16(c.opts.ReceiveMaximum)
+	}
+	for _, up := range c.opts.UserProperties {
+		cp.Properties.User.Add(up.Key, up.Value)
+	}
+	if c.will != nil {
+		cp.WillMessage = &paho.WillMessage{Topic: c.will.Topic, Payload: []byte(c.will.Body), QoS: byte(c.will.Qos), Retain: c.will.Retain}
+		cp.WillProperties = &paho.WillProperties{}
+	}
+	return cp, nil
+}
+
+func disconnectReason(d *paho.Disconnect) string {
+	if d.Properties == nil {
+		return ""
+	}
+	return d.Properties.ReasonString
+}
+
+func (c *mqttV5Client) connectionUp(ca *paho.Connack) {
+	c.mu.Lock()
+	c.connected = true
+	if c.sessionCtx == nil || c.sessionCtx.Err() != nil {
+		c.sessionCtx, c.endSession = context.WithCancelCause(context.Background())
+	}
+	c.outMax = 0
+	if ca.Properties != nil {
+		if ca.Properties.TopicAliasMaximum != nil && !c.opts.DisableTopicAliases {
+			c.outMax = *ca.Properties.TopicAliasMaximum
+		}
+		if ca.Properties.AssignedClientID != "" {
+			c.clientID = ca.Properties.AssignedClientID
+		}
+	}
+	c.outAliases = topicaliases.NewTAHandler(c.outMax)
+	c.outCount = 0
+	c.outWritten = map[uint16]bool{}
+	c.mu.Unlock()
+	if c.opts.Callbacks != nil && c.opts.Callbacks.OnConnectCallback != nil {
+		go c.opts.Callbacks.OnConnectCallback(c)
+	}
+}
+
+// connectionLost handles the loss of a connection once. Publishes in flight fail unless the
+// session outlives the connection, and autopaho reconnects unless AutoReconnect is off.
+func (c *mqttV5Client) connectionLost(cause error) {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return
+	}
+	c.connected = false
+	if c.protocolErr != nil {
+		cause, c.protocolErr = c.protocolErr, nil
+	}
+	if c.opts.SessionExpiry == 0 {
+		c.endSession(fmt.Errorf("mqtt connection lost: %w", cause))
+	}
+	closing, cm := c.closing, c.cm
+	c.mu.Unlock()
+	if closing {
+		return
+	}
+	if c.opts.Callbacks != nil && c.opts.Callbacks.OnConnectionLostCallback != nil {
+		go c.opts.Callbacks.OnConnectionLostCallback(c, cause)
+	}
+	if !c.opts.AutoReconnect {
+		go cm.Disconnect(context.Background())
+	}
+}
+
+func (c *mqttV5Client) Disconnect(quiesce uint) {
+	c.mu.Lock()
+	if c.closing || c.cm == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.closing = true
+	cm := c.cm
+	c.mu.Unlock()
+	deadline := time.Now().Add(time.Duration(quiesce) * time.Millisecond)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		n := c.inflight
+		c.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.connectTimeout)
+	defer cancel()
+	cm.Disconnect(ctx)
+	c.mu.Lock()
+	c.connected = false
+	if c.endSession != nil {
+		c.endSession(fmt.Errorf("mqtt connection lost: %w", errors.New("disconnected")))
+	}
+	c.mu.Unlock()
+}
+
+func (c *mqttV5Client) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	var data []byte
+	switch p := payload.(type) {
+	case []byte:
+		data = p
+	case string:
+		data = []byte(p)
+	case bytes.Buffer:
+		data = p.Bytes()
+	case *bytes.Buffer:
+		data = p.Bytes()
+	default:
+		return completedToken(fmt.Errorf("unknown payload type %T", payload))
+	}
+	return c.publish(topic, qos, retained, data, nil)
+}
+
+// publish returns once a QoS 0 PUBLISH is written, or a QoS 1 or 2 PUBLISH is in the session,
+// and completes the token when the broker acknowledged it
+func (c *mqttV5Client) publish(topic string, qos byte, retained bool, payload []byte, pp *PublishProperties) mqtt.Token {
+	if qos > 2 {
+		return completedToken(fmt.Errorf("invalid qos %d", qos))
+	}
+	p := &paho.Publish{QoS: qos, Retain: retained, Topic: topic, Payload: payload, Properties: pahoPublishProperties(pp)}
+	c.pubMu.Lock()
+	defer c.pubMu.Unlock()
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return completedToken(errMqttNotConnected)
+	}
+	cm, ctx, aliases := c.cm, c.sessionCtx, c.outAliases
+	// an alias is used once the PUBLISH that establishes it succeeded, until then the topic is sent
+	var alias uint16
+	switch id := aliases.GetAlias(topic); {
+	case topic == "":
+	case id != 0 && c.outWritten[id]:
+		p.Properties.TopicAlias = paho.Uint16(id)
+		p.Topic = ""
+	case id == 0 && c.outCount < c.outMax:
+		alias = aliases.SetAlias(topic)
+		c.outCount++
+		p.Properties.TopicAlias = paho.Uint16(alias)
+	}
+	c.inflight++
+	c.mu.Unlock()
+
+	pending := &v5Pending{topic: p.Topic, payload: p.Payload, stored: make(chan error, 1)}
+	c.pending.Store(pending)
+	defer c.pending.Store(nil)
+	token := newV5Token()
+	go func() {
+		resp, err := cm.Publish(ctx, p)
+		if resp != nil && resp.ReasonCode >= 0x80 {
+			reason := ""
+			if resp.Properties != nil {
+				reason = resp.Properties.ReasonString
+			}
+			err = &ReasonCodeError{Packet: "publish", Code: resp.ReasonCode, Reason: reason}
+		}
+		c.mu.Lock()
+		c.inflight--
+		if alias != 0 && c.outAliases == aliases {
+			if err == nil {
+				c.outWritten[alias] = true
+			} else {
+				// the broker never learned the alias, or will be told the new topic with it
+				aliases.ResetAlias("", alias)
+				c.outCount--
+			}
+		}
+		c.mu.Unlock()
+		switch {
+		case err == nil:
+		case errors.Is(err, autopaho.ConnectionDownError):
+			err = errMqttNotConnected
+		case context.Cause(ctx) != nil:
+			err = context.Cause(ctx)
+		default:
+			var rc *ReasonCodeError
+			if !errors.As(err, &rc) {
+				err = fmt.Errorf("could not publish to %s: %w", topic, err)
+			}
+		}
+		token.complete(err)
+	}()
+	select {
+	case <-pending.stored:
+	case <-token.done:
+	}
+	return token
+}
+
+func (c *mqttV5Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+func (c *mqttV5Client) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	topics := sortedKeys(filters)
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return completedToken(errMqttNotConnected)
+	}
+	cm := c.cm
+	c.mu.Unlock()
+	// routed first, so nothing the broker sends before the SUBACK is lost
+	for _, topic := range topics {
+		c.AddRoute(topic, callback)
+	}
+	sub := &paho.Subscribe{}
+	for _, topic := range topics {
+		sub.Subscriptions = append(sub.Subscriptions, paho.SubscribeOptions{Topic: topic, QoS: filters[topic] & 0x03})
+	}
+	token := newV5Token()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.connectTimeout)
+		defer cancel()
+		sa, err := cm.Subscribe(ctx, sub)
+		if sa == nil {
+			if err != nil {
+				for _, topic := range topics {
+					c.router.UnregisterHandler(topic)
+				}
+			}
+			token.complete(err)
+			return
+		}
+		var errs []error
+		for i, topic := range topics {
+			if i < len(sa.Reasons) && sa.Reasons[i] >= 0x80 {
+				c.router.UnregisterHandler(topic)
+				errs = append(errs, fmt.Errorf("%s: %w", topic, &ReasonCodeError{Packet: "subscribe", Code: sa.Reasons[i], Reason: subackReason(sa)}))
+			}
+		}
+		token.complete(errors.Join(errs...))
+	}()
+	return token
+}
+
+func subackReason(sa *paho.Suback) string {
+	if sa.Properties == nil {
+		return ""
+	}
+	return sa.Properties.ReasonString
+}
+
+func (c *mqttV5Client) Unsubscribe(topics ...string) mqtt.Token {
+	for _, topic := range topics {
+		c.router.UnregisterHandler(topic)
+	}
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return completedToken(errMqttNotConnected)
+	}
+	cm := c.cm
+	c.mu.Unlock()
+	token := newV5Token()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.connectTimeout)
+		defer cancel()
+		ua, err := cm.Unsubscribe(ctx, &paho.Unsubscribe{Topics: topics})
+		if ua == nil {
+			token.complete(err)
+			return
+		}
+		var errs []error
+		for i, topic := range topics {
+			// 0x11 means there was no such subscription, which is what the caller wanted anyway
+			if i < len(ua.Reasons) && ua.Reasons[i] >= 0x80 {
+				reason := ""
+				if ua.Properties != nil {
+					reason = ua.Properties.ReasonString
+				}
+				errs = append(errs, fmt.Errorf("%s: %w", topic, &ReasonCodeError{Packet: "unsubscribe", Code: ua.Reasons[i], Reason: reason}))
+			}
+		}
+		token.complete(errors.Join(errs...))
+	}()
+	return token
+}
+
+// AddRoute makes callback the handler of the messages matching topic, replacing any earlier one
+func (c *mqttV5Client) AddRoute(topic string, callback mqtt.MessageHandler) {
+	c.router.UnregisterHandler(topic)
+	if callback == nil {
+		return
+	}
+	c.router.RegisterHandler(topic, func(p *paho.Publish) {
+		callback(c, &v5Message{topic: p.Topic, payload: p.Payload, qos: p.QoS, retained: p.Retain, dup: p.Duplicate(), id: p.PacketID, props: p.Properties})
+	})
+}
+
+// received resolves the topic alias of an incoming message and routes it. paho.golang
+// acknowledges the message once this returns.
+func (c *mqttV5Client) received(pr paho.PublishReceived) (bool, error) {
+	pb := pr.Packet.Packet()
+	if pb.Properties == nil {
+		pb.Properties = &packets.Properties{}
+	}
+	c.mu.Lock()
+	if c.inClient != pr.Client {
+		c.inClient = pr.Client
+		c.inAliases = topicaliases.NewTAHandler(c.opts.TopicAliasMaximum)
+	}
+	var err error
+	if id := pb.Properties.TopicAlias; id != nil {
+		switch {
+		case *id == 0 || *id > c.opts.TopicAliasMaximum:
+			err = &ReasonCodeError{Packet: "publish", Code: 0x94}
+		case pb.Topic == "":
+			pb.Topic = c.inAliases.GetTopic(*id)
+		default:
+			c.inAliases.ResetAlias(pb.Topic, *id)
+		}
+		// resolved, the router would keep a table of its own
+		pb.Properties.TopicAlias = nil
+	}
+	if err == nil && pb.Topic == "" {
+		err = &ReasonCodeError{Packet: "publish", Code: 0x94}
+	}
+	if err != nil {
+		c.protocolErr = err
+	}
+	c.mu.Unlock()
+	if err != nil {
+		// paho.golang waits for this handler while closing, so disconnect elsewhere. autopaho
+		// reconnects once the connection is closed.
+		go pr.Client.Disconnect(&paho.Disconnect{ReasonCode: 0x94})
+		return false, err
+	}
+	c.router.Route(pb)
+	return true, nil
+}
+
+// v5Pending is the PUBLISH a publish call waits to see stored. paho.golang copies the topic and
+// the payload slice into the packet it stores.
+type v5Pending struct {
+	topic   string
+	payload []byte
+	stored  chan error
+}
+
+func (w *v5Pending) is(p *packets.Publish) bool {
+	return p.Topic == w.topic && len(p.Payload) == len(w.payload) && (len(p.Payload) == 0 || &p.Payload[0] == &w.payload[0])
+}
+
+// v5Session is the session state of an mqttV5Client. It tells publish when paho.golang stored
+// its PUBLISH, which paho.golang does before writing it. Requesters publish on the connection
+// manager directly, so not every PUBLISH is publish's.
+type v5Session struct {
+	*state.State
+	c *mqttV5Client
+}
+
+func (s *v5Session) AddToSession(ctx context.Context, packet session.Packet, resp chan<- packets.ControlPacket) error {
+	p, ok := packet.(*packets.Publish)
+	if !ok {
+		return s.State.AddToSession(ctx, packet, resp)
+	}
+	pending := s.c.pending.Load()
+	err := s.State.AddToSession(ctx, packet, resp)
+	if pending != nil && pending.is(p) {
+		select {
+		case pending.stored <- err:
+		default:
+		}
+	}
+	return err
+}
@@ -0,0 +1,362 @@
+package GoSDK
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+	"github.com/eclipse/paho.golang/packets"
+)
+
+func newV5TestClient(t *testing.T, b *v5Broker, clientID string, opts MQTTv5Options) MqttClient {
+	t.Helper()
+	c, err := newMqttV5Client("token", "key", "secret", clientID, 5, b.addr(), nil, nil, &opts)
+	if err != nil {
+		t.Fatalf("connect %s: %v", clientID, err)
+	}
+	t.Cleanup(func() { disconnect(c) })
+	return c
+}
+
+func nextV5(t *testing.T, msgs <-chan *MQTTv5Message) *MQTTv5Message {
+	t.Helper()
+	select {
+	case m, ok := <-msgs:
+		if !ok {
+			t.Fatal("subscription channel closed")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an MQTT 5 message")
+		return nil
+	}
+}
+
+func TestMQTTv5PublishesWithProperties(t *testing.T) {
+	b := newV5Broker(t).start()
+	sub := newV5TestClient(t, b, "sub", MQTTv5Options{})
+	msgs, err := subscribeWithProperties(sub, "data/#", 1)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	pub := newV5TestClient(t, b, "pub", MQTTv5Options{SessionExpiry: time.Minute, UserProperties: []UserProperty{{"site", "1"}}})
+	props := &PublishProperties{
+		ContentType:     "application/json",
+		ResponseTopic:   "replies/pub",
+		CorrelationData: []byte("c1"),
+		MessageExpiry:   90 * time.Second,
+		PayloadUTF8:     true,
+		UserProperties:  []UserProperty{{"k", "1"}, {"k", "2"}},
+	}
+	for _, qos := range []int{0, 1, 2} {
+		if err := publishWithProperties(pub, "data/x", []byte(fmt.Sprint(qos)), qos, false, props); err != nil {
+			t.Fatalf("publish at qos %d: %v", qos, err)
+		}
+		m := nextV5(t, msgs)
+		if m.Topic != "data/x" || string(m.Payload) != fmt.Sprint(qos) || !reflect.DeepEqual(m.Properties, *props) {
+			t.Fatalf("got %+v", m)
+		}
+	}
+
+	cp := b.connectPackets()[1]
+	if cp.ClientID != "pub" || cp.Username != "token" || string(cp.Password) != "key" || !cp.CleanStart {
+		t.Fatalf("connect %+v", cp)
+	}
+	if *cp.Properties.SessionExpiryInterval != 60 || *cp.Properties.TopicAliasMaximum != _V5_DEFAULT_ALIAS_MAXIMUM ||
+		len(cp.Properties.User) != 1 || cp.Properties.User[0].Key != "site" {
+		t.Fatalf("connect properties %+v", cp.Properties)
+	}
+}
+
+func TestMQTTv5ReportsReasonCodes(t *testing.T) {
+	b := newV5Broker(t)
+	b.denied["secret/x"] = 0x87
+	b.denied["secret/#"] = 0x87
+	b.onConnect = func(p *packets.Connect) (byte, string) {
+		if p.ClientID == "intruder" {
+			return 0x86, "bad password"
+		}
+		return 0, ""
+	}
+	b.start()
+
+	var rc *ReasonCodeError
+	if _, err := newMqttV5Client("token", "key", "secret", "intruder", 5, b.addr(), nil, nil, nil); !errors.As(err, &rc) ||
+		rc.Packet != "connect" || rc.Code != 0x86 || rc.Reason != "bad password" {
+		t.Fatalf("connect gave %v", err)
+	}
+	c := newV5TestClient(t, b, "client", MQTTv5Options{})
+	for _, qos := range []int{1, 2} {
+		if err := publishWithProperties(c, "secret/x", nil, qos, false, nil); !errors.As(err, &rc) || rc.Packet != "publish" || rc.Code != 0x87 {
+			t.Fatalf("publish at qos %d gave %v", qos, err)
+		}
+	}
+	msgs, err := subscribeWithProperties(c, "secret/#", 1)
+	if !errors.As(err, &rc) || rc.Packet != "subscribe" || rc.Code != 0x87 {
+		t.Fatalf("subscribe gave %v", err)
+	}
+	v5, _ := asMqttV5(c)
+	v5.router.Route(&packets.Publish{Topic: "secret/x", Properties: &packets.Properties{}})
+	select {
+	case m := <-msgs:
+		t.Fatalf("refused subscription still routed %s", m.Topic)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMQTTv5SetsTopicAliasesBeforeUsingThem(t *testing.T) {
+	const workers, topics = 8, 32
+	b := newV5Broker(t)
+	b.aliasMaximum = topics / 2
+	b.start()
+	c := newV5TestClient(t, b, "pub", MQTTv5Options{})
+
+	// every worker publishes to the same topics in the same order, so they race for each alias;
+	// the broker must learn an alias before its first use
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*topics+topics)
+	// subscriptions go through the same session as the publishes
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < topics; i++ {
+			if token := c.Subscribe(fmt.Sprintf("other/%d", i), 1, nil); token.Wait() && token.Error() != nil {
+				errs <- token.Error()
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < topics; i++ {
+				if err := publishWithProperties(c, fmt.Sprintf("data/%d", i), []byte("x"), w%2, false, nil); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	waitFor(t, "every publish to arrive", func() bool { return len(b.publishes()) == workers*topics })
+	if problems := b.protocolProblems(); len(problems) != 0 {
+		t.Fatalf("protocol errors %v", problems)
+	}
+	counts := map[string]int{}
+	aliases := map[uint16]string{}
+	aliasOnly := 0
+	for _, p := range b.publishes() {
+		counts[p.topic]++
+		if p.aliasOnly {
+			aliasOnly++
+		}
+		if p.properties.TopicAlias != nil {
+			alias := *p.properties.TopicAlias
+			if topic, ok := aliases[alias]; ok && topic != p.topic {
+				t.Fatalf("alias %d used for %s and %s", alias, topic, p.topic)
+			}
+			aliases[alias] = p.topic
+		}
+	}
+	if len(counts) != topics {
+		t.Fatalf("%d topics arrived", len(counts))
+	}
+	for topic, n := range counts {
+		if n != workers {
+			t.Fatalf("%s arrived %d times", topic, n)
+		}
+	}
+	if len(aliases) != topics/2 || aliasOnly == 0 {
+		t.Fatalf("%d aliases, %d alias only publishes", len(aliases), aliasOnly)
+	}
+}
+
+func TestMQTTv5ReleasesTheAliasOfAFailedPublish(t *testing.T) {
+	b := newV5Broker(t)
+	b.aliasMaximum = 1
+	b.qos0Only = true
+	b.start()
+	c := newV5TestClient(t, b, "pub", MQTTv5Options{})
+
+	// paho.golang refuses the QoS 1 publish, so the only alias must go to the next topic
+	if err := publishWithProperties(c, "data/a", []byte("refused"), 1, false, nil); err == nil {
+		t.Fatal("publish above the broker's maximum QoS succeeded")
+	}
+	for _, topic := range []string{"data/b", "data/b", "data/a"} {
+		if err := publishWithProperties(c, topic, []byte("x"), 0, false, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the publishes to arrive", func() bool { return len(b.publishes()) == 3 })
+	got := b.publishes()
+	if got[0].topic != "data/b" || got[0].aliasOnly || got[0].properties.TopicAlias == nil || *got[0].properties.TopicAlias != 1 ||
+		got[1].topic != "data/b" || !got[1].aliasOnly ||
+		got[2].topic != "data/a" || got[2].properties.TopicAlias != nil {
+		t.Fatalf("publishes %+v", got)
+	}
+	if problems := b.protocolProblems(); len(problems) != 0 {
+		t.Fatalf("protocol errors %v", problems)
+	}
+}
+
+func TestMQTTv5SendsTheTopicUntilItsAliasIsAcknowledged(t *testing.T) {
+	b := newV5Broker(t)
+	b.aliasMaximum = 1
+	b.holdAcks = make(chan struct{})
+	b.start()
+	c := newV5TestClient(t, b, "pub", MQTTv5Options{})
+	v5, _ := asMqttV5(c)
+
+	first := v5.publish("data/a", 1, false, []byte("1"), nil)
+	if err := publishWithProperties(c, "data/a", []byte("2"), 0, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	close(b.holdAcks)
+	if first.Wait(); first.Error() != nil {
+		t.Fatal(first.Error())
+	}
+	if err := publishWithProperties(c, "data/a", []byte("3"), 0, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the publishes to arrive", func() bool { return len(b.publishes()) == 3 })
+	got := map[string]v5Published{}
+	for _, p := range b.publishes() {
+		got[string(p.payload)] = p
+	}
+	if p := got["1"]; p.aliasOnly || p.properties.TopicAlias == nil {
+		t.Fatalf("first publish %+v", p)
+	}
+	// the broker may not have the alias yet
+	if p := got["2"]; p.aliasOnly || p.properties.TopicAlias != nil {
+		t.Fatalf("publish before the acknowledgement %+v", p)
+	}
+	if p := got["3"]; !p.aliasOnly {
+		t.Fatalf("publish after the acknowledgement %+v", p)
+	}
+	if problems := b.protocolProblems(); len(problems) != 0 {
+		t.Fatalf("protocol errors %v", problems)
+	}
+}
+
+func TestMQTTv5ResolvesIncomingTopicAliases(t *testing.T) {
+	b := newV5Broker(t)
+	b.sendAliases = true
+	b.start()
+	sub := newV5TestClient(t, b, "sub", MQTTv5Options{AutoReconnect: true})
+	msgs, err := subscribe(sub, "data/#", 1)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	pub := newV5TestClient(t, b, "pub", MQTTv5Options{})
+	for _, topic := range []string{"data/a", "data/a", "data/b"} {
+		if err := publish(pub, topic, []byte(topic), 1, 0, false); err != nil {
+			t.Fatal(err)
+		}
+		if msg := expectPublish(t, msgs, topic); msg.Topic.Whole != topic {
+			t.Fatalf("alias resolved to %s, want %s", msg.Topic.Whole, topic)
+		}
+	}
+
+	// an alias above the maximum we announced is a protocol error that ends the connection
+	alias := uint16(_V5_DEFAULT_ALIAS_MAXIMUM + 1)
+	if err := b.connection("sub").send(&packets.Publish{Properties: &packets.Properties{TopicAlias: &alias}}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the client to disconnect", func() bool {
+		codes := b.disconnectCodes()
+		return len(codes) == 1 && codes[0] == 0x94
+	})
+	waitFor(t, "the client to reconnect", func() bool { return len(b.connectPackets()) == 3 && b.connection("sub") != nil })
+	waitFor(t, "the subscription to be restored", func() bool { return b.connection("sub").subscribed("data/c") })
+	if err := publish(pub, "data/c", []byte("data/c"), 1, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	expectPublish(t, msgs, "data/c")
+}
+
+func TestMQTTv5ReconnectsAndFailsPublishesOfALostSession(t *testing.T) {
+	b := newV5Broker(t).start()
+	var lost, connected int32
+	c := newV5TestClient(t, b, "pub", MQTTv5Options{AutoReconnect: true, Callbacks: &Callbacks{
+		OnConnectCallback:        func(mqtt.Client) { atomic.AddInt32(&connected, 1) },
+		OnConnectionLostCallback: func(mqtt.Client, error) { atomic.AddInt32(&lost, 1) },
+	}})
+	b.dropConnections()
+	waitFor(t, "the reconnect", func() bool { return atomic.LoadInt32(&lost) == 1 && atomic.LoadInt32(&connected) == 2 })
+	if !c.IsConnectionOpen() {
+		t.Fatal("reconnected client is not open")
+	}
+	if err := publishWithProperties(c, "data/x", nil, 1, false, nil); err != nil {
+		t.Fatalf("publish after reconnect: %v", err)
+	}
+
+	// Disconnect neither reports a lost connection nor reconnects
+	c.Disconnect(0)
+	if err := publishWithProperties(c, "data/x", nil, 1, false, nil); !errors.Is(err, errMqttNotConnected) {
+		t.Fatalf("publish after disconnect gave %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&lost) != 1 || atomic.LoadInt32(&connected) != 2 || len(b.connectPackets()) != 2 {
+		t.Fatalf("%d lost, %d connected, %d connects", atomic.LoadInt32(&lost), atomic.LoadInt32(&connected), len(b.connectPackets()))
+	}
+}
+
+func TestMQTTv5SharedSubscription(t *testing.T) {
+	b := newV5Broker(t).start()
+	c := newV5TestClient(t, b, "worker", MQTTv5Options{})
+	if _, err := subscribeShared(c, "a/b", "jobs/#", 1); err == nil {
+		t.Fatal("subscribed with a group containing a slash")
+	}
+	msgs, err := subscribeShared(c, "workers", "jobs/#", 1)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if !b.connection("worker").subscribed("jobs/1") {
+		t.Fatal("broker did not see the shared subscription")
+	}
+	if err := publish(c, "jobs/1", []byte("job"), 1, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if msg := expectPublish(t, msgs, "job"); msg.Topic.Whole != "jobs/1" {
+		t.Fatalf("delivered on %s", msg.Topic.Whole)
+	}
+}
+
+func TestSubscribeTypedOverMQTTv5(t *testing.T) {
+	b := newV5Broker(t).start()
+	c := newV5TestClient(t, b, "typed", MQTTv5Options{})
+	var overflowed int32
+	sub, err := SubscribeTyped[codecReading](c, "readings/+", 1, TypedSubscribeOptions{Subscribe: SubscribeOptions{
+		BufferSize: 1,
+		Overflow:   OverflowCallback,
+		OnOverflow: func(string, *mqttTypes.Publish) { atomic.AddInt32(&overflowed, 1) },
+	}})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	// DefaultCodecs would pick JSON for the topic, the content type says otherwise
+	want := codecReading{Device: "d1", Value: 21.5}
+	data, err := CBORCodec.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := publishWithProperties(c, "readings/d1", data, 1, false, &PublishProperties{ContentType: "application/cbor"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the raw channel, the decoder and the typed channel hold one message each at most
+	waitFor(t, "the buffer to overflow", func() bool { return atomic.LoadInt32(&overflowed) >= 2 })
+	if got := nextTyped(t, sub); got.Value != want || got.ContentType != "application/cbor" {
+		t.Fatalf("got %+v", got)
+	}
+}
@@ -0,0 +1,150 @@
+package GoSDK
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+// MQTTAuthMode is how a websocket MQTT connection authenticates
+type MQTTAuthMode int
+
+const (
+	// MQTTAuthToken sends the client's token as the username
+	MQTTAuthToken MQTTAuthMode = iota
+	// MQTTAuthJWT sends the device token as the password, like InitializeJWTMQTT
+	MQTTAuthJWT
+	// MQTTAuthMTLS authenticates with the client certificate in the TLS config, like InitializeMQTTWithMTLS
+	MQTTAuthMTLS
+)
+
+// MQTTWebsocketOptions configures MQTT over WebSockets
+type MQTTWebsocketOptions struct {
+	// URL of the broker's websocket endpoint, e.g. wss://platform.clearblade.com:443/mqtt
+	URL string
+	// Headers are sent with the websocket handshake
+	Headers http.Header
+	// Proxy picks the proxy for the handshake. The HTTPS_PROXY and related environment variables
+	// are used when it is nil.
+	Proxy func(req *http.Request) (*url.URL, error)
+	// Auth defaults to MQTTAuthToken. Only devices support the other modes.
+	Auth MQTTAuthMode
+	// Username is sent by MQTTAuthMTLS connections
+	Username             string
+	DisableAutoReconnect bool
+	Callbacks            *Callbacks
+}
+
+// InitializeMQTTOverWebsocket allocates the mqtt client for the user, connecting over a websocket.
+// an empty string can be passed as the second argument for the user client
+func (u *UserClient) InitializeMQTTOverWebsocket(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, opts *MQTTWebsocketOptions) error {
+	if opts == nil || opts.Auth != MQTTAuthToken {
+		return errors.New("users can only connect over websockets with MQTTAuthToken")
+	}
+	mqc, err := newMqttWebsocketClient(u.getToken(), u.SystemKey, false, clientid, timeout, ssl, lastWill, opts)
+	if err != nil {
+		return err
+	}
+	useMQTTTokenSource(mqc, u.mqttToken)
+	u.MQTTClient = mqc
+	return nil
+}
+
+// InitializeMQTTOverWebsocket allocates the mqtt client for the developer, connecting over a websocket.
+// the second argument is the systemkey you wish to use for authenticating with the message broker
+func (d *DevClient) InitializeMQTTOverWebsocket(clientid, systemkey string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, opts *MQTTWebsocketOptions) error {
+	if opts == nil || opts.Auth != MQTTAuthToken {
+		return errors.New("developers can only connect over websockets with MQTTAuthToken")
+	}
+	mqc, err := newMqttWebsocketClient(d.getToken(), systemkey, false, clientid, timeout, ssl, lastWill, opts)
+	if err != nil {
+		return err
+	}
+	useMQTTTokenSource(mqc, d.mqttToken)
+	d.MQTTClient = mqc
+	return nil
+}
+
+// InitializeMQTTOverWebsocket allocates the mqtt client for the device, connecting over a websocket
+// with the authentication picked by opts.Auth
+func (d *DeviceClient) InitializeMQTTOverWebsocket(clientid string, ignore string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, opts *MQTTWebsocketOptions) error {
+	if opts == nil {
+		return errors.New("websocket options are required")
+	}
+	var mqc MqttClient
+	var err error
+	switch opts.Auth {
+	case MQTTAuthToken:
+		mqc, err = newMqttWebsocketClient(d.getToken(), d.SystemKey, false, clientid, timeout, ssl, lastWill, opts)
+	case MQTTAuthJWT:
+		mqc, err = newMqttWebsocketClient(d.getToken(), "", true, clientid, timeout, ssl, lastWill, opts)
+	case MQTTAuthMTLS:
+		if ssl == nil || (len(ssl.Certificates) == 0 && ssl.GetClientCertificate == nil) {
+			return errors.New("MQTTAuthMTLS needs a TLS config with a client certificate")
+		}
+		mqc, err = newMqttWebsocketClient(opts.Username, d.SystemKey, false, clientid, timeout, ssl, lastWill, opts)
+	default:
+		return fmt.Errorf("unknown MQTT auth mode %d", opts.Auth)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Auth != MQTTAuthMTLS {
+		useMQTTTokenSource(mqc, d.mqttToken)
+	}
+	d.MQTTClient = mqc
+	return nil
+}
+
+// newMqttWebsocketClient connects to the websocket endpoint in ws. When jwt is set token is sent as
+// the password over MQTT 3.1, otherwise as the username with password alongside it.
+func newMqttWebsocketClient(token, password string, jwt bool, clientid string, timeout int, ssl *tls.Config, lastWill *LastWillPacket, ws *MQTTWebsocketOptions) (MqttClient, error) {
+	u, err := url.Parse(ws.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket url %q: %w", ws.URL, err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("websocket url must start with ws:// or wss://, got %q", ws.URL)
+	}
+	if ws.Auth == MQTTAuthMTLS && u.Scheme != "wss" {
+		return nil, errors.New("MQTTAuthMTLS needs a wss:// url")
+	}
+	o := mqtt.NewClientOptions()
+	o.SetAutoReconnect(!ws.DisableAutoReconnect)
+	o.AddBroker(ws.URL)
+	if ssl != nil {
+		o.SetTLSConfig(ssl)
+	}
+	if ws.Headers != nil {
+		o.SetHTTPHeaders(ws.Headers)
+	}
+	if ws.Proxy != nil {
+		o.SetWebsocketOptions(&mqtt.WebsocketOptions{Proxy: ws.Proxy})
+	}
+	o.SetClientID(clientid)
+	creds := newMqttCredentials(token, password, false)
+	if jwt {
+		o.SetProtocolVersion(3)
+		creds = newMqttCredentials("", token, true)
+	}
+	o.SetConnectTimeout(time.Duration(timeout) * time.Second)
+	if lastWill != nil {
+		o.SetWill(lastWill.Topic, lastWill.Body, uint8(lastWill.Qos), lastWill.Retain)
+	}
+	subs := newSubscriptionManager()
+	creds.listen(subs)
+	o.SetCredentialsProvider(creds.get)
+	cb := subs.wrap(ws.Callbacks)
+	o.SetOnConnectHandler(cb.OnConnectCallback)
+	o.SetConnectionLostHandler(cb.OnConnectionLostCallback)
+	cli := mqtt.NewClient(o)
+	mqc := &mqttBaseClient{cli, ws.URL, token, password, "", clientid, timeout, subs, creds}
+	ret := mqc.Connect()
+	ret.Wait()
+	return mqc, ret.Error()
+}
@@ -0,0 +1,276 @@
+package GoSDK
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// websocketBroker serves a tcpBroker behind a websocket endpoint and records every handshake
+type websocketBroker struct {
+	*tcpBroker
+	srv *httptest.Server
+
+	hsMu       sync.Mutex
+	handshakes []*http.Request
+}
+
+func newWebsocketBroker(t *testing.T, secure bool) *websocketBroker {
+	t.Helper()
+	b := &websocketBroker{tcpBroker: newTCPBroker(t)}
+	handler := websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			b.hsMu.Lock()
+			b.handshakes = append(b.handshakes, r)
+			b.hsMu.Unlock()
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			b.serve(&tcpBrokerConn{Conn: ws})
+		},
+	}
+	b.srv = httptest.NewUnstartedServer(handler)
+	if secure {
+		b.srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+		b.srv.StartTLS()
+	} else {
+		b.srv.Start()
+	}
+	t.Cleanup(b.srv.Close)
+	return b
+}
+
+func (b *websocketBroker) url() string {
+	return "ws" + strings.TrimPrefix(b.srv.URL, "http") + "/mqtt"
+}
+
+// tlsConfig trusts the broker's certificate
+func (b *websocketBroker) tlsConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(b.srv.Certificate())
+	return &tls.Config{RootCAs: pool}
+}
+
+func (b *websocketBroker) handshakeRequests() []*http.Request {
+	b.hsMu.Lock()
+	defer b.hsMu.Unlock()
+	return append([]*http.Request(nil), b.handshakes...)
+}
+
+func clientCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dev"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func newWebsocketTestDevice() *DeviceClient {
+	d := NewDeviceClient("key", "secret", "dev", "active")
+	d.DeviceToken = "dev-token"
+	return d
+}
+
+func TestWebsocketRejectsBadURLs(t *testing.T) {
+	withCert := &tls.Config{Certificates: []tls.Certificate{clientCertificate(t)}}
+	for _, tc := range []struct {
+		name string
+		opts MQTTWebsocketOptions
+		ssl  *tls.Config
+		want string
+	}{
+		{name: "unparsable", opts: MQTTWebsocketOptions{URL: "ws://[::1"}, want: "invalid websocket url"},
+		{name: "tcp scheme", opts: MQTTWebsocketOptions{URL: "tcp://127.0.0.1:1883"}, want: "must start with ws:// or wss://"},
+		{name: "no scheme", opts: MQTTWebsocketOptions{URL: "broker.example.com/mqtt"}, want: "must start with ws:// or wss://"},
+		{name: "mtls over ws", opts: MQTTWebsocketOptions{URL: "ws://127.0.0.1:8903/mqtt", Auth: MQTTAuthMTLS}, ssl: withCert, want: "needs a wss:// url"},
+		{name: "mtls without a certificate", opts: MQTTWebsocketOptions{URL: "wss://127.0.0.1:8903/mqtt", Auth: MQTTAuthMTLS}, ssl: &tls.Config{}, want: "client certificate"},
+		{name: "unknown auth mode", opts: MQTTWebsocketOptions{URL: "wss://127.0.0.1:8903/mqtt", Auth: 9}, want: "unknown MQTT auth mode"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewDeviceClient("key", "secret", "dev", "active")
+			err := d.InitializeMQTTOverWebsocket("dev", "", 1, tc.ssl, nil, &tc.opts)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tc.want)
+			}
+			if d.MQTTClient != nil {
+				t.Fatal("client set after a failed initialize")
+			}
+		})
+	}
+}
+
+func TestWebsocketUserAndDevRequireTokenAuth(t *testing.T) {
+	for _, opts := range []*MQTTWebsocketOptions{
+		nil,
+		{URL: "wss://127.0.0.1:8903/mqtt", Auth: MQTTAuthJWT},
+		{URL: "wss://127.0.0.1:8903/mqtt", Auth: MQTTAuthMTLS},
+	} {
+		u := NewUserClient("key", "secret", "user@example.com", "pw")
+		if err := u.InitializeMQTTOverWebsocket("user", "", 1, nil, nil, opts); err == nil || !strings.Contains(err.Error(), "MQTTAuthToken") {
+			t.Fatalf("user with %+v: %v", opts, err)
+		}
+		d := NewDevClient("dev@example.com", "pw")
+		if err := d.InitializeMQTTOverWebsocket("dev", "key", 1, nil, nil, opts); err == nil || !strings.Contains(err.Error(), "MQTTAuthToken") {
+			t.Fatalf("developer with %+v: %v", opts, err)
+		}
+	}
+	if err := NewDeviceClient("key", "secret", "dev", "active").InitializeMQTTOverWebsocket("dev", "", 1, nil, nil, nil); err == nil {
+		t.Fatal("device accepted nil options")
+	}
+}
+
+func TestWebsocketAuthModes(t *testing.T) {
+	cert := clientCertificate(t)
+	for _, tc := range []struct {
+		name     string
+		auth     MQTTAuthMode
+		secure   bool
+		init     func(b *websocketBroker, opts *MQTTWebsocketOptions) (MqttClient, error)
+		username string
+		password string
+		version  byte
+		// a password without a username may not reach the wire depending on the paho build, so
+		// these are read from the credentials handed to the CONNECT
+		fromCreds bool
+	}{
+		{
+			name: "user token",
+			init: func(b *websocketBroker, opts *MQTTWebsocketOptions) (MqttClient, error) {
+				u := NewUserClient("key", "secret", "user@example.com", "pw")
+				u.UserToken = "user-token"
+				err := u.InitializeMQTTOverWebsocket("user", "", 5, nil, nil, opts)
+				return u.MQTTClient, err
+			},
+			username: "user-token", password: "key", version: 4,
+		},
+		{
+			name: "developer token",
+			init: func(b *websocketBroker, opts *MQTTWebsocketOptions) (MqttClient, error) {
+				d := NewDevClient("dev@example.com", "pw")
+				d.DevToken = "dev-token"
+				err := d.InitializeMQTTOverWebsocket("developer", "other-key", 5, nil, nil, opts)
+				return d.MQTTClient, err
+			},
+			username: "dev-token", password: "other-key", version: 4,
+		},
+		{
+			name: "device token",
+			init: func(b *websocketBroker, opts *MQTTWebsocketOptions) (MqttClient, error) {
+				d := newWebsocketTestDevice()
+				err := d.InitializeMQTTOverWebsocket("dev", "", 5, nil, nil, opts)
+				return d.MQTTClient, err
+			},
+			username: "dev-token", password: "key", version: 4,
+		},
+		{
+			name: "device jwt",
+			auth: MQTTAuthJWT,
+			init: func(b *websocketBroker, opts *MQTTWebsocketOptions) (MqttClient, error) {
+				d := newWebsocketTestDevice()
+				err := d.InitializeMQTTOverWebsocket("dev", "", 5, nil, nil, opts)
+				return d.MQTTClient, err
+			},
+			username: "", password: "dev-token", version: 3, fromCreds: true,
+		},
+		{
+			name:   "device mtls",
+			auth:   MQTTAuthMTLS,
+			secure: true,
+			init: func(b *websocketBroker, opts *MQTTWebsocketOptions) (MqttClient, error) {
+				d := newWebsocketTestDevice()
+				ssl := b.tlsConfig()
+				ssl.Certificates = []tls.Certificate{cert}
+				opts.Username = "dev-cert"
+				err := d.InitializeMQTTOverWebsocket("dev", "", 5, ssl, nil, opts)
+				return d.MQTTClient, err
+			},
+			username: "dev-cert", password: "key", version: 4,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newWebsocketBroker(t, tc.secure)
+			c, err := tc.init(b, &MQTTWebsocketOptions{URL: b.url(), Auth: tc.auth, DisableAutoReconnect: true})
+			if err != nil {
+				t.Fatalf("initialize: %v", err)
+			}
+			defer disconnect(c)
+			connects := b.connectPackets()
+			if len(connects) != 1 {
+				t.Fatalf("%d CONNECTs", len(connects))
+			}
+			p := connects[0]
+			username, password := p.Username, string(p.Password)
+			if tc.fromCreds {
+				username, password = credentialsOf(c).get()
+			}
+			if username != tc.username || password != tc.password || p.ProtocolVersion != tc.version {
+				t.Fatalf("CONNECT username %q password %q version %d, want %q %q %d",
+					username, password, p.ProtocolVersion, tc.username, tc.password, tc.version)
+			}
+			if tc.secure {
+				hs := b.handshakeRequests()
+				if len(hs) != 1 || hs[0].TLS == nil || len(hs[0].TLS.PeerCertificates) != 1 {
+					t.Fatal("client certificate not presented in the handshake")
+				}
+			}
+		})
+	}
+}
+
+func TestWebsocketPassesHeadersAndProxy(t *testing.T) {
+	b := newWebsocketBroker(t, true)
+	var proxied []string
+	var mu sync.Mutex
+	opts := &MQTTWebsocketOptions{
+		URL:     b.url(),
+		Headers: http.Header{"X-Site": {"north"}},
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			proxied = append(proxied, req.URL.Host)
+			// no proxy, dial the broker directly
+			return nil, nil
+		},
+		DisableAutoReconnect: true,
+	}
+	d := newWebsocketTestDevice()
+	if err := d.InitializeMQTTOverWebsocket("dev", "", 5, b.tlsConfig(), nil, opts); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	defer disconnect(d.MQTTClient)
+	hs := b.handshakeRequests()
+	if len(hs) != 1 || hs[0].Header.Get("X-Site") != "north" {
+		t.Fatalf("handshake headers %v", hs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(proxied) != 1 || proxied[0] != strings.TrimPrefix(b.srv.URL, "https://") {
+		t.Fatalf("proxy asked for %v", proxied)
+	}
+}
@@ -0,0 +1,386 @@
+package GoSDK
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	_OFFLINE_DEFAULT_RETRY     = 2 * time.Second
+	_OFFLINE_DEFAULT_MAX_RETRY = 2 * time.Minute
+)
+
+var ErrOfflineQueueClosed = errors.New("offline queue is closed")
+
+// OfflineMutationKind is the type of write held in an offline queue
+type OfflineMutationKind string
+
+const (
+	OfflineCreate OfflineMutationKind = "create"
+	OfflineUpdate OfflineMutationKind = "update"
+)
+
+// OfflineMutation is a single queued write. ID is generated on the client and is what makes replays
+// safe: created rows carry it in their id column and are upserted on it.
+type OfflineMutation struct {
+	Seq          uint64                   `json:"seq"`
+	ID           string                   `json:"id"`
+	Kind         OfflineMutationKind      `json:"kind"`
+	CollectionID string                   `json:"collection_id"`
+	Rows         []map[string]interface{} `json:"rows,omitempty"`
+	Query        *Query                   `json:"query,omitempty"`
+	Changes      map[string]interface{}   `json:"changes,omitempty"`
+	QueuedAt     time.Time                `json:"queued_at"`
+}
+
+// OfflineStore persists queued mutations in order. Implementations must survive a crash between
+// Append and Ack without losing or reordering entries.
+type OfflineStore interface {
+	Append(m OfflineMutation) error
+	// Front returns the oldest unacknowledged mutation
+	Front() (OfflineMutation, bool)
+	// Ack removes the mutation with the given sequence number, which is always the front
+	Ack(seq uint64) error
+	Len() int
+	// NextSeq returns one more than the highest sequence number ever appended
+	NextSeq() uint64
+	Close() error
+}
+
+// OfflineQueueOptions controls an OfflineQueue. Path is required unless Store is set.
+type OfflineQueueOptions struct {
+	// Path of the append-only queue file
+	Path string
+	// Store replaces the file store, e.g. with one backed by an embedded database
+	Store OfflineStore
+	// IDColumn receives the client generated id of created rows, "item_id" by default
+	IDColumn string
+	// RetryInterval is the initial delay between replay attempts, doubled up to MaxRetryInterval
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// OnDrop is called when the platform rejects a queued mutation outright. The mutation is removed.
+	OnDrop func(m OfflineMutation, err error)
+}
+
+// OfflineQueueStats is a point in time snapshot of an OfflineQueue
+type OfflineQueueStats struct {
+	Depth     int
+	OldestAge time.Duration
+	Replayed  int64
+	Dropped   int64
+	Retries   int64
+	LastError error
+}
+
+// OfflineQueue writes to collections directly while the platform is reachable and records the
+// writes durably while it is not, replaying them in order once it comes back.
+type OfflineQueue struct {
+	c    cbClient
+	opts OfflineQueueOptions
+
+	direct    sync.Mutex
+	mu        sync.Mutex
+	store     OfflineStore
+	sending   bool
+	closed    bool
+	replayed  int64
+	dropped   int64
+	retries   int64
+	lastError error
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// offlineSendError marks failures worth retrying, i.e. the request never got a useful answer
+type offlineSendError struct {
+	err       error
+	transient bool
+}
+
+func (e *offlineSendError) Error() string { return e.err.Error() }
+func (e *offlineSendError) Unwrap() error { return e.err }
+
+// NewOfflineQueue opens, or creates, the durable write queue described by opts and starts replaying it
+func (d *DevClient) NewOfflineQueue(opts OfflineQueueOptions) (*OfflineQueue, error) {
+	return newOfflineQueue(d, opts)
+}
+
+// NewOfflineQueue opens, or creates, the durable write queue described by opts and starts replaying it
+func (u *UserClient) NewOfflineQueue(opts OfflineQueueOptions) (*OfflineQueue, error) {
+	return newOfflineQueue(u, opts)
+}
+
+// NewOfflineQueue opens, or creates, the durable write queue described by opts and starts replaying it
+func (d *DeviceClient) NewOfflineQueue(opts OfflineQueueOptions) (*OfflineQueue, error) {
+	return newOfflineQueue(d, opts)
+}
+
+func newOfflineQueue(c cbClient, opts OfflineQueueOptions) (*OfflineQueue, error) {
+	if opts.IDColumn == "" {
+		opts.IDColumn = _SCHEMA_DEFAULT_ID_COLUMN
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = _OFFLINE_DEFAULT_RETRY
+	}
+	if opts.MaxRetryInterval < opts.RetryInterval {
+		opts.MaxRetryInterval = _OFFLINE_DEFAULT_MAX_RETRY
+	}
+	store := opts.Store
+	if store == nil {
+		if opts.Path == "" {
+			return nil, fmt.Errorf("offline queue needs a Path or a Store")
+		}
+		var err error
+		if store, err = OpenFileOfflineStore(opts.Path); err != nil {
+			return nil, err
+		}
+	}
+	q := &OfflineQueue{
+		c:     c,
+		opts:  opts,
+		store: store,
+		kick:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go q.replayLoop()
+	q.wake()
+	return q, nil
+}
+
+// CreateData inserts rows into a collection, or queues them if the platform cannot be reached.
+// Rows without an id get a client generated one so that a replay never duplicates them.
+// queued reports whether the rows were queued; err is only set when the platform rejected them.
+func (q *OfflineQueue) CreateData(collectionID string, rows []map[string]interface{}) (queued bool, err error) {
+	copied := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied[i] = make(map[string]interface{}, len(row)+1)
+		for k, v := range row {
+			copied[i][k] = v
+		}
+		if id, ok := copied[i][q.opts.IDColumn]; !ok || id == nil || id == "" {
+			copied[i][q.opts.IDColumn] = newClientID()
+		}
+	}
+	return q.submit(OfflineMutation{Kind: OfflineCreate, CollectionID: collectionID, Rows: copied})
+}
+
+// UpdateData applies changes to the rows matching query, or queues the update if the platform
+// cannot be reached. See CreateData for the return values.
+func (q *OfflineQueue) UpdateData(collectionID string, query *Query, changes map[string]interface{}) (queued bool, err error) {
+	if query == nil {
+		query = NewQuery()
+	}
+	return q.submit(OfflineMutation{Kind: OfflineUpdate, CollectionID: collectionID, Query: query, Changes: changes})
+}
+
+// Stats returns the current depth, age and counters of the queue
+func (q *OfflineQueue) Stats() OfflineQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := OfflineQueueStats{
+		Depth:     q.store.Len(),
+		Replayed:  q.replayed,
+		Dropped:   q.dropped,
+		Retries:   q.retries,
+		LastError: q.lastError,
+	}
+	if m, ok := q.store.Front(); ok {
+		s.OldestAge = time.Since(m.QueuedAt)
+	}
+	return s
+}
+
+// Close stops replaying and closes the store. Queued mutations stay on disk for the next run.
+func (q *OfflineQueue) Close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrOfflineQueueClosed
+	}
+	q.closed = true
+	q.mu.Unlock()
+	close(q.stop)
+	<-q.done
+	return q.store.Close()
+}
+
+func (q *OfflineQueue) submit(m OfflineMutation) (bool, error) {
+	m.ID = newClientID()
+	m.QueuedAt = time.Now()
+	// direct sends go one at a time without holding q.mu, so Stats, Close and the replay loop are
+	// not held up by the network. Nothing can be queued while one is in flight, so it cannot be
+	// overtaken by a later write.
+	q.direct.Lock()
+	defer q.direct.Unlock()
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false, ErrOfflineQueueClosed
+	}
+	// only go direct when nothing is waiting, otherwise this write would overtake queued ones
+	direct := q.store.Len() == 0 && !q.sending
+	q.mu.Unlock()
+
+	var sendErr error
+	if direct {
+		sendErr = q.send(m)
+		if sendErr == nil {
+			return false, nil
+		}
+		var se *offlineSendError
+		if !errors.As(sendErr, &se) || !se.transient {
+			return false, sendErr
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if sendErr != nil {
+		q.lastError = sendErr
+	}
+	if q.closed {
+		return false, ErrOfflineQueueClosed
+	}
+	m.Seq = q.store.NextSeq()
+	if err := q.store.Append(m); err != nil {
+		return false, fmt.Errorf("could not queue write: %w", err)
+	}
+	q.wake()
+	return true, nil
+}
+
+func (q *OfflineQueue) wake() {
+	select {
+	case q.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (q *OfflineQueue) replayLoop() {
+	defer close(q.done)
+	backoff := q.opts.RetryInterval
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-q.kick:
+		case <-timer.C:
+		}
+		ok := q.drain()
+		if ok {
+			backoff = q.opts.RetryInterval
+		} else if backoff *= 2; backoff > q.opts.MaxRetryInterval {
+			backoff = q.opts.MaxRetryInterval
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(backoff)
+	}
+}
+
+// drain replays queued mutations until the queue is empty or the platform is unreachable again
+func (q *OfflineQueue) drain() bool {
+	for {
+		q.mu.Lock()
+		m, ok := q.store.Front()
+		if !ok || q.closed {
+			q.mu.Unlock()
+			return true
+		}
+		q.sending = true
+		q.mu.Unlock()
+
+		err := q.send(m)
+
+		q.mu.Lock()
+		q.sending = false
+		var se *offlineSendError
+		if err != nil && errors.As(err, &se) && se.transient {
+			q.retries++
+			q.lastError = err
+			q.mu.Unlock()
+			return false
+		}
+		if ackErr := q.store.Ack(m.Seq); ackErr != nil {
+			q.lastError = ackErr
+			q.mu.Unlock()
+			return false
+		}
+		if err != nil {
+			q.dropped++
+			q.lastError = err
+		} else {
+			q.replayed++
+		}
+		q.mu.Unlock()
+		if err != nil && q.opts.OnDrop != nil {
+			q.opts.OnDrop(m, err)
+		}
+	}
+}
+
+func (q *OfflineQueue) send(m OfflineMutation) error {
+	creds, err := q.c.credentials()
+	if err != nil {
+		return err
+	}
+	var resp *CbResp
+	switch m.Kind {
+	case OfflineCreate:
+		url := fmt.Sprintf("%sdata/%s/upsert?conflictColumn=%s", _DATA_V4_PREAMBLE, m.CollectionID, q.opts.IDColumn)
+		resp, err = put(q.c, url, m.Rows, creds, nil)
+	case OfflineUpdate:
+		body := map[string]interface{}{"query": m.Query.serialize(), "$set": m.Changes}
+		resp, err = put(q.c, _DATA_PREAMBLE+m.CollectionID, body, creds, nil)
+	default:
+		return fmt.Errorf("unknown offline mutation kind %q", m.Kind)
+	}
+	if err != nil {
+		return &offlineSendError{err: fmt.Errorf("could not reach platform: %w", err), transient: true}
+	}
+	if resp.StatusCode != 200 {
+		transient := resp.StatusCode >= 500 || resp.StatusCode == 429 || resp.StatusCode == 408
+		return &offlineSendError{err: fmt.Errorf("%s of %s failed with status %d: %v", m.Kind, m.CollectionID, resp.StatusCode, resp.Body), transient: transient}
+	}
+	return nil
+}
+
+func newClientID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// FileOfflineStore keeps the queue in an append-only file of JSON lines. Acknowledgements are
+// appended as well and the file is rewritten once they outnumber the pending entries.
+type FileOfflineStore struct {
+	*fileQueue[OfflineMutation]
+}
+
+func (m OfflineMutation) sequence() uint64 { return m.Seq }
+
+// OpenFileOfflineStore opens the queue file at path, creating it if needed. A torn final line left
+// by a crash is ignored, other unreadable lines are moved aside and counted by Corrupt.
+func OpenFileOfflineStore(path string) (*FileOfflineStore, error) {
+	q, err := openFileQueue[OfflineMutation](path, "offline queue")
+	if err != nil {
+		return nil, err
+	}
+	return &FileOfflineStore{q}, nil
+}
@@ -0,0 +1,125 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// offlinePlatform accepts upserts while up and answers 503 while down. When gate is set every
+// request waits on it first.
+type offlinePlatform struct {
+	mu   sync.Mutex
+	down bool
+	got  []string
+	gate chan struct{}
+}
+
+func (p *offlinePlatform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.gate != nil {
+		<-p.gate
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		writeJSON(w, 503, "unavailable")
+		return
+	}
+	var rows []map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&rows)
+	for _, row := range rows {
+		p.got = append(p.got, row["name"].(string))
+	}
+	writeJSON(w, 200, rows)
+}
+
+func (p *offlinePlatform) setDown(down bool) {
+	p.mu.Lock()
+	p.down = down
+	p.mu.Unlock()
+}
+
+func (p *offlinePlatform) received() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.got...)
+}
+
+func newTestOfflineQueue(t *testing.T, p *offlinePlatform, path string) *OfflineQueue {
+	t.Helper()
+	q, err := newTestDevClient(t, p).NewOfflineQueue(OfflineQueueOptions{Path: path, RetryInterval: 10 * time.Millisecond, MaxRetryInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestOfflineQueueReplaysInOrder(t *testing.T) {
+	p := &offlinePlatform{down: true}
+	path := filepath.Join(t.TempDir(), "queue")
+	q := newTestOfflineQueue(t, p, path)
+	for _, name := range []string{"a", "b", "c"} {
+		queued, err := q.CreateData("cid", []map[string]interface{}{{"name": name}})
+		if err != nil || !queued {
+			t.Fatalf("write %s: queued %v, err %v", name, queued, err)
+		}
+	}
+	if depth := q.Stats().Depth; depth != 3 {
+		t.Fatalf("depth is %d, want 3", depth)
+	}
+	// a restart keeps the queue
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	q = newTestOfflineQueue(t, p, path)
+	defer q.Close()
+
+	p.setDown(false)
+	waitFor(t, "the queue to drain", func() bool { return q.Stats().Depth == 0 })
+	if got := p.received(); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("replayed %v, want [a b c]", got)
+	}
+	if queued, err := q.CreateData("cid", []map[string]interface{}{{"name": "d"}}); err != nil || queued {
+		t.Fatalf("write while up: queued %v, err %v", queued, err)
+	}
+}
+
+func TestOfflineQueueDirectSendDoesNotHoldTheLock(t *testing.T) {
+	p := &offlinePlatform{gate: make(chan struct{})}
+	q := newTestOfflineQueue(t, p, filepath.Join(t.TempDir(), "queue"))
+	defer q.Close()
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := q.CreateData("cid", []map[string]interface{}{{"name": "first"}})
+		first <- err
+	}()
+	second := make(chan error, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, err := q.CreateData("cid", []map[string]interface{}{{"name": "second"}})
+		second <- err
+	}()
+
+	stats := make(chan OfflineQueueStats, 1)
+	go func() { stats <- q.Stats() }()
+	select {
+	case <-stats:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stats blocked behind a direct send")
+	}
+
+	close(p.gate)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+	if got := p.received(); len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Fatalf("received %v, want [first second]", got)
+	}
+}
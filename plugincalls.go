@@ -61,7 +61,7 @@ func (d *DevClient) DeletePlugin(systemKey, name string) (map[string]interface{}
 	if err != nil {
 		return nil, err
 	}
-	resp, err := delete(d, _PLUGINS_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _PLUGINS_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return nil, err
@@ -63,7 +63,7 @@ func (d *DevClient) DeletePortal(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _PORTALS_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _PORTALS_USER_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
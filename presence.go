@@ -0,0 +1,471 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	_PRESENCE_DEFAULT_TOPIC_PREFIX = "presence"
+	_PRESENCE_DEFAULT_RECONCILE    = time.Minute
+	_PRESENCE_DEFAULT_BUFFER       = 100
+)
+
+// PresenceStatus is whether a device is connected
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// PresenceMessage is published, retained, on a device's status topic
+type PresenceMessage struct {
+	Device   string         `json:"device"`
+	Status   PresenceStatus `json:"status"`
+	ClientID string         `json:"client_id,omitempty"`
+	// Time is when the message was created. A last will carries the time it was registered.
+	Time time.Time `json:"time"`
+}
+
+// PresenceTopic returns the status topic of device, {prefix}/{device}/status
+func PresenceTopic(prefix, device string) string {
+	if prefix == "" {
+		prefix = _PRESENCE_DEFAULT_TOPIC_PREFIX
+	}
+	return prefix + "/" + device + "/status"
+}
+
+// PresenceOptions configures a device's Presence
+type PresenceOptions struct {
+	// TopicPrefix starts the status topic, "presence" by default
+	TopicPrefix string
+	// ClientID is included in presence messages to tell apart connections of the same device
+	ClientID string
+	// Qos defaults to 1, so a birth is not lost to a flaky connection
+	Qos int
+}
+
+// Presence announces a device's status: a retained online message after every connect and a
+// retained offline message as its last will
+type Presence struct {
+	d    *DeviceClient
+	opts PresenceOptions
+
+	mu      sync.Mutex
+	started bool
+	// c is the client Start published on, which Stop publishes on too
+	c MqttClient
+	// unlisten detaches from the reconnects of c
+	unlisten func()
+}
+
+// NewPresence returns the presence of this device. Pass its LastWill when initializing MQTT,
+// then Start it.
+func (d *DeviceClient) NewPresence(opts PresenceOptions) *Presence {
+	if opts.Qos == 0 {
+		opts.Qos = 1
+	}
+	return &Presence{d: d, opts: opts}
+}
+
+// Topic is the device's status topic
+func (p *Presence) Topic() string {
+	return PresenceTopic(p.opts.TopicPrefix, p.d.DeviceName)
+}
+
+// LastWill returns the retained offline message the broker publishes when the device drops off
+func (p *Presence) LastWill() *LastWillPacket {
+	body, _ := json.Marshal(p.message(PresenceOffline))
+	return &LastWillPacket{Topic: p.Topic(), Body: string(body), Qos: p.opts.Qos, Retain: true}
+}
+
+func (p *Presence) message(status PresenceStatus) *PresenceMessage {
+	return &PresenceMessage{Device: p.d.DeviceName, Status: status, ClientID: p.opts.ClientID, Time: time.Now().UTC()}
+}
+
+// Start publishes the birth message on the device's MQTTClient and publishes it again after every
+// reconnect of that client. Call Stop and Start again after replacing MQTTClient.
+func (p *Presence) Start() error {
+	c := p.d.MQTTClient
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	p.mu.Lock()
+	if p.started {
+		p.mu.Unlock()
+		return errors.New("presence is already started")
+	}
+	p.started = true
+	p.c = c
+	p.mu.Unlock()
+	// listen before the birth so a reconnect right after it is not missed
+	unlisten := func() {}
+	if subs := subscriptionsOf(c); subs != nil {
+		unlisten = subs.listen(func(ev MQTTEvent) {
+			if ev.Kind != MQTTReconnected {
+				return
+			}
+			// the broker published the last will when the connection dropped
+			go func() {
+				p.mu.Lock()
+				started := p.started && p.c == c
+				p.mu.Unlock()
+				if started {
+					p.publish(c, PresenceOnline)
+				}
+			}()
+		})
+	}
+	p.mu.Lock()
+	p.unlisten = unlisten
+	p.mu.Unlock()
+	if err := p.publish(c, PresenceOnline); err != nil {
+		p.mu.Lock()
+		p.started = false
+		p.c = nil
+		p.unlisten = nil
+		p.mu.Unlock()
+		unlisten()
+		return err
+	}
+	return nil
+}
+
+// Stop publishes the offline message on the client Start used, for a device disconnecting on
+// purpose. Stop and Start again to follow a replaced MQTTClient.
+func (p *Presence) Stop() error {
+	p.mu.Lock()
+	started, c := p.started, p.c
+	p.started = false
+	p.c = nil
+	unlisten := p.unlisten
+	p.unlisten = nil
+	p.mu.Unlock()
+	if unlisten != nil {
+		unlisten()
+	}
+	if !started {
+		return errors.New("presence is not started")
+	}
+	return p.publish(c, PresenceOffline)
+}
+
+func (p *Presence) publish(c MqttClient, status PresenceStatus) error {
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	body, err := json.Marshal(p.message(status))
+	if err != nil {
+		return err
+	}
+	return publish(c, p.Topic(), body, p.opts.Qos, 0, true)
+}
+
+// PresenceSource is what a PresenceEvent was learned from
+type PresenceSource int
+
+const (
+	// PresenceFromMQTT is a birth or last will on a status topic
+	PresenceFromMQTT PresenceSource = iota
+	// PresenceFromReconcile is a difference found by comparing with ConnectedDevices
+	PresenceFromReconcile
+)
+
+func (s PresenceSource) String() string {
+	if s == PresenceFromReconcile {
+		return "reconcile"
+	}
+	return "mqtt"
+}
+
+// PresenceEvent is a device going online or offline
+type PresenceEvent struct {
+	Device   string
+	Status   PresenceStatus
+	ClientID string
+	Time     time.Time
+	Source   PresenceSource
+}
+
+// PresenceWatcherOptions configures a PresenceWatcher. Zero values pick the defaults.
+type PresenceWatcherOptions struct {
+	// SystemKey defaults to the client's system key. Developers must set it.
+	SystemKey   string
+	TopicPrefix string
+	Qos         int
+	// ReconcileInterval is how often ConnectedDevices is compared with the known status, one minute by
+	// default. A negative interval only uses the status topics.
+	ReconcileInterval time.Duration
+	// ConnectedDevices replaces the ConnectedDevices call used to reconcile
+	ConnectedDevices func() ([]string, error)
+	// BufferSize is the number of events waiting to be read before the watcher blocks
+	BufferSize int
+	// OnError receives reconcile failures and status messages that do not decode
+	OnError func(err error)
+}
+
+// PresenceWatcher follows the status of every device. It takes retained and live messages from
+// the status topics and periodically corrects them with the platform's list of connected devices,
+// which catches devices that do not use Presence or whose last will was lost. Transitions are sent
+// on Events, which is closed by Close.
+type PresenceWatcher struct {
+	Events <-chan PresenceEvent
+
+	c         MqttClient
+	opts      PresenceWatcherOptions
+	connected func() ([]string, error)
+	filter    string
+	events    chan PresenceEvent
+
+	mu     sync.Mutex
+	status map[string]PresenceStatus
+	// heard is when a status topic last changed a device, so a stale connection list does not undo it
+	heard  map[string]time.Time
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewPresenceWatcher starts watching the status of every device of the system
+func (u *UserClient) NewPresenceWatcher(opts PresenceWatcherOptions) (*PresenceWatcher, error) {
+	if opts.SystemKey == "" {
+		opts.SystemKey = u.SystemKey
+	}
+	return newPresenceWatcher(u, u.MQTTClient, opts)
+}
+
+// NewPresenceWatcher starts watching the status of every device of the system
+func (d *DeviceClient) NewPresenceWatcher(opts PresenceWatcherOptions) (*PresenceWatcher, error) {
+	if opts.SystemKey == "" {
+		opts.SystemKey = d.SystemKey
+	}
+	return newPresenceWatcher(d, d.MQTTClient, opts)
+}
+
+// NewPresenceWatcher starts watching the status of every device of the system
+func (d *DevClient) NewPresenceWatcher(opts PresenceWatcherOptions) (*PresenceWatcher, error) {
+	return newPresenceWatcher(d, d.MQTTClient, opts)
+}
+
+func newPresenceWatcher(client cbClient, c MqttClient, opts PresenceWatcherOptions) (*PresenceWatcher, error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	if opts.ReconcileInterval == 0 {
+		opts.ReconcileInterval = _PRESENCE_DEFAULT_RECONCILE
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = _PRESENCE_DEFAULT_BUFFER
+	}
+	connected := opts.ConnectedDevices
+	if connected == nil && opts.ReconcileInterval > 0 {
+		if opts.SystemKey == "" {
+			return nil, errors.New("a system key is required to reconcile with ConnectedDevices")
+		}
+		connected = func() ([]string, error) {
+			resp, err := ConnectedDevices(client, opts.SystemKey)
+			if err != nil {
+				return nil, err
+			}
+			return connectedDeviceNames(resp)
+		}
+	}
+	events := make(chan PresenceEvent, opts.BufferSize)
+	w := &PresenceWatcher{
+		Events:    events,
+		c:         c,
+		opts:      opts,
+		connected: connected,
+		filter:    PresenceTopic(opts.TopicPrefix, "+"),
+		events:    events,
+		status:    map[string]PresenceStatus{},
+		heard:     map[string]time.Time{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	msgs, err := subscribe(c, w.filter, opts.Qos)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer close(w.done)
+		defer close(w.events)
+		var tick <-chan time.Time
+		if opts.ReconcileInterval > 0 {
+			ticker := time.NewTicker(opts.ReconcileInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-w.stop:
+				return
+			case pub, ok := <-msgs:
+				if !ok {
+					return
+				}
+				w.handleStatus(pub.Topic.Whole, pub.Payload)
+			case <-tick:
+				w.reconcile()
+			}
+		}
+	}()
+	return w, nil
+}
+
+// Status returns the last known status of device and whether it is known at all
+func (w *PresenceWatcher) Status(device string) (PresenceStatus, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s, ok := w.status[device]
+	return s, ok
+}
+
+// Online lists the devices currently known to be online
+func (w *PresenceWatcher) Online() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var online []string
+	for _, device := range sortedKeys(w.status) {
+		if w.status[device] == PresenceOnline {
+			online = append(online, device)
+		}
+	}
+	return online
+}
+
+// Reconcile compares the known status with ConnectedDevices now instead of waiting for the interval
+func (w *PresenceWatcher) Reconcile() error {
+	if w.connected == nil {
+		return errors.New("presence watcher has no connected devices source")
+	}
+	names, err := w.connected()
+	if err != nil {
+		return err
+	}
+	w.apply(names)
+	return nil
+}
+
+// Close unsubscribes from the status topics and closes Events
+func (w *PresenceWatcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errors.New("presence watcher is already closed")
+	}
+	w.closed = true
+	w.mu.Unlock()
+	close(w.stop)
+	err := unsubscribe(w.c, w.filter)
+	<-w.done
+	return err
+}
+
+func (w *PresenceWatcher) handleStatus(topic string, payload []byte) {
+	device := strings.TrimSuffix(topic, "/status")
+	device = device[strings.LastIndexByte(device, '/')+1:]
+	if len(payload) == 0 {
+		// a cleared retained message
+		return
+	}
+	var msg PresenceMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		w.fail(fmt.Errorf("could not decode presence on %s: %w", topic, err))
+		return
+	}
+	if msg.Status != PresenceOnline && msg.Status != PresenceOffline {
+		w.fail(fmt.Errorf("unknown presence status %q on %s", msg.Status, topic))
+		return
+	}
+	now := time.Now()
+	at := msg.Time
+	if at.IsZero() || msg.Status == PresenceOffline {
+		// a last will carries the time the device connected, not when it went away
+		at = now
+	}
+	w.mu.Lock()
+	w.heard[device] = now
+	w.mu.Unlock()
+	w.transition(PresenceEvent{Device: device, Status: msg.Status, ClientID: msg.ClientID, Time: at, Source: PresenceFromMQTT})
+}
+
+func (w *PresenceWatcher) reconcile() {
+	if err := w.Reconcile(); err != nil {
+		w.fail(fmt.Errorf("could not reconcile presence: %w", err))
+	}
+}
+
+// apply brings the known status in line with the connected devices, except for devices a status
+// topic changed within the last interval
+func (w *PresenceWatcher) apply(names []string) {
+	now := time.Now()
+	connected := map[string]bool{}
+	for _, name := range names {
+		connected[name] = true
+	}
+	w.mu.Lock()
+	var changes []PresenceEvent
+	recent := func(device string) bool {
+		heard, ok := w.heard[device]
+		return ok && w.opts.ReconcileInterval > 0 && now.Sub(heard) < w.opts.ReconcileInterval
+	}
+	for _, device := range sortedKeys(w.status) {
+		if w.status[device] == PresenceOnline && !connected[device] && !recent(device) {
+			changes = append(changes, PresenceEvent{Device: device, Status: PresenceOffline, Time: now, Source: PresenceFromReconcile})
+		}
+	}
+	for _, device := range names {
+		if w.status[device] != PresenceOnline && !recent(device) {
+			changes = append(changes, PresenceEvent{Device: device, Status: PresenceOnline, Time: now, Source: PresenceFromReconcile})
+		}
+	}
+	w.mu.Unlock()
+	for _, ev := range changes {
+		w.transition(ev)
+	}
+}
+
+// transition records ev and sends it on Events if it changes the device's status
+func (w *PresenceWatcher) transition(ev PresenceEvent) {
+	w.mu.Lock()
+	if w.status[ev.Device] == ev.Status || w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.status[ev.Device] = ev.Status
+	w.mu.Unlock()
+	select {
+	case w.events <- ev:
+	case <-w.stop:
+	}
+}
+
+func (w *PresenceWatcher) fail(err error) {
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+}
+
+// connectedDeviceNames reads a ConnectedDevices response, {"DATA": ["device", ...]}. Any other
+// shape is an error rather than a guess, since a wrong guess would mark devices offline.
+func connectedDeviceNames(resp map[string]interface{}) ([]string, error) {
+	list, ok := resp["DATA"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("connected devices response has no DATA list: %v", resp)
+	}
+	names := make([]string, 0, len(list))
+	for _, entry := range list {
+		name, ok := entry.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("connected devices response lists %v, not a device name", entry)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
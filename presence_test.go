@@ -0,0 +1,302 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+// newPresenceDevice connects a device named name to b with its presence's last will
+func newPresenceDevice(t *testing.T, b *MemoryBroker, name, clientID string) (*DeviceClient, *Presence) {
+	t.Helper()
+	d := NewDeviceClient("key", "secret", name, "active")
+	p := d.NewPresence(PresenceOptions{ClientID: clientID})
+	c, err := b.NewClient(clientID, MemoryClientOptions{LastWill: p.LastWill()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { disconnect(c) })
+	d.MQTTClient = c
+	return d, p
+}
+
+func nextPresence(t *testing.T, msgs <-chan *mqttTypes.Publish) PresenceMessage {
+	t.Helper()
+	select {
+	case pub := <-msgs:
+		var msg PresenceMessage
+		if err := json.Unmarshal(pub.Payload, &msg); err != nil {
+			t.Fatalf("presence on %s: %v", pub.Topic.Whole, err)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a presence message")
+		return PresenceMessage{}
+	}
+}
+
+func TestPresenceBirthWillAndRebirth(t *testing.T) {
+	b := NewMemoryBroker()
+	_, p := newPresenceDevice(t, b, "d1", "d1-conn")
+	if err := p.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer p.Stop()
+
+	// the birth is retained, so a late subscriber sees it
+	msgs, err := subscribe(newMemoryClient(t, b, "observer"), PresenceTopic("", "d1"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := nextPresence(t, msgs); msg.Status != PresenceOnline || msg.Device != "d1" || msg.ClientID != "d1-conn" {
+		t.Fatalf("birth %+v", msg)
+	}
+	if err := b.DropConnection("d1-conn"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := nextPresence(t, msgs); msg.Status != PresenceOffline {
+		t.Fatalf("will %+v", msg)
+	}
+	if msg := nextPresence(t, msgs); msg.Status != PresenceOnline {
+		t.Fatalf("rebirth after reconnect %+v", msg)
+	}
+}
+
+func TestPresenceFollowsAReplacedMQTTClient(t *testing.T) {
+	b := NewMemoryBroker()
+	d, p := newPresenceDevice(t, b, "d1", "first")
+	if err := p.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	msgs, err := subscribe(newMemoryClient(t, b, "observer"), PresenceTopic("", "d1"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextPresence(t, msgs)
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	nextPresence(t, msgs)
+
+	second, err := b.NewClient("second", MemoryClientOptions{LastWill: p.LastWill()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disconnect(second)
+	d.MQTTClient = second
+	if err := p.Start(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	defer p.Stop()
+	if msg := nextPresence(t, msgs); msg.Status != PresenceOnline {
+		t.Fatalf("birth on the new client %+v", msg)
+	}
+
+	// the old client reconnecting publishes its will but no birth any more
+	if err := b.DropConnection("first"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := nextPresence(t, msgs); msg.Status != PresenceOffline {
+		t.Fatalf("old client's will %+v", msg)
+	}
+	select {
+	case pub := <-msgs:
+		t.Fatalf("the old client published %s", pub.Payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := b.DropConnection("second"); err != nil {
+		t.Fatal(err)
+	}
+	nextPresence(t, msgs)
+	if msg := nextPresence(t, msgs); msg.Status != PresenceOnline {
+		t.Fatalf("rebirth on the new client %+v", msg)
+	}
+}
+
+// dropAfterPublish drops its connection once, right after its first publish
+type dropAfterPublish struct {
+	mqtt.Client
+	once sync.Once
+	drop func()
+}
+
+func (c *dropAfterPublish) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	tok := c.Client.Publish(topic, qos, retained, payload)
+	tok.Wait()
+	c.once.Do(c.drop)
+	return tok
+}
+
+func TestPresenceRebirthAfterAReconnectDuringStart(t *testing.T) {
+	b := NewMemoryBroker()
+	d, p := newPresenceDevice(t, b, "d1", "d1-conn")
+	reconnected := make(chan struct{}, 1)
+	if err := onMQTTEvent(d.MQTTClient, func(ev MQTTEvent) {
+		if ev.Kind == MQTTReconnected {
+			reconnected <- struct{}{}
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the birth is not done until the reconnect after it has been reported
+	base := d.MQTTClient.(*mqttBaseClient)
+	base.Client = &dropAfterPublish{Client: base.Client, drop: func() {
+		b.DropConnection("d1-conn")
+		<-reconnected
+	}}
+	msgs, err := subscribe(newMemoryClient(t, b, "observer"), PresenceTopic("", "d1"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer p.Stop()
+	for _, want := range []PresenceStatus{PresenceOnline, PresenceOffline, PresenceOnline} {
+		if msg := nextPresence(t, msgs); msg.Status != want {
+			t.Fatalf("got %s, want %s", msg.Status, want)
+		}
+	}
+}
+
+func TestPresenceStopsOnTheStartedClient(t *testing.T) {
+	b := NewMemoryBroker()
+	d, p := newPresenceDevice(t, b, "d1", "d1-conn")
+	if err := p.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	msgs, err := subscribe(newMemoryClient(t, b, "observer"), PresenceTopic("", "d1"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextPresence(t, msgs)
+	// the client is replaced without stopping first
+	d.MQTTClient = nil
+	if err := p.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if msg := nextPresence(t, msgs); msg.Status != PresenceOffline {
+		t.Fatalf("stop published %+v", msg)
+	}
+	if err := p.Stop(); err == nil {
+		t.Fatal("second Stop succeeded")
+	}
+}
+
+func nextPresenceEvent(t *testing.T, w *PresenceWatcher) PresenceEvent {
+	t.Helper()
+	select {
+	case ev := <-w.Events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a presence event")
+		return PresenceEvent{}
+	}
+}
+
+func TestPresenceWatcherMergesStatusTopicsWithReconcile(t *testing.T) {
+	b := NewMemoryBroker()
+	_, p := newPresenceDevice(t, b, "d1", "d1-conn")
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	connected := []string{"d1", "d2"}
+	u := NewUserClient("key", "secret", "user@example.com", "password")
+	u.MQTTClient = newMemoryClient(t, b, "watcher")
+	w, err := u.NewPresenceWatcher(PresenceWatcherOptions{
+		ReconcileInterval: time.Hour,
+		ConnectedDevices:  func() ([]string, error) { return connected, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if ev := nextPresenceEvent(t, w); ev.Device != "d1" || ev.Status != PresenceOnline || ev.Source != PresenceFromMQTT {
+		t.Fatalf("retained birth gave %+v", ev)
+	}
+	if err := w.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	// d1 was just heard on its status topic, so only d2 comes from the connection list
+	if ev := nextPresenceEvent(t, w); ev.Device != "d2" || ev.Status != PresenceOnline || ev.Source != PresenceFromReconcile {
+		t.Fatalf("reconcile gave %+v", ev)
+	}
+	connected = []string{"d1"}
+	if err := w.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextPresenceEvent(t, w); ev.Device != "d2" || ev.Status != PresenceOffline {
+		t.Fatalf("reconcile gave %+v", ev)
+	}
+	if online := w.Online(); len(online) != 1 || online[0] != "d1" {
+		t.Fatalf("online %v", online)
+	}
+}
+
+func TestPresenceWatcherReconcilesWithConnectedDevices(t *testing.T) {
+	var mu sync.Mutex
+	var body interface{} = map[string]interface{}{"DATA": []string{"d1"}}
+	d := newTestDevClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != _DEVICE_V4_PREAMBLE+"key/connections" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		writeJSON(w, http.StatusOK, body)
+	}))
+	d.MQTTClient = newMemoryClient(t, NewMemoryBroker(), "watcher")
+	w, err := d.NewPresenceWatcher(PresenceWatcherOptions{SystemKey: "key", ReconcileInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Reconcile(); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if ev := nextPresenceEvent(t, w); ev.Device != "d1" || ev.Status != PresenceOnline {
+		t.Fatalf("reconcile gave %+v", ev)
+	}
+
+	// a response of another shape is an error and changes nothing
+	mu.Lock()
+	body = map[string]interface{}{"d1": true, "d2": true}
+	mu.Unlock()
+	if err := w.Reconcile(); err == nil {
+		t.Fatal("reconciled with an unexpected response")
+	}
+	if online := w.Online(); len(online) != 1 || online[0] != "d1" {
+		t.Fatalf("online %v", online)
+	}
+}
+
+func TestConnectedDeviceNames(t *testing.T) {
+	names, err := connectedDeviceNames(map[string]interface{}{"DATA": []interface{}{"a", "b"}})
+	if err != nil || len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("got %v, %v", names, err)
+	}
+	if names, err := connectedDeviceNames(map[string]interface{}{"DATA": []interface{}{}}); err != nil || len(names) != 0 {
+		t.Fatalf("empty list gave %v, %v", names, err)
+	}
+	for _, resp := range []map[string]interface{}{
+		{},
+		{"a": true},
+		{"DATA": "a"},
+		{"DATA": map[string]interface{}{"a": true}},
+		{"DATA": []interface{}{"a", 1.0}},
+		{"DATA": []interface{}{""}},
+	} {
+		if names, err := connectedDeviceNames(resp); err == nil {
+			t.Fatalf("%v gave %v", resp, names)
+		}
+	}
+}
@@ -33,11 +33,11 @@ func (d *DevClient) OpenRemoteShell(systemKey, edgeName, origin string, handler
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	if d.DevToken == "" {
+	if d.getToken() == "" {
 		return nil, fmt.Errorf("client is not authenticated")
 	}
 
-	cfg.Protocol = []string{"clearblade", d.DevToken, systemKey, edgeName}
+	cfg.Protocol = []string{"clearblade", d.getToken(), systemKey, edgeName}
 	conn, err := websocket.DialConfig(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial: %w", err)
@@ -0,0 +1,379 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+)
+
+const (
+	_ROUTER_DEFAULT_WORKERS = 4
+	_ROUTER_DEFAULT_QUEUE   = 256
+)
+
+var ErrRouterClosed = errors.New("router is closed")
+
+// RouteMessage is a message delivered to a RouteHandler. Params holds the named wildcard segments
+// of the pattern that matched, e.g. {"deviceId": "abc"} for devices/{deviceId}/telemetry.
+type RouteMessage struct {
+	Pattern string
+	Topic   string
+	Payload []byte
+	Params  map[string]string
+	// Value is set by decoding middleware such as DecodeJSON
+	Value interface{}
+}
+
+// RouteHandler processes one message. Returned errors go to RouterOptions.OnError.
+type RouteHandler func(msg *RouteMessage) error
+
+// RouteMiddleware wraps a handler, e.g. to recover panics or decode payloads
+type RouteMiddleware func(next RouteHandler) RouteHandler
+
+// RouteLogger is satisfied by MQTTLogger and *log.Logger
+type RouteLogger interface {
+	Printf(format string, v ...interface{})
+}
+
+// RouterOptions controls a Router. Zero values pick sane defaults.
+type RouterOptions struct {
+	// Workers is the number of handlers that may run at once
+	Workers int
+	// QueueSize is the number of messages waiting for a worker before subscriptions back up
+	QueueSize int
+	// Subscribe controls the channel of each underlying subscription
+	Subscribe SubscribeOptions
+	// OnError receives the errors returned by handlers
+	OnError func(msg *RouteMessage, err error)
+}
+
+type routerRoute struct {
+	pattern  string
+	filter   string
+	segments []string
+	handler  RouteHandler
+}
+
+// Router subscribes on behalf of pattern handlers and dispatches messages to a bounded pool of
+// workers. Its subscriptions go through the client, so they are restored after a reconnect.
+type Router struct {
+	c    MqttClient
+	opts RouterOptions
+
+	mu         sync.Mutex
+	routes     map[string]*routerRoute
+	middleware []RouteMiddleware
+	closed     bool
+
+	jobs      chan routerJob
+	workers   sync.WaitGroup
+	forwarder sync.WaitGroup
+	// handling counts Handle calls still subscribing, which Close waits for before unsubscribing
+	handling sync.WaitGroup
+}
+
+type routerJob struct {
+	route *routerRoute
+	msg   *RouteMessage
+}
+
+// NewRouter returns a Router on the client's MQTT connection
+func (u *UserClient) NewRouter(opts RouterOptions) (*Router, error) {
+	return newRouter(u.MQTTClient, opts)
+}
+
+// NewRouter returns a Router on the client's MQTT connection
+func (d *DeviceClient) NewRouter(opts RouterOptions) (*Router, error) {
+	return newRouter(d.MQTTClient, opts)
+}
+
+// NewRouter returns a Router on the client's MQTT connection
+func (d *DevClient) NewRouter(opts RouterOptions) (*Router, error) {
+	return newRouter(d.MQTTClient, opts)
+}
+
+func newRouter(c MqttClient, opts RouterOptions) (*Router, error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = _ROUTER_DEFAULT_WORKERS
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = _ROUTER_DEFAULT_QUEUE
+	}
+	r := &Router{
+		c:      c,
+		opts:   opts,
+		routes: map[string]*routerRoute{},
+		jobs:   make(chan routerJob, opts.QueueSize),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		r.workers.Add(1)
+		go r.work()
+	}
+	return r, nil
+}
+
+// Use adds middleware. Middleware applies to every route, including ones already registered, in the
+// order it was added.
+func (r *Router) Use(mw ...RouteMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Handle subscribes to pattern and routes its messages to h. Patterns are topic filters whose levels
+// may be named: {name} matches one level like +, and a final {name...} matches the rest like #.
+func (r *Router) Handle(pattern string, qos int, h RouteHandler) error {
+	filter, segments, err := compileRoutePattern(pattern)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRouterClosed
+	}
+	if _, ok := r.routes[pattern]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("a handler is already registered for %s", pattern)
+	}
+	for _, other := range r.routes {
+		if other.filter == filter {
+			r.mu.Unlock()
+			return fmt.Errorf("%s and %s subscribe to the same filter %s", pattern, other.pattern, filter)
+		}
+	}
+	route := &routerRoute{pattern: pattern, filter: filter, segments: segments, handler: h}
+	r.routes[pattern] = route
+	// both are added under the lock so a concurrent Close cannot miss this route
+	r.handling.Add(1)
+	r.forwarder.Add(1)
+	r.mu.Unlock()
+	defer r.handling.Done()
+
+	msgs, err := subscribeWithOptions(r.c, filter, qos, r.opts.Subscribe)
+	if err != nil {
+		r.mu.Lock()
+		delete(r.routes, pattern)
+		r.mu.Unlock()
+		r.forwarder.Done()
+		return err
+	}
+	go func() {
+		defer r.forwarder.Done()
+		for pub := range msgs {
+			topic := pub.Topic.Whole
+			r.jobs <- routerJob{route: route, msg: &RouteMessage{
+				Pattern: pattern,
+				Topic:   topic,
+				Payload: pub.Payload,
+				Params:  route.params(topic),
+			}}
+		}
+	}()
+	return nil
+}
+
+// Dispatch hands pub to the handlers whose patterns match its topic as if it had been received,
+// e.g. to replay message history through them. It returns an error when no pattern matches.
+func (r *Router) Dispatch(pub *mqttTypes.Publish) error {
+	topic := pub.Topic.Whole
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRouterClosed
+	}
+	var matched []*routerRoute
+	for _, route := range r.routes {
+		if topicMatches(route.filter, topic) {
+			matched = append(matched, route)
+		}
+	}
+	if len(matched) == 0 {
+		r.mu.Unlock()
+		return fmt.Errorf("no handler is registered for %s", topic)
+	}
+	// counts as a forwarder so Close waits for it before closing the job queue
+	r.forwarder.Add(1)
+	r.mu.Unlock()
+	defer r.forwarder.Done()
+	for _, route := range matched {
+		r.jobs <- routerJob{route: route, msg: &RouteMessage{
+			Pattern: route.pattern,
+			Topic:   topic,
+			Payload: pub.Payload,
+			Params:  route.params(topic),
+		}}
+	}
+	return nil
+}
+
+// Remove unsubscribes the handler registered for pattern
+func (r *Router) Remove(pattern string) error {
+	r.mu.Lock()
+	route, ok := r.routes[pattern]
+	delete(r.routes, pattern)
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no handler is registered for %s", pattern)
+	}
+	return unsubscribe(r.c, route.filter)
+}
+
+// Close unsubscribes every route and waits for the messages already queued to be handled
+func (r *Router) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRouterClosed
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	// a Handle call that got in before closed was set finishes subscribing first
+	r.handling.Wait()
+	r.mu.Lock()
+	routes := r.routes
+	r.routes = map[string]*routerRoute{}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, route := range routes {
+		if err := unsubscribe(r.c, route.filter); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", route.pattern, err))
+		}
+	}
+	r.forwarder.Wait()
+	close(r.jobs)
+	r.workers.Wait()
+	return errors.Join(errs...)
+}
+
+func (r *Router) work() {
+	defer r.workers.Done()
+	for job := range r.jobs {
+		r.mu.Lock()
+		h := job.route.handler
+		for i := len(r.middleware) - 1; i >= 0; i-- {
+			h = r.middleware[i](h)
+		}
+		r.mu.Unlock()
+		if err := h(job.msg); err != nil && r.opts.OnError != nil {
+			r.opts.OnError(job.msg, err)
+		}
+	}
+}
+
+func (rt *routerRoute) params(topic string) map[string]string {
+	params := map[string]string{}
+	levels := strings.Split(topic, "/")
+	for i, name := range rt.segments {
+		if name == "" || i >= len(levels) {
+			continue
+		}
+		if strings.HasSuffix(name, "...") {
+			params[strings.TrimSuffix(name, "...")] = strings.Join(levels[i:], "/")
+			break
+		}
+		params[name] = levels[i]
+	}
+	return params
+}
+
+// compileRoutePattern turns a route pattern into a topic filter and the names of its wildcard levels
+func compileRoutePattern(pattern string) (string, []string, error) {
+	if pattern == "" {
+		return "", nil, errors.New("empty route pattern")
+	}
+	levels := strings.Split(pattern, "/")
+	filter := make([]string, len(levels))
+	names := make([]string, len(levels))
+	seen := map[string]bool{}
+	for i, level := range levels {
+		last := i == len(levels)-1
+		switch {
+		case strings.HasPrefix(level, "{") && strings.HasSuffix(level, "}"):
+			name := level[1 : len(level)-1]
+			rest := strings.HasSuffix(name, "...")
+			bare := strings.TrimSuffix(name, "...")
+			if !identifierPattern.MatchString(bare) {
+				return "", nil, fmt.Errorf("route pattern %s: invalid parameter name %q", pattern, bare)
+			}
+			if seen[bare] {
+				return "", nil, fmt.Errorf("route pattern %s: parameter %s used twice", pattern, bare)
+			}
+			seen[bare] = true
+			if rest && !last {
+				return "", nil, fmt.Errorf("route pattern %s: %s must be the last level", pattern, level)
+			}
+			filter[i] = "+"
+			if rest {
+				filter[i] = "#"
+			}
+			names[i] = name
+		case level == "#":
+			if !last {
+				return "", nil, fmt.Errorf("route pattern %s: # must be the last level", pattern)
+			}
+			filter[i] = level
+		case strings.ContainsAny(level, "{}#") || (strings.Contains(level, "+") && level != "+"):
+			return "", nil, fmt.Errorf("route pattern %s: invalid level %q", pattern, level)
+		default:
+			filter[i] = level
+		}
+	}
+	return strings.Join(filter, "/"), names, nil
+}
+
+// Recover turns a panicking handler into an error carrying the stack trace
+func Recover() RouteMiddleware {
+	return func(next RouteHandler) RouteHandler {
+		return func(msg *RouteMessage) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("handler for %s panicked: %v\n%s", msg.Topic, p, debug.Stack())
+				}
+			}()
+			return next(msg)
+		}
+	}
+}
+
+// Logging logs every message with how long its handler took and what it returned
+func Logging(logger RouteLogger) RouteMiddleware {
+	return func(next RouteHandler) RouteHandler {
+		return func(msg *RouteMessage) error {
+			start := time.Now()
+			err := next(msg)
+			if err != nil {
+				logger.Printf("%s (%s) failed after %v: %v\n", msg.Topic, msg.Pattern, time.Since(start), err)
+			} else {
+				logger.Printf("%s (%s) handled in %v\n", msg.Topic, msg.Pattern, time.Since(start))
+			}
+			return err
+		}
+	}
+}
+
+// DecodeJSON unmarshals every payload into a value from newValue and stores it in RouteMessage.Value.
+// Messages that do not decode never reach the handler.
+func DecodeJSON(newValue func() interface{}) RouteMiddleware {
+	return func(next RouteHandler) RouteHandler {
+		return func(msg *RouteMessage) error {
+			v := newValue()
+			if err := json.Unmarshal(msg.Payload, v); err != nil {
+				return fmt.Errorf("could not decode message on %s: %w", msg.Topic, err)
+			}
+			msg.Value = v
+			return next(msg)
+		}
+	}
+}
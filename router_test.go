@@ -0,0 +1,152 @@
+package GoSDK
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/clearblade/paho.mqtt.golang"
+)
+
+func TestRouterRoutesByPattern(t *testing.T) {
+	b := NewMemoryBroker()
+	pub := newMemoryClient(t, b, "pub")
+	r, err := newRouter(newMemoryClient(t, b, "svc"), RouterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got := make(chan *RouteMessage, 1)
+	if err := r.Handle("devices/{deviceId}/{rest...}", 1, func(msg *RouteMessage) error {
+		got <- msg
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	publish(pub, "devices/d1/telemetry/temp", []byte("20"), 1, 0, false)
+	select {
+	case msg := <-got:
+		if msg.Params["deviceId"] != "d1" || msg.Params["rest"] != "telemetry/temp" || string(msg.Payload) != "20" {
+			t.Fatalf("routed %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not routed")
+	}
+}
+
+func TestRouterRecoverMiddleware(t *testing.T) {
+	b := NewMemoryBroker()
+	pub := newMemoryClient(t, b, "pub")
+	errs := make(chan error, 2)
+	r, err := newRouter(newMemoryClient(t, b, "svc"), RouterOptions{
+		Workers: 1,
+		OnError: func(msg *RouteMessage, err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Use(Recover())
+	if err := r.Handle("jobs/{id}", 1, func(msg *RouteMessage) error {
+		if msg.Params["id"] == "bad" {
+			panic("boom")
+		}
+		return errors.New("handled " + msg.Params["id"])
+	}); err != nil {
+		t.Fatal(err)
+	}
+	publish(pub, "jobs/bad", nil, 1, 0, false)
+	publish(pub, "jobs/good", nil, 1, 0, false)
+	for _, want := range []string{"handler for jobs/bad panicked: boom", "handled good"} {
+		select {
+		case err := <-errs:
+			if !strings.Contains(err.Error(), want) {
+				t.Fatalf("got error %q, want %q", err, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no error reported for %q, the worker may have died", want)
+		}
+	}
+}
+
+func TestRouterResubscribesAfterReconnect(t *testing.T) {
+	b := NewMemoryBroker()
+	pub := newMemoryClient(t, b, "pub")
+	svc := newMemoryClient(t, b, "svc")
+	events := recordEvents(t, svc)
+	r, err := newRouter(svc, RouterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got := make(chan string, 1)
+	if err := r.Handle("cmd/{name}", 1, func(msg *RouteMessage) error {
+		got <- msg.Params["name"]
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	b.DropConnection("svc")
+	waitFor(t, "the route to be resubscribed", func() bool { return events.has(MQTTResubscribed, "cmd/+") })
+	publish(pub, "cmd/reboot", nil, 1, 0, false)
+	select {
+	case name := <-got:
+		if name != "reboot" {
+			t.Fatalf("routed %s", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("route did not survive the reconnect")
+	}
+}
+
+// gatedSubscribeClient holds every Subscribe until gate is closed
+type gatedSubscribeClient struct {
+	mqtt.Client
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (c *gatedSubscribeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	close(c.entered)
+	<-c.gate
+	return c.Client.Subscribe(topic, qos, callback)
+}
+
+func TestRouterCloseWaitsForHandle(t *testing.T) {
+	b := NewMemoryBroker()
+	base := newMemoryClient(t, b, "svc").(*mqttBaseClient)
+	c := &gatedSubscribeClient{Client: base.Client, entered: make(chan struct{}), gate: make(chan struct{})}
+	r, err := newRouter(&mqttBaseClient{Client: c, subs: base.subs}, RouterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.Handle("late/{x}", 1, func(*RouteMessage) error { return nil })
+	}()
+	<-c.entered
+	closed := make(chan error, 1)
+	go func() { closed <- r.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while Handle was still subscribing")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(c.gate)
+	wg.Wait()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	if subs := b.Subscriptions("svc"); len(subs) != 0 {
+		t.Fatalf("closed router left subscriptions %v", subs)
+	}
+}
@@ -0,0 +1,433 @@
+package GoSDK
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+	"github.com/eclipse/paho.golang/autopaho/extensions/rpc"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/log"
+)
+
+const (
+	_RPC_DEFAULT_TIMEOUT    = 30 * time.Second
+	_RPC_DEFAULT_WORKERS    = 8
+	_RPC_REPLY_TOPIC_PREFIX = "rpc/reply/"
+	_RPC_ERROR_PROPERTY     = "rpc-error"
+)
+
+var ErrRequesterClosed = errors.New("requester is closed")
+
+// RequestHandler answers a request received by HandleRequests. A returned error is sent back to
+// the requester, where Request returns it as an *RPCError.
+type RequestHandler func(topic string, payload []byte) ([]byte, error)
+
+// RPCError is an error returned by the remote RequestHandler
+type RPCError struct {
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return "remote handler failed: " + e.Message
+}
+
+// RequesterOptions configures a Requester. The zero value is usable.
+type RequesterOptions struct {
+	// ReplyTopic is where replies are sent. It defaults to a topic unique to the Requester.
+	ReplyTopic string
+	Qos        int
+	// Timeout applies to requests whose context has no deadline. It defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// HandlerOptions configures HandleRequestsWithOptions. The zero value is usable.
+type HandlerOptions struct {
+	// Workers is the number of requests handled at once. It defaults to 8; further requests wait
+	// in the subscription.
+	Workers int
+	// OnError receives the failures to publish a reply
+	OnError func(err error)
+}
+
+// rpcEnvelope carries the correlation of a request or reply over MQTT 3, which has no properties
+type rpcEnvelope struct {
+	CorrelationID string `json:"correlation_id"`
+	ReplyTo       string `json:"reply_to,omitempty"`
+	Payload       []byte `json:"payload"`
+	Error         string `json:"error,omitempty"`
+}
+
+// rpcMessage is a request or reply with its correlation, whichever protocol version carried it
+type rpcMessage struct {
+	topic         string
+	payload       []byte
+	replyTo       string
+	correlationID string
+	err           string
+}
+
+type rpcReply struct {
+	payload []byte
+	err     error
+}
+
+// Requester sends requests and matches the replies to them. Any number of requests may be
+// outstanding at once; they share a single reply topic subscription. Over MQTT 5 the correlation
+// is left to paho.golang's rpc extension.
+type Requester struct {
+	c          MqttClient
+	rpc        *rpc.Handler
+	replyTopic string
+	qos        int
+	timeout    time.Duration
+
+	mu      sync.Mutex
+	pending map[string]chan rpcReply
+	closed  bool
+	done    chan struct{}
+}
+
+// NewRequester subscribes to a reply topic and returns a Requester that uses it
+func (u *UserClient) NewRequester(opts RequesterOptions) (*Requester, error) {
+	return newRequester(u.MQTTClient, opts)
+}
+
+// NewRequester subscribes to a reply topic and returns a Requester that uses it
+func (d *DeviceClient) NewRequester(opts RequesterOptions) (*Requester, error) {
+	return newRequester(d.MQTTClient, opts)
+}
+
+// NewRequester subscribes to a reply topic and returns a Requester that uses it
+func (d *DevClient) NewRequester(opts RequesterOptions) (*Requester, error) {
+	return newRequester(d.MQTTClient, opts)
+}
+
+// HandleRequests subscribes to topic and publishes the handler's answer to each request's reply topic.
+// Unsubscribe from topic to stop handling requests.
+func (u *UserClient) HandleRequests(topic string, qos int, handler RequestHandler) error {
+	return handleRequests(u.MQTTClient, topic, qos, handler, HandlerOptions{})
+}
+
+// HandleRequests subscribes to topic and publishes the handler's answer to each request's reply topic.
+// Unsubscribe from topic to stop handling requests.
+func (d *DeviceClient) HandleRequests(topic string, qos int, handler RequestHandler) error {
+	return handleRequests(d.MQTTClient, topic, qos, handler, HandlerOptions{})
+}
+
+// HandleRequests subscribes to topic and publishes the handler's answer to each request's reply topic.
+// Unsubscribe from topic to stop handling requests.
+func (d *DevClient) HandleRequests(topic string, qos int, handler RequestHandler) error {
+	return handleRequests(d.MQTTClient, topic, qos, handler, HandlerOptions{})
+}
+
+// HandleRequestsWithOptions is HandleRequests with a limit on the requests handled at once and
+// a callback for the replies that could not be sent
+func (u *UserClient) HandleRequestsWithOptions(topic string, qos int, handler RequestHandler, opts HandlerOptions) error {
+	return handleRequests(u.MQTTClient, topic, qos, handler, opts)
+}
+
+// HandleRequestsWithOptions is HandleRequests with a limit on the requests handled at once and
+// a callback for the replies that could not be sent
+func (d *DeviceClient) HandleRequestsWithOptions(topic string, qos int, handler RequestHandler, opts HandlerOptions) error {
+	return handleRequests(d.MQTTClient, topic, qos, handler, opts)
+}
+
+// HandleRequestsWithOptions is HandleRequests with a limit on the requests handled at once and
+// a callback for the replies that could not be sent
+func (d *DevClient) HandleRequestsWithOptions(topic string, qos int, handler RequestHandler, opts HandlerOptions) error {
+	return handleRequests(d.MQTTClient, topic, qos, handler, opts)
+}
+
+func newRequester(c MqttClient, opts RequesterOptions) (*Requester, error) {
+	if c == nil {
+		return nil, errors.New("MQTTClient is uninitialized")
+	}
+	if opts.ReplyTopic == "" {
+		opts.ReplyTopic = _RPC_REPLY_TOPIC_PREFIX + newClientID()
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = _RPC_DEFAULT_TIMEOUT
+	}
+	r := &Requester{
+		c:          c,
+		replyTopic: opts.ReplyTopic,
+		qos:        opts.Qos,
+		timeout:    opts.Timeout,
+		pending:    map[string]chan rpcReply{},
+		done:       make(chan struct{}),
+	}
+	if v5, err := asMqttV5(c); err == nil {
+		if err := r.startV5(v5); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	replies, err := subscribeRPC(c, false, r.replyTopic, r.qos)
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to reply topic %s: %w", r.replyTopic, err)
+	}
+	go r.dispatch(replies)
+	return r, nil
+}
+
+// startV5 has the rpc extension correlate the replies. They arrive on a subscription of the
+// client, which restores it after reconnects, and are handed to the extension's handler.
+func (r *Requester) startV5(v5 *mqttV5Client) error {
+	replies, err := subscribeWithProperties(r.c, r.replyTopic, r.qos)
+	if err != nil {
+		return fmt.Errorf("could not subscribe to reply topic %s: %w", r.replyTopic, err)
+	}
+	router := &rpcRouter{}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	r.rpc, err = rpc.NewHandler(ctx, rpc.HandlerOpts{Conn: v5.connection(), Router: router, ResponseTopicFmt: "%s", ClientID: r.replyTopic})
+	if err != nil {
+		unsubscribe(r.c, r.replyTopic)
+		return fmt.Errorf("could not subscribe to reply topic %s: %w", r.replyTopic, err)
+	}
+	go func() {
+		for m := range replies {
+			// the extension blocks on a reply whose request gave up, which must not hold up the rest
+			go router.handler(&paho.Publish{Topic: m.Topic, Payload: m.Payload, Properties: pahoPublishProperties(&m.Properties)})
+		}
+	}()
+	return nil
+}
+
+// ReplyTopic returns the topic the Requester receives replies on
+func (r *Requester) ReplyTopic() string {
+	return r.replyTopic
+}
+
+// Request publishes payload to topic and waits for the matching reply, until ctx is done or,
+// when ctx has no deadline, until the Requester's timeout passes.
+func (r *Requester) Request(ctx context.Context, topic string, payload []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	if r.rpc != nil {
+		return r.requestV5(ctx, topic, payload)
+	}
+	id := newClientID()
+	wait := make(chan rpcReply, 1)
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRequesterClosed
+	}
+	r.pending[id] = wait
+	r.mu.Unlock()
+	defer r.forget(id)
+
+	msg := rpcMessage{topic: topic, payload: payload, replyTo: r.replyTopic, correlationID: id}
+	if err := publishRPC(r.c, false, msg, r.qos); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-wait:
+		return reply.payload, reply.err
+	case <-r.done:
+		return nil, ErrRequesterClosed
+	case <-ctx.Done():
+		return nil, fmt.Errorf("request to %s: %w", topic, ctx.Err())
+	}
+}
+
+func (r *Requester) requestV5(ctx context.Context, topic string, payload []byte) ([]byte, error) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return nil, ErrRequesterClosed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	resp, err := r.rpc.Request(ctx, &paho.Publish{Topic: topic, QoS: byte(r.qos), Payload: payload})
+	if err != nil {
+		select {
+		case <-r.done:
+			return nil, ErrRequesterClosed
+		default:
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("request to %s: %w", topic, ctx.Err())
+		}
+		return nil, err
+	}
+	if resp.Properties != nil {
+		if msg := resp.Properties.User.Get(_RPC_ERROR_PROPERTY); msg != "" {
+			return nil, &RPCError{Message: msg}
+		}
+	}
+	return resp.Payload, nil
+}
+
+// Close unsubscribes from the reply topic. Outstanding requests fail with ErrRequesterClosed.
+func (r *Requester) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRequesterClosed
+	}
+	r.closed = true
+	close(r.done)
+	r.mu.Unlock()
+	return unsubscribe(r.c, r.replyTopic)
+}
+
+func (r *Requester) forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, id)
+}
+
+func (r *Requester) dispatch(replies <-chan rpcMessage) {
+	for reply := range replies {
+		r.mu.Lock()
+		wait, ok := r.pending[reply.correlationID]
+		delete(r.pending, reply.correlationID)
+		r.mu.Unlock()
+		if !ok {
+			// late reply to a request that already timed out
+			continue
+		}
+		var err error
+		if reply.err != "" {
+			err = &RPCError{Message: reply.err}
+		}
+		wait <- rpcReply{payload: reply.payload, err: err}
+	}
+}
+
+// rpcRouter takes the response handler of the rpc extension, which the Requester calls itself
+type rpcRouter struct {
+	handler paho.MessageHandler
+}
+
+func (r *rpcRouter) RegisterHandler(_ string, h paho.MessageHandler) { r.handler = h }
+func (r *rpcRouter) UnregisterHandler(string)                        {}
+func (r *rpcRouter) Route(*packets.Publish)                          {}
+func (r *rpcRouter) SetDebugLogger(log.Logger)                       {}
+
+func handleRequests(c MqttClient, topic string, qos int, handler RequestHandler, opts HandlerOptions) error {
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = _RPC_DEFAULT_WORKERS
+	}
+	_, err := asMqttV5(c)
+	v5 := err == nil
+	requests, err := subscribeRPC(c, v5, topic, qos)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			for req := range requests {
+				if req.replyTo == "" || req.correlationID == "" {
+					continue
+				}
+				payload, err := handler(req.topic, req.payload)
+				reply := rpcMessage{topic: req.replyTo, payload: payload, correlationID: req.correlationID}
+				if err != nil {
+					reply.payload = nil
+					reply.err = err.Error()
+				}
+				if err := publishRPC(c, v5, reply, qos); err != nil && opts.OnError != nil {
+					opts.OnError(fmt.Errorf("could not reply to %s: %w", req.replyTo, err))
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// subscribeRPC subscribes to topic and decodes the correlation of every message it receives.
+// Messages without one are passed on with an empty correlationID.
+func subscribeRPC(c MqttClient, v5 bool, topic string, qos int) (<-chan rpcMessage, error) {
+	out := make(chan rpcMessage)
+	if v5 {
+		msgs, err := subscribeWithProperties(c, topic, qos)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			defer close(out)
+			for msg := range msgs {
+				rm := rpcMessage{
+					topic:         msg.Topic,
+					payload:       msg.Payload,
+					replyTo:       msg.Properties.ResponseTopic,
+					correlationID: string(msg.Properties.CorrelationData),
+				}
+				for _, prop := range msg.Properties.UserProperties {
+					if prop.Key == _RPC_ERROR_PROPERTY {
+						rm.err = prop.Value
+					}
+				}
+				out <- rm
+			}
+		}()
+		return out, nil
+	}
+	msgs, err := subscribeWithOptions(c, topic, qos, SubscribeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			out <- decodeRPCEnvelope(msg)
+		}
+	}()
+	return out, nil
+}
+
+func decodeRPCEnvelope(msg *mqttTypes.Publish) rpcMessage {
+	rm := rpcMessage{topic: msg.Topic.Whole, payload: msg.Payload}
+	var env rpcEnvelope
+	if err := json.Unmarshal(msg.Payload, &env); err != nil {
+		return rm
+	}
+	rm.payload = env.Payload
+	rm.replyTo = env.ReplyTo
+	rm.correlationID = env.CorrelationID
+	rm.err = env.Error
+	return rm
+}
+
+func publishRPC(c MqttClient, v5 bool, msg rpcMessage, qos int) error {
+	if v5 {
+		props := &PublishProperties{ResponseTopic: msg.replyTo, CorrelationData: []byte(msg.correlationID)}
+		if msg.err != "" {
+			props.UserProperties = []UserProperty{{Key: _RPC_ERROR_PROPERTY, Value: msg.err}}
+		}
+		return publishWithProperties(c, msg.topic, msg.payload, qos, false, props)
+	}
+	b, err := json.Marshal(rpcEnvelope{
+		CorrelationID: msg.correlationID,
+		ReplyTo:       msg.replyTo,
+		Payload:       msg.payload,
+		Error:         msg.err,
+	})
+	if err != nil {
+		return err
+	}
+	return publish(c, msg.topic, b, qos, 0, false)
+}
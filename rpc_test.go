@@ -0,0 +1,256 @@
+package GoSDK
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequesterCorrelatesReplies(t *testing.T) {
+	b := NewMemoryBroker()
+	responder := newMemoryClient(t, b, "responder")
+	// every request is outstanding before the first reply is sent
+	release := make(chan struct{})
+	var arrived int32
+	err := handleRequests(responder, "calc/double", QOS_AtLeastOnce, func(topic string, payload []byte) ([]byte, error) {
+		atomic.AddInt32(&arrived, 1)
+		<-release
+		return append(payload, payload...), nil
+	}, HandlerOptions{Workers: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRequester(newMemoryClient(t, b, "requester"), RequesterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			want := strings.Repeat(fmt.Sprint(i), 2)
+			got, err := r.Request(context.Background(), "calc/double", []byte(fmt.Sprint(i)))
+			if err == nil && string(got) != want {
+				err = fmt.Errorf("request %d got %q", i, got)
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	waitFor(t, "every request to arrive", func() bool { return atomic.LoadInt32(&arrived) == 10 })
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestRequestTimesOut(t *testing.T) {
+	b := NewMemoryBroker()
+	r, err := newRequester(newMemoryClient(t, b, "requester"), RequesterOptions{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Request(context.Background(), "nobody/home", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request without a responder gave %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Request(ctx, "nobody/home", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled request gave %v", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) != 0 {
+		t.Fatalf("%d requests still pending", len(r.pending))
+	}
+}
+
+func TestRequesterClose(t *testing.T) {
+	b := NewMemoryBroker()
+	c := newMemoryClient(t, b, "requester")
+	r, err := newRequester(c, RequesterOptions{ReplyTopic: "replies/me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := make(chan error, 1)
+	go func() {
+		_, err := r.Request(context.Background(), "nobody/home", nil)
+		failed <- err
+	}()
+	waitFor(t, "the request to be sent", func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.pending) == 1
+	})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-failed; !errors.Is(err, ErrRequesterClosed) {
+		t.Fatalf("outstanding request gave %v", err)
+	}
+	if _, err := r.Request(context.Background(), "nobody/home", nil); !errors.Is(err, ErrRequesterClosed) {
+		t.Fatalf("request after Close gave %v", err)
+	}
+	if err := r.Close(); !errors.Is(err, ErrRequesterClosed) {
+		t.Fatalf("second Close gave %v", err)
+	}
+	if subs := b.Subscriptions("requester"); len(subs) != 0 {
+		t.Fatalf("still subscribed to %v", subs)
+	}
+}
+
+func TestRequestEnvelopeOverMQTT3(t *testing.T) {
+	b := NewMemoryBroker()
+	watcher := newMemoryClient(t, b, "watcher")
+	requests, err := subscribe(watcher, "jobs/run", QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = handleRequests(newMemoryClient(t, b, "responder"), "jobs/run", QOS_AtLeastOnce, func(topic string, payload []byte) ([]byte, error) {
+		return nil, errors.New("no such job")
+	}, HandlerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRequester(newMemoryClient(t, b, "requester"), RequesterOptions{ReplyTopic: "replies/me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var rpcErr *RPCError
+	if _, err := r.Request(context.Background(), "jobs/run", []byte("job-1")); !errors.As(err, &rpcErr) || rpcErr.Message != "no such job" {
+		t.Fatalf("failed request gave %v", err)
+	}
+	var env rpcEnvelope
+	msg := <-requests
+	if err := json.Unmarshal(msg.Payload, &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.ReplyTo != "replies/me" || env.CorrelationID == "" || string(env.Payload) != "job-1" || env.Error != "" {
+		t.Fatalf("request envelope %+v", env)
+	}
+}
+
+func TestHandleRequestsBoundsConcurrency(t *testing.T) {
+	b := NewMemoryBroker()
+	var running, most int32
+	err := handleRequests(newMemoryClient(t, b, "responder"), "slow", QOS_AtLeastOnce, func(topic string, payload []byte) ([]byte, error) {
+		n := atomic.AddInt32(&running, 1)
+		for m := atomic.LoadInt32(&most); n > m && !atomic.CompareAndSwapInt32(&most, m, n); m = atomic.LoadInt32(&most) {
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return payload, nil
+	}, HandlerOptions{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRequester(newMemoryClient(t, b, "requester"), RequesterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Request(context.Background(), "slow", nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if m := atomic.LoadInt32(&most); m != 2 {
+		t.Fatalf("%d requests handled at once", m)
+	}
+}
+
+func TestHandleRequestsReportsReplyFailures(t *testing.T) {
+	b := NewMemoryBroker()
+	responder, err := b.NewClient("responder", MemoryClientOptions{NoAutoReconnect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := make(chan error, 1)
+	err = handleRequests(responder, "flaky", QOS_AtLeastOnce, func(topic string, payload []byte) ([]byte, error) {
+		// the reply has no connection to go out on
+		b.DropConnection("responder")
+		return payload, nil
+	}, HandlerOptions{OnError: func(err error) { failures <- err }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRequester(newMemoryClient(t, b, "requester"), RequesterOptions{ReplyTopic: "replies/me", Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Request(context.Background(), "flaky", nil)
+	select {
+	case err := <-failures:
+		if !strings.Contains(err.Error(), "replies/me") {
+			t.Fatalf("failure %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reply failure not reported")
+	}
+}
+
+func TestRequesterOverMQTTv5(t *testing.T) {
+	b := newV5Broker(t).start()
+	responder := newV5TestClient(t, b, "responder", MQTTv5Options{})
+	err := handleRequests(responder, "calc/upper", QOS_AtLeastOnce, func(topic string, payload []byte) ([]byte, error) {
+		if len(payload) == 0 {
+			return nil, errors.New("nothing to do")
+		}
+		return []byte(strings.ToUpper(string(payload))), nil
+	}, HandlerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRequester(newV5TestClient(t, b, "requester", MQTTv5Options{}), RequesterOptions{ReplyTopic: "replies/me", Qos: QOS_AtLeastOnce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	got, err := r.Request(context.Background(), "calc/upper", []byte("abc"))
+	if err != nil || string(got) != "ABC" {
+		t.Fatalf("request gave %q, %v", got, err)
+	}
+	var rpcErr *RPCError
+	if _, err := r.Request(context.Background(), "calc/upper", nil); !errors.As(err, &rpcErr) || rpcErr.Message != "nothing to do" {
+		t.Fatalf("failed request gave %v", err)
+	}
+	// the correlation travels in properties, the payload is the caller's
+	var requests []v5Published
+	for _, p := range b.publishes() {
+		if p.topic == "calc/upper" {
+			requests = append(requests, p)
+		}
+	}
+	if len(requests) != 2 || string(requests[0].payload) != "abc" {
+		t.Fatalf("requests %+v", requests)
+	}
+	for _, p := range requests {
+		if p.properties.ResponseTopic != "replies/me" || len(p.properties.CorrelationData) == 0 {
+			t.Fatalf("request properties %+v", p.properties)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+)
+
+// newTestDevClient returns a developer client whose platform calls go to handler
+func newTestDevClient(t *testing.T, handler http.Handler) *DevClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewDevClientWithTokenAndAddrs(srv.URL, "", "test-dev-token", "dev@example.com")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	waitForWithin(t, 5*time.Second, what, cond)
+}
+
+// waitForWithin is waitFor for conditions that take longer, such as a paho reconnect backoff
+func waitForWithin(t *testing.T, limit time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(limit)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectPublish waits for the next message on msgs and checks its payload
+func expectPublish(t *testing.T, msgs <-chan *mqttTypes.Publish, payload string) *mqttTypes.Publish {
+	t.Helper()
+	select {
+	case msg, ok := <-msgs:
+		if !ok {
+			t.Fatal("subscription channel closed")
+		}
+		if string(msg.Payload) != payload {
+			t.Fatalf("received %q, want %q", msg.Payload, payload)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %q", payload)
+	}
+	return nil
+}
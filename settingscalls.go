@@ -80,7 +80,7 @@ func deleteGoogleStorageSettings(c cbClient, endpoint string) error {
 	if err != nil {
 		return err
 	}
-	_, err = delete(c, endpoint, nil, creds, nil)
+	_, err = del(c, endpoint, nil, creds, nil)
 	return err
 }
 
@@ -212,7 +212,7 @@ func (d *DevClient) DeleteMTLSSystemCertificate(systemKey, name string) error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _SETTINGS_PREAMBLE+"mtls/"+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _SETTINGS_PREAMBLE+"mtls/"+systemKey+"/"+name, nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
@@ -238,7 +238,7 @@ func (d *DevClient) DeleteMTLSSettings() error {
 	if err != nil {
 		return err
 	}
-	resp, err := delete(d, _SETTINGS_PREAMBLE+"mtls", nil, creds, nil)
+	resp, err := del(d, _SETTINGS_PREAMBLE+"mtls", nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
@@ -254,7 +254,7 @@ func (d *DevClient) DeleteRevokedCertificate(certificateHash string) error {
 	payload := map[string]string{
 		"certificate_hash": certificateHash,
 	}
-	resp, err := delete(d, "/admin/revoked_certs", payload, creds, nil)
+	resp, err := del(d, "/admin/revoked_certs", payload, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
@@ -325,7 +325,7 @@ func (d *DevClient) DeleteRevokedCertificates(query *Query) error {
 	} else {
 		qry = nil
 	}
-	resp, err := delete(d, "/admin/revoked_certs", qry, creds, nil)
+	resp, err := del(d, "/admin/revoked_certs", qry, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return err
@@ -0,0 +1,543 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	_SHADOW_DEFAULT_COLUMN         = "shadow"
+	_SHADOW_DEFAULT_VERSION_COLUMN = "shadow_version"
+	_SHADOW_DEFAULT_TOPIC_PREFIX   = "shadow"
+	_SHADOW_DEFAULT_RETRIES        = 5
+)
+
+// AnyShadowVersion skips the version check of an update. Conflicting writes are retried on the
+// latest version instead.
+const AnyShadowVersion int64 = -1
+
+var ErrShadowConflict = errors.New("shadow version conflict")
+
+// ShadowConflictError is returned when a shadow changed since the version an update expected.
+// errors.Is(err, ErrShadowConflict) holds for it.
+type ShadowConflictError struct {
+	Device   string
+	Expected int64
+	Actual   int64
+}
+
+func (e *ShadowConflictError) Error() string {
+	return fmt.Sprintf("shadow of %s is at version %d, expected %d", e.Device, e.Actual, e.Expected)
+}
+
+func (e *ShadowConflictError) Is(target error) bool { return target == ErrShadowConflict }
+
+// Shadow is the desired and reported state of a device. Version goes up by one with every update.
+type Shadow struct {
+	Device    string                 `json:"device"`
+	Version   int64                  `json:"version"`
+	Desired   map[string]interface{} `json:"desired"`
+	Reported  map[string]interface{} `json:"reported"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// Delta returns the desired values the device has not reported yet
+func (s *Shadow) Delta() map[string]interface{} {
+	return ShadowDelta(s.Desired, s.Reported)
+}
+
+// ShadowDelta returns the entries of desired that are missing from reported or differ from it.
+// Nested objects are compared key by key.
+func ShadowDelta(desired, reported map[string]interface{}) map[string]interface{} {
+	delta := map[string]interface{}{}
+	for k, want := range desired {
+		have, ok := reported[k]
+		wantMap, wantIsMap := want.(map[string]interface{})
+		haveMap, haveIsMap := have.(map[string]interface{})
+		if wantIsMap && haveIsMap {
+			if sub := ShadowDelta(wantMap, haveMap); len(sub) > 0 {
+				delta[k] = sub
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(want, have) {
+			delta[k] = want
+		}
+	}
+	return delta
+}
+
+// mergeShadowState applies patch to state as a JSON merge patch: nested objects are merged and
+// null values remove keys. state is left untouched.
+func mergeShadowState(state, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(state))
+	for k, v := range state {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(merged, k)
+		case map[string]interface{}:
+			current, _ := merged[k].(map[string]interface{})
+			merged[k] = mergeShadowState(current, pv)
+		default:
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// normalizeShadowState round trips state through JSON so values compare the way they will
+// after being stored, e.g. every number becomes a float64
+func normalizeShadowState(state map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ShadowStore persists shadows
+type ShadowStore interface {
+	// LoadShadow returns the device's shadow, at version 0 if it was never written
+	LoadShadow(device string) (*Shadow, error)
+	// SaveShadow stores s if the stored shadow is still at version expected and returns a
+	// *ShadowConflictError otherwise
+	SaveShadow(s *Shadow, expected int64) error
+}
+
+// ShadowOptions configures a ShadowService. Zero values pick the defaults.
+type ShadowOptions struct {
+	// SystemKey defaults to the client's system key. Developers must set it.
+	SystemKey string
+	// Column is the string device column holding the shadow document, "shadow" by default
+	Column string
+	// VersionColumn is the int device column holding the shadow version, "shadow_version" by default
+	VersionColumn string
+	// Store replaces the device column store
+	Store ShadowStore
+	// TopicPrefix starts the notification topics {prefix}/{device}/update and {prefix}/{device}/delta,
+	// "shadow" by default
+	TopicPrefix string
+	Qos         int
+	// Retries bounds how often an AnyShadowVersion update is retried after a conflict
+	Retries int
+}
+
+// ShadowDeltaMessage is published on the delta topic when the desired state differs from the
+// reported state after an update
+type ShadowDeltaMessage struct {
+	Device  string                 `json:"device"`
+	Version int64                  `json:"version"`
+	State   map[string]interface{} `json:"state"`
+}
+
+// ShadowService reads and updates device shadows. Every update is published in full on the
+// device's update topic, and its delta on the delta topic when there is one.
+type ShadowService struct {
+	mqtt  func() MqttClient
+	store ShadowStore
+	opts  ShadowOptions
+}
+
+// NewShadowService returns a service keeping shadows in device columns
+func (u *UserClient) NewShadowService(opts ShadowOptions) (*ShadowService, error) {
+	if opts.SystemKey == "" {
+		opts.SystemKey = u.SystemKey
+	}
+	return newShadowService(u, _DEVICES_USER_PREAMBLE, func() MqttClient { return u.MQTTClient }, opts)
+}
+
+// NewShadowService returns a service keeping shadows in device columns
+func (d *DeviceClient) NewShadowService(opts ShadowOptions) (*ShadowService, error) {
+	if opts.SystemKey == "" {
+		opts.SystemKey = d.SystemKey
+	}
+	return newShadowService(d, _DEVICES_USER_PREAMBLE, func() MqttClient { return d.MQTTClient }, opts)
+}
+
+// NewShadowService returns a service keeping shadows in device columns
+func (d *DevClient) NewShadowService(opts ShadowOptions) (*ShadowService, error) {
+	return newShadowService(d, _DEVICES_DEV_PREAMBLE, func() MqttClient { return d.MQTTClient }, opts)
+}
+
+func newShadowService(client cbClient, preamble string, mqtt func() MqttClient, opts ShadowOptions) (*ShadowService, error) {
+	if opts.Column == "" {
+		opts.Column = _SHADOW_DEFAULT_COLUMN
+	}
+	if opts.VersionColumn == "" {
+		opts.VersionColumn = _SHADOW_DEFAULT_VERSION_COLUMN
+	}
+	if opts.TopicPrefix == "" {
+		opts.TopicPrefix = _SHADOW_DEFAULT_TOPIC_PREFIX
+	}
+	if opts.Retries <= 0 {
+		opts.Retries = _SHADOW_DEFAULT_RETRIES
+	}
+	store := opts.Store
+	if store == nil {
+		if opts.SystemKey == "" {
+			return nil, errors.New("a system key is required to store shadows in device columns")
+		}
+		store = &deviceColumnShadowStore{
+			client:        client,
+			preamble:      preamble,
+			systemKey:     opts.SystemKey,
+			column:        opts.Column,
+			versionColumn: opts.VersionColumn,
+		}
+	}
+	return &ShadowService{mqtt: mqtt, store: store, opts: opts}, nil
+}
+
+// CreateShadowColumns adds the device columns the default shadow store needs and starts every
+// existing device at shadow version 0
+func (d *DevClient) CreateShadowColumns(systemKey string, opts ShadowOptions) error {
+	if opts.Column == "" {
+		opts.Column = _SHADOW_DEFAULT_COLUMN
+	}
+	if opts.VersionColumn == "" {
+		opts.VersionColumn = _SHADOW_DEFAULT_VERSION_COLUMN
+	}
+	if err := d.CreateDeviceColumn(systemKey, opts.Column, "string"); err != nil {
+		return err
+	}
+	if err := d.CreateDeviceColumn(systemKey, opts.VersionColumn, "int"); err != nil {
+		return err
+	}
+	_, err := updateDevices(d, systemKey, _DEVICES_DEV_PREAMBLE, NewQuery(), map[string]interface{}{opts.VersionColumn: 0})
+	return err
+}
+
+// UpdateTopic is where every update of the device's shadow is published
+func (s *ShadowService) UpdateTopic(device string) string {
+	return s.opts.TopicPrefix + "/" + device + "/update"
+}
+
+// DeltaTopic is where the device's delta is published after an update leaves one
+func (s *ShadowService) DeltaTopic(device string) string {
+	return s.opts.TopicPrefix + "/" + device + "/delta"
+}
+
+// Get returns the device's shadow
+func (s *ShadowService) Get(device string) (*Shadow, error) {
+	return s.store.LoadShadow(device)
+}
+
+// UpdateDesired merges patch into the desired state. Null values remove keys. expected is the
+// version the update applies to, or AnyShadowVersion.
+func (s *ShadowService) UpdateDesired(device string, patch map[string]interface{}, expected int64) (*Shadow, error) {
+	return s.update(device, expected, patch, nil)
+}
+
+// UpdateReported merges patch into the reported state. Null values remove keys. expected is the
+// version the update applies to, or AnyShadowVersion.
+func (s *ShadowService) UpdateReported(device string, patch map[string]interface{}, expected int64) (*Shadow, error) {
+	return s.update(device, expected, nil, patch)
+}
+
+// update saves the patched shadow and then notifies. A failed notification is returned along with
+// the saved shadow.
+func (s *ShadowService) update(device string, expected int64, desired, reported map[string]interface{}) (*Shadow, error) {
+	var err error
+	if desired, err = normalizeShadowState(desired); err != nil {
+		return nil, fmt.Errorf("could not encode desired state of %s: %w", device, err)
+	}
+	if reported, err = normalizeShadowState(reported); err != nil {
+		return nil, fmt.Errorf("could not encode reported state of %s: %w", device, err)
+	}
+	var shadow *Shadow
+	for attempt := 0; ; attempt++ {
+		current, err := s.store.LoadShadow(device)
+		if err != nil {
+			return nil, err
+		}
+		if expected != AnyShadowVersion && current.Version != expected {
+			return nil, &ShadowConflictError{Device: device, Expected: expected, Actual: current.Version}
+		}
+		shadow = &Shadow{
+			Device:    device,
+			Version:   current.Version + 1,
+			Desired:   mergeShadowState(current.Desired, desired),
+			Reported:  mergeShadowState(current.Reported, reported),
+			UpdatedAt: time.Now().UTC(),
+		}
+		err = s.store.SaveShadow(shadow, current.Version)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrShadowConflict) || expected != AnyShadowVersion || attempt >= s.opts.Retries {
+			return nil, err
+		}
+	}
+	return shadow, s.notify(shadow)
+}
+
+func (s *ShadowService) notify(shadow *Shadow) error {
+	c := s.mqtt()
+	if c == nil {
+		return nil
+	}
+	doc, err := json.Marshal(shadow)
+	if err != nil {
+		return err
+	}
+	if err := publish(c, s.UpdateTopic(shadow.Device), doc, s.opts.Qos, 0, false); err != nil {
+		return fmt.Errorf("shadow of %s was saved at version %d but not published: %w", shadow.Device, shadow.Version, err)
+	}
+	delta := shadow.Delta()
+	if len(delta) == 0 {
+		return nil
+	}
+	msg, err := json.Marshal(&ShadowDeltaMessage{Device: shadow.Device, Version: shadow.Version, State: delta})
+	if err != nil {
+		return err
+	}
+	if err := publish(c, s.DeltaTopic(shadow.Device), msg, s.opts.Qos, 0, false); err != nil {
+		return fmt.Errorf("delta of %s at version %d was not published: %w", shadow.Device, shadow.Version, err)
+	}
+	return nil
+}
+
+// deviceColumnShadowStore keeps the shadow document in one device column and its version in another.
+// Saves only update the device row if the version column still holds the expected version.
+type deviceColumnShadowStore struct {
+	client        cbClient
+	preamble      string
+	systemKey     string
+	column        string
+	versionColumn string
+}
+
+func (st *deviceColumnShadowStore) LoadShadow(device string) (*Shadow, error) {
+	row, err := st.device(device)
+	if err != nil {
+		return nil, err
+	}
+	shadow := &Shadow{Device: device, Desired: map[string]interface{}{}, Reported: map[string]interface{}{}}
+	if raw, ok := row[st.column].(string); ok && raw != "" {
+		if err := json.Unmarshal([]byte(raw), shadow); err != nil {
+			return nil, fmt.Errorf("shadow of %s in column %s: %w", device, st.column, err)
+		}
+		shadow.Device = device
+	}
+	shadow.Version = 0
+	if v, ok := row[st.versionColumn]; ok && v != nil {
+		version, err := iWantAnInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("shadow version of %s in column %s: %w", device, st.versionColumn, err)
+		}
+		shadow.Version = int64(version)
+	}
+	return shadow, nil
+}
+
+func (st *deviceColumnShadowStore) device(name string) (map[string]interface{}, error) {
+	q := NewQuery()
+	q.EqualTo("name", name)
+	rows, err := getDevices(st.client, st.systemKey, st.preamble, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("device %s not found", name)
+	}
+	row, ok := rows[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("device %s: unexpected %T", name, rows[0])
+	}
+	return row, nil
+}
+
+func (st *deviceColumnShadowStore) SaveShadow(s *Shadow, expected int64) error {
+	doc, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	changes := map[string]interface{}{st.column: string(doc), st.versionColumn: s.Version}
+	q := NewQuery()
+	q.EqualTo("name", s.Device)
+	q.EqualTo(st.versionColumn, expected)
+	updated, err := updateDevices(st.client, st.systemKey, st.preamble, q, changes)
+	if err != nil {
+		return err
+	}
+	if len(updated) > 0 {
+		return nil
+	}
+	if expected != 0 {
+		return st.conflict(s.Device, expected)
+	}
+	row, err := st.device(s.Device)
+	if err != nil {
+		return err
+	}
+	if row[st.versionColumn] != nil {
+		return st.conflict(s.Device, expected)
+	}
+	// a device added after CreateShadowColumns has no version yet, so the first write is made
+	// on the column still being empty
+	q = NewQuery()
+	q.EqualTo("name", s.Device)
+	q.EqualTo(st.versionColumn, nil)
+	updated, err = updateDevices(st.client, st.systemKey, st.preamble, q, changes)
+	if err != nil {
+		return err
+	}
+	if len(updated) > 0 {
+		return nil
+	}
+	if row, err = st.device(s.Device); err != nil {
+		return err
+	}
+	if row[st.versionColumn] != nil {
+		return st.conflict(s.Device, expected)
+	}
+	return fmt.Errorf("shadow version column %s of %s is empty and could not be matched; set it to 0", st.versionColumn, s.Device)
+}
+
+func (st *deviceColumnShadowStore) conflict(device string, expected int64) error {
+	current, err := st.LoadShadow(device)
+	if err != nil {
+		return err
+	}
+	return &ShadowConflictError{Device: device, Expected: expected, Actual: current.Version}
+}
+
+// ShadowAgentOptions configures a device's ShadowAgent
+type ShadowAgentOptions struct {
+	ShadowOptions
+	// Apply is called with the desired values the device has not reported yet. It returns the
+	// values to report, which is the delta itself when all of it was applied.
+	Apply func(delta map[string]interface{}) (map[string]interface{}, error)
+	// OnError receives failures of applying or reporting a delta that arrived over MQTT
+	OnError func(err error)
+}
+
+// ShadowAgent keeps a device in line with its shadow: it applies every delta and reports the result
+type ShadowAgent struct {
+	svc    *ShadowService
+	device string
+	opts   ShadowAgentOptions
+
+	mu sync.Mutex
+	// version is the latest version the agent has handled, so deltas it caused are not applied twice
+	version int64
+	started bool
+}
+
+// NewShadowAgent returns an agent for this device's shadow. Start it once MQTT is initialized.
+func (d *DeviceClient) NewShadowAgent(opts ShadowAgentOptions) (*ShadowAgent, error) {
+	if opts.Apply == nil {
+		return nil, errors.New("a shadow agent needs an Apply function")
+	}
+	svc, err := d.NewShadowService(opts.ShadowOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &ShadowAgent{svc: svc, device: d.DeviceName, opts: opts}, nil
+}
+
+// Start subscribes to the device's delta topic and applies the delta left from while it was offline
+func (a *ShadowAgent) Start() error {
+	c := a.svc.mqtt()
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	a.mu.Lock()
+	if a.started {
+		a.mu.Unlock()
+		return errors.New("shadow agent is already started")
+	}
+	a.started = true
+	a.mu.Unlock()
+	msgs, err := subscribe(c, a.svc.DeltaTopic(a.device), a.svc.opts.Qos)
+	if err != nil {
+		a.mu.Lock()
+		a.started = false
+		a.mu.Unlock()
+		return err
+	}
+	go func() {
+		for pub := range msgs {
+			var msg ShadowDeltaMessage
+			if err := json.Unmarshal(pub.Payload, &msg); err != nil {
+				a.fail(fmt.Errorf("could not decode shadow delta on %s: %w", pub.Topic.Whole, err))
+				continue
+			}
+			if err := a.apply(msg.Version, msg.State); err != nil {
+				a.fail(err)
+			}
+		}
+	}()
+	return a.Sync()
+}
+
+// Sync reads the shadow and applies its delta, if any
+func (a *ShadowAgent) Sync() error {
+	shadow, err := a.svc.Get(a.device)
+	if err != nil {
+		return err
+	}
+	return a.apply(shadow.Version, shadow.Delta())
+}
+
+// Report merges state into the reported state
+func (a *ShadowAgent) Report(state map[string]interface{}) (*Shadow, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reportLocked(state)
+}
+
+// Close unsubscribes from the delta topic
+func (a *ShadowAgent) Close() error {
+	a.mu.Lock()
+	started := a.started
+	a.started = false
+	a.mu.Unlock()
+	if !started {
+		return errors.New("shadow agent is not started")
+	}
+	return unsubscribe(a.svc.mqtt(), a.svc.DeltaTopic(a.device))
+}
+
+func (a *ShadowAgent) apply(version int64, delta map[string]interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if version <= a.version || len(delta) == 0 {
+		return nil
+	}
+	a.version = version
+	applied, err := a.opts.Apply(delta)
+	if err != nil {
+		return fmt.Errorf("could not apply shadow delta at version %d: %w", version, err)
+	}
+	if len(applied) == 0 {
+		return nil
+	}
+	_, err = a.reportLocked(applied)
+	return err
+}
+
+func (a *ShadowAgent) reportLocked(state map[string]interface{}) (*Shadow, error) {
+	shadow, err := a.svc.UpdateReported(a.device, state, AnyShadowVersion)
+	if shadow != nil && shadow.Version > a.version {
+		a.version = shadow.Version
+	}
+	return shadow, err
+}
+
+func (a *ShadowAgent) fail(err error) {
+	if a.opts.OnError != nil {
+		a.opts.OnError(err)
+	}
+}
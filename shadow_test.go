@@ -0,0 +1,352 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestShadowDelta(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		desired, reported map[string]interface{}
+		want              map[string]interface{}
+	}{
+		{name: "in sync", desired: map[string]interface{}{"on": true}, reported: map[string]interface{}{"on": true, "temp": 20.0}, want: map[string]interface{}{}},
+		{name: "differs", desired: map[string]interface{}{"on": true}, reported: map[string]interface{}{"on": false}, want: map[string]interface{}{"on": true}},
+		{name: "not reported", desired: map[string]interface{}{"on": true}, reported: nil, want: map[string]interface{}{"on": true}},
+		{
+			name:     "nested",
+			desired:  map[string]interface{}{"led": map[string]interface{}{"color": "red", "level": 3.0}},
+			reported: map[string]interface{}{"led": map[string]interface{}{"color": "red", "level": 1.0}},
+			want:     map[string]interface{}{"led": map[string]interface{}{"level": 3.0}},
+		},
+		{
+			name:     "object replacing a value",
+			desired:  map[string]interface{}{"led": map[string]interface{}{"color": "red"}},
+			reported: map[string]interface{}{"led": "off"},
+			want:     map[string]interface{}{"led": map[string]interface{}{"color": "red"}},
+		},
+		{name: "lists compare whole", desired: map[string]interface{}{"ch": []interface{}{1.0, 2.0}}, reported: map[string]interface{}{"ch": []interface{}{1.0}}, want: map[string]interface{}{"ch": []interface{}{1.0, 2.0}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ShadowDelta(tc.desired, tc.reported); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeShadowState(t *testing.T) {
+	state := map[string]interface{}{
+		"on":  true,
+		"led": map[string]interface{}{"color": "red", "level": 1.0},
+		"old": "x",
+	}
+	patch := map[string]interface{}{
+		"old": nil,
+		"led": map[string]interface{}{"level": 2.0, "color": nil},
+		"new": 1.0,
+	}
+	got := mergeShadowState(state, patch)
+	want := map[string]interface{}{
+		"on":  true,
+		"led": map[string]interface{}{"level": 2.0},
+		"new": 1.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged %v, want %v", got, want)
+	}
+	if _, ok := state["old"]; !ok || state["led"].(map[string]interface{})["color"] != "red" {
+		t.Fatalf("state was modified: %v", state)
+	}
+	if got := mergeShadowState(nil, map[string]interface{}{"gone": nil}); len(got) != 0 {
+		t.Fatalf("deleting from an empty state gave %v", got)
+	}
+}
+
+// fakeShadowStore keeps shadows in memory. conflicts makes that many saves fail as if another
+// writer got there first.
+type fakeShadowStore struct {
+	mu        sync.Mutex
+	shadows   map[string]*Shadow
+	conflicts int
+	saves     int
+}
+
+func (f *fakeShadowStore) LoadShadow(device string) (*Shadow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.shadows[device]
+	if !ok {
+		return &Shadow{Device: device, Desired: map[string]interface{}{}, Reported: map[string]interface{}{}}, nil
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (f *fakeShadowStore) SaveShadow(s *Shadow, expected int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saves++
+	current := int64(0)
+	if stored, ok := f.shadows[s.Device]; ok {
+		current = stored.Version
+	}
+	if f.conflicts > 0 {
+		f.conflicts--
+		// another writer moved the shadow on
+		f.shadows[s.Device] = &Shadow{Device: s.Device, Version: current + 1, Desired: map[string]interface{}{"other": true}}
+		return &ShadowConflictError{Device: s.Device, Expected: expected, Actual: current + 1}
+	}
+	if current != expected {
+		return &ShadowConflictError{Device: s.Device, Expected: expected, Actual: current}
+	}
+	copied := *s
+	f.shadows[s.Device] = &copied
+	return nil
+}
+
+func newFakeShadowService(t *testing.T, c MqttClient, store *fakeShadowStore) *ShadowService {
+	t.Helper()
+	svc, err := newShadowService(nil, "", func() MqttClient { return c }, ShadowOptions{Store: store, Retries: 2, Qos: QOS_AtLeastOnce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestShadowUpdateVersions(t *testing.T) {
+	store := &fakeShadowStore{shadows: map[string]*Shadow{}}
+	svc := newFakeShadowService(t, nil, store)
+
+	s, err := svc.UpdateDesired("dev", map[string]interface{}{"on": true}, 0)
+	if err != nil || s.Version != 1 {
+		t.Fatalf("first update gave %+v, %v", s, err)
+	}
+	var conflict *ShadowConflictError
+	if _, err := svc.UpdateDesired("dev", map[string]interface{}{"on": false}, 0); !errors.As(err, &conflict) || conflict.Actual != 1 || !errors.Is(err, ErrShadowConflict) {
+		t.Fatalf("stale update gave %v", err)
+	}
+
+	// conflicts of an AnyShadowVersion update are retried on the latest shadow
+	store.conflicts = 2
+	s, err = svc.UpdateReported("dev", map[string]interface{}{"on": true}, AnyShadowVersion)
+	if err != nil || s.Version != 4 || s.Desired["other"] != true || s.Reported["on"] != true {
+		t.Fatalf("retried update gave %+v, %v", s, err)
+	}
+
+	// but only as often as Retries allows
+	store.conflicts = 3
+	if _, err := svc.UpdateReported("dev", map[string]interface{}{"on": false}, AnyShadowVersion); !errors.Is(err, ErrShadowConflict) {
+		t.Fatalf("update past its retries gave %v", err)
+	}
+
+	// a versioned update is not retried
+	current, _ := store.LoadShadow("dev")
+	store.conflicts, store.saves = 1, 0
+	if _, err := svc.UpdateReported("dev", map[string]interface{}{"on": false}, current.Version); !errors.Is(err, ErrShadowConflict) || store.saves != 1 {
+		t.Fatalf("versioned update gave %v after %d saves", err, store.saves)
+	}
+}
+
+func TestShadowUpdatePublishes(t *testing.T) {
+	b := NewMemoryBroker()
+	watcher := newMemoryClient(t, b, "watcher")
+	store := &fakeShadowStore{shadows: map[string]*Shadow{}}
+	svc := newFakeShadowService(t, newMemoryClient(t, b, "svc"), store)
+	updates, err := subscribe(watcher, svc.UpdateTopic("dev"), QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltas, err := subscribe(watcher, svc.DeltaTopic("dev"), QOS_AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateDesired("dev", map[string]interface{}{"level": 3}, AnyShadowVersion); err != nil {
+		t.Fatal(err)
+	}
+	var shadow Shadow
+	if err := json.Unmarshal((<-updates).Payload, &shadow); err != nil || shadow.Version != 1 || shadow.Desired["level"] != 3.0 {
+		t.Fatalf("update %+v, %v", shadow, err)
+	}
+	var delta ShadowDeltaMessage
+	if err := json.Unmarshal((<-deltas).Payload, &delta); err != nil || delta.Version != 1 || !reflect.DeepEqual(delta.State, map[string]interface{}{"level": 3.0}) {
+		t.Fatalf("delta %+v, %v", delta, err)
+	}
+
+	// reporting the desired state leaves no delta to publish
+	if _, err := svc.UpdateReported("dev", map[string]interface{}{"level": 3}, AnyShadowVersion); err != nil {
+		t.Fatal(err)
+	}
+	<-updates
+	if _, err := svc.UpdateDesired("dev", map[string]interface{}{"level": nil}, AnyShadowVersion); err != nil {
+		t.Fatal(err)
+	}
+	<-updates
+	select {
+	case msg := <-deltas:
+		t.Fatalf("delta published for a shadow in sync: %s", msg.Payload)
+	default:
+	}
+}
+
+func TestShadowAgentSkipsHandledVersions(t *testing.T) {
+	b := NewMemoryBroker()
+	store := &fakeShadowStore{shadows: map[string]*Shadow{
+		"dev": {Device: "dev", Version: 4, Desired: map[string]interface{}{"on": true}, Reported: map[string]interface{}{}},
+	}}
+	d := NewDeviceClient("key", "secret", "dev", "active")
+	d.MQTTClient = newMemoryClient(t, b, "dev")
+	var mu sync.Mutex
+	var applied []map[string]interface{}
+	a, err := d.NewShadowAgent(ShadowAgentOptions{
+		ShadowOptions: ShadowOptions{Store: store, Qos: QOS_AtLeastOnce},
+		Apply: func(delta map[string]interface{}) (map[string]interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			applied = append(applied, delta)
+			return delta, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the delta left from while the device was offline is applied and reported on Start
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	s, _ := store.LoadShadow("dev")
+	if s.Version != 5 || s.Reported["on"] != true {
+		t.Fatalf("shadow after Start %+v", s)
+	}
+
+	// deltas at versions the agent has handled, including its own report, are ignored
+	svc := newFakeShadowService(t, newMemoryClient(t, b, "svc"), store)
+	old := newMemoryClient(t, b, "old")
+	for _, version := range []int64{3, 5} {
+		msg, _ := json.Marshal(&ShadowDeltaMessage{Device: "dev", Version: version, State: map[string]interface{}{"stale": true}})
+		if err := publish(old, svc.DeltaTopic("dev"), msg, QOS_AtLeastOnce, 0, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.UpdateDesired("dev", map[string]interface{}{"level": 2}, AnyShadowVersion); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the new delta to be applied", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(applied) == 2
+	})
+	s, _ = store.LoadShadow("dev")
+	if s.Version != 7 || s.Reported["level"] != 2.0 {
+		t.Fatalf("shadow after the delta %+v", s)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(applied, []map[string]interface{}{{"on": true}, {"level": 2.0}}) {
+		t.Fatalf("applied %v", applied)
+	}
+}
+
+// deviceRowServer serves one device row for the device column store, recording the version
+// filter of every update
+type deviceRowServer struct {
+	mu  sync.Mutex
+	row map[string]interface{}
+	// putFilters holds the shadow_version each update was made on, or "missing"
+	putFilters []interface{}
+	// onClaim runs before an update on an empty version is matched
+	onClaim func(row map[string]interface{})
+}
+
+func (s *deviceRowServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, []interface{}{s.copyRow()})
+		return
+	}
+	var body struct {
+		Query struct {
+			FILTERS [][]map[string][]map[string]interface{}
+		} `json:"query"`
+		Set map[string]interface{} `json:"$set"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var version interface{} = "missing"
+	for _, f := range body.Query.FILTERS[0] {
+		for _, eq := range f["EQ"] {
+			if v, ok := eq["shadow_version"]; ok {
+				version = v
+			}
+		}
+	}
+	s.putFilters = append(s.putFilters, version)
+	if version == nil && s.onClaim != nil {
+		s.onClaim(s.row)
+	}
+	matched := version != "missing" && reflect.DeepEqual(version, s.row["shadow_version"])
+	if !matched {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"DATA": []interface{}{}})
+		return
+	}
+	for k, v := range body.Set {
+		s.row[k] = v
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"DATA": []interface{}{s.copyRow()}})
+}
+
+func (s *deviceRowServer) copyRow() map[string]interface{} {
+	row := map[string]interface{}{}
+	for k, v := range s.row {
+		row[k] = v
+	}
+	return row
+}
+
+func TestDeviceColumnShadowStoreSavesConditionally(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		version interface{}
+		onClaim func(row map[string]interface{})
+		filters []interface{}
+		actual  int64
+	}{
+		{name: "version 0", version: 0.0, filters: []interface{}{0.0}},
+		{name: "empty version", version: nil, filters: []interface{}{0.0, nil}},
+		{name: "written since", version: 3.0, filters: []interface{}{0.0}, actual: 3},
+		{
+			name: "empty version claimed meanwhile", version: nil, filters: []interface{}{0.0, nil}, actual: 1,
+			onClaim: func(row map[string]interface{}) { row["shadow_version"] = 1.0 },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := &deviceRowServer{row: map[string]interface{}{"name": "dev", "shadow_version": tc.version}, onClaim: tc.onClaim}
+			svc, err := newTestDevClient(t, srv).NewShadowService(ShadowOptions{SystemKey: "sys"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the first save of a shadow, as an update that loaded version 0 makes it
+			err = svc.store.SaveShadow(&Shadow{Device: "dev", Version: 1, Desired: map[string]interface{}{"on": true}}, 0)
+			if tc.actual != 0 {
+				var conflict *ShadowConflictError
+				if !errors.As(err, &conflict) || conflict.Actual != tc.actual {
+					t.Fatalf("got %v, want a conflict at version %d", err, tc.actual)
+				}
+			} else if err != nil || srv.row["shadow_version"] != 1.0 {
+				t.Fatalf("save gave %v; row %v", err, srv.row)
+			}
+			if !reflect.DeepEqual(srv.putFilters, tc.filters) {
+				t.Fatalf("updates were made on versions %v, want %v", srv.putFilters, tc.filters)
+			}
+		})
+	}
+}
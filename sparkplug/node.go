@@ -0,0 +1,474 @@
+// Package sparkplug runs Sparkplug B edge node sessions on a ClearBlade MQTT client
+package sparkplug
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cb "github.com/clearblade/Go-SDK"
+)
+
+const (
+	// Namespace is the first topic level of every Sparkplug B message
+	Namespace = "spBv1.0"
+	// RebirthMetric is the NCMD metric asking an edge node to publish its births again
+	RebirthMetric = "Node Control/Rebirth"
+	// BdSeqMetric carries the birth/death sequence number in NBIRTH and NDEATH
+	BdSeqMetric = "bdSeq"
+)
+
+// MessageType is the message type level of a Sparkplug B topic
+type MessageType string
+
+const (
+	NBIRTH MessageType = "NBIRTH"
+	NDEATH MessageType = "NDEATH"
+	DBIRTH MessageType = "DBIRTH"
+	DDEATH MessageType = "DDEATH"
+	NDATA  MessageType = "NDATA"
+	DDATA  MessageType = "DDATA"
+	NCMD   MessageType = "NCMD"
+	DCMD   MessageType = "DCMD"
+)
+
+func (t MessageType) isDevice() bool {
+	return t == DBIRTH || t == DDEATH || t == DDATA || t == DCMD
+}
+
+func (t MessageType) valid() bool {
+	switch t {
+	case NBIRTH, NDEATH, DBIRTH, DDEATH, NDATA, DDATA, NCMD, DCMD:
+		return true
+	}
+	return false
+}
+
+// Topic is spBv1.0/{GroupID}/{MessageType}/{NodeID}[/{DeviceID}]
+type Topic struct {
+	GroupID     string
+	MessageType MessageType
+	NodeID      string
+	// DeviceID is only set for DBIRTH, DDEATH, DDATA and DCMD
+	DeviceID string
+}
+
+func (t Topic) String() string {
+	topic := Namespace + "/" + t.GroupID + "/" + string(t.MessageType) + "/" + t.NodeID
+	if t.DeviceID != "" {
+		topic += "/" + t.DeviceID
+	}
+	return topic
+}
+
+// ParseTopic splits a Sparkplug B topic into its parts
+func ParseTopic(topic string) (Topic, error) {
+	levels := strings.Split(topic, "/")
+	if len(levels) < 4 || len(levels) > 5 || levels[0] != Namespace {
+		return Topic{}, fmt.Errorf("%s is not a Sparkplug B topic", topic)
+	}
+	t := Topic{GroupID: levels[1], MessageType: MessageType(levels[2]), NodeID: levels[3]}
+	if len(levels) == 5 {
+		t.DeviceID = levels[4]
+	}
+	if !t.MessageType.valid() {
+		return Topic{}, fmt.Errorf("%s has unknown Sparkplug message type %s", topic, t.MessageType)
+	}
+	if t.MessageType.isDevice() != (t.DeviceID != "") {
+		return Topic{}, fmt.Errorf("%s: only device messages have a device id level", topic)
+	}
+	return t, validateIDs(t.GroupID, t.NodeID, t.DeviceID)
+}
+
+func validateIDs(ids ...string) error {
+	for i, id := range ids {
+		if id == "" && i < 2 {
+			return errors.New("sparkplug group and edge node ids are required")
+		}
+		if strings.ContainsAny(id, "/+#") {
+			return fmt.Errorf("sparkplug id %q may not contain /, + or #", id)
+		}
+	}
+	return nil
+}
+
+// Command is an NCMD, when DeviceID is empty, or a DCMD received by an edge node
+type Command struct {
+	DeviceID string
+	Metrics  []Metric
+}
+
+// NodeOptions configures an edge node
+type NodeOptions struct {
+	GroupID string
+	NodeID  string
+	// Metrics are published in every NBIRTH. Their values are kept up to date by PublishData.
+	Metrics []Metric
+	// BdSeq is the birth/death sequence number of the first death certificate. Persist BdSeq()
+	// across restarts to keep it increasing.
+	BdSeq uint64
+	// OnCommand receives NCMD and DCMD messages. Rebirth requests are handled by the node and
+	// are not passed on.
+	OnCommand func(cmd Command)
+	// OnError receives errors of commands that do not decode and of rebirths after a reconnect
+	OnError func(err error)
+}
+
+// Node is a Sparkplug B edge node session. It numbers messages with seq, ties births to
+// the death certificate with bdSeq and publishes its births again after a reconnect or a rebirth
+// request. Births and data use QoS 0 and commands are subscribed with QoS 1, as the spec asks.
+type Node struct {
+	opts NodeOptions
+
+	mu       sync.Mutex
+	c        cb.MqttClient
+	bdSeq    uint64
+	will     bool
+	seq      uint64
+	metrics  []Metric
+	devices  map[string][]Metric
+	aliases  map[string]map[uint64]string
+	started  bool
+	stopping bool
+	// unlisten stops the reconnect listener on the client the node was started on
+	unlisten func()
+	commands sync.WaitGroup
+}
+
+// NewNode returns an edge node. Pass its DeathCertificate as the last will when
+// initializing MQTT, then Start it on the client.
+func NewNode(opts NodeOptions) (*Node, error) {
+	if err := validateIDs(opts.GroupID, opts.NodeID); err != nil {
+		return nil, err
+	}
+	return &Node{
+		opts:    opts,
+		bdSeq:   opts.BdSeq % 256,
+		metrics: append([]Metric{}, opts.Metrics...),
+		devices: map[string][]Metric{},
+		aliases: map[string]map[uint64]string{},
+	}, nil
+}
+
+// Topic returns the topic of a message of type t from this node, or from deviceID when it is set
+func (n *Node) Topic(t MessageType, deviceID string) string {
+	return Topic{GroupID: n.opts.GroupID, MessageType: t, NodeID: n.opts.NodeID, DeviceID: deviceID}.String()
+}
+
+// BdSeq returns the bdSeq of the current death certificate
+func (n *Node) BdSeq() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.bdSeq
+}
+
+// DeathCertificate returns the NDEATH to register as the MQTT last will. Every call after the
+// first starts a new session with the next bdSeq, so call it once per MQTT client.
+func (n *Node) DeathCertificate() (*cb.LastWillPacket, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.will {
+		n.bdSeq = (n.bdSeq + 1) % 256
+	}
+	n.will = true
+	body, err := n.deathLocked()
+	if err != nil {
+		return nil, err
+	}
+	return &cb.LastWillPacket{Topic: n.Topic(NDEATH, ""), Body: string(body), Qos: 1, Retain: false}, nil
+}
+
+func (n *Node) deathLocked() ([]byte, error) {
+	p := &Payload{
+		Timestamp: time.Now(),
+		Metrics:   []Metric{{Name: BdSeqMetric, DataType: UInt64, Value: n.bdSeq}},
+	}
+	return p.Encode()
+}
+
+// Start subscribes to the node's commands on c and publishes NBIRTH followed by a DBIRTH for
+// every device added so far. c must have been initialized with this node's death certificate.
+func (n *Node) Start(c cb.MqttClient) error {
+	if c == nil {
+		return errors.New("MQTTClient is uninitialized")
+	}
+	n.mu.Lock()
+	if n.started {
+		n.mu.Unlock()
+		return errors.New("sparkplug node is already started")
+	}
+	if !n.will {
+		n.mu.Unlock()
+		return errors.New("sparkplug node has no death certificate, pass DeathCertificate() as the last will")
+	}
+	n.c = c
+	n.started = true
+	n.stopping = false
+	n.mu.Unlock()
+
+	fail := func(err error) error {
+		n.mu.Lock()
+		n.started = false
+		unlisten := n.unlisten
+		n.unlisten = nil
+		n.mu.Unlock()
+		if unlisten != nil {
+			unlisten()
+		}
+		return err
+	}
+	for _, topic := range []string{n.Topic(NCMD, ""), n.Topic(DCMD, "+")} {
+		msgs, err := cb.SubscribeMQTT(c, topic, 1)
+		if err != nil {
+			return fail(err)
+		}
+		n.commands.Add(1)
+		go func() {
+			defer n.commands.Done()
+			for pub := range msgs {
+				n.handleCommand(pub.Topic.Whole, pub.Payload)
+			}
+		}()
+	}
+	// clients that do not report reconnects are not rebirthed by the node
+	unlisten, err := cb.ListenMQTTEvents(c, func(ev cb.MQTTEvent) {
+		if ev.Kind != cb.MQTTReconnected {
+			return
+		}
+		// the broker dropped the session, so the births have to be published again
+		go func() {
+			if err := n.Rebirth(); err != nil {
+				n.fail(err)
+			}
+		}()
+	})
+	if err == nil {
+		n.mu.Lock()
+		n.unlisten = unlisten
+		n.mu.Unlock()
+	}
+	if err := n.rebirth(c); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// Stop publishes NDEATH, as the spec asks of a node disconnecting on purpose, and unsubscribes
+// from commands. The client stays connected.
+func (n *Node) Stop() error {
+	n.mu.Lock()
+	if !n.started {
+		n.mu.Unlock()
+		return errors.New("sparkplug node is not started")
+	}
+	n.stopping = true
+	c := n.c
+	unlisten := n.unlisten
+	n.unlisten = nil
+	body, err := n.deathLocked()
+	n.mu.Unlock()
+	if unlisten != nil {
+		unlisten()
+	}
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if err := cb.PublishMQTT(c, n.Topic(NDEATH, ""), body, 1, false); err != nil {
+		errs = append(errs, err)
+	}
+	for _, topic := range []string{n.Topic(NCMD, ""), n.Topic(DCMD, "+")} {
+		if err := cb.UnsubscribeMQTT(c, topic); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	n.commands.Wait()
+	n.mu.Lock()
+	n.started = false
+	n.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Rebirth publishes NBIRTH and every DBIRTH again with seq starting over at 0
+func (n *Node) Rebirth() error {
+	n.mu.Lock()
+	c := n.c
+	n.mu.Unlock()
+	if c == nil {
+		return errors.New("sparkplug node is not started")
+	}
+	return n.rebirth(c)
+}
+
+func (n *Node) rebirth(c cb.MqttClient) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.started || n.stopping {
+		return nil
+	}
+	n.seq = 0
+	birth := append([]Metric{{Name: BdSeqMetric, DataType: UInt64, Value: n.bdSeq}}, n.metrics...)
+	n.aliases[""] = aliasesOf(n.metrics)
+	if err := n.publishLocked(c, NBIRTH, "", birth); err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(n.devices))
+	for id := range n.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := n.publishLocked(c, DBIRTH, id, n.devices[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishData publishes NDATA and records the values for later births
+func (n *Node) PublishData(metrics []Metric) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.publishLocked(n.c, NDATA, "", metrics); err != nil {
+		return err
+	}
+	n.metrics = mergeMetrics(n.metrics, metrics)
+	return nil
+}
+
+// AddDevice publishes a DBIRTH for deviceID. It is published again with every NBIRTH until the
+// device is removed.
+func (n *Node) AddDevice(deviceID string, metrics []Metric) error {
+	if deviceID == "" {
+		return errors.New("sparkplug device id is required")
+	}
+	if err := validateIDs(n.opts.GroupID, n.opts.NodeID, deviceID); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.devices[deviceID] = append([]Metric{}, metrics...)
+	n.aliases[deviceID] = aliasesOf(metrics)
+	if !n.started {
+		return nil
+	}
+	return n.publishLocked(n.c, DBIRTH, deviceID, metrics)
+}
+
+// PublishDeviceData publishes DDATA for a device added with AddDevice
+func (n *Node) PublishDeviceData(deviceID string, metrics []Metric) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	current, ok := n.devices[deviceID]
+	if !ok {
+		return fmt.Errorf("sparkplug device %s has not been added", deviceID)
+	}
+	if err := n.publishLocked(n.c, DDATA, deviceID, metrics); err != nil {
+		return err
+	}
+	n.devices[deviceID] = mergeMetrics(current, metrics)
+	return nil
+}
+
+// RemoveDevice publishes a DDEATH for deviceID and stops including it in births
+func (n *Node) RemoveDevice(deviceID string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.devices[deviceID]; !ok {
+		return fmt.Errorf("sparkplug device %s has not been added", deviceID)
+	}
+	delete(n.devices, deviceID)
+	delete(n.aliases, deviceID)
+	if !n.started {
+		return nil
+	}
+	return n.publishLocked(n.c, DDEATH, deviceID, nil)
+}
+
+// publishLocked stamps the payload with the next seq, which wraps at 256
+func (n *Node) publishLocked(c cb.MqttClient, t MessageType, deviceID string, metrics []Metric) error {
+	if !n.started {
+		return errors.New("sparkplug node is not started")
+	}
+	seq := n.seq
+	p := &Payload{Timestamp: time.Now(), Metrics: metrics, Seq: &seq}
+	body, err := p.Encode()
+	if err != nil {
+		return err
+	}
+	if err := cb.PublishMQTT(c, n.Topic(t, deviceID), body, 0, false); err != nil {
+		return err
+	}
+	n.seq = (n.seq + 1) % 256
+	return nil
+}
+
+func (n *Node) handleCommand(topic string, payload []byte) {
+	t, err := ParseTopic(topic)
+	if err != nil {
+		n.fail(err)
+		return
+	}
+	p, err := DecodePayload(payload)
+	if err != nil {
+		n.fail(fmt.Errorf("%s: %w", topic, err))
+		return
+	}
+	n.mu.Lock()
+	aliases := n.aliases[t.DeviceID]
+	n.mu.Unlock()
+	cmd := Command{DeviceID: t.DeviceID}
+	rebirth := false
+	for _, m := range p.Metrics {
+		if m.Name == "" {
+			m.Name = aliases[m.Alias]
+		}
+		if t.MessageType == NCMD && m.Name == RebirthMetric {
+			rebirth = rebirth || m.Value == true
+			continue
+		}
+		cmd.Metrics = append(cmd.Metrics, m)
+	}
+	if rebirth {
+		if err := n.Rebirth(); err != nil {
+			n.fail(err)
+		}
+	}
+	if len(cmd.Metrics) > 0 && n.opts.OnCommand != nil {
+		n.opts.OnCommand(cmd)
+	}
+}
+
+func (n *Node) fail(err error) {
+	if n.opts.OnError != nil {
+		n.opts.OnError(err)
+	}
+}
+
+func aliasesOf(metrics []Metric) map[uint64]string {
+	aliases := map[uint64]string{}
+	for _, m := range metrics {
+		if m.Alias != 0 && m.Name != "" {
+			aliases[m.Alias] = m.Name
+		}
+	}
+	return aliases
+}
+
+// mergeMetrics updates the birth metrics with newer values, matching by name or alias
+func mergeMetrics(birth, updates []Metric) []Metric {
+	for _, u := range updates {
+		for i := range birth {
+			if (u.Name != "" && birth[i].Name == u.Name) || (u.Name == "" && u.Alias != 0 && birth[i].Alias == u.Alias) {
+				birth[i].Value = u.Value
+				birth[i].IsNull = u.IsNull
+				birth[i].Timestamp = u.Timestamp
+				break
+			}
+		}
+	}
+	return birth
+}
@@ -0,0 +1,260 @@
+package sparkplug
+
+import (
+	"testing"
+	"time"
+
+	cb "github.com/clearblade/Go-SDK"
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+)
+
+func TestTopicRoundTrip(t *testing.T) {
+	for _, topic := range []string{"spBv1.0/G/NBIRTH/n1", "spBv1.0/G/DDATA/n1/d1", "spBv1.0/G/NCMD/n1"} {
+		parsed, err := ParseTopic(topic)
+		if err != nil {
+			t.Fatalf("parse %s: %v", topic, err)
+		}
+		if parsed.String() != topic {
+			t.Fatalf("%s came back as %s", topic, parsed)
+		}
+	}
+	for _, topic := range []string{"spBv1.0/G/NBIRTH/n1/d1", "spBv1.0/G/DDATA/n1", "spBv1.0/G/NOPE/n1", "spAv1.0/G/NBIRTH/n1", "spBv1.0/G/NBIRTH"} {
+		if _, err := ParseTopic(topic); err == nil {
+			t.Fatalf("parsed %s", topic)
+		}
+	}
+	if _, err := NewNode(NodeOptions{GroupID: "G", NodeID: "n/1"}); err == nil {
+		t.Fatal("created a node with a / in its id")
+	}
+}
+
+// observer records the Sparkplug messages of group G
+type observer struct {
+	t    *testing.T
+	c    cb.MqttClient
+	msgs <-chan *mqttTypes.Publish
+}
+
+func newObserver(t *testing.T, b *cb.MemoryBroker) *observer {
+	t.Helper()
+	c, err := b.NewClient("observer", cb.MemoryClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+	msgs, err := cb.SubscribeMQTT(c, Namespace+"/G/#", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &observer{t: t, c: c, msgs: msgs}
+}
+
+// next returns the next message from the node, which must be of type want. The observer's own
+// commands are skipped.
+func (o *observer) next(want MessageType) (Topic, *Payload) {
+	o.t.Helper()
+	for {
+		select {
+		case pub := <-o.msgs:
+			topic, err := ParseTopic(pub.Topic.Whole)
+			if err != nil {
+				o.t.Fatal(err)
+			}
+			if topic.MessageType == NCMD || topic.MessageType == DCMD {
+				continue
+			}
+			if topic.MessageType != want {
+				o.t.Fatalf("got %s, want %s", topic, want)
+			}
+			p, err := DecodePayload(pub.Payload)
+			if err != nil {
+				o.t.Fatal(err)
+			}
+			return topic, p
+		case <-time.After(5 * time.Second):
+			o.t.Fatalf("timed out waiting for %s", want)
+			return Topic{}, nil
+		}
+	}
+}
+
+// quiet fails if the node publishes anything within d
+func (o *observer) quiet(d time.Duration) {
+	o.t.Helper()
+	select {
+	case pub := <-o.msgs:
+		o.t.Fatalf("unexpected message on %s", pub.Topic.Whole)
+	case <-time.After(d):
+	}
+}
+
+func (o *observer) command(topic string, metrics ...Metric) {
+	o.t.Helper()
+	body, err := (&Payload{Timestamp: time.Now(), Metrics: metrics}).Encode()
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	if err := cb.PublishMQTT(o.c, topic, body, 1, false); err != nil {
+		o.t.Fatal(err)
+	}
+}
+
+func seqOf(t *testing.T, p *Payload) uint64 {
+	t.Helper()
+	if p.Seq == nil {
+		t.Fatal("payload has no seq")
+	}
+	return *p.Seq
+}
+
+func bdSeqOf(t *testing.T, p *Payload) uint64 {
+	t.Helper()
+	for _, m := range p.Metrics {
+		if m.Name == BdSeqMetric {
+			return m.Value.(uint64)
+		}
+	}
+	t.Fatal("payload has no bdSeq")
+	return 0
+}
+
+// startNode connects clientID with the node's next death certificate and starts the node on it
+func startNode(t *testing.T, b *cb.MemoryBroker, n *Node, clientID string) cb.MqttClient {
+	t.Helper()
+	will, err := n.DeathCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := b.NewClient(clientID, cb.MemoryClientOptions{LastWill: will})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Disconnect(0) })
+	if err := n.Start(c); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	return c
+}
+
+func TestNodeSession(t *testing.T) {
+	b := cb.NewMemoryBroker()
+	obs := newObserver(t, b)
+	commands := make(chan Command, 1)
+	n, err := NewNode(NodeOptions{
+		GroupID:   "G",
+		NodeID:    "n1",
+		BdSeq:     3,
+		Metrics:   []Metric{{Name: "temp", Alias: 1, Value: 20.0}},
+		OnCommand: func(cmd Command) { commands <- cmd },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startNode(t, b, n, "node")
+
+	_, birth := obs.next(NBIRTH)
+	if seqOf(t, birth) != 0 || bdSeqOf(t, birth) != 3 {
+		t.Fatalf("NBIRTH seq %d bdSeq %d", seqOf(t, birth), bdSeqOf(t, birth))
+	}
+	if err := n.AddDevice("d1", []Metric{{Name: "on", Value: false}}); err != nil {
+		t.Fatal(err)
+	}
+	if topic, p := obs.next(DBIRTH); topic.DeviceID != "d1" || seqOf(t, p) != 1 {
+		t.Fatalf("DBIRTH %s seq %d", topic, seqOf(t, p))
+	}
+	if err := n.PublishData([]Metric{{Alias: 1, Value: 21.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, p := obs.next(NDATA); seqOf(t, p) != 2 {
+		t.Fatalf("NDATA seq %d", seqOf(t, p))
+	}
+
+	// a command by alias reaches OnCommand with its name filled in
+	obs.command(n.Topic(NCMD, ""), Metric{Alias: 1, Value: 25.0})
+	select {
+	case cmd := <-commands:
+		if cmd.DeviceID != "" || len(cmd.Metrics) != 1 || cmd.Metrics[0].Name != "temp" {
+			t.Fatalf("command %+v", cmd)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not delivered")
+	}
+
+	// a rebirth request restarts seq and carries the latest values
+	obs.command(n.Topic(NCMD, ""), Metric{Name: RebirthMetric, Value: true})
+	_, rebirth := obs.next(NBIRTH)
+	if seqOf(t, rebirth) != 0 || rebirth.Metrics[1].Value != 21.5 {
+		t.Fatalf("rebirth seq %d metrics %+v", seqOf(t, rebirth), rebirth.Metrics)
+	}
+	obs.next(DBIRTH)
+
+	if err := n.RemoveDevice("d1"); err != nil {
+		t.Fatal(err)
+	}
+	if topic, _ := obs.next(DDEATH); topic.DeviceID != "d1" {
+		t.Fatalf("DDEATH for %s", topic)
+	}
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, death := obs.next(NDEATH); bdSeqOf(t, death) != 3 || death.Seq != nil {
+		t.Fatalf("NDEATH %+v", death)
+	}
+}
+
+func TestNodeDeathCertificateAndRebirthAfterReconnect(t *testing.T) {
+	b := cb.NewMemoryBroker()
+	obs := newObserver(t, b)
+	n, err := NewNode(NodeOptions{GroupID: "G", NodeID: "n1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startNode(t, b, n, "node")
+	obs.next(NBIRTH)
+
+	if err := b.DropConnection("node"); err != nil {
+		t.Fatal(err)
+	}
+	if _, death := obs.next(NDEATH); bdSeqOf(t, death) != 0 {
+		t.Fatalf("will bdSeq %d", bdSeqOf(t, death))
+	}
+	if _, birth := obs.next(NBIRTH); seqOf(t, birth) != 0 || bdSeqOf(t, birth) != 0 {
+		t.Fatalf("rebirth after reconnect %+v", birth)
+	}
+}
+
+func TestNodeFollowsTheClientItIsRestartedOn(t *testing.T) {
+	b := cb.NewMemoryBroker()
+	obs := newObserver(t, b)
+	n, err := NewNode(NodeOptions{GroupID: "G", NodeID: "n1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startNode(t, b, n, "first")
+	obs.next(NBIRTH)
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	obs.next(NDEATH)
+
+	startNode(t, b, n, "second")
+	if _, birth := obs.next(NBIRTH); bdSeqOf(t, birth) != 1 {
+		t.Fatalf("second session bdSeq %d", bdSeqOf(t, birth))
+	}
+
+	// the old client reconnecting publishes its will but no births any more
+	if err := b.DropConnection("first"); err != nil {
+		t.Fatal(err)
+	}
+	obs.next(NDEATH)
+	obs.quiet(200 * time.Millisecond)
+
+	// the new client reconnecting is followed by births
+	if err := b.DropConnection("second"); err != nil {
+		t.Fatal(err)
+	}
+	if _, death := obs.next(NDEATH); bdSeqOf(t, death) != 1 {
+		t.Fatalf("will bdSeq %d", bdSeqOf(t, death))
+	}
+	obs.next(NBIRTH)
+}
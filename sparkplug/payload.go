@@ -0,0 +1,498 @@
+package sparkplug
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Wire encoding of the Sparkplug B protobuf payload, org.eclipse.tahu.protobuf.Payload.
+// DataSet, Template and PropertySet values are not supported and are skipped when decoding.
+
+// DataType is the datatype of a Sparkplug B metric
+type DataType uint32
+
+const (
+	Unknown  DataType = 0
+	Int8     DataType = 1
+	Int16    DataType = 2
+	Int32    DataType = 3
+	Int64    DataType = 4
+	UInt8    DataType = 5
+	UInt16   DataType = 6
+	UInt32   DataType = 7
+	UInt64   DataType = 8
+	Float    DataType = 9
+	Double   DataType = 10
+	Boolean  DataType = 11
+	String   DataType = 12
+	DateTime DataType = 13
+	Text     DataType = 14
+	UUID     DataType = 15
+	Bytes    DataType = 17
+	File     DataType = 18
+)
+
+const (
+	_SP_PAYLOAD_TIMESTAMP = 1
+	_SP_PAYLOAD_METRICS   = 2
+	_SP_PAYLOAD_SEQ       = 3
+	_SP_PAYLOAD_UUID      = 4
+	_SP_PAYLOAD_BODY      = 5
+
+	_SP_METRIC_NAME          = 1
+	_SP_METRIC_ALIAS         = 2
+	_SP_METRIC_TIMESTAMP     = 3
+	_SP_METRIC_DATATYPE      = 4
+	_SP_METRIC_IS_HISTORICAL = 5
+	_SP_METRIC_IS_TRANSIENT  = 6
+	_SP_METRIC_IS_NULL       = 7
+	_SP_METRIC_INT           = 10
+	_SP_METRIC_LONG          = 11
+	_SP_METRIC_FLOAT         = 12
+	_SP_METRIC_DOUBLE        = 13
+	_SP_METRIC_BOOLEAN       = 14
+	_SP_METRIC_STRING        = 15
+	_SP_METRIC_BYTES         = 16
+)
+
+// Metric is a single metric. Value holds the Go type matching DataType: int8 to int64,
+// uint8 to uint64, float32, float64, bool, string, time.Time for DateTime and []byte for Bytes and File.
+// When encoding, any numeric value is converted and an unknown DataType is inferred from Value.
+type Metric struct {
+	Name         string
+	Alias        uint64
+	Timestamp    time.Time
+	DataType     DataType
+	Value        interface{}
+	IsNull       bool
+	IsHistorical bool
+	IsTransient  bool
+}
+
+// Payload is a Sparkplug B message body. Seq is nil for NDEATH and STATE messages.
+type Payload struct {
+	Timestamp time.Time
+	Metrics   []Metric
+	Seq       *uint64
+	UUID      string
+	Body      []byte
+}
+
+func millis(t time.Time) uint64 {
+	return uint64(t.UnixMilli())
+}
+
+// Encode marshals the payload to its protobuf form
+func (p *Payload) Encode() ([]byte, error) {
+	var b []byte
+	if !p.Timestamp.IsZero() {
+		b = protowire.AppendTag(b, _SP_PAYLOAD_TIMESTAMP, protowire.VarintType)
+		b = protowire.AppendVarint(b, millis(p.Timestamp))
+	}
+	for i := range p.Metrics {
+		metric := p.Metrics[i]
+		m, err := encodeMetric(&metric)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, _SP_PAYLOAD_METRICS, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	if p.Seq != nil {
+		b = protowire.AppendTag(b, _SP_PAYLOAD_SEQ, protowire.VarintType)
+		b = protowire.AppendVarint(b, *p.Seq)
+	}
+	if p.UUID != "" {
+		b = protowire.AppendTag(b, _SP_PAYLOAD_UUID, protowire.BytesType)
+		b = protowire.AppendString(b, p.UUID)
+	}
+	if p.Body != nil {
+		b = protowire.AppendTag(b, _SP_PAYLOAD_BODY, protowire.BytesType)
+		b = protowire.AppendBytes(b, p.Body)
+	}
+	return b, nil
+}
+
+func encodeMetric(m *Metric) ([]byte, error) {
+	if m.DataType == Unknown && !m.IsNull {
+		m.DataType = inferDataType(m.Value)
+		if m.DataType == Unknown {
+			return nil, fmt.Errorf("sparkplug metric %q: unsupported value type %T", m.Name, m.Value)
+		}
+	}
+	var b []byte
+	if m.Name != "" {
+		b = protowire.AppendTag(b, _SP_METRIC_NAME, protowire.BytesType)
+		b = protowire.AppendString(b, m.Name)
+	}
+	if m.Alias != 0 {
+		b = protowire.AppendTag(b, _SP_METRIC_ALIAS, protowire.VarintType)
+		b = protowire.AppendVarint(b, m.Alias)
+	}
+	if !m.Timestamp.IsZero() {
+		b = protowire.AppendTag(b, _SP_METRIC_TIMESTAMP, protowire.VarintType)
+		b = protowire.AppendVarint(b, millis(m.Timestamp))
+	}
+	b = protowire.AppendTag(b, _SP_METRIC_DATATYPE, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(m.DataType))
+	for _, flag := range []struct {
+		num protowire.Number
+		set bool
+	}{{_SP_METRIC_IS_HISTORICAL, m.IsHistorical}, {_SP_METRIC_IS_TRANSIENT, m.IsTransient}, {_SP_METRIC_IS_NULL, m.IsNull}} {
+		if flag.set {
+			b = protowire.AppendTag(b, flag.num, protowire.VarintType)
+			b = protowire.AppendVarint(b, 1)
+		}
+	}
+	if m.IsNull {
+		return b, nil
+	}
+	fail := func() ([]byte, error) {
+		return nil, fmt.Errorf("sparkplug metric %q: %T value does not fit datatype %d", m.Name, m.Value, m.DataType)
+	}
+	switch m.DataType {
+	case Int8, Int16, Int32:
+		v, ok := toInt(m.Value)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_INT, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(uint32(int32(v))))
+	case UInt8, UInt16, UInt32:
+		v, ok := toUint(m.Value)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_INT, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(uint32(v)))
+	case Int64:
+		v, ok := toInt(m.Value)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_LONG, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case UInt64:
+		v, ok := toUint(m.Value)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_LONG, protowire.VarintType)
+		b = protowire.AppendVarint(b, v)
+	case DateTime:
+		var ms uint64
+		switch v := m.Value.(type) {
+		case time.Time:
+			ms = millis(v)
+		default:
+			u, ok := toUint(v)
+			if !ok {
+				return fail()
+			}
+			ms = u
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_LONG, protowire.VarintType)
+		b = protowire.AppendVarint(b, ms)
+	case Float:
+		v, ok := toFloat(m.Value)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_FLOAT, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(float32(v)))
+	case Double:
+		v, ok := toFloat(m.Value)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_DOUBLE, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case Boolean:
+		v, ok := m.Value.(bool)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_BOOLEAN, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case String, Text, UUID:
+		v, ok := m.Value.(string)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_STRING, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	case Bytes, File:
+		v, ok := m.Value.([]byte)
+		if !ok {
+			return fail()
+		}
+		b = protowire.AppendTag(b, _SP_METRIC_BYTES, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	default:
+		return nil, fmt.Errorf("sparkplug metric %q: datatype %d is not supported", m.Name, m.DataType)
+	}
+	return b, nil
+}
+
+func inferDataType(v interface{}) DataType {
+	switch v.(type) {
+	case int8:
+		return Int8
+	case int16:
+		return Int16
+	case int32:
+		return Int32
+	case int, int64:
+		return Int64
+	case uint8:
+		return UInt8
+	case uint16:
+		return UInt16
+	case uint32:
+		return UInt32
+	case uint, uint64:
+		return UInt64
+	case float32:
+		return Float
+	case float64:
+		return Double
+	case bool:
+		return Boolean
+	case string:
+		return String
+	case time.Time:
+		return DateTime
+	case []byte:
+		return Bytes
+	}
+	return Unknown
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float64:
+		return int64(n), n == math.Trunc(n)
+	}
+	return 0, false
+}
+
+func toUint(v interface{}) (uint64, bool) {
+	i, ok := toInt(v)
+	if u, isUint := v.(uint64); isUint {
+		return u, true
+	}
+	return uint64(i), ok && i >= 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	i, ok := toInt(v)
+	return float64(i), ok
+}
+
+var errMalformed = errors.New("malformed sparkplug payload")
+
+// DecodePayload unmarshals a Sparkplug B protobuf payload
+func DecodePayload(data []byte) (*Payload, error) {
+	p := &Payload{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, errMalformed
+		}
+		data = data[n:]
+		switch {
+		case num == _SP_PAYLOAD_TIMESTAMP && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			p.Timestamp = time.UnixMilli(int64(v)).UTC()
+			data = data[n:]
+		case num == _SP_PAYLOAD_METRICS && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			m, err := decodeMetric(v)
+			if err != nil {
+				return nil, err
+			}
+			p.Metrics = append(p.Metrics, m)
+			data = data[n:]
+		case num == _SP_PAYLOAD_SEQ && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			p.Seq = &v
+			data = data[n:]
+		case num == _SP_PAYLOAD_UUID && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			p.UUID = v
+			data = data[n:]
+		case num == _SP_PAYLOAD_BODY && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			p.Body = append([]byte{}, v...)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, errMalformed
+			}
+			data = data[n:]
+		}
+	}
+	return p, nil
+}
+
+func decodeMetric(data []byte) (Metric, error) {
+	var m Metric
+	var raw uint64
+	var rawBytes []byte
+	var rawFloat32 float32
+	var rawFloat64 float64
+	var rawBool bool
+	var rawString string
+	var kind protowire.Number
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return m, errMalformed
+		}
+		data = data[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return m, errMalformed
+			}
+			data = data[n:]
+			switch num {
+			case _SP_METRIC_ALIAS:
+				m.Alias = v
+			case _SP_METRIC_TIMESTAMP:
+				m.Timestamp = time.UnixMilli(int64(v)).UTC()
+			case _SP_METRIC_DATATYPE:
+				m.DataType = DataType(v)
+			case _SP_METRIC_IS_HISTORICAL:
+				m.IsHistorical = v != 0
+			case _SP_METRIC_IS_TRANSIENT:
+				m.IsTransient = v != 0
+			case _SP_METRIC_IS_NULL:
+				m.IsNull = v != 0
+			case _SP_METRIC_INT, _SP_METRIC_LONG:
+				raw, kind = v, num
+			case _SP_METRIC_BOOLEAN:
+				rawBool, kind = v != 0, num
+			}
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data)
+			if n < 0 {
+				return m, errMalformed
+			}
+			data = data[n:]
+			if num == _SP_METRIC_FLOAT {
+				rawFloat32, kind = math.Float32frombits(v), num
+			}
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return m, errMalformed
+			}
+			data = data[n:]
+			if num == _SP_METRIC_DOUBLE {
+				rawFloat64, kind = math.Float64frombits(v), num
+			}
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return m, errMalformed
+			}
+			data = data[n:]
+			switch num {
+			case _SP_METRIC_NAME:
+				m.Name = string(v)
+			case _SP_METRIC_STRING:
+				rawString, kind = string(v), num
+			case _SP_METRIC_BYTES:
+				rawBytes, kind = append([]byte{}, v...), num
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return m, errMalformed
+			}
+			data = data[n:]
+		}
+	}
+	if m.IsNull || kind == 0 {
+		return m, nil
+	}
+	switch m.DataType {
+	case Int8:
+		m.Value = int8(int32(uint32(raw)))
+	case Int16:
+		m.Value = int16(int32(uint32(raw)))
+	case Int32:
+		m.Value = int32(uint32(raw))
+	case Int64:
+		m.Value = int64(raw)
+	case UInt8:
+		m.Value = uint8(raw)
+	case UInt16:
+		m.Value = uint16(raw)
+	case UInt32:
+		m.Value = uint32(raw)
+	case UInt64:
+		m.Value = raw
+	case DateTime:
+		m.Value = time.UnixMilli(int64(raw)).UTC()
+	case Float:
+		m.Value = rawFloat32
+	case Double:
+		m.Value = rawFloat64
+	case Boolean:
+		m.Value = rawBool
+	case String, Text, UUID:
+		m.Value = rawString
+	case Bytes, File:
+		m.Value = rawBytes
+	}
+	return m, nil
+}
@@ -0,0 +1,92 @@
+package sparkplug
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	seq := uint64(7)
+	now := time.UnixMilli(1700000000123).UTC()
+	in := &Payload{
+		Timestamp: now,
+		Seq:       &seq,
+		UUID:      "u-1",
+		Body:      []byte{1, 2},
+		Metrics: []Metric{
+			{Name: "i8", Value: int8(-3)},
+			{Name: "i32", DataType: Int32, Value: -70000},
+			{Name: "i64", Value: int64(-1 << 40)},
+			{Name: "u16", Value: uint16(65000)},
+			{Name: "u64", DataType: UInt64, Value: uint64(1 << 63)},
+			{Name: "f", Value: float32(1.5)},
+			{Name: "d", Value: 2.25},
+			{Name: "b", Value: true},
+			{Name: "s", Value: "hello", Alias: 4},
+			{Name: "t", Value: now, Timestamp: now},
+			{Name: "raw", Value: []byte("xyz")},
+			{Name: "gone", DataType: Int32, IsNull: true},
+		},
+	}
+	data, err := in.Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	out, err := DecodePayload(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !out.Timestamp.Equal(now) || out.Seq == nil || *out.Seq != 7 || out.UUID != "u-1" || !bytes.Equal(out.Body, []byte{1, 2}) {
+		t.Fatalf("payload fields %+v", out)
+	}
+	want := []interface{}{int8(-3), int32(-70000), int64(-1 << 40), uint16(65000), uint64(1 << 63), float32(1.5), 2.25, true, "hello", now, []byte("xyz"), nil}
+	if len(out.Metrics) != len(want) {
+		t.Fatalf("decoded %d metrics, want %d", len(out.Metrics), len(want))
+	}
+	for i, m := range out.Metrics {
+		if m.Name != in.Metrics[i].Name {
+			t.Fatalf("metric %d is %q", i, m.Name)
+		}
+		switch w := want[i].(type) {
+		case []byte:
+			if !bytes.Equal(m.Value.([]byte), w) {
+				t.Fatalf("%s = %v", m.Name, m.Value)
+			}
+		case time.Time:
+			if !m.Value.(time.Time).Equal(w) {
+				t.Fatalf("%s = %v", m.Name, m.Value)
+			}
+		default:
+			if m.Value != w {
+				t.Fatalf("%s = %#v, want %#v", m.Name, m.Value, w)
+			}
+		}
+	}
+	if out.Metrics[8].Alias != 4 || !out.Metrics[11].IsNull {
+		t.Fatalf("alias or null flag lost: %+v %+v", out.Metrics[8], out.Metrics[11])
+	}
+}
+
+func TestPayloadEncodeRejectsMismatchedValues(t *testing.T) {
+	for _, m := range []Metric{
+		{Name: "struct", Value: struct{}{}},
+		{Name: "bool as int", DataType: Int32, Value: true},
+		{Name: "negative uint", DataType: UInt32, Value: -1},
+	} {
+		if _, err := (&Payload{Metrics: []Metric{m}}).Encode(); err == nil {
+			t.Fatalf("encoded %s", m.Name)
+		}
+	}
+}
+
+func TestDecodePayloadRejectsTruncatedData(t *testing.T) {
+	data, err := (&Payload{Metrics: []Metric{{Name: "s", Value: "hello"}}}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodePayload(data[:len(data)-2]); !errors.Is(err, errMalformed) {
+		t.Fatalf("got %v, want errMalformed", err)
+	}
+}
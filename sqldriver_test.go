@@ -0,0 +1,193 @@
+package GoSDK
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestSQLDB opens a database whose platform and edge endpoints answer from handler
+func newTestSQLDB(t *testing.T, edgeName string, handler http.HandlerFunc) *sql.DB {
+	t.Helper()
+	db := sql.OpenDB(NewSQLConnector(newTestDevClient(t, handler), "sys", edgeName))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func respondRaw(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+}
+
+func TestSQLDriverKeepsColumnOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"row key order", `{"results": [{"zone": "b", "id": 1}, {"zone": "a", "id": 2, "extra": true}]}`, []string{"zone", "id", "extra"}},
+		{"column list", `{"columns": ["id", "zone"], "results": [{"zone": "b", "id": 1}]}`, []string{"id", "zone"}},
+		{"typed column list", `{"results": [{"zone": "b", "id": 1}], "columns": [{"name": "zone", "type": "text"}, {"name": "id", "type": "int"}]}`, []string{"zone", "id"}},
+		{"bare array", `[{"zone": "b", "id": 1}]`, []string{"zone", "id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestSQLDB(t, "", respondRaw(tt.body))
+			rows, err := db.Query("SELECT zone, id FROM devices")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			cols, err := rows.Columns()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cols, tt.want) {
+				t.Fatalf("columns are %v, want %v", cols, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLDriverScansByPosition(t *testing.T) {
+	db := newTestSQLDB(t, "", respondRaw(`{"results": [{"zone": "b", "id": 7}]}`))
+	var zone string
+	var id int64
+	if err := db.QueryRow("SELECT zone, id FROM devices").Scan(&zone, &id); err != nil {
+		t.Fatal(err)
+	}
+	if zone != "b" || id != 7 {
+		t.Fatalf("scanned zone %q id %d", zone, id)
+	}
+}
+
+func TestSQLDriverParsesTimesOnlyInTimestampColumns(t *testing.T) {
+	body := `{"columns": [{"name": "label", "type": "text"}, {"name": "at", "type": "timestamp with time zone"}],
+		"results": [{"label": "2023-01-02 03:04:05", "at": "2023-01-02T03:04:05Z"}]}`
+	db := newTestSQLDB(t, "", respondRaw(body))
+	var label string
+	var at time.Time
+	if err := db.QueryRow("SELECT label, at FROM events").Scan(&label, &at); err != nil {
+		t.Fatal(err)
+	}
+	if label != "2023-01-02 03:04:05" {
+		t.Fatalf("text column was rewritten to %q", label)
+	}
+	if !at.Equal(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("timestamp column scanned as %v", at)
+	}
+}
+
+func TestSQLDriverQueryUsesEdgeEndpoint(t *testing.T) {
+	var path string
+	db := newTestSQLDB(t, "edge1", func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`[{"n": 1}]`))
+	})
+	var n int
+	if err := db.QueryRow("SELECT count(*) AS n FROM t WHERE a = ?", 1).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v/4/database/sys/edge1/query" || n != 1 {
+		t.Fatalf("queried %s and got %d", path, n)
+	}
+}
+
+func TestSQLDriverReportsFailedStatements(t *testing.T) {
+	db := newTestSQLDB(t, "", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 400, "relation \"missing\" does not exist")
+	})
+	if _, err := db.Exec("DELETE FROM missing"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("exec returned %v, want the platform error", err)
+	}
+	if _, err := db.Query("SELECT * FROM missing"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("query returned %v, want the platform error", err)
+	}
+}
+
+func TestSQLDriverRejectsUnknownResponses(t *testing.T) {
+	db := newTestSQLDB(t, "", respondRaw(`{"message": "ok"}`))
+	if _, err := db.Query("SELECT 1"); err == nil {
+		t.Fatal("expected an error for a response without rows")
+	}
+}
+
+func TestSQLDriverExecCancelsTheRequest(t *testing.T) {
+	for _, edge := range []string{"", "edge1"} {
+		t.Run("edge "+edge, func(t *testing.T) {
+			started, cancelled := make(chan struct{}), make(chan struct{})
+			db := newTestSQLDB(t, edge, func(w http.ResponseWriter, r *http.Request) {
+				// the server only notices the client going away once the body is read
+				io.Copy(io.Discard, r.Body)
+				close(started)
+				<-r.Context().Done()
+				close(cancelled)
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-started
+				cancel()
+			}()
+			if _, err := db.ExecContext(ctx, "DELETE FROM t"); !errors.Is(err, context.Canceled) {
+				t.Fatalf("exec returned %v, want context.Canceled", err)
+			}
+			select {
+			case <-cancelled:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the platform request was not cancelled")
+			}
+		})
+	}
+}
+
+func TestSQLDriverExecReportsEdgeRowsAffected(t *testing.T) {
+	var path string
+	db := newTestSQLDB(t, "edge1", func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		writeJSON(w, 200, map[string]interface{}{"count": 3})
+	})
+	res, err := db.Exec("DELETE FROM t WHERE a = ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 3 || path != "/api/v/4/database/sys/edge1/exec" {
+		t.Fatalf("exec at %s affected %d, %v", path, n, err)
+	}
+}
+
+func TestSQLConnectorRetriesFailedAuthentication(t *testing.T) {
+	var auths int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/auth") {
+			if atomic.AddInt32(&auths, 1) == 1 {
+				writeJSON(w, 500, map[string]interface{}{"error": "platform starting"})
+				return
+			}
+			writeJSON(w, 200, map[string]interface{}{"dev_token": "fresh"})
+			return
+		}
+		w.Write([]byte(`{"results": [{"n": 1}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	connector := NewSQLConnector(NewDevClientWithAddrs(srv.URL, "", "dev@example.com", "pw"), "sys", "")
+	if _, err := connector.Connect(context.Background()); err == nil {
+		t.Fatal("connected although authentication failed")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := connector.Connect(context.Background()); err != nil {
+			t.Fatalf("connect %d after the failure: %v", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&auths); n != 2 {
+		t.Fatalf("authenticated %d times, want 2", n)
+	}
+}
@@ -0,0 +1,171 @@
+package GoSDK
+
+import (
+	"sync"
+	"sync/atomic"
+
+	mqttTypes "github.com/clearblade/mqtt_parsing"
+)
+
+const _SUBSCRIBE_DEFAULT_BUFFER = 50
+
+// OverflowPolicy decides what happens to a message that arrives while a subscription's channel is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for the consumer. A slow consumer stalls every subscription on the client.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered message to make room
+	OverflowDropOldest
+	// OverflowDropNewest discards the message that just arrived
+	OverflowDropNewest
+	// OverflowCallback hands the message that just arrived to SubscribeOptions.OnOverflow instead
+	OverflowCallback
+)
+
+// SubscribeOptions controls how messages are handed to the channel returned by SubscribeWithOptions.
+// The zero value matches Subscribe: a buffer of 50 that blocks when full.
+type SubscribeOptions struct {
+	BufferSize int
+	Overflow   OverflowPolicy
+	// OnOverflow receives the messages OverflowCallback did not deliver. It must not block.
+	OnOverflow func(topic string, msg *mqttTypes.Publish)
+}
+
+// SubscriptionStats are the delivery counters of a single subscription
+type SubscriptionStats struct {
+	Topic     string
+	Delivered uint64
+	Dropped   uint64
+	Buffered  int
+}
+
+// subscriptionChannel is what the subscription manager needs from a delivery queue of any message type
+type subscriptionChannel interface {
+	close()
+	stats() SubscriptionStats
+}
+
+// deliveryQueue feeds one subscription channel. It applies the overflow policy and makes sure the
+// channel is only closed once no send can be in progress.
+type deliveryQueue[T any] struct {
+	topic      string
+	ch         chan T
+	policy     OverflowPolicy
+	onOverflow func(T)
+
+	mu        sync.RWMutex
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	delivered uint64
+	dropped   uint64
+}
+
+func newDeliveryQueue[T any](topic string, size int, policy OverflowPolicy, onOverflow func(T)) *deliveryQueue[T] {
+	if size <= 0 {
+		size = _SUBSCRIBE_DEFAULT_BUFFER
+	}
+	return &deliveryQueue[T]{
+		topic:      topic,
+		ch:         make(chan T, size),
+		policy:     policy,
+		onOverflow: onOverflow,
+		closing:    make(chan struct{}),
+	}
+}
+
+func (q *deliveryQueue[T]) send(msg T) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return
+	}
+	select {
+	case q.ch <- msg:
+		atomic.AddUint64(&q.delivered, 1)
+		return
+	default:
+	}
+	switch q.policy {
+	case OverflowBlock:
+		select {
+		case q.ch <- msg:
+			atomic.AddUint64(&q.delivered, 1)
+		case <-q.closing:
+			atomic.AddUint64(&q.dropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.ch <- msg:
+				atomic.AddUint64(&q.delivered, 1)
+				return
+			default:
+			}
+			select {
+			case <-q.ch:
+				atomic.AddUint64(&q.dropped, 1)
+			default:
+			}
+		}
+	case OverflowCallback:
+		atomic.AddUint64(&q.dropped, 1)
+		if q.onOverflow != nil {
+			q.onOverflow(msg)
+		}
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+	}
+}
+
+func (q *deliveryQueue[T]) close() {
+	q.closeOnce.Do(func() {
+		// wake any blocked sender before waiting for the senders to leave
+		close(q.closing)
+		q.mu.Lock()
+		q.closed = true
+		close(q.ch)
+		q.mu.Unlock()
+	})
+}
+
+func (q *deliveryQueue[T]) stats() SubscriptionStats {
+	return SubscriptionStats{
+		Topic:     q.topic,
+		Delivered: atomic.LoadUint64(&q.delivered),
+		Dropped:   atomic.LoadUint64(&q.dropped),
+		Buffered:  len(q.ch),
+	}
+}
+
+// SubscribeWithOptions is Subscribe with control over the channel buffer and what happens when it fills up
+func (u *UserClient) SubscribeWithOptions(topic string, qos int, opts SubscribeOptions) (<-chan *mqttTypes.Publish, error) {
+	return subscribeWithOptions(u.MQTTClient, topic, qos, opts)
+}
+
+// SubscribeWithOptions is Subscribe with control over the channel buffer and what happens when it fills up
+func (d *DeviceClient) SubscribeWithOptions(topic string, qos int, opts SubscribeOptions) (<-chan *mqttTypes.Publish, error) {
+	return subscribeWithOptions(d.MQTTClient, topic, qos, opts)
+}
+
+// SubscribeWithOptions is Subscribe with control over the channel buffer and what happens when it fills up
+func (d *DevClient) SubscribeWithOptions(topic string, qos int, opts SubscribeOptions) (<-chan *mqttTypes.Publish, error) {
+	return subscribeWithOptions(d.MQTTClient, topic, qos, opts)
+}
+
+// SubscriptionStats returns the delivery counters of every active subscription
+func (u *UserClient) SubscriptionStats() ([]SubscriptionStats, error) {
+	return subscriptionStats(u.MQTTClient)
+}
+
+// SubscriptionStats returns the delivery counters of every active subscription
+func (d *DeviceClient) SubscriptionStats() ([]SubscriptionStats, error) {
+	return subscriptionStats(d.MQTTClient)
+}
+
+// SubscriptionStats returns the delivery counters of every active subscription
+func (d *DevClient) SubscriptionStats() ([]SubscriptionStats, error) {
+	return subscriptionStats(d.MQTTClient)
+}
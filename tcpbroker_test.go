@@ -0,0 +1,179 @@
+package GoSDK
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/clearblade/paho.mqtt.golang/packets"
+)
+
+// tcpBroker is a minimal MQTT 3.1.1 broker on a loopback port, for flows that dial a real
+// connection such as the auth handshake and credential refresh on reconnect
+type tcpBroker struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu       sync.Mutex
+	connects []*packets.ConnectPacket
+	conns    []net.Conn
+	unsubs   []string
+	// onConnect decides the CONNACK return code; nil accepts everything
+	onConnect func(*packets.ConnectPacket) byte
+	// onSubscribe runs after the SUBACK is written and may publish to the subscriber
+	onSubscribe func(c *tcpBrokerConn, topic string)
+}
+
+type tcpBrokerConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+func (c *tcpBrokerConn) write(p packets.ControlPacket) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return p.Write(c.Conn)
+}
+
+// publish sends a QoS 0 message to the client on this connection
+func (c *tcpBrokerConn) publish(topic string, payload []byte) error {
+	pub := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	pub.TopicName = topic
+	pub.Payload = payload
+	return c.write(pub)
+}
+
+func newTCPBroker(t *testing.T) *tcpBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	b := &tcpBroker{t: t, ln: ln}
+	go b.accept()
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *tcpBroker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *tcpBroker) close() {
+	b.ln.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+}
+
+// dropConnections closes every client connection without stopping the listener
+func (b *tcpBroker) dropConnections() {
+	b.mu.Lock()
+	conns := b.conns
+	b.conns = nil
+	b.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// connectPackets returns every CONNECT the broker has seen, accepted or not
+func (b *tcpBroker) connectPackets() []*packets.ConnectPacket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*packets.ConnectPacket(nil), b.connects...)
+}
+
+func (b *tcpBroker) accept() {
+	for {
+		nc, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.conns = append(b.conns, nc)
+		b.mu.Unlock()
+		go b.serve(&tcpBrokerConn{Conn: nc})
+	}
+}
+
+func (b *tcpBroker) serve(c *tcpBrokerConn) {
+	defer c.Close()
+	for {
+		p, err := packets.ReadPacket(c)
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.connects = append(b.connects, p)
+			decide := b.onConnect
+			b.mu.Unlock()
+			ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			if decide != nil {
+				ack.ReturnCode = decide(p)
+			}
+			if c.write(ack) != nil || ack.ReturnCode != packets.Accepted {
+				return
+			}
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = p.Qoss
+			if c.write(ack) != nil {
+				return
+			}
+			b.mu.Lock()
+			hook := b.onSubscribe
+			b.mu.Unlock()
+			if hook != nil {
+				for _, topic := range p.Topics {
+					hook(c, topic)
+				}
+			}
+		case *packets.UnsubscribePacket:
+			b.mu.Lock()
+			b.unsubs = append(b.unsubs, p.Topics...)
+			b.mu.Unlock()
+			ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			ack.MessageID = p.MessageID
+			if c.write(ack) != nil {
+				return
+			}
+		case *packets.PublishPacket:
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				if c.write(ack) != nil {
+					return
+				}
+			}
+		case *packets.PingreqPacket:
+			if c.write(packets.NewControlPacket(packets.Pingresp)) != nil {
+				return
+			}
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// unsubscribed returns every topic clients have unsubscribed from
+func (b *tcpBroker) unsubscribed() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.unsubs...)
+}
+
+// clientIDs lists the client ids of the CONNECTs seen so far, for failure messages
+func (b *tcpBroker) clientIDs() string {
+	var ids []string
+	for _, p := range b.connectPackets() {
+		ids = append(ids, p.ClientIdentifier)
+	}
+	return strings.Join(ids, ",")
+}
@@ -40,7 +40,7 @@ func (d *DevClient) DeleteThrottlerCasesAndExceptions(throttlerName string) (map
 	if err != nil {
 		return nil, err
 	}
-	resp, err := mapResponse(delete(d, _THROTTLERS_PREAMBLE+"/"+throttlerName, nil, creds, nil))
+	resp, err := mapResponse(del(d, _THROTTLERS_PREAMBLE+"/"+throttlerName, nil, creds, nil))
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +82,7 @@ func (d *DevClient) deleteAllThrottlerCases(throttlerName, pathTail string) (map
 	if err != nil {
 		return nil, err
 	}
-	resp, err := mapResponse(delete(d, _THROTTLERS_PREAMBLE+"/"+throttlerName+pathTail, nil, creds, nil))
+	resp, err := mapResponse(del(d, _THROTTLERS_PREAMBLE+"/"+throttlerName+pathTail, nil, creds, nil))
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +124,7 @@ func (d *DevClient) deleteThrottlerCase(throttlerName, caseName, pathTail string
 	if err != nil {
 		return nil, err
 	}
-	resp, err := mapResponse(delete(d, _THROTTLERS_PREAMBLE+"/"+throttlerName+pathTail+"/"+caseName, nil, creds, nil))
+	resp, err := mapResponse(del(d, _THROTTLERS_PREAMBLE+"/"+throttlerName+pathTail+"/"+caseName, nil, creds, nil))
 	if err != nil {
 		return nil, err
 	}
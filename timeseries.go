@@ -0,0 +1,317 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rawTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// Point is a single time bucket of a series. Values holds one entry per aggregate alias; an entry is
+// missing when the bucket had no data and nothing was carried forward into it.
+type Point struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// Series is the run of points for one combination of group by tags
+type Series struct {
+	Tags   map[string]interface{}
+	Points []Point
+}
+
+type timeSeriesFilter struct {
+	column   string
+	operator string
+	value    interface{}
+}
+
+// TimeSeriesQuery builds a downsampling query against a hypertable, e.g. the average per 5 minutes
+// over the last day per device. Run it with QueryTimeSeries.
+type TimeSeriesQuery struct {
+	collection   string
+	timeColumn   string
+	start, end   time.Time
+	bucket       time.Duration
+	aggregations []Aggregation
+	groupBy      []string
+	filters      []timeSeriesFilter
+	gapFill      bool
+	carryForward bool
+}
+
+// NewTimeSeriesQuery starts a query over the given collection, bucketing on timeColumn
+func NewTimeSeriesQuery(collection, timeColumn string) *TimeSeriesQuery {
+	return &TimeSeriesQuery{collection: collection, timeColumn: timeColumn}
+}
+
+// Range limits the query to start <= time < end
+func (q *TimeSeriesQuery) Range(start, end time.Time) *TimeSeriesQuery {
+	q.start, q.end = start, end
+	return q
+}
+
+// Last limits the query to the window of length d ending now
+func (q *TimeSeriesQuery) Last(d time.Duration) *TimeSeriesQuery {
+	now := time.Now()
+	return q.Range(now.Add(-d), now)
+}
+
+// Bucket sets the width of each point
+func (q *TimeSeriesQuery) Bucket(width time.Duration) *TimeSeriesQuery {
+	q.bucket = width
+	return q
+}
+
+// Aggregate adds an aggregate column. function is one of avg, sum, min, max, count, first, last,
+// stddev or variance; column may be "*" for count.
+func (q *TimeSeriesQuery) Aggregate(function, column, alias string) *TimeSeriesQuery {
+	q.aggregations = append(q.aggregations, Aggregation{Function: function, Column: column, Alias: alias})
+	return q
+}
+
+// GroupBy splits the result into one series per distinct combination of tag columns
+func (q *TimeSeriesQuery) GroupBy(tags ...string) *TimeSeriesQuery {
+	q.groupBy = append(q.groupBy, tags...)
+	return q
+}
+
+// Where adds a condition on a column, operator is one of =, !=, <, <=, >, >=
+func (q *TimeSeriesQuery) Where(column, operator string, value interface{}) *TimeSeriesQuery {
+	q.filters = append(q.filters, timeSeriesFilter{column: column, operator: operator, value: value})
+	return q
+}
+
+// GapFill emits a point for every bucket in the range, even those without data
+func (q *TimeSeriesQuery) GapFill() *TimeSeriesQuery {
+	q.gapFill = true
+	return q
+}
+
+// CarryForward fills empty buckets with the last value seen. It implies GapFill.
+func (q *TimeSeriesQuery) CarryForward() *TimeSeriesQuery {
+	q.gapFill = true
+	q.carryForward = true
+	return q
+}
+
+// Validate checks the query before any SQL is generated
+func (q *TimeSeriesQuery) Validate() error {
+	if q.collection == "" {
+		return fmt.Errorf("time series query needs a collection")
+	}
+	if !identifierPattern.MatchString(q.timeColumn) {
+		return fmt.Errorf("time column %q is not a valid column name", q.timeColumn)
+	}
+	if q.start.IsZero() || q.end.IsZero() || !q.start.Before(q.end) {
+		return fmt.Errorf("time series query needs a time range with start before end")
+	}
+	if q.bucket <= 0 {
+		return fmt.Errorf("time series query needs a positive bucket width")
+	}
+	opts := ContinuousAggregateOptions{
+		TimeColumn:   q.timeColumn,
+		BucketWidth:  Interval(q.bucket),
+		GroupBy:      q.groupBy,
+		Aggregations: q.aggregations,
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	for _, f := range q.filters {
+		if !identifierPattern.MatchString(f.column) {
+			return fmt.Errorf("filter column %q is not a valid column name", f.column)
+		}
+		switch f.operator {
+		case "=", "!=", "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("filter operator %q is not supported", f.operator)
+		}
+	}
+	return nil
+}
+
+// SQL returns the statement and parameters QueryTimeSeries would send
+func (q *TimeSeriesQuery) SQL() (string, []interface{}, error) {
+	if err := q.Validate(); err != nil {
+		return "", nil, err
+	}
+	params := []interface{}{Interval(q.bucket).IntervalStr, q.start.UTC(), q.end.UTC()}
+	timeCol := quoteIdentifier(q.timeColumn)
+
+	bucketFn := "time_bucket"
+	if q.gapFill {
+		bucketFn = "time_bucket_gapfill"
+	}
+	cols := []string{fmt.Sprintf("%s($1::interval, %s) AS bucket", bucketFn, timeCol)}
+	for _, tag := range q.groupBy {
+		cols = append(cols, quoteIdentifier(tag))
+	}
+	for _, agg := range q.aggregations {
+		expr := aggregateExpression(agg, timeCol)
+		if q.carryForward {
+			expr = "locf(" + expr + ")"
+		}
+		cols = append(cols, expr+" AS "+quoteIdentifier(agg.Alias))
+	}
+
+	where := []string{timeCol + " >= $2", timeCol + " < $3"}
+	for _, f := range q.filters {
+		params = append(params, f.value)
+		where = append(where, fmt.Sprintf("%s %s $%d", quoteIdentifier(f.column), f.operator, len(params)))
+	}
+
+	group := []string{"bucket"}
+	order := []string{}
+	for _, tag := range q.groupBy {
+		group = append(group, quoteIdentifier(tag))
+		order = append(order, quoteIdentifier(tag))
+	}
+	order = append(order, "bucket")
+
+	sql := fmt.Sprintf("SELECT %s FROM %s WHERE %s GROUP BY %s ORDER BY %s",
+		strings.Join(cols, ", "),
+		quoteIdentifier(q.collection),
+		strings.Join(where, " AND "),
+		strings.Join(group, ", "),
+		strings.Join(order, ", "))
+	return sql, params, nil
+}
+
+// QueryTimeSeries runs q against the system database and returns one series per group
+func (d *DevClient) QueryTimeSeries(systemKey string, q *TimeSeriesQuery) ([]Series, error) {
+	sql, params, err := q.SQL()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.RawQuery(systemKey, sql, params)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rawQueryRows(resp)
+	if err != nil {
+		return nil, err
+	}
+	return q.toSeries(rows)
+}
+
+func (q *TimeSeriesQuery) toSeries(rows []map[string]interface{}) ([]Series, error) {
+	rval := []Series{}
+	index := map[string]int{}
+	for _, row := range rows {
+		ts, err := parseRawTime(row["bucket"])
+		if err != nil {
+			return nil, fmt.Errorf("could not read bucket time: %w", err)
+		}
+		tags := make(map[string]interface{}, len(q.groupBy))
+		for _, tag := range q.groupBy {
+			tags[tag] = row[tag]
+		}
+		key := seriesKey(q.groupBy, tags)
+		i, ok := index[key]
+		if !ok {
+			i = len(rval)
+			index[key] = i
+			rval = append(rval, Series{Tags: tags})
+		}
+		pt := Point{Time: ts, Values: make(map[string]float64, len(q.aggregations))}
+		for _, agg := range q.aggregations {
+			v, ok, err := rawFloat(row[agg.Alias])
+			if err != nil {
+				return nil, fmt.Errorf("could not read %s: %w", agg.Alias, err)
+			}
+			if ok {
+				pt.Values[agg.Alias] = v
+			}
+		}
+		rval[i].Points = append(rval[i].Points, pt)
+	}
+	for _, s := range rval {
+		sort.Slice(s.Points, func(a, b int) bool { return s.Points[a].Time.Before(s.Points[b].Time) })
+	}
+	return rval, nil
+}
+
+func aggregateExpression(agg Aggregation, timeCol string) string {
+	fn := strings.ToLower(agg.Function)
+	col := "*"
+	if agg.Column != "*" {
+		col = quoteIdentifier(agg.Column)
+	}
+	switch fn {
+	case "first", "last":
+		// timescale's first and last take the column that orders the values
+		return fmt.Sprintf("%s(%s, %s)", fn, col, timeCol)
+	case "count":
+		return fmt.Sprintf("count(%s)", col)
+	}
+	return fmt.Sprintf("%s(%s)", fn, col)
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func seriesKey(tags []string, values map[string]interface{}) string {
+	parts := make([]string, len(tags))
+	for i, tag := range tags {
+		parts[i] = fmt.Sprintf("%v", values[tag])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// rawQueryRows pulls the result rows out of a RawQuery response, which holds them under "results"
+func rawQueryRows(resp map[string]interface{}) ([]map[string]interface{}, error) {
+	rows, ok := resp["results"]
+	if !ok {
+		return nil, fmt.Errorf("unexpected raw query response: %v", resp)
+	}
+	if rows == nil {
+		return nil, nil
+	}
+	return makeSliceOfMaps(rows)
+}
+
+func parseRawTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range rawTimeLayouts {
+			if ts, err := time.Parse(layout, t); err == nil {
+				return ts, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognised time %q", t)
+	case float64:
+		return time.Unix(0, int64(t*float64(time.Second))).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unexpected time value %v of type %T", v, v)
+}
+
+func rawFloat(v interface{}) (float64, bool, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return n, true, nil
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil, err
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil, err
+	}
+	i, err := iWantAnInt(v)
+	return float64(i), err == nil, err
+}
@@ -0,0 +1,178 @@
+package GoSDK
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	seriesStart = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	seriesEnd   = seriesStart.Add(time.Hour)
+)
+
+func TestTimeSeriesQuerySQL(t *testing.T) {
+	for name, tc := range map[string]struct {
+		query  *TimeSeriesQuery
+		sql    string
+		params []interface{}
+	}{
+		"plain buckets": {
+			NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(5*time.Minute).Aggregate("AVG", "temp", "avg_temp"),
+			`SELECT time_bucket($1::interval, "ts") AS bucket, avg("temp") AS "avg_temp" FROM "readings" WHERE "ts" >= $2 AND "ts" < $3 GROUP BY bucket ORDER BY bucket`,
+			[]interface{}{"300 seconds", seriesStart, seriesEnd},
+		},
+		"grouped and filtered": {
+			NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(time.Minute).
+				Aggregate("count", "*", "n").Aggregate("last", "temp", "latest").
+				GroupBy("site", "device").Where("temp", ">", 10).Where("device", "!=", "d9"),
+			`SELECT time_bucket($1::interval, "ts") AS bucket, "site", "device", count(*) AS "n", last("temp", "ts") AS "latest" FROM "readings" ` +
+				`WHERE "ts" >= $2 AND "ts" < $3 AND "temp" > $4 AND "device" != $5 GROUP BY bucket, "site", "device" ORDER BY "site", "device", bucket`,
+			[]interface{}{"60 seconds", seriesStart, seriesEnd, 10, "d9"},
+		},
+		"gap filled": {
+			NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(time.Minute).Aggregate("max", "temp", "hi").GapFill(),
+			`SELECT time_bucket_gapfill($1::interval, "ts") AS bucket, max("temp") AS "hi" FROM "readings" WHERE "ts" >= $2 AND "ts" < $3 GROUP BY bucket ORDER BY bucket`,
+			[]interface{}{"60 seconds", seriesStart, seriesEnd},
+		},
+		"carried forward": {
+			NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(1500*time.Millisecond).Aggregate("first", "temp", "open").CarryForward(),
+			`SELECT time_bucket_gapfill($1::interval, "ts") AS bucket, locf(first("temp", "ts")) AS "open" FROM "readings" WHERE "ts" >= $2 AND "ts" < $3 GROUP BY bucket ORDER BY bucket`,
+			[]interface{}{"1500 milliseconds", seriesStart, seriesEnd},
+		},
+		"quoted collection": {
+			NewTimeSeriesQuery(`odd "name"`, "ts").Range(seriesStart.In(time.FixedZone("X", 3600)), seriesEnd).Bucket(time.Hour).Aggregate("sum", "kwh", "total"),
+			`SELECT time_bucket($1::interval, "ts") AS bucket, sum("kwh") AS "total" FROM "odd ""name""" WHERE "ts" >= $2 AND "ts" < $3 GROUP BY bucket ORDER BY bucket`,
+			[]interface{}{"3600 seconds", seriesStart, seriesEnd},
+		},
+	} {
+		sql, params, err := tc.query.SQL()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if sql != tc.sql {
+			t.Errorf("%s:\n got %s\nwant %s", name, sql, tc.sql)
+		}
+		if !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("%s: params %v, want %v", name, params, tc.params)
+		}
+	}
+}
+
+func TestTimeSeriesQueryValidate(t *testing.T) {
+	valid := func() *TimeSeriesQuery {
+		return NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(time.Minute).Aggregate("avg", "temp", "t")
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, q := range map[string]*TimeSeriesQuery{
+		"no collection":       NewTimeSeriesQuery("", "ts").Range(seriesStart, seriesEnd).Bucket(time.Minute).Aggregate("avg", "temp", "t"),
+		"bad time column":     NewTimeSeriesQuery("readings", "ts)").Range(seriesStart, seriesEnd).Bucket(time.Minute).Aggregate("avg", "temp", "t"),
+		"no range":            NewTimeSeriesQuery("readings", "ts").Bucket(time.Minute).Aggregate("avg", "temp", "t"),
+		"reversed range":      valid().Range(seriesEnd, seriesStart),
+		"no bucket":           valid().Bucket(0),
+		"no aggregate":        NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(time.Minute),
+		"bad function":        valid().Aggregate("median", "temp", "m"),
+		"bad group by":        valid().GroupBy("site;"),
+		"bad filter column":   valid().Where("1temp", "=", 1),
+		"bad filter operator": valid().Where("temp", "LIKE", "%"),
+	} {
+		if _, _, err := q.SQL(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestTimeSeriesQueryToSeries(t *testing.T) {
+	q := NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(time.Minute).
+		Aggregate("avg", "temp", "t").Aggregate("count", "*", "n").GroupBy("device")
+	rows := []map[string]interface{}{
+		{"bucket": "2024-03-01T00:01:00Z", "device": "d1", "t": 21.5, "n": json.Number("3")},
+		{"bucket": "2024-03-01 00:00:00+00", "device": "d1", "t": "20", "n": 2.0},
+		{"bucket": "2024-03-01T00:00:00Z", "device": "d2", "t": nil, "n": 0.0},
+	}
+	series, err := q.toSeries(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Series{
+		{Tags: map[string]interface{}{"device": "d1"}, Points: []Point{
+			{Time: seriesStart, Values: map[string]float64{"t": 20, "n": 2}},
+			{Time: seriesStart.Add(time.Minute), Values: map[string]float64{"t": 21.5, "n": 3}},
+		}},
+		{Tags: map[string]interface{}{"device": "d2"}, Points: []Point{
+			{Time: seriesStart, Values: map[string]float64{"n": 0}},
+		}},
+	}
+	if len(series) != 2 {
+		t.Fatalf("got %d series", len(series))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(series[i].Tags, want[i].Tags) || len(series[i].Points) != len(want[i].Points) {
+			t.Fatalf("series %d is %+v", i, series[i])
+		}
+		for j, pt := range series[i].Points {
+			if !pt.Time.Equal(want[i].Points[j].Time) || !reflect.DeepEqual(pt.Values, want[i].Points[j].Values) {
+				t.Fatalf("series %d point %d is %+v, want %+v", i, j, pt, want[i].Points[j])
+			}
+		}
+	}
+
+	if _, err := q.toSeries([]map[string]interface{}{{"bucket": "yesterday"}}); err == nil {
+		t.Fatal("accepted an unreadable bucket time")
+	}
+	if _, err := q.toSeries([]map[string]interface{}{{"bucket": "2024-03-01T00:00:00Z", "t": "warm"}}); err == nil {
+		t.Fatal("accepted an unreadable value")
+	}
+}
+
+func TestRawQueryRows(t *testing.T) {
+	rows, err := rawQueryRows(map[string]interface{}{"results": []interface{}{map[string]interface{}{"a": 1.0}}})
+	if err != nil || len(rows) != 1 || rows[0]["a"] != 1.0 {
+		t.Fatalf("got %v, %v", rows, err)
+	}
+	if rows, err := rawQueryRows(map[string]interface{}{"results": nil}); err != nil || rows != nil {
+		t.Fatalf("null results gave %v, %v", rows, err)
+	}
+	for _, resp := range []map[string]interface{}{
+		{},
+		{"rows": []interface{}{}},
+		{"DATA": []interface{}{}},
+		{"results": "none"},
+		{"results": []interface{}{1.0}},
+	} {
+		if rows, err := rawQueryRows(resp); err == nil {
+			t.Errorf("%v gave %v", resp, rows)
+		}
+	}
+}
+
+func TestQueryTimeSeries(t *testing.T) {
+	var sent map[string]interface{}
+	d := newTestDevClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != _DATA_V4_PREAMBLE+"database/sys/query" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&sent)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"results": []interface{}{
+			map[string]interface{}{"bucket": "2024-03-01T00:00:00Z", "t": 20.0},
+		}})
+	}))
+	q := NewTimeSeriesQuery("readings", "ts").Range(seriesStart, seriesEnd).Bucket(time.Minute).Aggregate("avg", "temp", "t")
+	series, err := d.QueryTimeSeries("sys", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 1 || series[0].Points[0].Values["t"] != 20 {
+		t.Fatalf("got %+v", series)
+	}
+	sql, _, _ := q.SQL()
+	if sent["query"] != sql || len(sent["params"].([]interface{})) != 3 {
+		t.Fatalf("sent %v", sent)
+	}
+}
@@ -18,10 +18,10 @@ const (
 
 func (u *UserClient) credentials() ([][]string, error) {
 	ret := make([][]string, 0)
-	if u.UserToken != "" {
+	if tok := u.getToken(); tok != "" {
 		ret = append(ret, []string{
 			_USER_HEADER_KEY,
-			u.UserToken,
+			tok,
 		})
 	}
 	if u.SystemSecret != "" && u.SystemKey != "" {
@@ -52,21 +52,33 @@ func (u *UserClient) getSystemInfo() (string, string) {
 }
 
 func (u *UserClient) setToken(t string) {
+	u.tokenMu.Lock()
+	defer u.tokenMu.Unlock()
 	u.UserToken = t
 }
 func (u *UserClient) getToken() string {
+	u.tokenMu.RLock()
+	defer u.tokenMu.RUnlock()
 	return u.UserToken
 }
 func (u *UserClient) getRefreshToken() string {
+	u.tokenMu.RLock()
+	defer u.tokenMu.RUnlock()
 	return u.RefreshToken
 }
 func (u *UserClient) setRefreshToken(body map[string]interface{}) {
+	u.tokenMu.Lock()
+	defer u.tokenMu.Unlock()
 	u.RefreshToken = nicelySetRefreshToken(body)
 }
 func (u *UserClient) setExpiresAt(t float64) {
+	u.tokenMu.Lock()
+	defer u.tokenMu.Unlock()
 	u.ExpiresAt = t
 }
 func (u *UserClient) getExpiresAt() float64 {
+	u.tokenMu.RLock()
+	defer u.tokenMu.RUnlock()
 	return u.ExpiresAt
 }
 
@@ -203,7 +215,7 @@ func (d *DevClient) DeleteUserColumn(systemKey, columnName string) error {
 	}
 	data := map[string]string{"column": columnName}
 
-	resp, err := delete(d, _USER_ADMIN+"/"+systemKey+"/columns", data, creds, nil)
+	resp, err := del(d, _USER_ADMIN+"/"+systemKey+"/columns", data, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting user column: %v", err)
 	}
@@ -286,7 +298,7 @@ func (d *DevClient) DeleteUserSession(systemKey string, query *Query) error {
 	} else {
 		qry = nil
 	}
-	resp, err := delete(d, _USER_SESSION+"/"+systemKey+"/user", qry, creds, nil)
+	resp, err := del(d, _USER_SESSION+"/"+systemKey+"/user", qry, creds, nil)
 	if err != nil {
 		return fmt.Errorf("Error deleting user session data: %v", err)
 	}
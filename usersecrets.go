@@ -61,7 +61,7 @@ func (d *DevClient) DeleteSecret(systemKey, name string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	resp, err := delete(d, _USER_SECRETS_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
+	resp, err := del(d, _USER_SECRETS_PREAMBLE+systemKey+"/"+name, nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return "", err
@@ -74,7 +74,7 @@ func (d *DevClient) DeleteSecrets(systemKey string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	resp, err := delete(d, _USER_SECRETS_PREAMBLE+systemKey, nil, creds, nil)
+	resp, err := del(d, _USER_SECRETS_PREAMBLE+systemKey, nil, creds, nil)
 	resp, err = mapResponse(resp, err)
 	if err != nil {
 		return "", err
@@ -2,6 +2,7 @@ package GoSDK
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"os/exec"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/fatih/structs"
@@ -147,6 +149,9 @@ type UserClient struct {
 	MqttAuthAddr string
 	MTLSPort     string
 	edgeProxy    *EdgeProxy
+	// tokenMu guards UserToken, RefreshToken and ExpiresAt, which MQTT reconnects refresh from
+	// the client's own goroutine
+	tokenMu sync.RWMutex
 }
 
 type DeviceClient struct {
@@ -168,6 +173,8 @@ type DeviceClient struct {
 	Cert         string
 	Key          string
 	DetailsInCN  bool
+	// tokenMu guards DeviceToken, RefreshToken and ExpiresAt
+	tokenMu sync.RWMutex
 }
 
 // DevClient is the type for developers
@@ -185,6 +192,8 @@ type DevClient struct {
 	MqttAuthAddr string
 	MTLSPort     string
 	edgeProxy    *EdgeProxy
+	// tokenMu guards DevToken, RefreshToken and ExpiresAt
+	tokenMu sync.RWMutex
 }
 
 type EdgeProxy struct {
@@ -204,6 +213,8 @@ type CbReq struct {
 	Transport   *http.Transport
 	IsMTLS      bool
 	NoDecode    bool
+	// Context cancels the request, none when nil
+	Context context.Context
 }
 
 func (r *CbReq) setupForMTLS(client *DeviceClient) error {
@@ -671,7 +682,7 @@ func (d *DevClient) VerifyAuthentication(verifyParams VerifyAuthenticationParams
 
 // Register creates a new user
 func (u *UserClient) Register(username, password string) error {
-	if u.UserToken == "" {
+	if u.getToken() == "" {
 		return fmt.Errorf("Must be logged in to create users")
 	}
 	_, err := register(u, createUser, username, password, u.SystemKey, u.SystemSecret, "", "", "", "")
@@ -680,7 +691,7 @@ func (u *UserClient) Register(username, password string) error {
 
 // RegisterUser creates a new user, returning the body of the response.
 func (u *UserClient) RegisterUser(username, password string) (map[string]interface{}, error) {
-	if u.UserToken == "" {
+	if u.getToken() == "" {
 		return nil, fmt.Errorf("Must be logged in to create users")
 	}
 	resp, err := register(u, createUser, username, password, u.SystemKey, u.SystemSecret, "", "", "", "")
@@ -696,13 +707,13 @@ func (d *DevClient) Register(username, password, fname, lname, org string) error
 	if err != nil {
 		return err
 	} else {
-		d.DevToken = resp["dev_token"].(string)
+		d.setToken(resp["dev_token"].(string))
 		return nil
 	}
 }
 
 func (d *DevClient) RegisterNewUser(username, password, systemkey, systemsecret string) (map[string]interface{}, error) {
-	if d.DevToken == "" {
+	if d.getToken() == "" {
 		return nil, fmt.Errorf("Must authenticate first")
 	}
 	return register(d, createUser, username, password, systemkey, systemsecret, "", "", "", "")
@@ -969,12 +980,16 @@ func do(c cbClient, r *CbReq, creds [][]string) (*CbResp, error) {
 	if r.QueryString != "" {
 		url += "?" + r.QueryString
 	}
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	var req *http.Request
 	var reqErr error
 	if bodyToSend != nil {
-		req, reqErr = http.NewRequest(r.Method, url, bodyToSend)
+		req, reqErr = http.NewRequestWithContext(ctx, r.Method, url, bodyToSend)
 	} else {
-		req, reqErr = http.NewRequest(r.Method, url, nil)
+		req, reqErr = http.NewRequestWithContext(ctx, r.Method, url, nil)
 	}
 	if reqErr != nil {
 		return nil, fmt.Errorf("Request Creation Error: %s", reqErr)
@@ -1000,7 +1015,7 @@ func do(c cbClient, r *CbReq, creds [][]string) (*CbResp, error) {
 	}
 	resp, err := cli.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Error Making Request: %v", err)
+		return nil, fmt.Errorf("Error Making Request: %w", err)
 	}
 	defer resp.Body.Close()
 	body, readErr := ioutil.ReadAll(resp.Body)
@@ -1108,7 +1123,7 @@ func put(c cbClient, endpoint string, body interface{}, heads [][]string, header
 	return do(c, req, heads)
 }
 
-func delete(c cbClient, endpoint string, query map[string]string, heads [][]string, headers map[string][]string) (*CbResp, error) {
+func del(c cbClient, endpoint string, query map[string]string, heads [][]string, headers map[string][]string) (*CbResp, error) {
 	req := &CbReq{
 		Body:        nil,
 		Method:      "DELETE",
@@ -0,0 +1,360 @@
+package GoSDK
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/eclipse/paho.golang/packets"
+)
+
+// v5Broker is a minimal MQTT 5 broker on a loopback port. It resolves the topic aliases clients
+// send, can use aliases itself when delivering, and records what a test needs to check the wire.
+type v5Broker struct {
+	t  *testing.T
+	ln net.Listener
+	// aliasMaximum is sent in every CONNACK; 0 leaves topic aliases off
+	aliasMaximum uint16
+	// sendAliases makes deliveries use topic aliases up to the client's maximum
+	sendAliases bool
+	// qos0Only sends a maximum QoS of 0, which has paho.golang refuse QoS 1 and 2 publishes
+	qos0Only bool
+	// holdAcks, when set, delays the acknowledgements of publishes until it is closed
+	holdAcks chan struct{}
+
+	mu          sync.Mutex
+	connects    []*packets.Connect
+	conns       []*v5BrokerConn
+	published   []v5Published
+	disconnects []byte
+	problems    []string
+	// onConnect decides the CONNACK reason code and reason string; nil accepts everything
+	onConnect func(*packets.Connect) (byte, string)
+	// denied answers a PUBLISH to the topic or a SUBSCRIBE to the filter with the reason code
+	denied map[string]byte
+}
+
+// v5Published is a PUBLISH the broker received, with its topic alias resolved
+type v5Published struct {
+	topic      string
+	aliasOnly  bool
+	properties *packets.Properties
+	payload    []byte
+}
+
+type v5BrokerConn struct {
+	net.Conn
+	b *v5Broker
+	// inAliases is only used by the serving goroutine
+	inAliases map[uint16]string
+
+	mu         sync.Mutex
+	subs       []string
+	aliasMax   uint16
+	outAliases map[string]uint16
+	clientID   string
+}
+
+// send writes pub to the client as is, aliases and all
+func (c *v5BrokerConn) send(pub *packets.Publish) error {
+	if pub.Properties == nil {
+		pub.Properties = &packets.Properties{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := pub.WriteTo(c.Conn)
+	return err
+}
+
+// deliver sends a QoS 0 message to the client, with a topic alias when the broker uses them
+func (c *v5BrokerConn) deliver(topic string, payload []byte, props *packets.Properties) error {
+	p := *props
+	p.TopicAlias = nil
+	pub := &packets.Publish{Topic: topic, Payload: payload, Properties: &p}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.b.sendAliases {
+		if alias, ok := c.outAliases[topic]; ok {
+			pub.Topic = ""
+			pub.Properties.TopicAlias = &alias
+		} else if n := uint16(len(c.outAliases)); n < c.aliasMax {
+			alias := n + 1
+			c.outAliases[topic] = alias
+			pub.Properties.TopicAlias = &alias
+		}
+	}
+	_, err := pub.WriteTo(c.Conn)
+	return err
+}
+
+func (c *v5BrokerConn) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, filter := range c.subs {
+		if topicMatches(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func newV5Broker(t *testing.T) *v5Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	b := &v5Broker{t: t, ln: ln, denied: map[string]byte{}}
+	t.Cleanup(b.close)
+	return b
+}
+
+// start accepts connections; the settings above must not change after it
+func (b *v5Broker) start() *v5Broker {
+	go b.accept()
+	return b
+}
+
+func (b *v5Broker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *v5Broker) close() {
+	b.ln.Close()
+	b.dropConnections()
+}
+
+// dropConnections closes every client connection without stopping the listener
+func (b *v5Broker) dropConnections() {
+	b.mu.Lock()
+	conns := b.conns
+	b.conns = nil
+	b.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// connection returns the open connection of clientID, or nil
+func (b *v5Broker) connection(clientID string) *v5BrokerConn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.mu.Lock()
+		id := c.clientID
+		c.mu.Unlock()
+		if id == clientID {
+			return c
+		}
+	}
+	return nil
+}
+
+// connectPackets returns every CONNECT the broker has seen, accepted or not
+func (b *v5Broker) connectPackets() []*packets.Connect {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*packets.Connect(nil), b.connects...)
+}
+
+// publishes returns every PUBLISH clients have sent
+func (b *v5Broker) publishes() []v5Published {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]v5Published(nil), b.published...)
+}
+
+// disconnectCodes returns the reason codes of the DISCONNECTs clients have sent
+func (b *v5Broker) disconnectCodes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.disconnects...)
+}
+
+// protocolProblems lists the protocol errors clients made, such as an unknown topic alias
+func (b *v5Broker) protocolProblems() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.problems...)
+}
+
+func (b *v5Broker) problem(format string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.problems = append(b.problems, fmt.Sprintf(format, args...))
+}
+
+func (b *v5Broker) accept() {
+	for {
+		nc, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &v5BrokerConn{Conn: nc, b: b, inAliases: map[uint16]string{}, outAliases: map[string]uint16{}}
+		b.mu.Lock()
+		b.conns = append(b.conns, c)
+		b.mu.Unlock()
+		go b.serve(c)
+	}
+}
+
+func (b *v5Broker) serve(c *v5BrokerConn) {
+	defer func() {
+		c.Close()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, open := range b.conns {
+			if open == c {
+				b.conns = append(b.conns[:i], b.conns[i+1:]...)
+				break
+			}
+		}
+	}()
+	for {
+		cp, err := packets.ReadPacket(c)
+		if err != nil {
+			return
+		}
+		var out *packets.ControlPacket
+		switch p := cp.Content.(type) {
+		case *packets.Connect:
+			b.mu.Lock()
+			b.connects = append(b.connects, p)
+			decide := b.onConnect
+			b.mu.Unlock()
+			out = packets.NewControlPacket(packets.CONNACK)
+			ack := out.Content.(*packets.Connack)
+			if decide != nil {
+				ack.ReasonCode, ack.Properties.ReasonString = decide(p)
+			}
+			if b.aliasMaximum > 0 {
+				max := b.aliasMaximum
+				ack.Properties.TopicAliasMaximum = &max
+			}
+			if b.qos0Only {
+				ack.Properties.MaximumQOS = new(byte)
+			}
+			c.mu.Lock()
+			c.clientID = p.ClientID
+			if p.Properties != nil && p.Properties.TopicAliasMaximum != nil {
+				c.aliasMax = *p.Properties.TopicAliasMaximum
+			}
+			c.mu.Unlock()
+			if c.reply(out) != nil || ack.ReasonCode >= 0x80 {
+				return
+			}
+			continue
+		case *packets.Subscribe:
+			out = packets.NewControlPacket(packets.SUBACK)
+			ack := out.Content.(*packets.Suback)
+			ack.PacketID = p.PacketID
+			for _, sub := range p.Subscriptions {
+				b.mu.Lock()
+				code, denied := b.denied[sub.Topic]
+				b.mu.Unlock()
+				if !denied {
+					code = sub.QoS
+					c.mu.Lock()
+					c.subs = append(c.subs, sub.Topic)
+					c.mu.Unlock()
+				}
+				ack.Reasons = append(ack.Reasons, code)
+			}
+		case *packets.Unsubscribe:
+			out = packets.NewControlPacket(packets.UNSUBACK)
+			ack := out.Content.(*packets.Unsuback)
+			ack.PacketID = p.PacketID
+			c.mu.Lock()
+			for _, topic := range p.Topics {
+				code := byte(0x11)
+				for i, filter := range c.subs {
+					if filter == topic {
+						c.subs = append(c.subs[:i], c.subs[i+1:]...)
+						code = 0
+						break
+					}
+				}
+				ack.Reasons = append(ack.Reasons, code)
+			}
+			c.mu.Unlock()
+		case *packets.Publish:
+			out = b.received(c, p)
+			if hold := b.holdAcks; hold != nil && out != nil {
+				go func(out *packets.ControlPacket) {
+					<-hold
+					c.reply(out)
+				}(out)
+				continue
+			}
+		case *packets.Pubrel:
+			out = packets.NewControlPacket(packets.PUBCOMP)
+			out.Content.(*packets.Pubcomp).PacketID = p.PacketID
+		case *packets.Pingreq:
+			out = packets.NewControlPacket(packets.PINGRESP)
+		case *packets.Disconnect:
+			b.mu.Lock()
+			b.disconnects = append(b.disconnects, p.ReasonCode)
+			b.mu.Unlock()
+			return
+		}
+		if out != nil && c.reply(out) != nil {
+			return
+		}
+	}
+}
+
+func (c *v5BrokerConn) reply(cp *packets.ControlPacket) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := cp.WriteTo(c.Conn)
+	return err
+}
+
+// received resolves the alias of p, records it, delivers it unless it is denied and returns the
+// acknowledgement to send
+func (b *v5Broker) received(c *v5BrokerConn, p *packets.Publish) *packets.ControlPacket {
+	topic := p.Topic
+	if p.Properties != nil && p.Properties.TopicAlias != nil {
+		alias := *p.Properties.TopicAlias
+		switch {
+		case alias == 0 || alias > b.aliasMaximum:
+			b.problem("topic alias %d is out of range", alias)
+		case topic == "":
+			if topic = c.inAliases[alias]; topic == "" {
+				b.problem("topic alias %d was used before it was set", alias)
+			}
+		default:
+			c.inAliases[alias] = topic
+		}
+	}
+	b.mu.Lock()
+	b.published = append(b.published, v5Published{topic: topic, aliasOnly: p.Topic == "", properties: p.Properties, payload: p.Payload})
+	code := b.denied[topic]
+	conns := append([]*v5BrokerConn(nil), b.conns...)
+	b.mu.Unlock()
+	if code == 0 && topic != "" {
+		props := p.Properties
+		if props == nil {
+			props = &packets.Properties{}
+		}
+		for _, sub := range conns {
+			if sub.subscribed(topic) {
+				sub.deliver(topic, p.Payload, props)
+			}
+		}
+	}
+	switch p.QoS {
+	case 1:
+		out := packets.NewControlPacket(packets.PUBACK)
+		ack := out.Content.(*packets.Puback)
+		ack.PacketID, ack.ReasonCode = p.PacketID, code
+		return out
+	case 2:
+		out := packets.NewControlPacket(packets.PUBREC)
+		ack := out.Content.(*packets.Pubrec)
+		ack.PacketID, ack.ReasonCode = p.PacketID, code
+		return out
+	}
+	return nil
+}